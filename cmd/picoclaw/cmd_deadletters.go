@@ -0,0 +1,152 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+func deadLettersCmd() {
+	if len(os.Args) < 3 {
+		deadLettersHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	store := channels.NewDeadLetterStore(
+		filepath.Join(cfg.WorkspacePath(), "state", "dead_letters.json"),
+		cfg.Channels.Delivery.MaxDeadLetters,
+	)
+
+	subcommand := os.Args[2]
+	switch subcommand {
+	case "list":
+		deadLettersListCmd(store)
+	case "show", "resend", "remove":
+		if len(os.Args) < 4 {
+			fmt.Printf("Usage: picoclaw deadletters %s <id>\n", subcommand)
+			return
+		}
+		id := os.Args[3]
+		switch subcommand {
+		case "show":
+			deadLettersShowCmd(store, id)
+		case "resend":
+			deadLettersResendCmd(cfg, id)
+		case "remove":
+			deadLettersRemoveCmd(store, id)
+		}
+	case "clear":
+		count, err := store.Clear()
+		if err != nil {
+			fmt.Printf("Error clearing dead letters: %v\n", err)
+			return
+		}
+		fmt.Printf("✓ Removed %d dead letter(s)\n", count)
+	default:
+		fmt.Printf("Unknown deadletters command: %s\n", subcommand)
+		deadLettersHelp()
+	}
+}
+
+func deadLettersHelp() {
+	fmt.Println("\nDead letter commands:")
+	fmt.Println("  list              List messages that could not be delivered")
+	fmt.Println("  show <id>         Show a message in full")
+	fmt.Println("  resend <id>       Send a message again (needs a running gateway)")
+	fmt.Println("  remove <id>       Delete a message")
+	fmt.Println("  clear             Delete all messages")
+}
+
+func deadLettersListCmd(store *channels.DeadLetterStore) {
+	letters, err := store.List()
+	if err != nil {
+		fmt.Printf("Error reading dead letters: %v\n", err)
+		return
+	}
+	if len(letters) == 0 {
+		fmt.Println("No undelivered messages.")
+		return
+	}
+
+	fmt.Println("\nUndelivered Messages:")
+	fmt.Println("---------------------")
+	for _, letter := range letters {
+		fmt.Printf("  %s  %s  %s:%s\n", letter.ID, letter.FailedAt.Format("2006-01-02 15:04"), letter.Channel, letter.ChatID)
+		fmt.Printf("    %s\n", utils.Truncate(strings.ReplaceAll(letter.Content, "\n", " "), 70))
+		fmt.Printf("    Error: %s (%d attempts)\n", letter.Error, letter.Attempts)
+	}
+}
+
+func deadLettersShowCmd(store *channels.DeadLetterStore, id string) {
+	letter, ok, err := store.Get(id)
+	if err != nil {
+		fmt.Printf("Error reading dead letters: %v\n", err)
+		return
+	}
+	if !ok {
+		fmt.Printf("✗ Dead letter %s not found\n", id)
+		return
+	}
+
+	fmt.Printf("ID:        %s\n", letter.ID)
+	fmt.Printf("Channel:   %s\n", letter.Channel)
+	fmt.Printf("Chat:      %s\n", letter.ChatID)
+	fmt.Printf("Failed at: %s\n", letter.FailedAt.Format(time.RFC3339))
+	fmt.Printf("Attempts:  %d\n", letter.Attempts)
+	fmt.Printf("Error:     %s\n", letter.Error)
+	fmt.Printf("\n%s\n", letter.Content)
+}
+
+func deadLettersRemoveCmd(store *channels.DeadLetterStore, id string) {
+	found, err := store.Remove(id)
+	if err != nil {
+		fmt.Printf("Error removing dead letter: %v\n", err)
+		return
+	}
+	if !found {
+		fmt.Printf("✗ Dead letter %s not found\n", id)
+		return
+	}
+	fmt.Printf("✓ Removed dead letter %s\n", id)
+}
+
+// deadLettersResendCmd asks the running gateway to resend, since only it has
+// the channel connections.
+func deadLettersResendCmd(cfg *config.Config, id string) {
+	url := gatewayURL(cfg, "/api/v1/deliveries/dead-letters/resend")
+
+	body, _ := json.Marshal(map[string]string{"id": id})
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("Error contacting gateway (is `picoclaw gateway` running?): %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		fmt.Printf("✗ Resend failed: %s\n", strings.TrimSpace(string(msg)))
+		return
+	}
+	fmt.Printf("✓ Dead letter %s resent\n", id)
+}
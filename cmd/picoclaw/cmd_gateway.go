@@ -6,16 +6,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/agent"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/chatapi"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/dashboard"
@@ -26,6 +29,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
@@ -56,7 +60,7 @@ func gatewayCmd() {
 		cfg.Agents.Defaults.Model = modelID
 	}
 
-	msgBus := bus.NewMessageBus()
+	msgBus := newGatewayBus(cfg)
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
 
 	// Ensure workspace exists and enable file logging
@@ -92,9 +96,7 @@ func gatewayCmd() {
 		agentLoop,
 		msgBus,
 		cfg.WorkspacePath(),
-		cfg.Agents.Defaults.RestrictToWorkspace,
 		execTimeout,
-		cfg,
 	)
 
 	heartbeatService := heartbeat.NewHeartbeatService(
@@ -213,6 +215,17 @@ func gatewayCmd() {
 	dashboardAPI := dashboard.NewAPI(getConfigPath(), cfg, channelManager, agentLoop.GetTools(), stateManager, cronService)
 	dashboardAPI.RegisterRoutes(healthServer.Mux())
 
+	// OpenAI-compatible chat API
+	chatAPIEnabled := false
+	if cfg.Gateway.API.Enabled {
+		if cfg.Gateway.API.Token == "" {
+			fmt.Println("⚠ Warning: gateway.api.token is not set, OpenAI-compatible API disabled")
+		} else {
+			chatapi.NewHandler(agentLoop, cfg.Gateway.API.Token).RegisterRoutes(healthServer.Mux())
+			chatAPIEnabled = true
+		}
+	}
+
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]any{"error": err.Error()})
@@ -220,6 +233,9 @@ func gatewayCmd() {
 	}()
 	fmt.Printf("✓ Health endpoints available at http://%s:%d/health and /ready\n", cfg.Gateway.Host, cfg.Gateway.Port)
 	fmt.Printf("✓ Dashboard API available at http://%s:%d/api/v1/system/status\n", cfg.Gateway.Host, cfg.Gateway.Port)
+	if chatAPIEnabled {
+		fmt.Printf("✓ OpenAI-compatible API available at http://%s:%d/v1\n", cfg.Gateway.Host, cfg.Gateway.Port)
+	}
 
 	go agentLoop.Run(ctx)
 
@@ -242,9 +258,7 @@ func setupCronTool(
 	agentLoop *agent.AgentLoop,
 	msgBus *bus.MessageBus,
 	workspace string,
-	restrict bool,
 	execTimeout time.Duration,
-	cfg *config.Config,
 ) *cron.CronService {
 	cronStorePath := filepath.Join(workspace, "cron", "jobs.json")
 
@@ -252,7 +266,7 @@ func setupCronTool(
 	cronService := cron.NewCronService(cronStorePath, nil)
 
 	// Create and register CronTool
-	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, workspace, restrict, execTimeout, cfg)
+	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, execTimeout)
 	agentLoop.RegisterTool(cronTool)
 
 	// Set the onJob handler
@@ -263,3 +277,32 @@ func setupCronTool(
 
 	return cronService
 }
+
+// newGatewayBus returns the durable SQLite-backed bus when enabled, and the
+// in-memory bus otherwise or if the database cannot be opened.
+func newGatewayBus(cfg *config.Config) *bus.MessageBus {
+	if !cfg.Persistence.DurableBus {
+		return bus.NewMessageBus()
+	}
+
+	db, err := utils.InitDB(filepath.Join(cfg.WorkspacePath(), "picoclaw.db"))
+	if err == nil {
+		var msgBus *bus.MessageBus
+		if msgBus, err = bus.NewDurableMessageBus(db); err == nil {
+			fmt.Println("✓ Durable message bus enabled")
+			return msgBus
+		}
+		db.Close()
+	}
+	fmt.Printf("⚠ Warning: durable message bus unavailable, using in-memory bus: %v\n", err)
+	return bus.NewMessageBus()
+}
+
+// gatewayURL returns the URL of path on the locally running gateway.
+func gatewayURL(cfg *config.Config, path string) string {
+	host := cfg.Gateway.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Gateway.Port)) + path
+}
@@ -0,0 +1,168 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mcp"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func mcpCmd() {
+	if len(os.Args) < 3 {
+		mcpHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "serve":
+		mcpServeCmd()
+	default:
+		fmt.Printf("Unknown mcp command: %s\n", os.Args[2])
+		mcpHelp()
+	}
+}
+
+func mcpHelp() {
+	fmt.Println("\nMCP commands:")
+	fmt.Println("  serve             Serve picoclaw's tools and a chat tool over MCP")
+	fmt.Println()
+	fmt.Println("Serve options:")
+	fmt.Println("  --http <addr>     Listen for streamable HTTP on addr (default: stdio)")
+	fmt.Println("  --agent <id>      Agent whose tools are served (default: default agent)")
+	fmt.Println("  --token <token>   Require this bearer token over HTTP (or PICOCLAW_MCP_TOKEN);")
+	fmt.Println("                    needed unless --http is a loopback address")
+	fmt.Println("  --debug, -d       Enable debug logging")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  picoclaw mcp serve")
+	fmt.Println("  picoclaw mcp serve --http 127.0.0.1:18791 --agent work --token secret")
+}
+
+func mcpServeCmd() {
+	httpAddr := ""
+	agentID := ""
+	token := os.Getenv("PICOCLAW_MCP_TOKEN")
+
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--debug", "-d":
+			logger.SetLevel(logger.DEBUG)
+		case "--http":
+			if i+1 < len(args) {
+				httpAddr = args[i+1]
+				i++
+			}
+		case "--agent":
+			if i+1 < len(args) {
+				agentID = args[i+1]
+				i++
+			}
+		case "--token":
+			if i+1 < len(args) {
+				token = args[i+1]
+				i++
+			}
+		}
+	}
+
+	// Over stdio, stdout carries the protocol. Anything else that would
+	// print there (startup notices from tools, etc.) goes to stderr.
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	provider, modelID, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+	if modelID != "" {
+		cfg.Agents.Defaults.Model = modelID
+	}
+
+	msgBus := bus.NewMessageBus()
+	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	defer agentLoop.Stop()
+
+	target, ok := agentLoop.GetAgent(agentID)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown agent: %s\n", agentID)
+		os.Exit(1)
+	}
+
+	server := mcp.NewServer(mcp.Implementation{Name: "picoclaw", Version: version}, target.Tools)
+	server.AddTool(mcp.NewChatTool(agentLoop, target.ID))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	agentLoop.Start(ctx)
+
+	if httpAddr == "" {
+		logger.InfoCF("mcp", "Serving MCP over stdio", map[string]any{
+			"agent_id": target.ID,
+			"tools":    len(server.Tools()),
+		})
+		if err := server.ServeStdio(ctx, os.Stdin, protocolOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if token == "" && !isLoopbackAddr(httpAddr) {
+		fmt.Fprintf(os.Stderr, "Refusing to serve MCP on %s without a token: set --token or PICOCLAW_MCP_TOKEN\n", httpAddr)
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", server.HTTPHandler(token))
+	httpServer := &http.Server{Addr: httpAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	logger.InfoCF("mcp", "Serving MCP over HTTP", map[string]any{
+		"agent_id": target.ID,
+		"tools":    len(server.Tools()),
+	})
+	fmt.Fprintf(os.Stderr, "%s MCP server listening on http://%s/mcp\n", logo, httpAddr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -4,10 +4,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/auth"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 func statusCmd() {
@@ -17,6 +24,15 @@ func statusCmd() {
 		return
 	}
 
+	if len(os.Args) > 2 && os.Args[2] == "--pull" {
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: picoclaw status --pull <model>")
+			return
+		}
+		ollamaPullCmd(cfg, os.Args[3])
+		return
+	}
+
 	configPath := getConfigPath()
 
 	fmt.Printf("%s picoclaw Status\n", logo)
@@ -85,6 +101,9 @@ func statusCmd() {
 			fmt.Println("Ollama: not set")
 		}
 
+		printRateLimits(cfg)
+		printOllamaModels(cfg)
+
 		store, _ := auth.LoadStore()
 		if store != nil && len(store.Credentials) > 0 {
 			fmt.Println("\nOAuth/Token Auth:")
@@ -100,3 +119,106 @@ func statusCmd() {
 		}
 	}
 }
+
+// printRateLimits lists the configured model rate limits, with live usage
+// and wait times when the gateway is running.
+func printRateLimits(cfg *config.Config) {
+	var limited []config.ModelConfig
+	for _, m := range cfg.ModelList {
+		if m.RPM > 0 || m.TPM > 0 {
+			limited = append(limited, m)
+		}
+	}
+	if len(limited) == 0 {
+		return
+	}
+
+	fmt.Println("\nRate Limits:")
+	for _, m := range limited {
+		fmt.Printf("  %s: %s\n", m.ModelName, formatLimits(m.RPM, m.TPM))
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(gatewayURL(cfg, "/api/v1/rate-limits"))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var live []providers.RateLimitStats
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&live) != nil {
+		return
+	}
+	fmt.Println("  Gateway:")
+	for _, s := range live {
+		fmt.Printf("    %s: %d req, %d tokens in the last minute; %d waiting, %d delayed (last %.1fs)\n",
+			s.Name, s.Requests, s.Tokens, s.Waiting, s.Waits, s.LastWait)
+	}
+}
+
+func formatLimits(rpm, tpm int) string {
+	var parts []string
+	if rpm > 0 {
+		parts = append(parts, fmt.Sprintf("%d rpm", rpm))
+	}
+	if tpm > 0 {
+		parts = append(parts, fmt.Sprintf("%d tpm", tpm))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printOllamaModels lists the models installed on each Ollama server in
+// model_list.
+func printOllamaModels(cfg *config.Config) {
+	servers := providers.OllamaServers(cfg.ModelList)
+	if len(servers) == 0 {
+		return
+	}
+
+	fmt.Println("\nOllama Models:")
+	for _, server := range servers {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		models, err := server.Provider.ListModels(ctx)
+		cancel()
+		if err != nil {
+			fmt.Printf("  %s: ✗ unreachable\n", server.APIBase)
+			continue
+		}
+		fmt.Printf("  %s: ✓ %d installed\n", server.APIBase, len(models))
+		for _, m := range models {
+			fmt.Printf("    %s (%s, %.1f GB)\n", m.Name, m.Details.ParameterSize, float64(m.Size)/1e9)
+		}
+	}
+	fmt.Println("  Pull a model with: picoclaw status --pull <model>")
+}
+
+// ollamaPullCmd downloads a model onto the Ollama server it is configured for.
+func ollamaPullCmd(cfg *config.Config, name string) {
+	server, model, err := providers.ResolveOllamaPull(cfg.ModelList, name)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+
+	fmt.Printf("Pulling %s on %s...\n", model, server.APIBase)
+	lastStatus := ""
+	err = server.Provider.PullModel(context.Background(), model, func(p providers.OllamaPullProgress) {
+		if p.Total > 0 {
+			fmt.Printf("\r  %s: %d%%", p.Status, p.Completed*100/p.Total)
+			lastStatus = p.Status
+			return
+		}
+		if p.Status != lastStatus {
+			if lastStatus != "" {
+				fmt.Println()
+			}
+			fmt.Printf("  %s", p.Status)
+			lastStatus = p.Status
+		}
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	fmt.Printf("✓ Pulled %s\n", model)
+}
@@ -0,0 +1,114 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/usage"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+func usageCmd() {
+	period := "month"
+	by := "agent"
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--period", "-p":
+			if i+1 < len(args) {
+				period = args[i+1]
+				i++
+			}
+		case "--by", "-b":
+			if i+1 < len(args) {
+				by = args[i+1]
+				i++
+			}
+		case "--today":
+			period = "today"
+		case "--all":
+			period = "all"
+		case "help", "--help", "-h":
+			usageHelp()
+			return
+		default:
+			fmt.Printf("Unknown usage option: %s\n", args[i])
+			usageHelp()
+			return
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	report, err := usage.BuildReport(cfg, period, by, time.Now())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	title := "All Time"
+	if !report.Since.IsZero() {
+		title = "Since " + report.Since.Format("2006-01-02")
+	}
+	fmt.Printf("\nLLM Usage by %s (%s):\n", report.By, title)
+	fmt.Println("---------------------")
+	if len(report.Totals) == 0 {
+		fmt.Println("  No usage recorded.")
+	} else {
+		fmt.Printf("  %-32s %8s %12s %12s %12s %10s\n", report.By, "calls", "prompt", "cached", "completion", "cost")
+		for _, t := range append(report.Totals, report.Total) {
+			fmt.Printf("  %-32s %8d %12d %12d %12d %10s\n",
+				utils.Truncate(t.Key, 32), t.Requests, t.PromptTokens, t.CachedTokens, t.CompletionTokens,
+				formatCost(t.Cost))
+		}
+	}
+
+	if len(report.Budgets) > 0 {
+		fmt.Println("\nBudgets:")
+		for _, b := range report.Budgets {
+			mark := "✓"
+			if b.Exceeded {
+				mark = "✗"
+			}
+			fmt.Printf("  %s %s: today %s", mark, b.AgentID, formatCost(b.SpentToday))
+			if b.Daily > 0 {
+				fmt.Printf(" of %s", formatCost(b.Daily))
+			}
+			fmt.Printf(", this month %s", formatCost(b.SpentMonth))
+			if b.Monthly > 0 {
+				fmt.Printf(" of %s", formatCost(b.Monthly))
+			}
+			if b.Exceeded {
+				if b.DowngradeModel != "" {
+					fmt.Printf(" (using %s)", b.DowngradeModel)
+				} else {
+					fmt.Print(" (refusing turns)")
+				}
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func usageHelp() {
+	fmt.Println("\nUsage: picoclaw usage [options]")
+	fmt.Println("\nShow tokens and cost of LLM calls recorded in the usage ledger.")
+	fmt.Println("\nOptions:")
+	fmt.Println("  -p, --period <p>  Period to total: today, month (default) or all")
+	fmt.Println("  -b, --by <group>  Group by agent (default), session, channel, model, kind or day")
+	fmt.Println("  --today           Same as --period today")
+	fmt.Println("  --all             Same as --period all")
+}
+
+func formatCost(usd float64) string {
+	return fmt.Sprintf("$%.4f", usd)
+}
@@ -14,6 +14,7 @@ import (
 	"runtime"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/egress"
 	"github.com/sipeed/picoclaw/pkg/skills"
 )
 
@@ -115,6 +116,12 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "deadletters":
+		deadLettersCmd()
+	case "usage":
+		usageCmd()
+	case "mcp":
+		mcpCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -131,6 +138,7 @@ func main() {
 
 		workspace := cfg.WorkspacePath()
 		installer := skills.NewSkillInstaller(workspace)
+		installer.SetEgressPolicy(egress.NewPolicy(cfg.Tools.Egress))
 		// 获取全局配置目录和内置 skills 目录
 		globalDir := filepath.Dir(getConfigPath())
 		globalSkillsDir := filepath.Join(globalDir, "skills")
@@ -184,8 +192,11 @@ func printHelp() {
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  deadletters Inspect and resend undelivered messages")
+	fmt.Println("  mcp         Serve picoclaw over the Model Context Protocol")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
+	fmt.Println("  usage       Show token usage and cost per agent, session, channel or model")
 	fmt.Println("  version     Show version information")
 }
 
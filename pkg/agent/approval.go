@@ -0,0 +1,234 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// approvalBroker asks for approval in the chat a turn came from and hands
+// the user's answer, which arrives as an inbound message, to the tool call
+// waiting for it. Answers are taken off the bus before session dispatch, as
+// the session they belong to is busy with the waiting turn.
+type approvalBroker struct {
+	bus       *bus.MessageBus
+	approvers []string // may answer every request
+
+	mu       sync.Mutex
+	channels *channels.Manager
+	pending  map[string]*pendingApproval
+}
+
+type pendingApproval struct {
+	req      tools.ApprovalRequest
+	decision chan tools.ApprovalDecision
+}
+
+func newApprovalBroker(msgBus *bus.MessageBus, approvers []string) *approvalBroker {
+	return &approvalBroker{
+		bus:       msgBus,
+		approvers: approvers,
+		pending:   make(map[string]*pendingApproval),
+	}
+}
+
+// answerers returns the sender IDs that may answer req: the user who
+// started the turn and the configured approvers. It is empty, and anyone in
+// the chat may answer, only when neither is known.
+func (b *approvalBroker) answerers(req tools.ApprovalRequest) []string {
+	if req.SenderID == "" {
+		return b.approvers
+	}
+	return append([]string{req.SenderID}, b.approvers...)
+}
+
+// applyApprovalPolicies has every agent ask before running the tool calls
+// matched by tools.approval.
+func applyApprovalPolicies(cfg *config.Config, registry *AgentRegistry, approver tools.Approver) {
+	if cfg == nil || len(cfg.Tools.Approval.RequireApproval) == 0 {
+		return
+	}
+
+	auditPath := tools.ApprovalAuditPath(cfg.WorkspacePath())
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok {
+			agent.Tools.SetApprovalPolicy(tools.NewApprovalPolicy(cfg.Tools.Approval, tools.ApprovalPolicyOptions{
+				AgentID:   agent.ID,
+				Workspace: agent.Workspace,
+				Approver:  approver,
+				AuditPath: auditPath,
+			}))
+		}
+	}
+}
+
+func (b *approvalBroker) setChannelManager(cm *channels.Manager) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.channels = cm
+}
+
+// RequestApproval prompts the request's chat and waits for the answer.
+func (b *approvalBroker) RequestApproval(ctx context.Context, req tools.ApprovalRequest) (tools.ApprovalDecision, error) {
+	p := &pendingApproval{req: req, decision: make(chan tools.ApprovalDecision, 1)}
+	b.mu.Lock()
+	b.pending[req.ID] = p
+	cm := b.channels
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, req.ID)
+		b.mu.Unlock()
+	}()
+
+	prompt := channels.ApprovalPrompt{ID: req.ID, Summary: approvalSummary(req), Answerers: b.answerers(req)}
+	if cm != nil {
+		if err := cm.SendApprovalPrompt(ctx, req.Channel, req.ChatID, prompt); err != nil {
+			return tools.ApprovalDecision{}, err
+		}
+	} else {
+		b.notify(req.Channel, req.ChatID, prompt.Text())
+	}
+
+	select {
+	case decision := <-p.decision:
+		return decision, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			b.notify(req.Channel, req.ChatID,
+				fmt.Sprintf("⌛ Approval %s expired, %s was not run.", req.ID, req.Tool))
+		}
+		return tools.ApprovalDecision{}, ctx.Err()
+	}
+}
+
+func approvalSummary(req tools.ApprovalRequest) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Tool: %s", req.Tool)
+	if req.AgentID != "" {
+		fmt.Fprintf(&sb, " (agent %s)", req.AgentID)
+	}
+	if args := tools.FormatApprovalArgs(req.Args); args != "" {
+		sb.WriteString("\n" + args)
+	}
+	fmt.Fprintf(&sb, "\nWhy: %s\nID: %s", req.Reason, req.ID)
+	return sb.String()
+}
+
+// resolve answers a pending approval when msg is a reply to one, and
+// reports whether msg was consumed. Replies are only recognised in chats
+// with a pending approval, or when they come from an approval button, and
+// only count when their sender may answer the request.
+func (b *approvalBroker) resolve(msg bus.InboundMessage) bool {
+	approve, id, ok := parseApprovalReply(msg.Content)
+	fromButton := msg.Metadata["approval_id"] != ""
+	if !ok {
+		return false
+	}
+
+	b.mu.Lock()
+	var inChat []*pendingApproval
+	for _, p := range b.pending {
+		if p.req.Channel == msg.Channel && p.req.ChatID == msg.ChatID {
+			inChat = append(inChat, p)
+		}
+	}
+	if len(inChat) == 0 && !fromButton {
+		b.mu.Unlock()
+		return false
+	}
+
+	var match, refused *pendingApproval
+	switch {
+	case id != "":
+		// A button press identifies its request, which may have been asked
+		// in a thread the reply doesn't report
+		if p := b.pending[id]; p != nil && p.req.Channel == msg.Channel &&
+			(p.req.ChatID == msg.ChatID || fromButton) {
+			match = p
+		}
+	default:
+		var answerable []*pendingApproval
+		for _, p := range inChat {
+			if channels.MayAnswerApproval(msg.SenderID, b.answerers(p.req)) {
+				answerable = append(answerable, p)
+			}
+		}
+		switch {
+		case len(answerable) == 1:
+			match = answerable[0]
+		case len(answerable) == 0:
+			refused = inChat[0]
+		default:
+			inChat = answerable
+		}
+	}
+	if match != nil && !channels.MayAnswerApproval(msg.SenderID, b.answerers(match.req)) {
+		match, refused = nil, match
+	}
+	if match != nil {
+		delete(b.pending, match.req.ID)
+	}
+	b.mu.Unlock()
+
+	switch {
+	case refused != nil:
+		logger.WarnCF("agent", "Approval answer refused",
+			map[string]any{
+				"id":     refused.req.ID,
+				"sender": msg.SenderID,
+			})
+		b.notify(msg.Channel, msg.ChatID,
+			fmt.Sprintf("Approval %s can only be answered by the user who asked for it.", refused.req.ID))
+	case match != nil:
+		match.decision <- tools.ApprovalDecision{Approved: approve, By: msg.SenderID}
+		logger.InfoCF("agent", "Approval answered",
+			map[string]any{
+				"id":       match.req.ID,
+				"approved": approve,
+				"sender":   msg.SenderID,
+			})
+	case id != "":
+		b.notify(msg.Channel, msg.ChatID, fmt.Sprintf("No approval %s is pending.", id))
+	default:
+		b.notify(msg.Channel, msg.ChatID,
+			"Several approvals are pending, reply with the ID, for example \"approve "+inChat[0].req.ID+"\".")
+	}
+	return true
+}
+
+func (b *approvalBroker) notify(channel, chatID, content string) {
+	b.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: content,
+	})
+}
+
+// parseApprovalReply recognises "approve", "deny" and their synonyms,
+// optionally followed by a request ID.
+func parseApprovalReply(content string) (approve bool, id string, ok bool) {
+	fields := strings.Fields(strings.ToLower(content))
+	if len(fields) == 0 || len(fields) > 2 {
+		return false, "", false
+	}
+	if len(fields) == 2 {
+		id = fields[1]
+	}
+
+	switch strings.TrimRight(strings.TrimPrefix(fields[0], "/"), ".!") {
+	case "approve", "approved", "yes", "y", "ok":
+		return true, id, true
+	case "deny", "denied", "no", "n", "reject":
+		return false, id, true
+	}
+	return false, "", false
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestApprovalBroker_KeywordAndButtonReplies(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	broker := newApprovalBroker(msgBus, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ask := func(id, chatID string) <-chan tools.ApprovalDecision {
+		done := make(chan tools.ApprovalDecision, 1)
+		go func() {
+			decision, err := broker.RequestApproval(ctx, tools.ApprovalRequest{
+				ID:      id,
+				Tool:    "exec",
+				Args:    map[string]any{"command": "git commit"},
+				Reason:  "command matches an approval pattern",
+				Channel: "telegram",
+				ChatID:  chatID,
+			})
+			if err != nil {
+				t.Errorf("RequestApproval(%s) error: %v", id, err)
+			}
+			done <- decision
+		}()
+		prompt, ok := msgBus.SubscribeOutbound(ctx)
+		if !ok || prompt.ChatID != chatID || !strings.Contains(prompt.Content, "approve "+id) ||
+			!strings.Contains(prompt.Content, "command: git commit") {
+			t.Fatalf("prompt = %+v, want one asking to approve %s", prompt, id)
+		}
+		return done
+	}
+
+	if broker.resolve(bus.InboundMessage{Channel: "telegram", ChatID: "1", Content: "yes"}) {
+		t.Error("a reply in a chat without pending approvals should pass through")
+	}
+
+	done := ask("aaa111", "1")
+	if broker.resolve(bus.InboundMessage{Channel: "telegram", ChatID: "2", Content: "yes"}) {
+		t.Error("a reply in another chat should pass through")
+	}
+	if broker.resolve(bus.InboundMessage{Channel: "telegram", ChatID: "1", Content: "yes, but first tell me why"}) {
+		t.Error("a sentence should pass through")
+	}
+	if !broker.resolve(bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u1", Content: "Yes"}) {
+		t.Fatal("keyword reply was not consumed")
+	}
+	if decision := <-done; !decision.Approved || decision.By != "u1" {
+		t.Errorf("decision = %+v, want approved by u1", decision)
+	}
+
+	// A button press names its request, even from a chat ID without thread
+	done = ask("bbb222", "C1/1700000000.1")
+	reply := bus.InboundMessage{
+		Channel:  "telegram",
+		ChatID:   "C1",
+		SenderID: "u2",
+		Content:  "deny bbb222",
+		Metadata: map[string]string{"approval_id": "bbb222"},
+	}
+	if !broker.resolve(reply) {
+		t.Fatal("button reply was not consumed")
+	}
+	if decision := <-done; decision.Approved || decision.By != "u2" {
+		t.Errorf("decision = %+v, want denied by u2", decision)
+	}
+
+	// A late press is consumed and answered rather than sent to the agent
+	if !broker.resolve(reply) {
+		t.Error("a press for an expired request should be consumed")
+	}
+	if msg, ok := msgBus.SubscribeOutbound(ctx); !ok || !strings.Contains(msg.Content, "No approval bbb222") {
+		t.Errorf("notice = %+v, want that bbb222 is not pending", msg)
+	}
+}
+
+func TestApprovalBroker_OnlyRequesterOrApproverMayAnswer(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	broker := newApprovalBroker(msgBus, []string{"admin"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ask := func(id string) <-chan tools.ApprovalDecision {
+		done := make(chan tools.ApprovalDecision, 1)
+		go func() {
+			decision, _ := broker.RequestApproval(ctx, tools.ApprovalRequest{
+				ID: id, Tool: "exec", Channel: "telegram", ChatID: "group", SenderID: "u1",
+			})
+			done <- decision
+		}()
+		if _, ok := msgBus.SubscribeOutbound(ctx); !ok {
+			t.Fatal("no prompt")
+		}
+		return done
+	}
+	expectRefusal := func(reply bus.InboundMessage) {
+		t.Helper()
+		if !broker.resolve(reply) {
+			t.Fatalf("reply %+v was not consumed", reply)
+		}
+		notice, ok := msgBus.SubscribeOutbound(ctx)
+		if !ok || !strings.Contains(notice.Content, "only be answered by the user who asked") {
+			t.Errorf("notice = %+v, want a refusal", notice)
+		}
+	}
+
+	done := ask("aaa111")
+	expectRefusal(bus.InboundMessage{Channel: "telegram", ChatID: "group", SenderID: "u2", Content: "yes"})
+	expectRefusal(bus.InboundMessage{
+		Channel:  "telegram",
+		ChatID:   "group",
+		SenderID: "u2",
+		Content:  "approve aaa111",
+		Metadata: map[string]string{"approval_id": "aaa111"},
+	})
+	select {
+	case decision := <-done:
+		t.Fatalf("another group member decided %+v", decision)
+	default:
+	}
+
+	if !broker.resolve(bus.InboundMessage{Channel: "telegram", ChatID: "group", SenderID: "u1", Content: "yes"}) {
+		t.Fatal("the requester's reply was not consumed")
+	}
+	if decision := <-done; !decision.Approved || decision.By != "u1" {
+		t.Errorf("decision = %+v, want approved by u1", decision)
+	}
+
+	done = ask("bbb222")
+	if !broker.resolve(bus.InboundMessage{Channel: "telegram", ChatID: "group", SenderID: "admin", Content: "deny"}) {
+		t.Fatal("the approver's reply was not consumed")
+	}
+	if decision := <-done; decision.Approved || decision.By != "admin" {
+		t.Errorf("decision = %+v, want denied by admin", decision)
+	}
+}
+
+func TestApprovalBroker_ExpiredRequestIsAnnounced(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	broker := newApprovalBroker(msgBus, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := broker.RequestApproval(ctx, tools.ApprovalRequest{ID: "ccc333", Tool: "exec", Channel: "slack", ChatID: "C1"})
+	if err == nil {
+		t.Fatal("RequestApproval() should fail once the deadline passes")
+	}
+
+	readCtx, readCancel := context.WithTimeout(context.Background(), time.Second)
+	defer readCancel()
+	msgBus.SubscribeOutbound(readCtx) // the prompt
+	if msg, ok := msgBus.SubscribeOutbound(readCtx); !ok || !strings.Contains(msg.Content, "expired") {
+		t.Errorf("notice = %+v, want the expiry", msg)
+	}
+	if len(broker.pending) != 0 {
+		t.Error("expired request should no longer be pending")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -21,6 +22,20 @@ type ContextBuilder struct {
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
 	tools        *tools.ToolRegistry // Direct reference to tool registry
+
+	// The stable part of the system prompt is cached until the bootstrap
+	// files, skills or tools it was built from change.
+	mu                sync.Mutex
+	cachedPrompt      string
+	cachedFingerprint string
+}
+
+// bootstrapFiles are the workspace files included in the system prompt.
+var bootstrapFiles = []string{
+	"AGENT.md",
+	"SOUL.md",
+	"USER.md",
+	"IDENTITY.md",
 }
 
 func getGlobalConfigDir() string {
@@ -51,7 +66,6 @@ func (cb *ContextBuilder) SetToolsRegistry(registry *tools.ToolRegistry) {
 }
 
 func (cb *ContextBuilder) getIdentity() string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
 	runtime := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
 
@@ -61,9 +75,6 @@ func (cb *ContextBuilder) getIdentity() string {
 	return fmt.Sprintf(`# Core Identity
 **You are PicoClaw (🦞)**, an ultra-lightweight personal AI assistant. Your name is PicoClaw.
 
-## Current Time
-%s
-
 ## Runtime
 %s
 
@@ -82,7 +93,7 @@ Your workspace is at: %s
 2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
 
 3. **Memory** - When interacting with me if something seems memorable, update %s/memory/MEMORY.md`,
-		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
+		runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
 }
 
 func (cb *ContextBuilder) buildToolsSection() string {
@@ -109,7 +120,36 @@ func (cb *ContextBuilder) buildToolsSection() string {
 	return sb.String()
 }
 
+// BuildSystemPrompt returns the full system prompt: the stable part, which
+// is cached, followed by the current time and memory.
 func (cb *ContextBuilder) BuildSystemPrompt() string {
+	return cb.stablePrompt() + promptSeparator + cb.buildDynamicPrompt()
+}
+
+// promptSeparator separates the sections of the system prompt.
+const promptSeparator = "\n\n---\n\n"
+
+// stablePrompt returns the part of the system prompt that stays the same
+// between turns, rebuilding it only when its sources have changed. Keeping
+// it byte-identical and first lets provider prompt caches reuse it.
+func (cb *ContextBuilder) stablePrompt() string {
+	fingerprint := cb.sourceFingerprint()
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.cachedPrompt != "" && cb.cachedFingerprint == fingerprint {
+		return cb.cachedPrompt
+	}
+	cb.cachedPrompt = cb.buildStablePrompt()
+	cb.cachedFingerprint = fingerprint
+	logger.DebugCF("agent", "System prompt rebuilt",
+		map[string]any{
+			"chars": len(cb.cachedPrompt),
+		})
+	return cb.cachedPrompt
+}
+
+func (cb *ContextBuilder) buildStablePrompt() string {
 	parts := []string{}
 
 	// Core identity section
@@ -131,24 +171,61 @@ The following skills extend your capabilities. To use a skill, read its SKILL.md
 %s`, skillsSummary))
 	}
 
+	return strings.Join(parts, promptSeparator)
+}
+
+// buildDynamicPrompt returns the sections of the system prompt that change
+// from turn to turn. They follow the stable part so they don't break its
+// cache.
+func (cb *ContextBuilder) buildDynamicPrompt() string {
+	now := time.Now().Format("2006-01-02 15:04 (Monday)")
+	parts := []string{"## Current Time\n" + now}
+
 	// Memory context
 	memoryContext := cb.memory.GetMemoryContext()
 	if memoryContext != "" {
 		parts = append(parts, "# Memory\n\n"+memoryContext)
 	}
 
-	// Join with "---" separator
-	return strings.Join(parts, "\n\n---\n\n")
+	return strings.Join(parts, promptSeparator)
 }
 
-func (cb *ContextBuilder) LoadBootstrapFiles() string {
-	bootstrapFiles := []string{
-		"AGENT.md",
-		"SOUL.md",
-		"USER.md",
-		"IDENTITY.md",
+// sourceFingerprint describes the files and tools the stable prompt is
+// built from. It changes when a bootstrap file or skill is added, removed or
+// edited, or when a tool is registered or removed.
+func (cb *ContextBuilder) sourceFingerprint() string {
+	var sb strings.Builder
+	for _, filename := range bootstrapFiles {
+		writeFileStamp(&sb, filepath.Join(cb.workspace, filename))
+	}
+	for _, dir := range cb.skillsLoader.Dirs() {
+		if dir == "" {
+			continue
+		}
+		writeFileStamp(&sb, dir)
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				writeFileStamp(&sb, filepath.Join(dir, entry.Name(), "SKILL.md"))
+			}
+		}
 	}
+	if cb.tools != nil {
+		fmt.Fprintf(&sb, "tools %p %d\n", cb.tools, cb.tools.Version())
+	}
+	return sb.String()
+}
+
+func writeFileStamp(sb *strings.Builder, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(sb, "%s -\n", path)
+		return
+	}
+	fmt.Fprintf(sb, "%s %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+}
 
+func (cb *ContextBuilder) LoadBootstrapFiles() string {
 	var sb strings.Builder
 	for _, filename := range bootstrapFiles {
 		filePath := filepath.Join(cb.workspace, filename)
@@ -169,12 +246,14 @@ func (cb *ContextBuilder) BuildMessages(
 ) []providers.Message {
 	messages := []providers.Message{}
 
-	systemPrompt := cb.BuildSystemPrompt()
+	stable := cb.stablePrompt()
+	dynamic := promptSeparator + cb.buildDynamicPrompt()
 
 	// Add Current Session info if provided
 	if channel != "" && chatID != "" {
-		systemPrompt += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
+		dynamic += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
 	}
+	systemPrompt := stable + dynamic
 
 	// Log system prompt summary for debugging (debug mode only)
 	logger.DebugCF("agent", "System prompt built",
@@ -195,14 +274,19 @@ func (cb *ContextBuilder) BuildMessages(
 		})
 
 	if summary != "" {
-		systemPrompt += "\n\n## Summary of Previous Conversation\n\n" + summary
+		dynamic += "\n\n## Summary of Previous Conversation\n\n" + summary
 	}
 
 	history = sanitizeHistoryForProvider(history)
 
+	// The stable part ends at a cache breakpoint for providers that take one
 	messages = append(messages, providers.Message{
 		Role:    "system",
-		Content: systemPrompt,
+		Content: stable + dynamic,
+		SystemParts: []providers.ContentBlock{
+			{Type: "text", Text: stable, CacheControl: &providers.CacheControl{Type: "ephemeral"}},
+			{Type: "text", Text: dynamic},
+		},
 	})
 
 	messages = append(messages, history...)
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+type promptTestTool struct{ name string }
+
+func (t *promptTestTool) Name() string               { return t.name }
+func (t *promptTestTool) Description() string        { return "test tool " + t.name }
+func (t *promptTestTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (t *promptTestTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	return tools.NewToolResult("ok")
+}
+
+func TestContextBuilder_CachesStablePrompt(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(workspace, "AGENT.md"), "Be brief.")
+
+	cb := NewContextBuilder(workspace)
+	registry := tools.NewToolRegistry()
+	registry.Register(&promptTestTool{name: "alpha"})
+	cb.SetToolsRegistry(registry)
+
+	first := cb.stablePrompt()
+	if !strings.Contains(first, "Be brief.") || !strings.Contains(first, "`alpha`") {
+		t.Fatalf("stable prompt misses bootstrap file or tools:\n%s", first)
+	}
+	if strings.Contains(first, "Current Time") {
+		t.Error("stable prompt must not contain the current time")
+	}
+
+	// Memory is part of the dynamic tail and doesn't invalidate the cache
+	writeFile(filepath.Join(workspace, "memory", "MEMORY.md"), "likes tea")
+	cb.cachedPrompt = "cached"
+	if got := cb.stablePrompt(); got != "cached" {
+		t.Fatalf("stable prompt rebuilt without a source change")
+	}
+	if !strings.Contains(cb.BuildSystemPrompt(), "likes tea") {
+		t.Error("system prompt misses memory")
+	}
+
+	changes := []struct {
+		name   string
+		change func()
+		want   string
+	}{
+		{"bootstrap file", func() {
+			writeFile(filepath.Join(workspace, "AGENT.md"), "Be thorough.")
+		}, "Be thorough."},
+		{"tool", func() { registry.Register(&promptTestTool{name: "beta"}) }, "`beta`"},
+		{"skill", func() {
+			writeFile(filepath.Join(workspace, "skills", "weather", "SKILL.md"),
+				"---\nname: weather\ndescription: Look up the weather\n---\n# Weather\n")
+		}, "Look up the weather"},
+	}
+	for _, c := range changes {
+		cb.cachedPrompt = "cached"
+		c.change()
+		if got := cb.stablePrompt(); !strings.Contains(got, c.want) {
+			t.Errorf("after %s change, stable prompt misses %q", c.name, c.want)
+		}
+	}
+}
+
+func TestContextBuilder_BuildMessagesSplitsSystemPrompt(t *testing.T) {
+	cb := NewContextBuilder(t.TempDir())
+	messages := cb.BuildMessages(nil, "talked about tea", "hi", nil, "telegram", "42")
+
+	system := messages[0]
+	if len(system.SystemParts) != 2 {
+		t.Fatalf("len(SystemParts) = %d, want 2", len(system.SystemParts))
+	}
+	stable, dynamic := system.SystemParts[0], system.SystemParts[1]
+	if stable.CacheControl == nil || dynamic.CacheControl != nil {
+		t.Error("only the stable part should carry a cache breakpoint")
+	}
+	if system.Content != stable.Text+dynamic.Text {
+		t.Error("Content should be the system parts joined")
+	}
+	for _, want := range []string{time.Now().Format("2006-01-02"), "Chat ID: 42", "talked about tea"} {
+		if !strings.Contains(dynamic.Text, want) {
+			t.Errorf("dynamic part misses %q", want)
+		}
+	}
+
+	again := cb.BuildMessages(nil, "", "hello", nil, "discord", "7")
+	if again[0].SystemParts[0].Text != stable.Text {
+		t.Error("stable part differs between turns")
+	}
+}
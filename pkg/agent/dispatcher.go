@@ -0,0 +1,131 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// defaultMaxConcurrentTurns is used when agents.defaults.max_concurrent_turns is unset.
+const defaultMaxConcurrentTurns = 4
+
+// sessionDispatcher runs inbound messages on per-session workers.
+// Messages that share a session key are processed strictly in arrival order,
+// while different sessions run in parallel, bounded by a global slot pool
+// and the optional per-agent limit.
+type sessionDispatcher struct {
+	handle func(ctx context.Context, msg bus.InboundMessage)
+	slots  chan struct{}
+	queues map[string][]bus.InboundMessage
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+}
+
+func newSessionDispatcher(maxConcurrent int, handle func(ctx context.Context, msg bus.InboundMessage)) *sessionDispatcher {
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxConcurrentTurns
+	}
+	return &sessionDispatcher{
+		handle: handle,
+		slots:  make(chan struct{}, maxConcurrent),
+		queues: make(map[string][]bus.InboundMessage),
+	}
+}
+
+// Dispatch enqueues msg on the worker for sessionKey, starting one if needed.
+func (d *sessionDispatcher) Dispatch(ctx context.Context, sessionKey string, agent *AgentInstance, msg bus.InboundMessage) {
+	d.mu.Lock()
+	queue, active := d.queues[sessionKey]
+	d.queues[sessionKey] = append(queue, msg)
+	d.mu.Unlock()
+
+	if active {
+		return
+	}
+
+	d.wg.Add(1)
+	go d.work(ctx, sessionKey, agent)
+}
+
+// Wait blocks until all session workers have exited.
+func (d *sessionDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// ActiveSessions returns the number of sessions that currently have a worker.
+func (d *sessionDispatcher) ActiveSessions() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queues)
+}
+
+func (d *sessionDispatcher) work(ctx context.Context, sessionKey string, agent *AgentInstance) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		queue := d.queues[sessionKey]
+		if len(queue) == 0 {
+			delete(d.queues, sessionKey)
+			d.mu.Unlock()
+			return
+		}
+		msg := queue[0]
+		d.mu.Unlock()
+
+		if !d.acquire(ctx, agent) {
+			d.mu.Lock()
+			delete(d.queues, sessionKey)
+			d.mu.Unlock()
+			logger.WarnCF("agent", "Dropping queued messages on shutdown",
+				map[string]any{
+					"session_key": sessionKey,
+					"count":       len(queue),
+				})
+			return
+		}
+		d.handle(ctx, msg)
+		d.release(agent)
+
+		// Pop only after handling so that Dispatch keeps appending to this
+		// worker's queue instead of starting a second one for the session.
+		d.mu.Lock()
+		d.queues[sessionKey] = d.queues[sessionKey][1:]
+		d.mu.Unlock()
+	}
+}
+
+// acquire takes the per-agent slot before a global one so that a saturated
+// agent never holds global slots that other agents could use.
+func (d *sessionDispatcher) acquire(ctx context.Context, agent *AgentInstance) bool {
+	if agent != nil && agent.turnSlots != nil {
+		select {
+		case agent.turnSlots <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	select {
+	case d.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		if agent != nil && agent.turnSlots != nil {
+			<-agent.turnSlots
+		}
+		return false
+	}
+}
+
+func (d *sessionDispatcher) release(agent *AgentInstance) {
+	<-d.slots
+	if agent != nil && agent.turnSlots != nil {
+		<-agent.turnSlots
+	}
+}
@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestSessionDispatcher_SameSessionIsOrdered(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	var running atomic.Int32
+
+	d := newSessionDispatcher(4, func(ctx context.Context, msg bus.InboundMessage) {
+		if running.Add(1) > 1 {
+			t.Error("two turns of the same session ran concurrently")
+		}
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		order = append(order, msg.Content)
+		mu.Unlock()
+		running.Add(-1)
+	})
+
+	ctx := context.Background()
+	for _, content := range []string{"1", "2", "3", "4"} {
+		d.Dispatch(ctx, "session-a", nil, bus.InboundMessage{Content: content})
+	}
+	d.Wait()
+
+	want := []string{"1", "2", "3", "4"}
+	if len(order) != len(want) {
+		t.Fatalf("expected %d processed messages, got %d", len(want), len(order))
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected order %v, got %v", want, order)
+		}
+	}
+	if d.ActiveSessions() != 0 {
+		t.Errorf("expected no active sessions after Wait, got %d", d.ActiveSessions())
+	}
+}
+
+func TestSessionDispatcher_DifferentSessionsRunInParallel(t *testing.T) {
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(2)
+
+	d := newSessionDispatcher(4, func(ctx context.Context, msg bus.InboundMessage) {
+		started.Done()
+		<-release
+	})
+
+	ctx := context.Background()
+	d.Dispatch(ctx, "session-a", nil, bus.InboundMessage{Content: "slow"})
+	d.Dispatch(ctx, "session-b", nil, bus.InboundMessage{Content: "fast"})
+
+	done := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("second session was blocked by the first")
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestSessionDispatcher_RespectsGlobalAndAgentLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    int
+		agentCap  int
+		wantLimit int32
+	}{
+		{name: "global cap", global: 2, agentCap: 0, wantLimit: 2},
+		{name: "agent cap", global: 4, agentCap: 1, wantLimit: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, peak atomic.Int32
+			d := newSessionDispatcher(tt.global, func(ctx context.Context, msg bus.InboundMessage) {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				running.Add(-1)
+			})
+
+			agent := &AgentInstance{ID: "main"}
+			if tt.agentCap > 0 {
+				agent.turnSlots = make(chan struct{}, tt.agentCap)
+			}
+
+			ctx := context.Background()
+			for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+				d.Dispatch(ctx, key, agent, bus.InboundMessage{Content: key})
+			}
+			d.Wait()
+
+			if got := peak.Load(); got > tt.wantLimit {
+				t.Errorf("expected at most %d concurrent turns, got %d", tt.wantLimit, got)
+			}
+		})
+	}
+}
+
+func TestSessionDispatcher_StopsOnCancel(t *testing.T) {
+	block := make(chan struct{})
+	var handled atomic.Int32
+
+	d := newSessionDispatcher(1, func(ctx context.Context, msg bus.InboundMessage) {
+		handled.Add(1)
+		<-block
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Dispatch(ctx, "a", nil, bus.InboundMessage{Content: "first"})
+	d.Dispatch(ctx, "b", nil, bus.InboundMessage{Content: "queued"})
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	close(block)
+	d.Wait()
+
+	if got := handled.Load(); got != 1 {
+		t.Errorf("expected only the in-flight turn to run, got %d", got)
+	}
+}
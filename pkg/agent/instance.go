@@ -6,10 +6,12 @@ import (
 	"strings"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/egress"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/usage"
 )
 
 // AgentInstance represents a fully configured agent with its own workspace,
@@ -31,14 +33,46 @@ type AgentInstance struct {
 	Subagents      *config.SubagentsConfig
 	SkillsFilter   []string
 	Candidates     []providers.FallbackCandidate
+
+	// ImageCandidates are tried in order for turns that carry image
+	// attachments; empty means such turns use the regular model.
+	ImageCandidates []providers.FallbackCandidate
+	// Budget caps what the agent spends; once exceeded, turns use
+	// DowngradeCandidates or are refused when there are none.
+	Budget              config.BudgetConfig
+	DowngradeCandidates []providers.FallbackCandidate
+	// Routing picks a model tier per turn; Tiers holds the candidates of
+	// each configured tier and ClassifierCandidates the optional model that
+	// picks one.
+	Routing              config.RoutingConfig
+	Tiers                map[string][]providers.FallbackCandidate
+	ClassifierCandidates []providers.FallbackCandidate
+	// Reasoning sets the thinking effort or budget passed to the provider,
+	// and whether a reasoning summary is shown on the channel.
+	Reasoning config.ReasoningConfig
+	// MaxParallelTools caps how many tool calls from one response run at
+	// the same time; 1 runs them one after another.
+	MaxParallelTools int
+	// Egress decides which hosts the agent's HTTP-calling tools may reach.
+	Egress *egress.Policy
+	// pool serves candidates resolved from model_list entries.
+	pool *providers.ProviderPool
+	// ledger records the usage of the agent's providers; nil disables it.
+	ledger *usage.Ledger
+
+	// turnSlots limits concurrent sessions for this agent; nil means unlimited.
+	turnSlots chan struct{}
 }
 
-// NewAgentInstance creates an agent instance from config.
+// NewAgentInstance creates an agent instance from config. Candidates from
+// model_list are served by pool, which agents share so that they reuse one
+// provider per entry; a nil pool gives the agent its own.
 func NewAgentInstance(
 	agentCfg *config.AgentConfig,
 	defaults *config.AgentDefaults,
 	cfg *config.Config,
 	provider providers.LLMProvider,
+	pool *providers.ProviderPool,
 ) *AgentInstance {
 	workspace := resolveAgentWorkspace(agentCfg, defaults)
 	os.MkdirAll(workspace, 0o755)
@@ -51,9 +85,14 @@ func NewAgentInstance(
 	toolsRegistry.Register(tools.NewReadFileTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewWriteFileTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewListDirTool(workspace, restrict))
-	toolsRegistry.Register(tools.NewExecToolWithConfig(workspace, restrict, cfg))
+	execTool := tools.NewExecToolWithConfig(workspace, restrict, cfg)
+	execTool.SetSandboxNetwork(resolveAgentExecNetwork(agentCfg, cfg))
+	toolsRegistry.Register(execTool)
 	toolsRegistry.Register(tools.NewEditFileTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewAppendFileTool(workspace, restrict))
+	if agentCfg != nil {
+		toolsRegistry.SetToolPolicy(tools.NewToolPolicy(agentCfg.Tools, workspace))
+	}
 
 	sessionsDir := filepath.Join(workspace, "sessions")
 	pType := config.PersistenceJSON
@@ -69,12 +108,16 @@ func NewAgentInstance(
 	agentName := ""
 	var subagents *config.SubagentsConfig
 	var skillsFilter []string
+	var turnSlots chan struct{}
 
 	if agentCfg != nil {
 		agentID = routing.NormalizeAgentID(agentCfg.ID)
 		agentName = agentCfg.Name
 		subagents = agentCfg.Subagents
 		skillsFilter = agentCfg.Skills
+		if agentCfg.MaxConcurrency > 0 {
+			turnSlots = make(chan struct{}, agentCfg.MaxConcurrency)
+		}
 	}
 
 	maxIter := defaults.MaxToolIterations
@@ -92,21 +135,53 @@ func NewAgentInstance(
 		temperature = *defaults.Temperature
 	}
 
-	// Resolve the actual model ID from configuration (translating aliases to provider IDs)
-	resolvedModel := model
-	if cfg != nil {
-		if mCfg, err := cfg.GetModelConfig(model); err == nil {
-			_, resolvedModel, _ = providers.CreateProviderFromConfig(mCfg)
-		}
+	// Resolve fallback candidates; model_list entries get their own providers
+	if pool == nil {
+		pool = providers.NewProviderPool(cfg)
 	}
-	model = resolvedModel
-
-	// Resolve fallback candidates
-	modelCfg := providers.ModelConfig{
+	candidates := pool.ResolveCandidates(providers.ModelConfig{
 		Primary:   model,
 		Fallbacks: fallbacks,
+	}, defaults.Provider)
+
+	// The primary candidate's provider also serves summaries and subagents
+	if len(candidates) > 0 {
+		if p, ok := pool.Provider(candidates[0]); ok {
+			provider = p
+			model = candidates[0].Model
+		}
+	}
+
+	imageCandidates := resolveImageCandidates(pool, defaults)
+
+	budget := resolveAgentBudget(agentCfg, defaults)
+	var downgradeCandidates []providers.FallbackCandidate
+	if strings.TrimSpace(budget.DowngradeModel) != "" {
+		downgradeCandidates = pool.ResolveCandidates(providers.ModelConfig{
+			Primary: budget.DowngradeModel,
+		}, defaults.Provider)
+	}
+
+	routingCfg := resolveAgentRouting(agentCfg, defaults)
+	var tiers map[string][]providers.FallbackCandidate
+	var classifierCandidates []providers.FallbackCandidate
+	if routingCfg.Enabled {
+		tiers = make(map[string][]providers.FallbackCandidate)
+		for name, m := range routingCfg.Tiers {
+			tierCandidates := pool.ResolveCandidates(providers.ModelConfig{
+				Primary:   m.Primary,
+				Fallbacks: m.Fallbacks,
+			}, defaults.Provider)
+			if len(tierCandidates) > 0 {
+				tiers[strings.ToLower(strings.TrimSpace(name))] = tierCandidates
+			}
+		}
+		if strings.TrimSpace(routingCfg.ClassifierModel) != "" {
+			classifierCandidates = pool.ResolveCandidates(providers.ModelConfig{
+				Primary: routingCfg.ClassifierModel,
+			}, defaults.Provider)
+		}
 	}
-	candidates := providers.ResolveCandidates(modelCfg, defaults.Provider)
 
 	return &AgentInstance{
 		ID:             agentID,
@@ -125,7 +200,61 @@ func NewAgentInstance(
 		Subagents:      subagents,
 		SkillsFilter:   skillsFilter,
 		Candidates:     candidates,
+		turnSlots:      turnSlots,
+
+		ImageCandidates:     imageCandidates,
+		Budget:              budget,
+		DowngradeCandidates: downgradeCandidates,
+		pool:                pool,
+
+		Routing:              routingCfg,
+		Tiers:                tiers,
+		ClassifierCandidates: classifierCandidates,
+		Reasoning:            resolveAgentReasoning(agentCfg, defaults),
+		MaxParallelTools:     resolveAgentMaxParallelTools(agentCfg, defaults),
+		Egress:               egress.NewPolicy(resolveAgentEgress(agentCfg, cfg)),
+	}
+}
+
+// trackUsage records the usage of every provider the agent calls in ledger.
+func (a *AgentInstance) trackUsage(ledger *usage.Ledger) {
+	a.ledger = ledger
+	a.Provider = usage.Track(a.Provider, ledger)
+}
+
+// ImageProvider returns the provider serving the given image candidate.
+func (a *AgentInstance) ImageProvider(provider, model string) providers.LLMProvider {
+	key := providers.ModelKey(provider, model)
+	for _, c := range a.ImageCandidates {
+		if providers.ModelKey(c.Provider, c.Model) == key {
+			return a.ProviderFor(c)
+		}
+	}
+	return a.Provider
+}
+
+// resolveImageCandidates resolves the image model and its fallbacks. Names
+// found in model_list are served by their pool entries; others by the
+// agent's default provider.
+func resolveImageCandidates(pool *providers.ProviderPool, defaults *config.AgentDefaults) []providers.FallbackCandidate {
+	if strings.TrimSpace(defaults.ImageModel) == "" {
+		return nil
 	}
+	return pool.ResolveCandidates(providers.ModelConfig{
+		Primary:   defaults.ImageModel,
+		Fallbacks: defaults.ImageModelFallbacks,
+	}, defaults.Provider)
+}
+
+// ProviderFor returns the provider serving a fallback candidate. Candidates
+// not from model_list are served by the agent's default provider.
+func (a *AgentInstance) ProviderFor(c providers.FallbackCandidate) providers.LLMProvider {
+	if a.pool != nil {
+		if p, ok := a.pool.Provider(c); ok {
+			return usage.Track(p, a.ledger)
+		}
+	}
+	return a.Provider
 }
 
 // resolveAgentWorkspace determines the workspace directory for an agent.
@@ -149,6 +278,62 @@ func resolveAgentModel(agentCfg *config.AgentConfig, defaults *config.AgentDefau
 	return defaults.Model
 }
 
+// resolveAgentBudget resolves the spending budget for an agent.
+func resolveAgentBudget(agentCfg *config.AgentConfig, defaults *config.AgentDefaults) config.BudgetConfig {
+	if agentCfg != nil && agentCfg.Budget != nil {
+		return *agentCfg.Budget
+	}
+	return defaults.Budget
+}
+
+// resolveAgentRouting resolves the model routing settings for an agent.
+func resolveAgentRouting(agentCfg *config.AgentConfig, defaults *config.AgentDefaults) config.RoutingConfig {
+	if agentCfg != nil && agentCfg.Routing != nil {
+		return *agentCfg.Routing
+	}
+	return defaults.Routing
+}
+
+// resolveAgentReasoning resolves the reasoning settings for an agent.
+func resolveAgentReasoning(agentCfg *config.AgentConfig, defaults *config.AgentDefaults) config.ReasoningConfig {
+	if agentCfg != nil && agentCfg.Reasoning != nil {
+		return *agentCfg.Reasoning
+	}
+	return defaults.Reasoning
+}
+
+// resolveAgentExecNetwork resolves whether an agent's sandboxed commands
+// may use the network.
+func resolveAgentExecNetwork(agentCfg *config.AgentConfig, cfg *config.Config) bool {
+	if agentCfg != nil && agentCfg.ExecNetwork != nil {
+		return *agentCfg.ExecNetwork
+	}
+	return cfg != nil && cfg.Tools.Exec.Sandbox.Network
+}
+
+// resolveAgentMaxParallelTools resolves how many tool calls from one
+// response an agent runs at once.
+func resolveAgentMaxParallelTools(agentCfg *config.AgentConfig, defaults *config.AgentDefaults) int {
+	if agentCfg != nil && agentCfg.MaxParallelTools > 0 {
+		return agentCfg.MaxParallelTools
+	}
+	if defaults.MaxParallelTools > 0 {
+		return defaults.MaxParallelTools
+	}
+	return defaultMaxParallelTools
+}
+
+// resolveAgentEgress resolves the egress rules for an agent.
+func resolveAgentEgress(agentCfg *config.AgentConfig, cfg *config.Config) config.EgressConfig {
+	if agentCfg != nil && agentCfg.Egress != nil {
+		return *agentCfg.Egress
+	}
+	if cfg == nil {
+		return config.EgressConfig{}
+	}
+	return cfg.Tools.Egress
+}
+
 // resolveAgentFallbacks resolves the fallback models for an agent.
 func resolveAgentFallbacks(agentCfg *config.AgentConfig, defaults *config.AgentDefaults) []string {
 	if agentCfg != nil && agentCfg.Model != nil && agentCfg.Model.Fallbacks != nil {
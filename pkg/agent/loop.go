@@ -22,11 +22,13 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mcp"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/usage"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -39,6 +41,11 @@ type AgentLoop struct {
 	summarizing    sync.Map
 	fallback       *providers.FallbackChain
 	channelManager *channels.Manager
+	dispatcher     *sessionDispatcher
+	mcp            *mcp.Manager
+	mcpOnce        sync.Once
+	ledger         *usage.Ledger
+	approvals      *approvalBroker
 }
 
 // processOptions configures how a message is processed
@@ -52,13 +59,20 @@ type processOptions struct {
 	SendResponse    bool     // Whether to send response via bus
 	NoHistory       bool     // If true, don't load session history (for heartbeat)
 	Media           []string // List of media file paths
+	Stream          bool     // Stream the reply to the channel as it is generated
+	Downgrade       bool     // Over budget: use the agent's downgrade model
+	Tier            string   // Model tier picked by the router; empty means the regular model
+	ResponseFormat  *providers.ResponseFormat // Structured final answer requested by the caller
 }
 
 func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
 	registry := NewAgentRegistry(cfg, provider)
 
+	// Record the usage of every LLM call, including subagents and summaries
+	ledger := newUsageLedger(cfg, registry)
+
 	// Register shared tools to all agents
-	registerSharedTools(cfg, msgBus, registry, provider)
+	registerSharedTools(cfg, msgBus, registry)
 
 	// Set up shared fallback chain
 	cooldown := providers.NewCooldownTracker()
@@ -75,14 +89,63 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		stateManager = state.NewManager(pType, defaultAgent.Workspace)
 	}
 
-	return &AgentLoop{
+	al := &AgentLoop{
 		bus:         msgBus,
 		cfg:         cfg,
 		registry:    registry,
 		state:       stateManager,
 		summarizing: sync.Map{},
 		fallback:    fallbackChain,
+		ledger:      ledger,
+	}
+
+	maxConcurrent := 0
+	if cfg != nil {
+		maxConcurrent = cfg.Agents.Defaults.MaxConcurrentTurns
+	}
+	al.dispatcher = newSessionDispatcher(maxConcurrent, al.handleInbound)
+	al.mcp = newMCPManager(cfg, registry)
+	var approvers []string
+	if cfg != nil {
+		approvers = cfg.Tools.Approval.Approvers
+	}
+	al.approvals = newApprovalBroker(msgBus, approvers)
+	applyApprovalPolicies(cfg, registry, al.approvals)
+
+	return al
+}
+
+// newUsageLedger opens the usage ledger in the default workspace and has
+// every agent record its LLM calls in it.
+func newUsageLedger(cfg *config.Config, registry *AgentRegistry) *usage.Ledger {
+	if cfg == nil || cfg.WorkspacePath() == "" {
+		return nil
+	}
+
+	ledger := usage.NewLedger(usage.LedgerPath(cfg.WorkspacePath()), usage.PricesFromConfig(cfg.ModelList))
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok {
+			agent.trackUsage(ledger)
+		}
 	}
+	return ledger
+}
+
+// newMCPManager sets up the configured MCP servers to expose their tools in
+// every agent's registry once Start connects them. It returns nil when none
+// are configured.
+func newMCPManager(cfg *config.Config, registry *AgentRegistry) *mcp.Manager {
+	if cfg == nil || len(cfg.Tools.MCP.Servers) == 0 {
+		return nil
+	}
+
+	manager := mcp.NewManager(cfg.Tools.MCP.Servers)
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok {
+			manager.AddRegistry(agent.Tools)
+		}
+	}
+	return manager
 }
 
 // registerSharedTools registers tools that are shared across all agents (web, message, spawn).
@@ -90,7 +153,6 @@ func registerSharedTools(
 	cfg *config.Config,
 	msgBus *bus.MessageBus,
 	registry *AgentRegistry,
-	provider providers.LLMProvider,
 ) {
 	for _, agentID := range registry.ListAgentIDs() {
 		agent, ok := registry.GetAgent(agentID)
@@ -115,7 +177,9 @@ func registerSharedTools(
 		}); searchTool != nil {
 			agent.Tools.Register(searchTool)
 		}
-		agent.Tools.Register(tools.NewWebFetchTool(50000))
+		fetchTool := tools.NewWebFetchTool(50000)
+		fetchTool.SetEgressPolicy(agent.Egress)
+		agent.Tools.Register(fetchTool)
 
 		// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
 		agent.Tools.Register(tools.NewI2CTool())
@@ -131,12 +195,23 @@ func registerSharedTools(
 			})
 			return nil
 		})
+		messageTool.SetSendMediaCallback(agent.Workspace, cfg.Agents.Defaults.RestrictToWorkspace,
+			func(channel, chatID, content string, media []string) error {
+				msgBus.PublishOutbound(bus.OutboundMessage{
+					Channel: channel,
+					ChatID:  chatID,
+					Content: content,
+					Media:   media,
+				})
+				return nil
+			})
 		agent.Tools.Register(messageTool)
 
 		// Skill discovery and installation tools
 		registryMgr := skills.NewRegistryManagerFromConfig(skills.RegistryConfig{
 			MaxConcurrentSearches: cfg.Tools.Skills.MaxConcurrentSearches,
 			ClawHub:               skills.ClawHubConfig(cfg.Tools.Skills.Registries.ClawHub),
+			Egress:                agent.Egress,
 		})
 		searchCache := skills.NewSearchCache(
 			cfg.Tools.Skills.SearchCache.MaxSize,
@@ -146,7 +221,7 @@ func registerSharedTools(
 		agent.Tools.Register(tools.NewInstallSkillTool(registryMgr, agent.Workspace))
 
 		// Spawn tool with allowlist checker
-		subagentManager := tools.NewSubagentManager(provider, agent.Model, agent.Workspace, msgBus)
+		subagentManager := tools.NewSubagentManager(agent.Provider, agent.Model, agent.Workspace, msgBus)
 		subagentManager.SetLLMOptions(agent.MaxTokens, agent.Temperature)
 		spawnTool := tools.NewSpawnTool(subagentManager)
 		currentAgentID := agentID
@@ -160,8 +235,13 @@ func registerSharedTools(
 	}
 }
 
+// Run consumes inbound messages and hands them to per-session workers.
+// Messages for the same session are processed in order; different sessions
+// run concurrently up to agents.defaults.max_concurrent_turns.
 func (al *AgentLoop) Run(ctx context.Context) error {
+	al.Start(ctx)
 	al.running.Store(true)
+	defer al.dispatcher.Wait()
 
 	for al.running.Load() {
 		select {
@@ -173,52 +253,100 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 				continue
 			}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
-				// Persist error response to session history if possible
-				if al.registry != nil {
-					if agent, ok := al.registry.GetAgent(msg.SenderID); ok {
-						agent.Sessions.AddMessage(msg.SessionKey, "assistant", response)
-						agent.Sessions.Save(msg.SessionKey)
-					} else if defaultAgent := al.registry.GetDefaultAgent(); defaultAgent != nil {
-						// Fallback to default agent if specific agent not found
-						defaultAgent.Sessions.AddMessage(msg.SessionKey, "assistant", response)
-						defaultAgent.Sessions.Save(msg.SessionKey)
-					}
-				}
+			// Answers to approval prompts go to the turn waiting for them,
+			// which holds its session's worker
+			if al.approvals.resolve(msg) {
+				al.bus.AckInbound(msg)
+				continue
 			}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				// Use default agent's tools to check (message tool is shared).
-				alreadySent := false
-				defaultAgent := al.registry.GetDefaultAgent()
-				if defaultAgent != nil {
-					if tool, ok := defaultAgent.Tools.Get("message"); ok {
-						if mt, ok := tool.(*tools.MessageTool); ok {
-							alreadySent = mt.HasSentInRound()
-						}
-					}
-				}
+			agent, sessionKey := al.resolveSession(msg)
+			al.dispatcher.Dispatch(ctx, sessionKey, agent, msg)
+		}
+	}
 
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					})
-				}
+	return nil
+}
+
+// handleInbound processes one inbound message and publishes the reply.
+// It runs on the session worker owning the message's session key.
+func (al *AgentLoop) handleInbound(ctx context.Context, msg bus.InboundMessage) {
+	turn := &tools.TurnContext{}
+	if !constants.IsInternalChannel(msg.Channel) {
+		turn.SenderID = msg.SenderID
+	}
+	ctx = tools.WithTurnContext(ctx, turn)
+	if al.cfg != nil && al.cfg.Agents.Defaults.Streaming {
+		ctx = withStreamedReplies(ctx)
+	}
+
+	response, err := al.processMessage(ctx, msg)
+	if err != nil {
+		response = fmt.Sprintf("Error processing message: %v", err)
+		// Persist error response to session history if possible
+		if al.registry != nil {
+			if agent, ok := al.registry.GetAgent(msg.SenderID); ok {
+				agent.Sessions.AddMessage(msg.SessionKey, "assistant", response)
+				agent.Sessions.Save(msg.SessionKey)
+			} else if defaultAgent := al.registry.GetDefaultAgent(); defaultAgent != nil {
+				// Fallback to default agent if specific agent not found
+				defaultAgent.Sessions.AddMessage(msg.SessionKey, "assistant", response)
+				defaultAgent.Sessions.Save(msg.SessionKey)
 			}
 		}
 	}
 
-	return nil
+	// Skip publishing if the reply was streamed, to avoid duplicate
+	// messages. If the message tool already answered, the reply is marked
+	// so only channels waiting for the end of the turn send it.
+	if response != "" && !turn.ReplyStreamed() {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			Content:  response,
+			Final:    true,
+			Answered: turn.MessageSent(),
+		})
+	}
+
+	// A turn cut short by shutdown stays unacknowledged so the durable bus
+	// replays it on the next start.
+	if ctx.Err() == nil {
+		al.bus.AckInbound(msg)
+	}
+}
+
+// resolveSession returns the agent and session key an inbound message will be
+// processed under. It mirrors the routing done in processMessage and
+// processSystemMessage so the dispatcher can serialize turns per session.
+func (al *AgentLoop) resolveSession(msg bus.InboundMessage) (*AgentInstance, string) {
+	if msg.Channel == "system" {
+		agent := al.registry.GetDefaultAgent()
+		if agent == nil {
+			return nil, msg.Channel + ":" + msg.ChatID
+		}
+		return agent, routing.BuildAgentMainSessionKey(agent.ID)
+	}
+
+	agent, sessionKey, _ := al.routeMessage(msg)
+	return agent, sessionKey
+}
+
+// Start connects to the configured MCP servers, waiting until each has been
+// tried once, and keeps them connected until ctx ends or Stop is called. Run
+// calls it; callers that process messages directly call it first. Calls
+// after the first do nothing.
+func (al *AgentLoop) Start(ctx context.Context) {
+	if al.mcp != nil {
+		al.mcpOnce.Do(func() { al.mcp.Start(ctx) })
+	}
 }
 
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	if al.mcp != nil {
+		al.mcp.Close()
+	}
 }
 
 func (al *AgentLoop) GetTools() *tools.ToolRegistry {
@@ -228,6 +356,31 @@ func (al *AgentLoop) GetTools() *tools.ToolRegistry {
 	return nil
 }
 
+// GetAgent returns the agent with the given ID, or the default agent when
+// agentID is empty.
+func (al *AgentLoop) GetAgent(agentID string) (*AgentInstance, bool) {
+	if agentID == "" {
+		agent := al.registry.GetDefaultAgent()
+		return agent, agent != nil
+	}
+	return al.registry.GetAgent(agentID)
+}
+
+// GetAgentTools returns the tool registry of the agent with the given ID,
+// or of the default agent when agentID is empty.
+func (al *AgentLoop) GetAgentTools(agentID string) (*tools.ToolRegistry, bool) {
+	agent, ok := al.GetAgent(agentID)
+	if !ok {
+		return nil, false
+	}
+	return agent.Tools, true
+}
+
+// ListAgentIDs returns the IDs of all configured agents.
+func (al *AgentLoop) ListAgentIDs() []string {
+	return al.registry.ListAgentIDs()
+}
+
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
 	for _, agentID := range al.registry.ListAgentIDs() {
 		if agent, ok := al.registry.GetAgent(agentID); ok {
@@ -238,6 +391,7 @@ func (al *AgentLoop) RegisterTool(tool tools.Tool) {
 
 func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	al.channelManager = cm
+	al.approvals.setChannelManager(cm)
 }
 
 // RecordLastChannel records the last active channel for this workspace.
@@ -281,6 +435,7 @@ func (al *AgentLoop) ProcessDirectWithChannel(
 // Each heartbeat is independent and doesn't accumulate context.
 func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, chatID string) (string, error) {
 	agent := al.registry.GetDefaultAgent()
+	ctx = usage.WithKind(ctx, usage.KindHeartbeat)
 	return al.runAgentLoop(ctx, agent, processOptions{
 		SessionKey:      "heartbeat",
 		Channel:         channel,
@@ -329,6 +484,31 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	}
 
 	// Route to determine agent and session key
+	agent, sessionKey, route := al.routeMessage(msg)
+
+	logger.InfoCF("agent", "Routed message",
+		map[string]any{
+			"agent_id":    agent.ID,
+			"session_key": sessionKey,
+			"matched_by":  route.MatchedBy,
+		})
+
+	return al.runAgentLoop(ctx, agent, processOptions{
+		SessionKey:      sessionKey,
+		Channel:         msg.Channel,
+		ChatID:          msg.ChatID,
+		UserMessage:     msg.Content,
+		Media:           msg.Media,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		EnableSummary:   true,
+		SendResponse:    false,
+		Stream:          streamedRepliesRequested(ctx),
+		ResponseFormat:  providers.ResponseFormatFromContext(ctx),
+	})
+}
+
+// routeMessage resolves the agent and session key for a non-system message.
+func (al *AgentLoop) routeMessage(msg bus.InboundMessage) (*AgentInstance, string, routing.ResolvedRoute) {
 	route := al.registry.ResolveRoute(routing.RouteInput{
 		Channel:    msg.Channel,
 		AccountID:  msg.Metadata["account_id"],
@@ -344,28 +524,18 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	}
 
 	// Use routed session key, but honor pre-set agent-scoped keys (for ProcessDirect/cron)
+	// together with the agent they name.
 	sessionKey := route.SessionKey
 	if msg.SessionKey != "" && strings.HasPrefix(msg.SessionKey, "agent:") {
 		sessionKey = msg.SessionKey
+		if parsed := routing.ParseAgentSessionKey(sessionKey); parsed != nil {
+			if scoped, ok := al.registry.GetAgent(parsed.AgentID); ok {
+				agent = scoped
+			}
+		}
 	}
 
-	logger.InfoCF("agent", "Routed message",
-		map[string]any{
-			"agent_id":    agent.ID,
-			"session_key": sessionKey,
-			"matched_by":  route.MatchedBy,
-		})
-
-	return al.runAgentLoop(ctx, agent, processOptions{
-		SessionKey:      sessionKey,
-		Channel:         msg.Channel,
-		ChatID:          msg.ChatID,
-		UserMessage:     msg.Content,
-		Media:           msg.Media,
-		DefaultResponse: "I've completed processing but have no response to give.",
-		EnableSummary:   true,
-		SendResponse:    false,
-	})
+	return agent, sessionKey, route
 }
 
 func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
@@ -421,6 +591,7 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 		DefaultResponse: "Background task completed.",
 		EnableSummary:   false,
 		SendResponse:    true,
+		Stream:          streamedRepliesRequested(ctx),
 	})
 }
 
@@ -437,10 +608,53 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		}
 	}
 
-	// 1. Update tool contexts
-	al.updateToolContexts(agent, opts.Channel, opts.ChatID)
+	// 1. Bind channel/chatID to this turn so shared tools don't see other sessions' targets
+	turn := tools.TurnContextFrom(ctx)
+	if turn == nil {
+		turn = &tools.TurnContext{}
+		ctx = tools.WithTurnContext(ctx, turn)
+	}
+	turn.Channel = opts.Channel
+	turn.ChatID = opts.ChatID
+	turn.AgentID = agent.ID
+	ctx = usage.WithTags(ctx, usage.Tags{
+		AgentID:    agent.ID,
+		SessionKey: opts.SessionKey,
+		Channel:    opts.Channel,
+	})
+
+	// 2. Enforce the agent's spending budget
+	if limit, exceeded := al.ledger.Exceeded(agent.ID, agent.Budget); exceeded {
+		if len(agent.DowngradeCandidates) == 0 {
+			logger.WarnCF("agent", "Budget exceeded, refusing turn",
+				map[string]any{"agent_id": agent.ID, "limit": limit})
+			refusal := fmt.Sprintf("I've reached my %s, so I can't take on new requests until it resets.", limit)
+			if opts.SendResponse {
+				al.bus.PublishOutbound(bus.OutboundMessage{
+					Channel: opts.Channel,
+					ChatID:  opts.ChatID,
+					Content: refusal,
+				})
+			}
+			return refusal, nil
+		}
+		logger.InfoCF("agent", "Budget exceeded, downgrading model",
+			map[string]any{
+				"agent_id": agent.ID,
+				"limit":    limit,
+				"model":    agent.Budget.DowngradeModel,
+			})
+		opts.Downgrade = true
+	}
+
+	// 3. Route the turn to a model tier
+	if len(agent.Tiers) > 0 && !opts.Downgrade {
+		if d := al.routeTurn(ctx, agent, &opts); d.Tier != TierDefault || agent.Tiers[TierDefault] != nil {
+			opts.Tier = d.Tier
+		}
+	}
 
-	// 2. Build messages (skip history for heartbeat)
+	// 4. Build messages (skip history for heartbeat)
 	var history []providers.Message
 	var summary string
 	if !opts.NoHistory {
@@ -455,11 +669,16 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		opts.Channel,
 		opts.ChatID,
 	)
+	if opts.ResponseFormat != nil {
+		// A JSON answer is not for streaming; say what shape it must take
+		opts.Stream = false
+		addStructuredOutputInstruction(messages, opts.ResponseFormat)
+	}
 
-	// 3. Save user message to session
+	// 5. Save user message to session
 	agent.Sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
 
-	// 4. Run LLM iteration loop
+	// 6. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(ctx, agent, messages, opts)
 	if err != nil {
 		return "", err
@@ -468,22 +687,22 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	// If last tool had ForUser content and we already sent it, we might not need to send final response
 	// This is controlled by the tool's Silent flag and ForUser content
 
-	// 5. Handle empty response
+	// 7. Handle empty response
 	if finalContent == "" {
 		finalContent = opts.DefaultResponse
 	}
 
-	// 6. Save final assistant message to session
+	// 8. Save final assistant message to session
 	agent.Sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
 	agent.Sessions.Save(opts.SessionKey)
 
-	// 7. Optional: summarization
+	// 9. Optional: summarization
 	if opts.EnableSummary {
 		al.maybeSummarize(agent, opts.SessionKey, opts.Channel, opts.ChatID)
 	}
 
-	// 8. Optional: send response via bus
-	if opts.SendResponse {
+	// 10. Optional: send response via bus
+	if opts.SendResponse && !turn.ReplyStreamed() {
 		al.bus.PublishOutbound(bus.OutboundMessage{
 			Channel: opts.Channel,
 			ChatID:  opts.ChatID,
@@ -491,7 +710,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		})
 	}
 
-	// 9. Log response
+	// 11. Log response
 	responsePreview := utils.Truncate(finalContent, 120)
 	logger.InfoCF("agent", fmt.Sprintf("Response: %s", responsePreview),
 		map[string]any{
@@ -552,14 +771,40 @@ func (al *AgentLoop) runLLMIteration(
 		var response *providers.LLMResponse
 		var err error
 
-		callLLM := func() (*providers.LLMResponse, error) {
-			if len(agent.Candidates) > 1 && al.fallback != nil {
-				fbResult, fbErr := al.fallback.Execute(ctx, agent.Candidates,
-					func(ctx context.Context, provider, model string) (*providers.LLMResponse, error) {
-						return agent.Provider.Chat(ctx, messages, providerToolDefs, model, map[string]any{
-							"max_tokens":  agent.MaxTokens,
-							"temperature": agent.Temperature,
-						})
+		// Stream content into an editable channel message when supported
+		stream := al.newReplyStream(ctx, agent, opts)
+
+		callLLM := func(messages []providers.Message) (*providers.LLMResponse, error) {
+			// Turns carrying images go to the image model when one is set
+			if len(agent.ImageCandidates) > 0 && al.fallback != nil && hasImageAttachments(messages) {
+				fbResult, fbErr := al.fallback.ExecuteImageCandidates(ctx, agent.ImageCandidates,
+					func(ctx context.Context, c providers.FallbackCandidate) (*providers.LLMResponse, error) {
+						return al.chat(ctx, agent, agent.ProviderFor(c), messages, providerToolDefs, c.Model, opts.ResponseFormat, stream)
+					},
+				)
+				if fbErr != nil {
+					return nil, fbErr
+				}
+				logger.DebugCF("agent", "Image model answered",
+					map[string]any{
+						"agent_id":  agent.ID,
+						"provider":  fbResult.Provider,
+						"model":     fbResult.Model,
+						"iteration": iteration,
+					})
+				return fbResult.Response, nil
+			}
+			candidates := agent.Candidates
+			switch {
+			case opts.Downgrade:
+				candidates = agent.DowngradeCandidates
+			case opts.Tier != "":
+				candidates = agent.Tiers[opts.Tier]
+			}
+			if (len(candidates) > 1 || opts.Downgrade || opts.Tier != "") && al.fallback != nil {
+				fbResult, fbErr := al.fallback.ExecuteCandidates(ctx, candidates,
+					func(ctx context.Context, c providers.FallbackCandidate) (*providers.LLMResponse, error) {
+						return al.chat(ctx, agent, agent.ProviderFor(c), messages, providerToolDefs, c.Model, opts.ResponseFormat, stream)
 					},
 				)
 				if fbErr != nil {
@@ -572,21 +817,33 @@ func (al *AgentLoop) runLLMIteration(
 				}
 				return fbResult.Response, nil
 			}
-			return agent.Provider.Chat(ctx, messages, providerToolDefs, agent.Model, map[string]any{
-				"max_tokens":  agent.MaxTokens,
-				"temperature": agent.Temperature,
-			})
+			return al.chat(ctx, agent, agent.Provider, messages, providerToolDefs, agent.Model, opts.ResponseFormat, stream)
 		}
 
 		// Retry loop for context/token errors
 		maxRetries := 2
+		imagesShrunk := false
 		for retry := 0; retry <= maxRetries; retry++ {
-			response, err = callLLM()
+			response, err = callLLM(messages)
 			if err == nil {
 				break
 			}
 
 			errMsg := strings.ToLower(err.Error())
+
+			// Images the provider rejected are downscaled once and resent
+			if !imagesShrunk && (providers.IsImageSizeError(errMsg) || providers.IsImageDimensionError(errMsg)) {
+				imagesShrunk = true
+				if shrunk, changed := providers.DownscaleAttachments(messages); changed {
+					logger.WarnCF("agent", "Image rejected by provider, retrying downscaled", map[string]any{
+						"agent_id": agent.ID,
+						"error":    err.Error(),
+					})
+					messages = shrunk
+					retry--
+					continue
+				}
+			}
 			isContextError := strings.Contains(errMsg, "token") ||
 				strings.Contains(errMsg, "context") ||
 				strings.Contains(errMsg, "invalidparameter") ||
@@ -613,11 +870,17 @@ func (al *AgentLoop) runLLMIteration(
 					newHistory, newSummary, "",
 					nil, opts.Channel, opts.ChatID,
 				)
+				addStructuredOutputInstruction(messages, opts.ResponseFormat)
 				continue
 			}
 			break
 		}
 
+		// A structured final answer is validated, with one retry
+		if err == nil && opts.ResponseFormat != nil {
+			response, err = providers.EnforceResponseFormat(opts.ResponseFormat, messages, response, callLLM)
+		}
+
 		if err != nil {
 			logger.ErrorCF("agent", "LLM call failed",
 				map[string]any{
@@ -628,6 +891,18 @@ func (al *AgentLoop) runLLMIteration(
 			return "", iteration, fmt.Errorf("LLM call failed after retries: %w", err)
 		}
 
+		if response.Reasoning != "" {
+			logger.DebugCF("agent", "LLM reasoning",
+				map[string]any{
+					"agent_id":  agent.ID,
+					"iteration": iteration,
+					"reasoning": utils.Truncate(response.Reasoning, 500),
+				})
+			if agent.Reasoning.Show {
+				al.showReasoning(ctx, opts, response.Reasoning)
+			}
+		}
+
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
@@ -637,9 +912,25 @@ func (al *AgentLoop) runLLMIteration(
 					"iteration":     iteration,
 					"content_chars": len(finalContent),
 				})
+			if stream.started() && finalContent != "" {
+				if err := stream.finish(finalContent); err != nil {
+					logger.WarnCF("agent", "Failed to finish streamed reply",
+						map[string]any{"agent_id": agent.ID, "error": err.Error()})
+				} else {
+					tools.TurnContextFrom(ctx).MarkReplyStreamed()
+				}
+			}
 			break
 		}
 
+		// Text streamed before the tool calls stays visible as its own message
+		if stream.started() {
+			if err := stream.finish(response.Content); err != nil {
+				logger.WarnCF("agent", "Failed to finish streamed message",
+					map[string]any{"agent_id": agent.ID, "error": err.Error()})
+			}
+		}
+
 		normalizedToolCalls := make([]providers.ToolCall, 0, len(response.ToolCalls))
 		for _, tc := range response.ToolCalls {
 			normalizedToolCalls = append(normalizedToolCalls, providers.NormalizeToolCall(tc))
@@ -658,10 +949,12 @@ func (al *AgentLoop) runLLMIteration(
 				"iteration": iteration,
 			})
 
-		// Build assistant message with tool calls
+		// Build assistant message with tool calls, keeping signed thinking
+		// blocks the provider needs back with the tool results
 		assistantMsg := providers.Message{
-			Role:    "assistant",
-			Content: response.Content,
+			Role:     "assistant",
+			Content:  response.Content,
+			Thinking: response.Thinking,
 		}
 		for _, tc := range normalizedToolCalls {
 			argumentsJSON, _ := json.Marshal(tc.Arguments)
@@ -690,7 +983,7 @@ func (al *AgentLoop) runLLMIteration(
 		// Save assistant message with tool calls to session
 		agent.Sessions.AddFullMessage(opts.SessionKey, assistantMsg)
 
-		// Execute tool calls
+		// Execute tool calls, independent ones in parallel
 		for _, tc := range normalizedToolCalls {
 			argsJSON, _ := json.Marshal(tc.Arguments)
 			argsPreview := utils.Truncate(string(argsJSON), 200)
@@ -700,31 +993,43 @@ func (al *AgentLoop) runLLMIteration(
 					"tool":      tc.Name,
 					"iteration": iteration,
 				})
+		}
 
-			// Create async callback for tools that implement AsyncTool
-			// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
-			// Instead, they notify the agent via PublishInbound, and the agent decides
-			// whether to forward the result to the user (in processSystemMessage).
-			asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
-				// Log the async completion but don't send directly to user
-				// The agent will handle user notification via processSystemMessage
-				if !result.Silent && result.ForUser != "" {
-					logger.InfoCF("agent", "Async tool completed, agent will handle notification",
-						map[string]any{
-							"tool":        tc.Name,
-							"content_len": len(result.ForUser),
-						})
+		toolResults := runToolCalls(ctx, normalizedToolCalls, agent.MaxParallelTools,
+			func(tc providers.ToolCall) string {
+				return agent.Tools.SerialKey(tc.Name, tc.Arguments)
+			},
+			func(ctx context.Context, tc providers.ToolCall) *tools.ToolResult {
+				// Create async callback for tools that implement AsyncTool
+				// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
+				// Instead, they notify the agent via PublishInbound, and the agent decides
+				// whether to forward the result to the user (in processSystemMessage).
+				asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
+					// Log the async completion but don't send directly to user
+					// The agent will handle user notification via processSystemMessage
+					if !result.Silent && result.ForUser != "" {
+						logger.InfoCF("agent", "Async tool completed, agent will handle notification",
+							map[string]any{
+								"tool":        tc.Name,
+								"content_len": len(result.ForUser),
+							})
+					}
 				}
-			}
 
-			toolResult := agent.Tools.ExecuteWithContext(
-				ctx,
-				tc.Name,
-				tc.Arguments,
-				opts.Channel,
-				opts.ChatID,
-				asyncCallback,
-			)
+				return agent.Tools.ExecuteWithContext(
+					ctx,
+					tc.Name,
+					tc.Arguments,
+					opts.Channel,
+					opts.ChatID,
+					asyncCallback,
+				)
+			})
+
+		// Results go back in call order, as providers match them to the
+		// assistant message's tool calls
+		for i, tc := range normalizedToolCalls {
+			toolResult := toolResults[i]
 
 			// Send ForUser content to user immediately if not Silent
 			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
@@ -761,23 +1066,19 @@ func (al *AgentLoop) runLLMIteration(
 	return finalContent, iteration, nil
 }
 
-// updateToolContexts updates the context for tools that need channel/chatID info.
-func (al *AgentLoop) updateToolContexts(agent *AgentInstance, channel, chatID string) {
-	// Use ContextualTool interface instead of type assertions
-	if tool, ok := agent.Tools.Get("message"); ok {
-		if mt, ok := tool.(tools.ContextualTool); ok {
-			mt.SetContext(channel, chatID)
-		}
-	}
-	if tool, ok := agent.Tools.Get("spawn"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
-		}
+// maxReasoningSummary bounds the reasoning shown on a channel, in characters.
+const maxReasoningSummary = 1500
+
+// showReasoning sends the model's reasoning, shortened, to the turn's channel
+// when the channel can show it collapsed.
+func (al *AgentLoop) showReasoning(ctx context.Context, opts processOptions, reasoning string) {
+	if al.channelManager == nil || constants.IsInternalChannel(opts.Channel) {
+		return
 	}
-	if tool, ok := agent.Tools.Get("subagent"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
-		}
+	summary := utils.Truncate(strings.TrimSpace(reasoning), maxReasoningSummary)
+	if err := al.channelManager.SendReasoning(ctx, opts.Channel, opts.ChatID, summary); err != nil {
+		logger.WarnCF("agent", "Failed to send reasoning summary",
+			map[string]any{"channel": opts.Channel, "error": err.Error()})
 	}
 }
 
@@ -799,7 +1100,7 @@ func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, c
 						Content: "Memory threshold reached. Optimizing conversation history...",
 					})
 				}
-				al.summarizeSession(agent, sessionKey)
+				al.summarizeSession(agent, sessionKey, channel)
 			}()
 		}
 	}
@@ -883,9 +1184,34 @@ func (al *AgentLoop) GetStartupInfo() map[string]any {
 		"ids":   al.registry.ListAgentIDs(),
 	}
 
+	// MCP servers info
+	if al.mcp != nil {
+		info["mcp"] = al.mcp.Status()
+	}
+
 	return info
 }
 
+// addStructuredOutputInstruction tells the model the shape of its final
+// answer at the end of the system prompt. A nil rf leaves messages as is.
+func addStructuredOutputInstruction(messages []providers.Message, rf *providers.ResponseFormat) {
+	if rf != nil && len(messages) > 0 && messages[0].Role == "system" {
+		messages[0].Content += "\n\n" + providers.StructuredOutputInstruction(rf)
+	}
+}
+
+// hasImageAttachments reports whether any message carries an image.
+func hasImageAttachments(messages []providers.Message) bool {
+	for _, msg := range messages {
+		for _, att := range msg.Attachments {
+			if strings.HasPrefix(att.MimeType, "image/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // formatMessagesForLog formats messages for logging
 func formatMessagesForLog(messages []providers.Message) string {
 	if len(messages) == 0 {
@@ -937,10 +1263,17 @@ func formatToolsForLog(toolDefs []providers.ToolDefinition) string {
 	return sb.String()
 }
 
-// summarizeSession summarizes the conversation history for a session.
-func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string) {
+// summarizeSession summarizes the conversation history for a session. Its
+// usage is recorded against channel, the one the session's turns came from.
+func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey, channel string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
+	ctx = usage.WithTags(ctx, usage.Tags{
+		AgentID:    agent.ID,
+		SessionKey: sessionKey,
+		Channel:    channel,
+		Kind:       usage.KindSummary,
+	})
 
 	history := agent.Sessions.GetHistory(sessionKey)
 	summary := agent.Sessions.GetSummary(sessionKey)
@@ -994,8 +1327,9 @@ func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string) {
 			nil,
 			agent.Model,
 			map[string]any{
-				"max_tokens":  1024,
-				"temperature": 0.3,
+				"max_tokens":     1024,
+				"temperature":    0.3,
+				"context_window": agent.ContextWindow,
 			},
 		)
 		if err == nil {
@@ -1044,8 +1378,9 @@ func (al *AgentLoop) summarizeBatch(
 		nil,
 		agent.Model,
 		map[string]any{
-			"max_tokens":  1024,
-			"temperature": 0.3,
+			"max_tokens":     1024,
+			"temperature":    0.3,
+			"context_window": agent.ContextWindow,
 		},
 	)
 	if err != nil {
@@ -3,8 +3,14 @@ package agent
 import (
 	"context"
 	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +18,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/usage"
 )
 
 func TestRecordLastChannel(t *testing.T) {
@@ -631,3 +638,438 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+func TestProcessDirectWithChannel_AgentScopedSessionKeySelectsAgent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "agent-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+			List: []config.AgentConfig{
+				{ID: "main", Default: true, Workspace: filepath.Join(tmpDir, "main")},
+				{ID: "work", Workspace: filepath.Join(tmpDir, "work")},
+			},
+		},
+	}
+
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+
+	sessionKey := "agent:work:mcp:review"
+	if _, err := al.ProcessDirectWithChannel(context.Background(), "hello", sessionKey, "mcp", "review"); err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+	}
+
+	work, _ := al.GetAgent("work")
+	if got := len(work.Sessions.GetHistory(sessionKey)); got == 0 {
+		t.Error("expected the turn to be recorded in the work agent's session")
+	}
+	main, _ := al.GetAgent("")
+	if got := len(main.Sessions.GetHistory(sessionKey)); got != 0 {
+		t.Errorf("default agent recorded %d messages for a work-scoped session", got)
+	}
+}
+
+// visionMockProvider records the model and attachments of each call and
+// rejects the first oversized image.
+type visionMockProvider struct {
+	rejectFirst bool
+	models      []string
+	mimeTypes   []string
+}
+
+func (m *visionMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.models = append(m.models, model)
+	mime := ""
+	for _, msg := range messages {
+		for _, att := range msg.Attachments {
+			mime = att.MimeType
+		}
+	}
+	m.mimeTypes = append(m.mimeTypes, mime)
+	if m.rejectFirst && len(m.models) == 1 {
+		return nil, fmt.Errorf("invalid_request_error: image exceeds 5 MB maximum")
+	}
+	return &providers.LLMResponse{Content: "I see a picture"}, nil
+}
+
+func (m *visionMockProvider) GetDefaultModel() string {
+	return "text-model"
+}
+
+func writeTestPNG(t *testing.T, dir string) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	path := filepath.Join(dir, "photo.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAgentLoop_RoutesImagesToImageModel(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = tmpDir
+	cfg.Agents.Defaults.Model = "text-model"
+	cfg.Agents.Defaults.ImageModel = "vision-model"
+
+	provider := &visionMockProvider{rejectFirst: true}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	response, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel:  "telegram",
+		SenderID: "user1",
+		ChatID:   "chat1",
+		Content:  "What is this?",
+		Media:    []string{writeTestPNG(t, tmpDir)},
+	})
+	if err != nil {
+		t.Fatalf("processMessage() error: %v", err)
+	}
+	if response != "I see a picture" {
+		t.Errorf("response = %q", response)
+	}
+
+	wantModels := []string{"vision-model", "vision-model"}
+	wantMimes := []string{"image/png", "image/jpeg"}
+	if !reflect.DeepEqual(provider.models, wantModels) || !reflect.DeepEqual(provider.mimeTypes, wantMimes) {
+		t.Errorf("calls = %v %v, want %v %v (original, then downscaled)",
+			provider.models, provider.mimeTypes, wantModels, wantMimes)
+	}
+
+	provider.rejectFirst = false
+	provider.models, provider.mimeTypes = nil, nil
+	if _, err := al.ProcessDirectWithChannel(context.Background(), "hi", "text-only", "cli", "direct"); err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+	}
+	if len(provider.models) != 1 || provider.models[0] != "text-model" {
+		t.Errorf("text-only turn used %v, want text-model", provider.models)
+	}
+}
+
+func TestAgentLoop_FallbackUsesCandidateProvider(t *testing.T) {
+	newServer := func(status int, content string, hits *int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*hits++
+			if status != http.StatusOK {
+				http.Error(w, `{"error":{"message":"rate limit exceeded"}}`, status)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"choices":[{"message":{"content":%q},"finish_reason":"stop"}]}`, content)
+		}))
+	}
+	var primaryHits, backupHits int
+	primary := newServer(http.StatusTooManyRequests, "", &primaryHits)
+	defer primary.Close()
+	backup := newServer(http.StatusOK, "from backup", &backupHits)
+	defer backup.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Agents.Defaults.Model = "primary"
+	cfg.Agents.Defaults.ModelFallbacks = []string{"backup"}
+	cfg.Agents.Defaults.Streaming = false
+	cfg.ModelList = []config.ModelConfig{
+		{ModelName: "primary", Model: "openai/gpt-4o", APIKey: "sk-primary", APIBase: primary.URL},
+		{ModelName: "backup", Model: "deepseek/deepseek-chat", APIKey: "sk-backup", APIBase: backup.URL},
+	}
+
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	response, err := al.ProcessDirectWithChannel(context.Background(), "hello", "s1", "cli", "direct")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+	}
+	if response != "from backup" {
+		t.Errorf("response = %q, want the backup endpoint's reply", response)
+	}
+	if primaryHits != 1 || backupHits != 1 {
+		t.Errorf("hits = primary %d, backup %d, want one each", primaryHits, backupHits)
+	}
+}
+
+func TestAgentLoop_ImageFallbackUsesCandidateProvider(t *testing.T) {
+	newServer := func(status int, content string, hits *int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*hits++
+			if status != http.StatusOK {
+				http.Error(w, `{"error":{"message":"rate limit exceeded"}}`, status)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"choices":[{"message":{"content":%q},"finish_reason":"stop"}]}`, content)
+		}))
+	}
+	var visionHits, backupHits int
+	vision := newServer(http.StatusTooManyRequests, "", &visionHits)
+	defer vision.Close()
+	backup := newServer(http.StatusOK, "a cat", &backupHits)
+	defer backup.Close()
+
+	tmpDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = tmpDir
+	cfg.Agents.Defaults.Model = "text-model"
+	cfg.Agents.Defaults.ImageModel = "vision"
+	cfg.Agents.Defaults.ImageModelFallbacks = []string{"vision-backup"}
+	cfg.Agents.Defaults.Streaming = false
+	cfg.ModelList = []config.ModelConfig{
+		{ModelName: "vision", Model: "openai/gpt-4o", APIKey: "sk-vision", APIBase: vision.URL},
+		{ModelName: "vision-backup", Model: "openai/gpt-4o-mini", APIKey: "sk-backup", APIBase: backup.URL},
+	}
+
+	provider := &visionMockProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	response, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel:  "telegram",
+		SenderID: "user1",
+		ChatID:   "chat1",
+		Content:  "What is this?",
+		Media:    []string{writeTestPNG(t, tmpDir)},
+	})
+	if err != nil {
+		t.Fatalf("processMessage() error: %v", err)
+	}
+	if response != "a cat" {
+		t.Errorf("response = %q, want the backup image endpoint's reply", response)
+	}
+	if visionHits != 1 || backupHits != 1 || len(provider.models) != 0 {
+		t.Errorf("hits = vision %d, backup %d, default provider %v; want one each and none",
+			visionHits, backupHits, provider.models)
+	}
+
+	agent := al.registry.GetDefaultAgent()
+	if p := agent.ImageProvider("openai", "gpt-4o-mini"); p == agent.Provider {
+		t.Error("ImageProvider served the backup image model with the default provider")
+	}
+}
+
+func TestAgentLoop_RecordsUsageAndEnforcesBudget(t *testing.T) {
+	newServer := func(content string, hits *int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*hits++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"choices":[{"message":{"content":%q},"finish_reason":"stop"}],`+
+				`"usage":{"prompt_tokens":1000,"completion_tokens":100,"total_tokens":1100}}`, content)
+		}))
+	}
+	var premiumHits, cheapHits int
+	premium := newServer("from premium", &premiumHits)
+	defer premium.Close()
+	cheap := newServer("from cheap", &cheapHits)
+	defer cheap.Close()
+
+	newLoop := func(budget config.BudgetConfig) (*AgentLoop, string) {
+		cfg := config.DefaultConfig()
+		cfg.Agents.Defaults.Workspace = t.TempDir()
+		cfg.Agents.Defaults.Model = "premium"
+		cfg.Agents.Defaults.Streaming = false
+		cfg.Agents.Defaults.Budget = budget
+		cfg.ModelList = []config.ModelConfig{
+			{ModelName: "premium", Model: "openai/gpt-4o", APIKey: "sk-a", APIBase: premium.URL, InputPrice: 10, OutputPrice: 30},
+			{ModelName: "cheap", Model: "openai/gpt-4o-mini", APIKey: "sk-a", APIBase: cheap.URL},
+		}
+		return NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{}), cfg.WorkspacePath()
+	}
+	ctx := context.Background()
+
+	// $0.013 per call against a $0.01 daily budget: the second call downgrades
+	al, workspace := newLoop(config.BudgetConfig{Daily: 0.01, DowngradeModel: "cheap"})
+	for _, want := range []string{"from premium", "from cheap"} {
+		response, err := al.ProcessDirectWithChannel(ctx, "hello", "s1", "cli", "direct")
+		if err != nil {
+			t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+		}
+		if response != want {
+			t.Errorf("response = %q, want %q", response, want)
+		}
+	}
+
+	records, err := usage.ReadRecords(usage.LedgerPath(workspace), time.Time{})
+	if err != nil {
+		t.Fatalf("ReadRecords() error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d usage records, want 2", len(records))
+	}
+	first := records[0]
+	if first.AgentID != "main" || first.SessionKey != "agent:main:main" || first.Channel != "cli" ||
+		first.Kind != usage.KindChat || first.Model != "gpt-4o" || first.PromptTokens != 1000 {
+		t.Errorf("first record = %+v", first)
+	}
+	if first.Cost < 0.0129 || first.Cost > 0.0131 {
+		t.Errorf("first record cost = %v, want 0.013", first.Cost)
+	}
+	if records[1].Model != "gpt-4o-mini" || records[1].Cost != 0 {
+		t.Errorf("second record = %+v, want the unpriced downgrade model", records[1])
+	}
+
+	// Without a downgrade model the agent refuses once over budget
+	premiumHits, cheapHits = 0, 0
+	al, _ = newLoop(config.BudgetConfig{Daily: 0.01})
+	al.ProcessDirectWithChannel(ctx, "hello", "s1", "cli", "direct")
+	response, err := al.ProcessDirectWithChannel(ctx, "hello again", "s1", "cli", "direct")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+	}
+	if premiumHits != 1 || cheapHits != 0 {
+		t.Errorf("hits = premium %d, cheap %d, want the over-budget turn refused", premiumHits, cheapHits)
+	}
+	if !strings.Contains(response, "daily budget") {
+		t.Errorf("response = %q, want a budget refusal", response)
+	}
+}
+
+func TestAgentLoop_SummaryUsageIsTaggedWithChannel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"summary"},"finish_reason":"stop"}],`+
+			`"usage":{"prompt_tokens":100,"completion_tokens":10,"total_tokens":110}}`)
+	}))
+	defer server.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Agents.Defaults.Model = "priced"
+	cfg.ModelList = []config.ModelConfig{
+		{ModelName: "priced", Model: "openai/gpt-4o", APIKey: "sk-a", APIBase: server.URL},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	agent := al.registry.GetDefaultAgent()
+	for i := 0; i < 6; i++ {
+		agent.Sessions.AddMessage("s1", "user", fmt.Sprintf("message %d", i))
+	}
+
+	al.summarizeSession(agent, "s1", "telegram")
+
+	records, err := usage.ReadRecords(usage.LedgerPath(cfg.WorkspacePath()), time.Time{})
+	if err != nil {
+		t.Fatalf("ReadRecords() error: %v", err)
+	}
+	if len(records) != 1 || records[0].Kind != usage.KindSummary || records[0].Channel != "telegram" {
+		t.Errorf("records = %+v, want one summary record for telegram", records)
+	}
+}
+
+// jsonMockProvider answers in prose first and in JSON once corrected.
+type jsonMockProvider struct {
+	calls   int
+	formats []*providers.ResponseFormat
+}
+
+func (m *jsonMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	rf, _ := opts[providers.ResponseFormatOption].(*providers.ResponseFormat)
+	m.formats = append(m.formats, rf)
+	if m.calls == 1 {
+		return &providers.LLMResponse{Content: "Disk usage is at 42%."}, nil
+	}
+	return &providers.LLMResponse{Content: `{"disk_percent": 42}`}, nil
+}
+
+func (m *jsonMockProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestAgentLoop_ResponseFormatFromContext(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Agents.Defaults.Model = "test-model"
+
+	provider := &jsonMockProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	format := providers.NewResponseFormat(map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"disk_percent": map[string]any{"type": "number"}},
+		"required":   []any{"disk_percent"},
+	})
+	ctx := providers.WithResponseFormat(context.Background(), format)
+	response, err := al.ProcessDirectWithChannel(ctx, "check disk", "cron-job1", "cli", "direct")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+	}
+	if response != `{"disk_percent":42}` {
+		t.Errorf("response = %q, want the validated JSON", response)
+	}
+	if provider.calls != 2 || provider.formats[0] != format || provider.formats[1] != format {
+		t.Errorf("calls = %d, formats = %v", provider.calls, provider.formats)
+	}
+}
+
+// overflowOnceProvider rejects the first request as too long, then answers
+// in JSON, recording the system prompt of each request.
+type overflowOnceProvider struct {
+	systemPrompts []string
+}
+
+func (m *overflowOnceProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.systemPrompts = append(m.systemPrompts, messages[0].Content)
+	if len(m.systemPrompts) == 1 {
+		return nil, fmt.Errorf("maximum context length exceeded")
+	}
+	return &providers.LLMResponse{Content: `{"ok": true}`}, nil
+}
+
+func (m *overflowOnceProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestAgentLoop_ResponseFormatSurvivesCompression(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Agents.Defaults.Model = "test-model"
+
+	provider := &overflowOnceProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	ctx := providers.WithResponseFormat(context.Background(), providers.NewResponseFormat(map[string]any{}))
+	response, err := al.ProcessDirectWithChannel(ctx, "status?", "cron-job1", "cli", "direct")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+	}
+	if response != `{"ok":true}` {
+		t.Errorf("response = %q", response)
+	}
+	instruction := providers.StructuredOutputInstruction(providers.NewResponseFormat(map[string]any{}))
+	for i, prompt := range provider.systemPrompts {
+		if !strings.Contains(prompt, instruction) {
+			t.Errorf("request %d lacks the structured output instruction", i+1)
+		}
+	}
+}
@@ -203,3 +203,24 @@ func TestAgentInstance_FallbackExplicitEmpty(t *testing.T) {
 		t.Errorf("expected 0 fallbacks (explicit empty), got %d: %v", len(agent.Fallbacks), agent.Fallbacks)
 	}
 }
+
+func TestNewAgentRegistry_SharesProviderPool(t *testing.T) {
+	cfg := testCfg([]config.AgentConfig{
+		{ID: "sales", Default: true},
+		{ID: "support"},
+	})
+	cfg.Agents.Defaults.Model = "shared"
+	cfg.ModelList = []config.ModelConfig{
+		{ModelName: "shared", Model: "openai/gpt-4o", APIKey: "sk-test", APIBase: "http://127.0.0.1:1"},
+	}
+	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+
+	sales, _ := registry.GetAgent("sales")
+	support, _ := registry.GetAgent("support")
+	if sales.pool != support.pool {
+		t.Fatal("agents got separate provider pools")
+	}
+	if sales.Provider != support.Provider {
+		t.Error("agents using the same model_list entry got separate providers")
+	}
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+// Model tiers a turn can be routed to.
+const (
+	TierFast    = "fast"
+	TierDefault = "default"
+	TierDeep    = "deep"
+)
+
+const (
+	defaultFastMaxChars = 160
+	defaultDeepMinChars = 2000
+	classifierTimeout   = 15 * time.Second
+)
+
+// defaultDeepKeywords mark requests that need careful reasoning.
+var defaultDeepKeywords = []string{
+	"analyze", "analyse", "architecture", "debug", "design", "explain why",
+	"in depth", "plan", "proof", "prove", "refactor", "step by step", "trade-off",
+}
+
+// toolIntentKeywords mark requests likely to need several tool calls, which
+// the fast tier is not trusted with.
+var toolIntentKeywords = []string{
+	"download", "edit", "execute", "fetch", "file", "install", "remind",
+	"run", "schedule", "search", "spawn", "write",
+}
+
+// tierDecision is the tier picked for a turn and why.
+type tierDecision struct {
+	Tier   string
+	Reason string
+}
+
+// parseTierCommand strips an inline "/tier <name>" or "/<name>" prefix naming
+// a configured tier from a message.
+func parseTierCommand(content string, tiers map[string][]providers.FallbackCandidate) (string, string, bool) {
+	trimmed := strings.TrimSpace(content)
+	if !strings.HasPrefix(trimmed, "/") || len(tiers) == 0 {
+		return "", content, false
+	}
+
+	cmd, rest, _ := strings.Cut(trimmed, " ")
+	name := strings.ToLower(strings.TrimPrefix(cmd, "/"))
+	if name == "tier" {
+		name, rest, _ = strings.Cut(strings.TrimSpace(rest), " ")
+		name = strings.ToLower(name)
+	}
+	if _, ok := tiers[name]; !ok && name != TierDefault {
+		return "", content, false
+	}
+	return name, strings.TrimSpace(rest), true
+}
+
+// classifyTurn picks a tier from the shape of a message: media and tool
+// requests never go to the fast tier, long or reasoning-heavy requests go to
+// the deep tier, and short plain messages go to the fast tier.
+func classifyTurn(cfg config.RoutingConfig, content string, media []string) tierDecision {
+	fastMax := cfg.FastMaxChars
+	if fastMax <= 0 {
+		fastMax = defaultFastMaxChars
+	}
+	deepMin := cfg.DeepMinChars
+	if deepMin <= 0 {
+		deepMin = defaultDeepMinChars
+	}
+	deepKeywords := cfg.DeepKeywords
+	if len(deepKeywords) == 0 {
+		deepKeywords = defaultDeepKeywords
+	}
+
+	lower := strings.ToLower(content)
+	length := len([]rune(content))
+
+	if length >= deepMin {
+		return tierDecision{Tier: TierDeep, Reason: fmt.Sprintf("long message (%d chars)", length)}
+	}
+	if kw := findKeyword(lower, deepKeywords); kw != "" {
+		return tierDecision{Tier: TierDeep, Reason: fmt.Sprintf("keyword %q", kw)}
+	}
+	if len(media) > 0 {
+		return tierDecision{Tier: TierDefault, Reason: "media attached"}
+	}
+	if kw := findKeyword(lower, toolIntentKeywords); kw != "" {
+		return tierDecision{Tier: TierDefault, Reason: fmt.Sprintf("tool intent %q", kw)}
+	}
+	if length <= fastMax {
+		return tierDecision{Tier: TierFast, Reason: fmt.Sprintf("short message (%d chars)", length)}
+	}
+	return tierDecision{Tier: TierDefault, Reason: "no signal"}
+}
+
+// findKeyword returns the first keyword occurring in lower as whole words.
+func findKeyword(lower string, keywords []string) string {
+	for _, kw := range keywords {
+		if kw != "" && containsWord(lower, strings.ToLower(kw)) {
+			return kw
+		}
+	}
+	return ""
+}
+
+func containsWord(s, word string) bool {
+	for start := 0; ; {
+		i := strings.Index(s[start:], word)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(word)
+		if (i == 0 || !isWordByte(s[i-1])) && (end == len(s) || !isWordByte(s[end])) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+const classifierPrompt = `Classify how demanding the user's message is for an AI assistant.
+Reply with exactly one word:
+fast - greetings, small talk, quick facts, short answers
+default - ordinary requests, including ones that need tools
+deep - complex reasoning, planning, long analysis or code design`
+
+// classifyWithModel asks the agent's classifier model to pick a tier.
+func (al *AgentLoop) classifyWithModel(ctx context.Context, agent *AgentInstance, content string) (string, error) {
+	ctx, cancel := context.WithTimeout(usage.WithKind(ctx, usage.KindRouter), classifierTimeout)
+	defer cancel()
+
+	messages := []providers.Message{
+		{Role: "system", Content: classifierPrompt},
+		{Role: "user", Content: content},
+	}
+	options := map[string]any{"max_tokens": 8, "temperature": 0.0}
+	result, err := al.fallback.ExecuteCandidates(ctx, agent.ClassifierCandidates,
+		func(ctx context.Context, c providers.FallbackCandidate) (*providers.LLMResponse, error) {
+			return agent.ProviderFor(c).Chat(ctx, messages, nil, c.Model, options)
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	for _, word := range strings.Fields(strings.ToLower(result.Response.Content)) {
+		switch word = strings.Trim(word, ".,:;!\"'`*"); word {
+		case TierFast, TierDefault, TierDeep:
+			return word, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected classifier reply %q", result.Response.Content)
+}
+
+// routeTurn picks the model tier for a turn. An inline tier command wins and
+// is stripped from the message; otherwise the classifier model decides, with
+// the heuristics as fallback. Tiers the agent does not configure resolve to
+// its regular model.
+func (al *AgentLoop) routeTurn(ctx context.Context, agent *AgentInstance, opts *processOptions) tierDecision {
+	if tier, rest, ok := parseTierCommand(opts.UserMessage, agent.Tiers); ok {
+		opts.UserMessage = rest
+		return al.selectTier(agent, tierDecision{Tier: tier, Reason: "inline command"})
+	}
+
+	if len(agent.ClassifierCandidates) > 0 && al.fallback != nil {
+		tier, err := al.classifyWithModel(ctx, agent, opts.UserMessage)
+		if err == nil {
+			return al.selectTier(agent, tierDecision{Tier: tier, Reason: "classifier model"})
+		}
+		logger.WarnCF("agent", "Tier classifier failed, using heuristics",
+			map[string]any{"agent_id": agent.ID, "error": err.Error()})
+	}
+
+	return al.selectTier(agent, classifyTurn(agent.Routing, opts.UserMessage, opts.Media))
+}
+
+// selectTier logs a decision, resolving tiers the agent lacks to the default.
+func (al *AgentLoop) selectTier(agent *AgentInstance, d tierDecision) tierDecision {
+	if _, ok := agent.Tiers[d.Tier]; !ok {
+		d.Tier = TierDefault
+	}
+	model := agent.Model
+	if candidates := agent.Tiers[d.Tier]; len(candidates) > 0 {
+		model = candidates[0].Model
+	}
+	logger.InfoCF("agent", "Model tier selected",
+		map[string]any{
+			"agent_id": agent.ID,
+			"tier":     d.Tier,
+			"reason":   d.Reason,
+			"model":    model,
+		})
+	return d
+}
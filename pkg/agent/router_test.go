@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestClassifyTurn(t *testing.T) {
+	cfg := config.RoutingConfig{}
+	tests := []struct {
+		name    string
+		content string
+		media   []string
+		want    string
+	}{
+		{"greeting", "hi there!", nil, TierFast},
+		{"media", "what is this?", []string{"/tmp/photo.jpg"}, TierDefault},
+		{"tool intent", "search the news about sipeed", nil, TierDefault},
+		{"keyword inside a word", "my profile is outdated", nil, TierFast},
+		{"deep keyword", "can you refactor this function", nil, TierDeep},
+		{"long message", strings.Repeat("word ", 500), nil, TierDeep},
+		{"medium plain", strings.Repeat("tell me more ", 20), nil, TierDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyTurn(cfg, tt.content, tt.media); got.Tier != tt.want {
+				t.Errorf("classifyTurn() = %+v, want tier %q", got, tt.want)
+			}
+		})
+	}
+
+	custom := config.RoutingConfig{FastMaxChars: 5, DeepKeywords: []string{"ponder"}}
+	if got := classifyTurn(custom, "hi there!", nil); got.Tier != TierDefault {
+		t.Errorf("with fast_max_chars 5, tier = %q, want default", got.Tier)
+	}
+	if got := classifyTurn(custom, "please ponder this", nil); got.Tier != TierDeep {
+		t.Errorf("with custom keyword, tier = %q, want deep", got.Tier)
+	}
+}
+
+func TestParseTierCommand(t *testing.T) {
+	tiers := map[string][]providers.FallbackCandidate{
+		TierFast: {{Provider: "openai", Model: "gpt-4o-mini"}},
+		TierDeep: {{Provider: "openai", Model: "o3"}},
+	}
+	tests := []struct {
+		content  string
+		wantTier string
+		wantRest string
+		wantOK   bool
+	}{
+		{"/deep why is the sky blue?", TierDeep, "why is the sky blue?", true},
+		{"/tier fast hello", TierFast, "hello", true},
+		{"/default hello", TierDefault, "hello", true},
+		{"/show model", "", "/show model", false},
+		{"/tier huge hello", "", "/tier huge hello", false},
+		{"plain message", "", "plain message", false},
+	}
+	for _, tt := range tests {
+		tier, rest, ok := parseTierCommand(tt.content, tiers)
+		if tier != tt.wantTier || rest != tt.wantRest || ok != tt.wantOK {
+			t.Errorf("parseTierCommand(%q) = %q, %q, %v, want %q, %q, %v",
+				tt.content, tier, rest, ok, tt.wantTier, tt.wantRest, tt.wantOK)
+		}
+	}
+}
+
+func TestAgentLoop_RoutesTurnsToTiers(t *testing.T) {
+	newServer := func(name string, status int, hits map[string]int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			if status != http.StatusOK {
+				http.Error(w, `{"error":{"message":"rate limit exceeded"}}`, status)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"choices":[{"message":{"content":"from %s"},"finish_reason":"stop"}]}`, name)
+		}))
+	}
+	hits := make(map[string]int)
+	regular := newServer("regular", http.StatusOK, hits)
+	defer regular.Close()
+	fast := newServer("fast", http.StatusOK, hits)
+	defer fast.Close()
+	deep := newServer("deep", http.StatusTooManyRequests, hits)
+	defer deep.Close()
+	deepBackup := newServer("deep-backup", http.StatusOK, hits)
+	defer deepBackup.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Agents.Defaults.Model = "regular"
+	cfg.Agents.Defaults.Streaming = false
+	cfg.Agents.Defaults.Routing = config.RoutingConfig{
+		Enabled: true,
+		Tiers: map[string]config.AgentModelConfig{
+			TierFast: {Primary: "fast"},
+			TierDeep: {Primary: "deep", Fallbacks: []string{"deep-backup"}},
+		},
+	}
+	cfg.ModelList = []config.ModelConfig{
+		{ModelName: "regular", Model: "openai/regular", APIKey: "sk-a", APIBase: regular.URL},
+		{ModelName: "fast", Model: "openai/fast", APIKey: "sk-a", APIBase: fast.URL},
+		{ModelName: "deep", Model: "openai/deep", APIKey: "sk-a", APIBase: deep.URL},
+		{ModelName: "deep-backup", Model: "openai/deep-backup", APIKey: "sk-b", APIBase: deepBackup.URL},
+	}
+
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"hi!", "from fast"},
+		{"please search the web for picoclaw releases and summarize them", "from regular"},
+		{"/deep hi!", "from deep-backup"},
+	}
+	for _, tt := range tests {
+		response, err := al.ProcessDirectWithChannel(context.Background(), tt.content, "s1", "cli", "direct")
+		if err != nil {
+			t.Fatalf("ProcessDirectWithChannel(%q) error: %v", tt.content, err)
+		}
+		if response != tt.want {
+			t.Errorf("ProcessDirectWithChannel(%q) = %q, want %q", tt.content, response, tt.want)
+		}
+	}
+	if hits["deep"] != 1 {
+		t.Errorf("deep tier primary hit %d times, want 1 before falling back", hits["deep"])
+	}
+
+	agent := al.registry.GetDefaultAgent()
+	history := agent.Sessions.GetHistory("agent:main:main")
+	for _, m := range history {
+		if m.Role == "user" && strings.HasPrefix(m.Content, "/deep") {
+			t.Errorf("inline tier command was kept in history: %q", m.Content)
+		}
+	}
+}
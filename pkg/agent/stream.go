@@ -0,0 +1,147 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+type streamRepliesKey struct{}
+
+// withStreamedReplies marks ctx so that the turn streams its replies to the
+// originating channel. Only turns started from the inbound bus set it; direct
+// callers (cron, heartbeat, CLI) deliver the returned text themselves.
+func withStreamedReplies(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamRepliesKey{}, true)
+}
+
+func streamedRepliesRequested(ctx context.Context) bool {
+	v, _ := ctx.Value(streamRepliesKey{}).(bool)
+	return v
+}
+
+type replyDeltasKey struct{}
+
+// deltaSink collects the reply text of a whole turn for a direct caller.
+type deltaSink struct {
+	fn      func(text string)
+	emitted bool
+}
+
+// WithReplyDeltas makes the turn run with ctx pass reply text to fn as the
+// model generates it, independent of any channel. Text of successive LLM
+// calls, e.g. before and after tool calls, is separated by a blank line.
+// Nothing is passed when the provider cannot stream.
+func WithReplyDeltas(ctx context.Context, fn func(text string)) context.Context {
+	return context.WithValue(ctx, replyDeltasKey{}, &deltaSink{fn: fn})
+}
+
+// replyStream forwards content deltas of one LLM call into a progressively
+// edited channel message, or to the caller's delta sink.
+type replyStream struct {
+	ctx    context.Context
+	stream *channels.Stream
+	buf    strings.Builder
+
+	sink        *deltaSink
+	sinkStarted bool
+}
+
+// newReplyStream returns a reply stream for the turn, or nil when the turn,
+// provider or channel does not support streaming.
+func (al *AgentLoop) newReplyStream(ctx context.Context, agent *AgentInstance, opts processOptions) *replyStream {
+	if sink, ok := ctx.Value(replyDeltasKey{}).(*deltaSink); ok {
+		if _, ok := agent.Provider.(providers.StreamingProvider); !ok {
+			return nil
+		}
+		return &replyStream{ctx: ctx, sink: sink}
+	}
+	if !opts.Stream || al.channelManager == nil || constants.IsInternalChannel(opts.Channel) {
+		return nil
+	}
+	if _, ok := agent.Provider.(providers.StreamingProvider); !ok {
+		return nil
+	}
+	stream := al.channelManager.OpenStream(opts.Channel, opts.ChatID)
+	if stream == nil {
+		return nil
+	}
+	return &replyStream{ctx: ctx, stream: stream}
+}
+
+// reset discards text from a previous attempt, e.g. after a fallback. The
+// channel message is reused and overwritten by the next update.
+func (r *replyStream) reset() {
+	r.buf.Reset()
+}
+
+func (r *replyStream) onDelta(delta providers.StreamDelta) {
+	if delta.Content == "" {
+		return
+	}
+	if r.sink != nil {
+		// Text already handed to the caller cannot be taken back, so a
+		// fallback retry simply continues the stream.
+		if !r.sinkStarted && r.sink.emitted {
+			r.sink.fn("\n\n")
+		}
+		r.sinkStarted = true
+		r.sink.emitted = true
+		r.sink.fn(delta.Content)
+		return
+	}
+	r.buf.WriteString(delta.Content)
+	r.stream.Update(r.ctx, r.buf.String())
+}
+
+// started reports whether anything was shown on the channel yet.
+func (r *replyStream) started() bool {
+	return r != nil && r.stream != nil && r.stream.Started()
+}
+
+// finish replaces the streamed text with the complete content.
+func (r *replyStream) finish(content string) error {
+	return r.stream.Finish(r.ctx, content)
+}
+
+// chat calls provider with the agent's options, including its reasoning
+// settings, and the requested response format, streaming content deltas to
+// rs when set.
+func (al *AgentLoop) chat(
+	ctx context.Context,
+	agent *AgentInstance,
+	provider providers.LLMProvider,
+	messages []providers.Message,
+	toolDefs []providers.ToolDefinition,
+	model string,
+	format *providers.ResponseFormat,
+	rs *replyStream,
+) (*providers.LLMResponse, error) {
+	options := map[string]any{
+		"max_tokens":     agent.MaxTokens,
+		"temperature":    agent.Temperature,
+		"context_window": agent.ContextWindow,
+	}
+	if format != nil {
+		options[providers.ResponseFormatOption] = format
+	}
+	if agent.Reasoning.Effort != "" {
+		options[providers.ReasoningEffortOption] = agent.Reasoning.Effort
+	}
+	if agent.Reasoning.Budget > 0 {
+		options[providers.ReasoningBudgetOption] = agent.Reasoning.Budget
+	}
+	if sp, ok := provider.(providers.StreamingProvider); ok && rs != nil {
+		rs.reset()
+		return sp.ChatStream(ctx, messages, toolDefs, model, options, rs.onDelta)
+	}
+	return provider.Chat(ctx, messages, toolDefs, model, options)
+}
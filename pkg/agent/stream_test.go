@@ -0,0 +1,269 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+type streamingMockProvider struct {
+	chunks []string
+}
+
+func (m *streamingMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	return m.ChatStream(ctx, messages, tools, model, opts, nil)
+}
+
+func (m *streamingMockProvider) ChatStream(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+	onDelta func(providers.StreamDelta),
+) (*providers.LLMResponse, error) {
+	var content string
+	for _, chunk := range m.chunks {
+		content += chunk
+		if onDelta != nil {
+			onDelta(providers.StreamDelta{Content: chunk})
+		}
+	}
+	return &providers.LLMResponse{Content: content, FinishReason: "stop"}, nil
+}
+
+func (m *streamingMockProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+type editableTestChannel struct {
+	*channels.BaseChannel
+	mu    sync.Mutex
+	sent  []string
+	edits []string
+}
+
+func (c *editableTestChannel) Start(ctx context.Context) error { return nil }
+func (c *editableTestChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *editableTestChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, msg.Content)
+	return nil
+}
+
+func (c *editableTestChannel) SendEditable(ctx context.Context, chatID, content string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, content)
+	return "1", nil
+}
+
+func (c *editableTestChannel) EditMessage(ctx context.Context, chatID, messageID, content string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.edits = append(c.edits, content)
+	return nil
+}
+
+func (c *editableTestChannel) MaxMessageLength() int { return 4000 }
+
+func newStreamingTestLoop(t *testing.T, streaming bool) (*AgentLoop, *bus.MessageBus, *editableTestChannel) {
+	t.Helper()
+	tmpDir, err := os.MkdirTemp("", "agent-stream-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Streaming:         streaming,
+			},
+		},
+	}
+
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &streamingMockProvider{chunks: []string{"Hello", ", ", "world"}})
+
+	cm, err := channels.NewManager(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("Failed to create channel manager: %v", err)
+	}
+	ch := &editableTestChannel{BaseChannel: channels.NewBaseChannel("editable", nil, msgBus, nil)}
+	cm.RegisterChannel("editable", ch)
+	al.SetChannelManager(cm)
+
+	return al, msgBus, ch
+}
+
+func TestHandleInbound_StreamsReplyToEditableChannel(t *testing.T) {
+	al, msgBus, ch := newStreamingTestLoop(t, true)
+
+	al.handleInbound(context.Background(), bus.InboundMessage{
+		Channel:  "editable",
+		SenderID: "user1",
+		ChatID:   "chat1",
+		Content:  "hi",
+	})
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.sent) != 1 || ch.sent[0] != "Hello" {
+		t.Fatalf("expected the first delta to open the message, got %v", ch.sent)
+	}
+	if len(ch.edits) == 0 || ch.edits[len(ch.edits)-1] != "Hello, world" {
+		t.Fatalf("expected final edit with the full reply, got %v", ch.edits)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if msg, ok := msgBus.SubscribeOutbound(ctx); ok {
+		t.Fatalf("streamed reply must not be published again, got %q", msg.Content)
+	}
+}
+
+func TestHandleInbound_StreamingDisabledPublishesOnce(t *testing.T) {
+	al, msgBus, ch := newStreamingTestLoop(t, false)
+
+	al.handleInbound(context.Background(), bus.InboundMessage{
+		Channel:  "editable",
+		SenderID: "user1",
+		ChatID:   "chat1",
+		Content:  "hi",
+	})
+
+	ch.mu.Lock()
+	if len(ch.sent) != 0 || len(ch.edits) != 0 {
+		t.Fatalf("expected no direct channel writes, got sent=%v edits=%v", ch.sent, ch.edits)
+	}
+	ch.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || msg.Content != "Hello, world" || !msg.Final {
+		t.Fatalf("expected the final reply on the outbound bus, got %+v (ok=%v)", msg, ok)
+	}
+}
+
+// thinkingMockProvider calls a tool with signed reasoning, then answers.
+type thinkingMockProvider struct {
+	calls    [][]providers.Message
+	lastOpts map[string]any
+}
+
+func (m *thinkingMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls = append(m.calls, messages)
+	m.lastOpts = opts
+	if len(m.calls) == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "list_dir", Arguments: map[string]any{"path": "."}}},
+			Reasoning: "The user wants the files, so list the directory.",
+			Thinking:  []providers.ThinkingBlock{{Thinking: "list the directory", Signature: "sig"}},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "Nothing here.", FinishReason: "stop"}, nil
+}
+
+func (m *thinkingMockProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+type reasoningTestChannel struct {
+	editableTestChannel
+	reasoning []string
+}
+
+func (c *reasoningTestChannel) SendReasoning(ctx context.Context, chatID, summary string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reasoning = append(c.reasoning, summary)
+	return nil
+}
+
+func TestAgentLoop_ReasoningSettingsAndThinkingBlocks(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Reasoning:         config.ReasoningConfig{Effort: "high", Show: true},
+			},
+		},
+	}
+
+	msgBus := bus.NewMessageBus()
+	provider := &thinkingMockProvider{}
+	al := NewAgentLoop(cfg, msgBus, provider)
+	cm, err := channels.NewManager(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("Failed to create channel manager: %v", err)
+	}
+	ch := &reasoningTestChannel{editableTestChannel: editableTestChannel{
+		BaseChannel: channels.NewBaseChannel("thinking", nil, msgBus, nil),
+	}}
+	cm.RegisterChannel("thinking", ch)
+	al.SetChannelManager(cm)
+
+	if _, err := al.ProcessDirectWithChannel(context.Background(), "what files?", "s1", "thinking", "chat1"); err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+	}
+
+	if provider.lastOpts[providers.ReasoningEffortOption] != "high" {
+		t.Errorf("options = %v, want reasoning_effort high", provider.lastOpts)
+	}
+	if len(ch.reasoning) != 1 || ch.reasoning[0] != "The user wants the files, so list the directory." {
+		t.Errorf("reasoning sent = %v", ch.reasoning)
+	}
+
+	// The tool-calling turn goes back to the provider with its signed thinking
+	second := provider.calls[1]
+	var assistant *providers.Message
+	for i := range second {
+		if second[i].Role == "assistant" && len(second[i].ToolCalls) > 0 {
+			assistant = &second[i]
+		}
+	}
+	if assistant == nil || len(assistant.Thinking) != 1 || assistant.Thinking[0].Signature != "sig" {
+		t.Fatalf("assistant tool-call message = %+v", assistant)
+	}
+
+	agent, _ := al.GetAgent("")
+	persisted := false
+	for _, msg := range agent.Sessions.GetHistory("agent:main:main") {
+		if len(msg.Thinking) > 0 {
+			persisted = true
+		}
+	}
+	if !persisted {
+		t.Error("thinking blocks were not saved with the session")
+	}
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// defaultMaxParallelTools is used when agents.defaults.max_parallel_tools is unset.
+const defaultMaxParallelTools = 4
+
+// runToolCalls executes the tool calls of one LLM response, up to limit at a
+// time, and returns their results in call order. Calls that share a non-empty
+// serial key form a chain run one after another in call order; each chain and
+// each call without a key runs alongside the others. A call keyed
+// tools.SerialExclusive waits for the calls before it and runs alone.
+func runToolCalls(
+	ctx context.Context,
+	calls []providers.ToolCall,
+	limit int,
+	serialKey func(tc providers.ToolCall) string,
+	execute func(ctx context.Context, tc providers.ToolCall) *tools.ToolResult,
+) []*tools.ToolResult {
+	results := make([]*tools.ToolResult, len(calls))
+	if limit <= 1 || len(calls) <= 1 {
+		for i, tc := range calls {
+			results[i] = execute(ctx, tc)
+		}
+		return results
+	}
+
+	keys := make([]string, len(calls))
+	for i, tc := range calls {
+		keys[i] = serialKey(tc)
+	}
+	start := 0
+	for i := range calls {
+		if keys[i] != tools.SerialExclusive {
+			continue
+		}
+		runChains(ctx, calls, keys, start, i, limit, results, execute)
+		results[i] = execute(ctx, calls[i])
+		start = i + 1
+	}
+	runChains(ctx, calls, keys, start, len(calls), limit, results, execute)
+	return results
+}
+
+// runChains runs calls[from:to] as described for runToolCalls, storing
+// their results, and returns once all of them are done.
+func runChains(
+	ctx context.Context,
+	calls []providers.ToolCall,
+	keys []string,
+	from, to, limit int,
+	results []*tools.ToolResult,
+	execute func(ctx context.Context, tc providers.ToolCall) *tools.ToolResult,
+) {
+	var chains [][]int
+	chainOf := make(map[string]int)
+	for i := from; i < to; i++ {
+		key := keys[i]
+		if key == "" {
+			chains = append(chains, []int{i})
+			continue
+		}
+		if c, ok := chainOf[key]; ok {
+			chains[c] = append(chains[c], i)
+			continue
+		}
+		chainOf[key] = len(chains)
+		chains = append(chains, []int{i})
+	}
+
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, chain := range chains {
+		wg.Add(1)
+		go func(chain []int) {
+			defer wg.Done()
+			for _, i := range chain {
+				slots <- struct{}{}
+				results[i] = execute(ctx, calls[i])
+				<-slots
+			}
+		}(chain)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestRunToolCalls_ParallelInOrder(t *testing.T) {
+	calls := []providers.ToolCall{
+		{ID: "1", Name: "web_search"},
+		{ID: "2", Name: "edit_file", Arguments: map[string]any{"path": "a.md"}},
+		{ID: "3", Name: "web_search"},
+		{ID: "4", Name: "edit_file", Arguments: map[string]any{"path": "a.md"}},
+		{ID: "5", Name: "web_search"},
+		{ID: "6", Name: "edit_file", Arguments: map[string]any{"path": "b.md"}},
+	}
+	serialKey := func(tc providers.ToolCall) string {
+		if tc.Name == "edit_file" {
+			return "file:" + tc.Arguments["path"].(string)
+		}
+		return ""
+	}
+
+	var running, peak atomic.Int32
+	var mu sync.Mutex
+	var editOrder []string
+	results := runToolCalls(context.Background(), calls, 3, serialKey,
+		func(ctx context.Context, tc providers.ToolCall) *tools.ToolResult {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			if tc.Name == "edit_file" {
+				mu.Lock()
+				editOrder = append(editOrder, tc.ID)
+				mu.Unlock()
+			}
+			// Later calls finish first
+			id, _ := strconv.Atoi(tc.ID)
+			time.Sleep(time.Duration(7-id) * 5 * time.Millisecond)
+			return tools.NewToolResult("result " + tc.ID)
+		})
+
+	for i, r := range results {
+		if want := fmt.Sprintf("result %d", i+1); r.ForLLM != want {
+			t.Errorf("results[%d] = %q, want %q", i, r.ForLLM, want)
+		}
+	}
+	if p := peak.Load(); p < 2 || p > 3 {
+		t.Errorf("peak concurrency = %d, want between 2 and the limit of 3", p)
+	}
+	pos := map[string]int{}
+	for i, id := range editOrder {
+		pos[id] = i
+	}
+	if pos["2"] > pos["4"] {
+		t.Errorf("edits of a.md ran as %v, want call 2 before call 4", editOrder)
+	}
+}
+
+func TestRunToolCalls_LimitOneIsSequential(t *testing.T) {
+	calls := []providers.ToolCall{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	var order []string
+	runToolCalls(context.Background(), calls, 1,
+		func(providers.ToolCall) string { return "" },
+		func(ctx context.Context, tc providers.ToolCall) *tools.ToolResult {
+			order = append(order, tc.ID)
+			return tools.NewToolResult("")
+		})
+	if fmt.Sprint(order) != "[1 2 3]" {
+		t.Errorf("order = %v, want [1 2 3]", order)
+	}
+}
+
+func TestRunToolCalls_ExecRunsAloneAmongFileWrites(t *testing.T) {
+	workspace := t.TempDir()
+	registry := tools.NewToolRegistry()
+	registry.Register(tools.NewWriteFileTool(workspace, true))
+	registry.Register(tools.NewExecTool(workspace, true))
+
+	calls := []providers.ToolCall{
+		{ID: "1", Name: "write_file", Arguments: map[string]any{"path": "a.txt", "content": "one"}},
+		{ID: "2", Name: "write_file", Arguments: map[string]any{"path": "b.txt", "content": "two"}},
+		{ID: "3", Name: "exec", Arguments: map[string]any{"command": "cat a.txt b.txt"}},
+		{ID: "4", Name: "write_file", Arguments: map[string]any{"path": "a.txt", "content": "three"}},
+	}
+
+	var running atomic.Int32
+	var overlapped atomic.Bool
+	var mu sync.Mutex
+	var order []string
+	results := runToolCalls(context.Background(), calls, 4,
+		func(tc providers.ToolCall) string { return registry.SerialKey(tc.Name, tc.Arguments) },
+		func(ctx context.Context, tc providers.ToolCall) *tools.ToolResult {
+			n := running.Add(1)
+			defer running.Add(-1)
+			if tc.Name == "exec" && n > 1 {
+				overlapped.Store(true)
+			}
+			mu.Lock()
+			order = append(order, tc.ID)
+			mu.Unlock()
+			// Give a write that ignored the exec call time to overlap it
+			if tc.Name == "write_file" {
+				time.Sleep(10 * time.Millisecond)
+			}
+			result := registry.Execute(ctx, tc.Name, tc.Arguments)
+			if tc.Name == "exec" && running.Load() > 1 {
+				overlapped.Store(true)
+			}
+			return result
+		})
+
+	if overlapped.Load() {
+		t.Error("exec ran alongside a file write")
+	}
+	if fmt.Sprint(order[2:]) != "[3 4]" {
+		t.Errorf("order = %v, want the exec call after both earlier writes and before the later one", order)
+	}
+	if out := results[2].ForLLM; !strings.Contains(out, "onetwo") {
+		t.Errorf("exec output = %q, want the files as written before it", out)
+	}
+}
@@ -9,6 +9,7 @@ type MessageBus struct {
 	inbound  chan InboundMessage
 	outbound chan OutboundMessage
 	handlers map[string]MessageHandler
+	store    *durableStore // nil for the in-memory bus
 	closed   bool
 	mu       sync.RWMutex
 }
@@ -27,6 +28,9 @@ func (mb *MessageBus) PublishInbound(msg InboundMessage) {
 	if mb.closed {
 		return
 	}
+	if mb.store != nil && mb.store.publishInbound(msg) {
+		return
+	}
 	mb.inbound <- msg
 }
 
@@ -45,6 +49,9 @@ func (mb *MessageBus) PublishOutbound(msg OutboundMessage) {
 	if mb.closed {
 		return
 	}
+	if mb.store != nil && mb.store.publishOutbound(msg) {
+		return
+	}
 	mb.outbound <- msg
 }
 
@@ -77,6 +84,9 @@ func (mb *MessageBus) Close() {
 		return
 	}
 	mb.closed = true
+	if mb.store != nil {
+		mb.store.stop()
+	}
 	close(mb.inbound)
 	close(mb.outbound)
 }
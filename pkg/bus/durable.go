@@ -0,0 +1,386 @@
+package bus
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Message states in the bus_inbound and bus_outbound tables.
+const (
+	statusPending   = "pending"
+	statusInflight  = "inflight"
+	statusDone      = "done"
+	statusFailed    = "failed"
+	durableFeedSize = 20
+)
+
+var (
+	// durablePollInterval is how often the feeders look for due retries.
+	durablePollInterval = time.Second
+
+	// maxInboundAttempts stops replaying a message that was in flight this
+	// many times without being processed, e.g. because it crashes the process.
+	maxInboundAttempts = 3
+
+	// Outbound sends are retried with exponential backoff, starting at
+	// outboundRetryDelay and capped at outboundMaxRetryDelay.
+	maxOutboundAttempts   = 6
+	outboundRetryDelay    = 2 * time.Second
+	outboundMaxRetryDelay = 5 * time.Minute
+
+	// durableRetention is how long finished rows are kept before pruning.
+	durableRetention = 7 * 24 * time.Hour
+)
+
+// durableStore keeps bus messages in SQLite. Publishing only writes a row;
+// feeder goroutines move pending rows into the bus channels in order, so
+// publishers never block on a full buffer.
+type durableStore struct {
+	db             *utils.DB
+	inbound        chan<- InboundMessage
+	outbound       chan<- OutboundMessage
+	inboundNotify  chan struct{}
+	outboundNotify chan struct{}
+	done           chan struct{}
+	wg             sync.WaitGroup
+}
+
+// NewDurableMessageBus creates a message bus backed by the SQLite database.
+// Inbound messages are stored before they are acknowledged to the channel
+// and replayed on startup until AckInbound marks them processed; outbound
+// messages are retried with backoff when NackOutbound reports a failed send.
+func NewDurableMessageBus(db *utils.DB) (*MessageBus, error) {
+	mb := NewMessageBus()
+	store := &durableStore{
+		db:             db,
+		inbound:        mb.inbound,
+		outbound:       mb.outbound,
+		inboundNotify:  make(chan struct{}, 1),
+		outboundNotify: make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+	if err := store.recover(); err != nil {
+		return nil, err
+	}
+	mb.store = store
+
+	store.wg.Add(2)
+	go store.feed(store.inboundNotify, store.feedInbound)
+	go store.feed(store.outboundNotify, store.feedOutbound)
+	return mb, nil
+}
+
+// AckInbound marks a message as processed so it is not replayed. It is a
+// no-op on the in-memory bus.
+func (mb *MessageBus) AckInbound(msg InboundMessage) {
+	if mb.store == nil || msg.ID == 0 {
+		return
+	}
+	mb.store.setStatus("bus_inbound", msg.ID, statusDone)
+}
+
+// AckOutbound marks an outbound message as done, whether it was delivered
+// or given up on. It is a no-op on the in-memory bus.
+func (mb *MessageBus) AckOutbound(msg OutboundMessage) {
+	if mb.store == nil || msg.ID == 0 {
+		return
+	}
+	mb.store.setStatus("bus_outbound", msg.ID, statusDone)
+}
+
+// NackOutbound records a failed send and schedules a retry. It reports
+// whether the message will be retried; the in-memory bus never retries.
+func (mb *MessageBus) NackOutbound(msg OutboundMessage, sendErr error) bool {
+	if mb.store == nil || msg.ID == 0 {
+		return false
+	}
+	return mb.store.retryOutbound(msg, sendErr)
+}
+
+// RetryOutboundAfter records a failed send and hands msg back once delay
+// has passed, for callers that apply their own retry policy. Unlike
+// NackOutbound it never gives up; the caller acks the message when it does.
+// It reports whether the message will be retried; the in-memory bus never
+// retries.
+func (mb *MessageBus) RetryOutboundAfter(msg OutboundMessage, sendErr error, delay time.Duration) bool {
+	if mb.store == nil || msg.ID == 0 {
+		return false
+	}
+	return mb.store.scheduleRetry(msg, sendErr, msg.Attempt, delay)
+}
+
+// recover prepares the tables after a restart: messages that were in flight
+// when the process stopped become pending again, and old rows are pruned.
+func (s *durableStore) recover() error {
+	res, err := s.db.Exec(`UPDATE bus_inbound SET status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE status = ? AND attempts >= ?`, statusFailed, statusInflight, maxInboundAttempts)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logger.WarnCF("bus", "Giving up on inbound messages that failed repeatedly", map[string]any{
+			"count": n,
+		})
+	}
+
+	res, err = s.db.Exec(`UPDATE bus_inbound SET status = ? WHERE status = ?`, statusPending, statusInflight)
+	if err != nil {
+		return err
+	}
+	replayed, _ := res.RowsAffected()
+
+	if _, err := s.db.Exec(`UPDATE bus_outbound SET status = ? WHERE status = ?`, statusPending, statusInflight); err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-durableRetention).UTC().Format("2006-01-02 15:04:05")
+	for _, table := range []string{"bus_inbound", "bus_outbound"} {
+		if _, err := s.db.Exec(`DELETE FROM `+table+` WHERE status IN (?, ?) AND updated_at < ?`,
+			statusDone, statusFailed, cutoff); err != nil {
+			return err
+		}
+	}
+
+	var pending int
+	s.db.QueryRow(`SELECT COUNT(*) FROM bus_inbound WHERE status = ?`, statusPending).Scan(&pending)
+	if pending > 0 {
+		logger.InfoCF("bus", "Replaying unprocessed inbound messages", map[string]any{
+			"pending":     pending,
+			"interrupted": replayed,
+		})
+	}
+	return nil
+}
+
+func (s *durableStore) stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *durableStore) wake(notify chan struct{}) {
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+}
+
+// publishInbound stores msg. It reports false if the write failed, in which
+// case the caller delivers the message in memory only.
+func (s *durableStore) publishInbound(msg InboundMessage) bool {
+	payload, err := json.Marshal(msg)
+	if err == nil {
+		_, err = s.db.Exec(`INSERT INTO bus_inbound (payload, status) VALUES (?, ?)`, string(payload), statusPending)
+	}
+	if err != nil {
+		logger.ErrorCF("bus", "Failed to persist inbound message", map[string]any{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+		return false
+	}
+	s.wake(s.inboundNotify)
+	return true
+}
+
+func (s *durableStore) publishOutbound(msg OutboundMessage) bool {
+	payload, err := json.Marshal(msg)
+	if err == nil {
+		_, err = s.db.Exec(`INSERT INTO bus_outbound (payload, status, next_attempt_at) VALUES (?, ?, ?)`,
+			string(payload), statusPending, time.Now().UnixMilli())
+	}
+	if err != nil {
+		logger.ErrorCF("bus", "Failed to persist outbound message", map[string]any{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+		return false
+	}
+	s.wake(s.outboundNotify)
+	return true
+}
+
+// feed runs fn whenever it is notified of new rows, and periodically to
+// pick up due retries.
+func (s *durableStore) feed(notify chan struct{}, fn func() bool) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(durablePollInterval)
+	defer ticker.Stop()
+	for {
+		if !fn() {
+			return
+		}
+		select {
+		case <-s.done:
+			return
+		case <-notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// feedInbound hands pending inbound messages to the bus channel in arrival
+// order. It returns false once the store is stopped.
+func (s *durableStore) feedInbound() bool {
+	for {
+		rows, err := s.load(`SELECT id, payload, attempts FROM bus_inbound WHERE status = ? ORDER BY id LIMIT ?`,
+			statusPending, durableFeedSize)
+		if err != nil {
+			logger.ErrorCF("bus", "Failed to load inbound messages", map[string]any{"error": err.Error()})
+			return true
+		}
+		if len(rows) == 0 {
+			return true
+		}
+		for _, row := range rows {
+			var msg InboundMessage
+			if err := json.Unmarshal([]byte(row.payload), &msg); err != nil {
+				s.setStatus("bus_inbound", row.id, statusFailed)
+				continue
+			}
+			msg.ID = row.id
+			if err := s.markInflight("bus_inbound", row.id); err != nil {
+				logger.ErrorCF("bus", "Failed to update message status", map[string]any{"error": err.Error()})
+				return true
+			}
+			select {
+			case s.inbound <- msg:
+			case <-s.done:
+				return false
+			}
+		}
+	}
+}
+
+// feedOutbound hands outbound messages that are due to the bus channel.
+func (s *durableStore) feedOutbound() bool {
+	for {
+		rows, err := s.load(`SELECT id, payload, attempts FROM bus_outbound WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT ?`,
+			statusPending, time.Now().UnixMilli(), durableFeedSize)
+		if err != nil {
+			logger.ErrorCF("bus", "Failed to load outbound messages", map[string]any{"error": err.Error()})
+			return true
+		}
+		if len(rows) == 0 {
+			return true
+		}
+		for _, row := range rows {
+			var msg OutboundMessage
+			if err := json.Unmarshal([]byte(row.payload), &msg); err != nil {
+				s.setStatus("bus_outbound", row.id, statusFailed)
+				continue
+			}
+			msg.ID = row.id
+			msg.Attempt = row.attempts + 1
+			if err := s.markInflight("bus_outbound", row.id); err != nil {
+				logger.ErrorCF("bus", "Failed to update message status", map[string]any{"error": err.Error()})
+				return true
+			}
+			select {
+			case s.outbound <- msg:
+			case <-s.done:
+				return false
+			}
+		}
+	}
+}
+
+type durableRow struct {
+	id       int64
+	payload  string
+	attempts int // attempts before this one
+}
+
+// load returns the rows selected by query.
+func (s *durableStore) load(query string, args ...any) ([]durableRow, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []durableRow
+	for rows.Next() {
+		var row durableRow
+		if err := rows.Scan(&row.id, &row.payload, &row.attempts); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// markInflight records that a row is being handed out, counting the attempt.
+func (s *durableStore) markInflight(table string, id int64) error {
+	_, err := s.db.Exec(`UPDATE `+table+` SET status = ?, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, statusInflight, id)
+	return err
+}
+
+func (s *durableStore) setStatus(table string, id int64, status string) {
+	if _, err := s.db.Exec(`UPDATE `+table+` SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		status, id); err != nil {
+		logger.ErrorCF("bus", "Failed to update message status", map[string]any{
+			"table":  table,
+			"id":     id,
+			"status": status,
+			"error":  err.Error(),
+		})
+	}
+}
+
+func (s *durableStore) retryOutbound(msg OutboundMessage, sendErr error) bool {
+	var attempts int
+	if err := s.db.QueryRow(`SELECT attempts FROM bus_outbound WHERE id = ?`, msg.ID).Scan(&attempts); err != nil {
+		return false
+	}
+
+	errText := ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+
+	if attempts >= maxOutboundAttempts {
+		s.db.Exec(`UPDATE bus_outbound SET status = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+			statusFailed, errText, msg.ID)
+		logger.ErrorCF("bus", "Giving up on outbound message", map[string]any{
+			"channel":  msg.Channel,
+			"chat_id":  msg.ChatID,
+			"attempts": attempts,
+			"error":    errText,
+		})
+		return false
+	}
+
+	delay := outboundRetryDelay << (attempts - 1)
+	if delay <= 0 || delay > outboundMaxRetryDelay {
+		delay = outboundMaxRetryDelay
+	}
+	return s.scheduleRetry(msg, sendErr, attempts, delay)
+}
+
+// scheduleRetry makes a failed outbound message pending again once delay
+// has passed.
+func (s *durableStore) scheduleRetry(msg OutboundMessage, sendErr error, attempts int, delay time.Duration) bool {
+	errText := ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+
+	next := time.Now().Add(delay)
+	if _, err := s.db.Exec(`UPDATE bus_outbound SET status = ?, next_attempt_at = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, statusPending, next.UnixMilli(), errText, msg.ID); err != nil {
+		return false
+	}
+	logger.WarnCF("bus", "Outbound message will be retried", map[string]any{
+		"channel":  msg.Channel,
+		"chat_id":  msg.ChatID,
+		"attempt":  attempts,
+		"retry_in": delay.String(),
+	})
+	return true
+}
@@ -0,0 +1,220 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+func openTestDB(t *testing.T, dir string) *utils.DB {
+	t.Helper()
+	db, err := utils.InitDB(filepath.Join(dir, "picoclaw.db"))
+	if err != nil {
+		t.Fatalf("InitDB() error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestDurableBus(t *testing.T, dir string) *MessageBus {
+	t.Helper()
+	mb, err := NewDurableMessageBus(openTestDB(t, dir))
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus() error: %v", err)
+	}
+	t.Cleanup(mb.Close)
+	return mb
+}
+
+func consume(t *testing.T, mb *MessageBus) InboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	return msg
+}
+
+func expectNoInbound(t *testing.T, mb *MessageBus) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if msg, ok := mb.ConsumeInbound(ctx); ok {
+		t.Fatalf("unexpected inbound message: %+v", msg)
+	}
+}
+
+func TestDurableBus_ReplaysUnacknowledgedInbound(t *testing.T) {
+	dir := t.TempDir()
+	mb := newTestDurableBus(t, dir)
+
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "first"})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "second"})
+
+	first := consume(t, mb)
+	if first.Content != "first" || first.ID == 0 {
+		t.Fatalf("unexpected message: %+v", first)
+	}
+	mb.AckInbound(first)
+	second := consume(t, mb)
+	if second.Content != "second" {
+		t.Fatalf("messages out of order: %+v", second)
+	}
+
+	// Simulate a crash before the second message is processed.
+	mb.Close()
+
+	restarted := newTestDurableBus(t, dir)
+	replayed := consume(t, restarted)
+	if replayed.Content != "second" || replayed.ID != second.ID {
+		t.Fatalf("replayed %+v, want the unacknowledged message", replayed)
+	}
+	restarted.AckInbound(replayed)
+	expectNoInbound(t, restarted)
+}
+
+func TestDurableBus_GivesUpOnRepeatedlyInterruptedInbound(t *testing.T) {
+	dir := t.TempDir()
+	mb := newTestDurableBus(t, dir)
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "crashes"})
+	consume(t, mb)
+	mb.Close()
+
+	for i := 1; i < maxInboundAttempts; i++ {
+		mb = newTestDurableBus(t, dir)
+		consume(t, mb)
+		mb.Close()
+	}
+
+	mb = newTestDurableBus(t, dir)
+	expectNoInbound(t, mb)
+}
+
+func TestDurableBus_PublishDoesNotBlockOnFullBuffer(t *testing.T) {
+	mb := newTestDurableBus(t, t.TempDir())
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 150; i++ {
+			mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("PublishInbound blocked with a full buffer")
+	}
+
+	for i := 0; i < 150; i++ {
+		mb.AckInbound(consume(t, mb))
+	}
+}
+
+func TestDurableBus_RetriesFailedOutbound(t *testing.T) {
+	oldDelay, oldPoll, oldMax := outboundRetryDelay, durablePollInterval, maxOutboundAttempts
+	outboundRetryDelay, durablePollInterval, maxOutboundAttempts = 10*time.Millisecond, 10*time.Millisecond, 2
+	t.Cleanup(func() {
+		outboundRetryDelay, durablePollInterval, maxOutboundAttempts = oldDelay, oldPoll, oldMax
+	})
+
+	mb := newTestDurableBus(t, t.TempDir())
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1", Content: "hello"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg, ok := mb.SubscribeOutbound(ctx)
+	if !ok {
+		t.Fatal("no outbound message")
+	}
+	if !mb.NackOutbound(msg, errors.New("connection reset")) {
+		t.Fatal("first failure should be retried")
+	}
+
+	retry, ok := mb.SubscribeOutbound(ctx)
+	if !ok || retry.ID != msg.ID || retry.Content != "hello" {
+		t.Fatalf("retry = %+v, want message %d again", retry, msg.ID)
+	}
+	if mb.NackOutbound(retry, errors.New("connection reset")) {
+		t.Fatal("message retried beyond maxOutboundAttempts")
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	if extra, ok := mb.SubscribeOutbound(short); ok {
+		t.Fatalf("unexpected outbound message after giving up: %+v", extra)
+	}
+}
+
+func TestDurableBus_ReplaysUndeliveredOutbound(t *testing.T) {
+	dir := t.TempDir()
+	mb := newTestDurableBus(t, dir)
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1", Content: "delivered"})
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1", Content: "interrupted"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	delivered, ok := mb.SubscribeOutbound(ctx)
+	if !ok || delivered.Content != "delivered" {
+		t.Fatalf("unexpected outbound message: %+v", delivered)
+	}
+	mb.AckOutbound(delivered)
+	if _, ok := mb.SubscribeOutbound(ctx); !ok {
+		t.Fatal("no second outbound message")
+	}
+	mb.Close()
+
+	restarted := newTestDurableBus(t, dir)
+	replayed, ok := restarted.SubscribeOutbound(ctx)
+	if !ok || replayed.Content != "interrupted" {
+		t.Fatalf("replayed %+v, want the unacknowledged message", replayed)
+	}
+}
+
+func TestDurableBus_RetryOutboundAfterCountsAttempts(t *testing.T) {
+	oldPoll := durablePollInterval
+	durablePollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { durablePollInterval = oldPoll })
+
+	mb := newTestDurableBus(t, t.TempDir())
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1", Content: "hello"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg, ok := mb.SubscribeOutbound(ctx)
+	if !ok || msg.Attempt != 1 {
+		t.Fatalf("first delivery = %+v, want attempt 1", msg)
+	}
+	for want := 2; want <= maxOutboundAttempts+1; want++ {
+		if !mb.RetryOutboundAfter(msg, errors.New("connection reset"), 10*time.Millisecond) {
+			t.Fatal("RetryOutboundAfter should always retry on the durable bus")
+		}
+		msg, ok = mb.SubscribeOutbound(ctx)
+		if !ok || msg.Attempt != want || msg.Content != "hello" {
+			t.Fatalf("retry = %+v, want attempt %d", msg, want)
+		}
+	}
+	mb.AckOutbound(msg)
+
+	if NewMessageBus().RetryOutboundAfter(OutboundMessage{Channel: "slack"}, errors.New("fail"), time.Millisecond) {
+		t.Error("in-memory bus should not retry")
+	}
+}
+
+func TestInMemoryBus_AcksAreNoOps(t *testing.T) {
+	mb := NewMessageBus()
+	mb.AckInbound(InboundMessage{})
+	mb.AckOutbound(OutboundMessage{})
+	if mb.NackOutbound(OutboundMessage{Channel: "slack"}, errors.New("fail")) {
+		t.Error("in-memory bus should not retry")
+	}
+}
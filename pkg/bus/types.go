@@ -1,6 +1,7 @@
 package bus
 
 type InboundMessage struct {
+	ID         int64             `json:"-"` // row ID in the durable bus, 0 otherwise
 	Channel    string            `json:"channel"`
 	SenderID   string            `json:"sender_id"`
 	ChatID     string            `json:"chat_id"`
@@ -11,9 +12,20 @@ type InboundMessage struct {
 }
 
 type OutboundMessage struct {
+	ID      int64  `json:"-"` // row ID in the durable bus, 0 otherwise
+	Attempt int    `json:"-"` // delivery attempt counted by the durable bus, 0 otherwise
 	Channel string `json:"channel"`
 	ChatID  string `json:"chat_id"`
 	Content string `json:"content"`
+	// Media holds paths of local files to attach. Channels that cannot
+	// send files deliver the text only.
+	Media []string `json:"media,omitempty"`
+	// Final marks the reply that ends an agent turn. Notices, approval
+	// prompts and message tool output sent while the turn runs are not final.
+	Final bool `json:"final,omitempty"`
+	// Answered marks a final reply to a chat the message tool has already
+	// answered. Only channels that wait for the end of a turn send it.
+	Answered bool `json:"answered,omitempty"`
 }
 
 type MessageHandler func(InboundMessage) error
@@ -0,0 +1,146 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ApprovalPrompt asks the user to approve or deny a tool call.
+type ApprovalPrompt struct {
+	ID      string
+	Summary string // what is about to run and why it needs approval
+	// Answerers are the sender IDs that may answer; empty means anyone the
+	// channel accepts messages from.
+	Answerers []string
+}
+
+// ApprovalPrompter is implemented by channels that show approve and deny
+// buttons. A press comes back as an inbound message with the content of
+// ApprovalReply and the request ID in the "approval_id" metadata.
+type ApprovalPrompter interface {
+	SendApprovalPrompt(ctx context.Context, chatID string, prompt ApprovalPrompt) error
+}
+
+const (
+	approvalTitle        = "🔐 Approval needed"
+	approvalActionPrefix = "approval:"
+)
+
+// Text renders the prompt for channels without buttons, which are answered
+// by replying with a keyword.
+func (p ApprovalPrompt) Text() string {
+	return fmt.Sprintf("%s\n%s\n\nReply \"approve %s\" or \"deny %s\".", approvalTitle, p.Summary, p.ID, p.ID)
+}
+
+// ApprovalReply is the message content that answers the request id.
+func ApprovalReply(id string, approve bool) string {
+	if approve {
+		return "approve " + id
+	}
+	return "deny " + id
+}
+
+// approvalAction is the button payload that answers the request id.
+func approvalAction(id string, approve bool) string {
+	return approvalActionPrefix + ApprovalReply(id, approve)
+}
+
+// parseApprovalAction reverses approvalAction.
+func parseApprovalAction(data string) (id string, approve, ok bool) {
+	verb, id, found := strings.Cut(strings.TrimPrefix(data, approvalActionPrefix), " ")
+	if !strings.HasPrefix(data, approvalActionPrefix) || !found || id == "" {
+		return "", false, false
+	}
+	switch verb {
+	case "approve":
+		return id, true, true
+	case "deny":
+		return id, false, true
+	}
+	return "", false, false
+}
+
+// MayAnswerApproval reports whether senderID is one of answerers, or
+// answerers is empty. Compound "id|username" IDs match on their ID part.
+func MayAnswerApproval(senderID string, answerers []string) bool {
+	if len(answerers) == 0 {
+		return true
+	}
+	id, _, _ := strings.Cut(senderID, "|")
+	for _, answerer := range answerers {
+		answererID, _, _ := strings.Cut(answerer, "|")
+		if senderID == answerer || (id != "" && id == answererID) {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalGate remembers who may answer the prompts a channel showed with
+// buttons, so a press by anyone else is turned away before the prompt is
+// marked as answered.
+type approvalGate struct {
+	answerers sync.Map // prompt ID -> []string
+}
+
+func (g *approvalGate) remember(prompt ApprovalPrompt) {
+	if len(prompt.Answerers) > 0 {
+		g.answerers.Store(prompt.ID, prompt.Answerers)
+	}
+}
+
+// allow reports whether senderID may answer prompt id, and forgets the
+// prompt once they have.
+func (g *approvalGate) allow(id, senderID string) bool {
+	answerers, ok := g.answerers.Load(id)
+	if !ok {
+		return true
+	}
+	if !MayAnswerApproval(senderID, answerers.([]string)) {
+		return false
+	}
+	g.answerers.Delete(id)
+	return true
+}
+
+// approvalOutcome is the line added to a prompt once it has been answered.
+func approvalOutcome(approve bool, by string) string {
+	if approve {
+		return "✅ Approved by " + by
+	}
+	return "❌ Denied by " + by
+}
+
+// SendApprovalPrompt shows prompt in chatID on the named channel, with
+// buttons where the channel has them and as a keyword prompt otherwise.
+func (m *Manager) SendApprovalPrompt(ctx context.Context, channelName, chatID string, prompt ApprovalPrompt) error {
+	m.mu.RLock()
+	ch, exists := m.channels[channelName]
+	m.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("channel %s not found", channelName)
+	}
+
+	if prompter, ok := ch.(ApprovalPrompter); ok {
+		err := prompter.SendApprovalPrompt(ctx, chatID, prompt)
+		if err == nil {
+			return nil
+		}
+		logger.WarnCF("channels", "Failed to send approval buttons, asking for a reply instead", map[string]any{
+			"channel": channelName,
+			"error":   err.Error(),
+		})
+	}
+
+	m.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channelName,
+		ChatID:  chatID,
+		Content: prompt.Text(),
+	})
+	return nil
+}
@@ -0,0 +1,50 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApprovalAction_RoundTrip(t *testing.T) {
+	for _, approve := range []bool{true, false} {
+		data := approvalAction("a1b2c3", approve)
+		if len(data) > 64 {
+			t.Errorf("%q exceeds Telegram's 64 byte callback data limit", data)
+		}
+		id, gotApprove, ok := parseApprovalAction(data)
+		if !ok || id != "a1b2c3" || gotApprove != approve {
+			t.Errorf("parseApprovalAction(%q) = %q, %v, %v", data, id, gotApprove, ok)
+		}
+	}
+
+	for _, data := range []string{"", "approval:", "approval:approve", "approval:maybe x", "other:approve x"} {
+		if _, _, ok := parseApprovalAction(data); ok {
+			t.Errorf("parseApprovalAction(%q) should fail", data)
+		}
+	}
+
+	prompt := ApprovalPrompt{ID: "a1b2c3", Summary: "Tool: exec"}
+	if text := prompt.Text(); !strings.Contains(text, `"approve a1b2c3"`) || !strings.Contains(text, "Tool: exec") {
+		t.Errorf("Text() = %q, want the summary and reply keywords", text)
+	}
+}
+
+func TestApprovalGate_OnlyAnswerersMayPress(t *testing.T) {
+	var gate approvalGate
+	gate.remember(ApprovalPrompt{ID: "a1", Answerers: []string{"42|alice", "7"}})
+	gate.remember(ApprovalPrompt{ID: "b2"})
+
+	if gate.allow("a1", "99") {
+		t.Error("a press by another group member was allowed")
+	}
+	if !gate.allow("a1", "42") {
+		t.Error("the requester's press was refused")
+	}
+	if !gate.allow("b2", "99") {
+		t.Error("a prompt without answerers should take any press")
+	}
+
+	if !MayAnswerApproval("7|bob", []string{"7"}) || MayAnswerApproval("8", []string{"7"}) {
+		t.Error("MayAnswerApproval should match on the ID part")
+	}
+}
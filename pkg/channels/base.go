@@ -16,6 +16,13 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// TurnWaiter is implemented by channels that hold a request open until the
+// agent's turn ends. They are sent the final reply even when the message
+// tool has already answered the chat.
+type TurnWaiter interface {
+	WaitsForTurnEnd()
+}
+
 type BaseChannel struct {
 	config    any
 	bus       *bus.MessageBus
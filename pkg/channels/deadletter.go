@@ -0,0 +1,198 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// ErrDeadLetterNotFound is returned when resending an unknown dead letter.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is an outbound message that could not be delivered.
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Channel  string    `json:"channel"`
+	ChatID   string    `json:"chat_id"`
+	Content  string    `json:"content"`
+	Media    []string  `json:"media,omitempty"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// Message returns the outbound message to send again.
+func (d DeadLetter) Message() bus.OutboundMessage {
+	return bus.OutboundMessage{
+		Channel: d.Channel,
+		ChatID:  d.ChatID,
+		Content: d.Content,
+		Media:   d.Media,
+	}
+}
+
+// DeadLetterStore keeps undeliverable messages in a JSON file. The file is
+// read on every call, so the gateway and the CLI can share it.
+type DeadLetterStore struct {
+	path string
+	max  int
+	mu   sync.Mutex
+}
+
+// NewDeadLetterStore creates a store at path holding at most max entries;
+// the oldest are dropped first. max <= 0 means no limit.
+func NewDeadLetterStore(path string, max int) *DeadLetterStore {
+	return &DeadLetterStore{path: path, max: max}
+}
+
+// Add records msg as undeliverable after the given number of attempts.
+func (s *DeadLetterStore) Add(msg bus.OutboundMessage, sendErr error, attempts int) (DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters, err := s.load()
+	if err != nil {
+		return DeadLetter{}, err
+	}
+
+	letter := DeadLetter{
+		ID:       uuid.NewString()[:8],
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		Content:  msg.Content,
+		Media:    msg.Media,
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+	if sendErr != nil {
+		letter.Error = sendErr.Error()
+	}
+	letters = append(letters, letter)
+	if s.max > 0 && len(letters) > s.max {
+		letters = letters[len(letters)-s.max:]
+	}
+	return letter, s.save(letters)
+}
+
+// List returns all dead letters, oldest first.
+func (s *DeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Get returns the dead letter with the given ID.
+func (s *DeadLetterStore) Get(id string) (DeadLetter, bool, error) {
+	letters, err := s.List()
+	if err != nil {
+		return DeadLetter{}, false, err
+	}
+	for _, letter := range letters {
+		if letter.ID == id {
+			return letter, true, nil
+		}
+	}
+	return DeadLetter{}, false, nil
+}
+
+// Update replaces the stored entry with the same ID.
+func (s *DeadLetterStore) Update(letter DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range letters {
+		if letters[i].ID == letter.ID {
+			letters[i] = letter
+			return s.save(letters)
+		}
+	}
+	return fmt.Errorf("dead letter %s not found", letter.ID)
+}
+
+// Remove deletes the dead letter with the given ID and reports whether it
+// existed.
+func (s *DeadLetterStore) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	for i := range letters {
+		if letters[i].ID == id {
+			return true, s.save(append(letters[:i], letters[i+1:]...))
+		}
+	}
+	return false, nil
+}
+
+// Clear deletes all dead letters and returns how many there were.
+func (s *DeadLetterStore) Clear() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	return len(letters), s.save(nil)
+}
+
+func (s *DeadLetterStore) load() ([]DeadLetter, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var letters []DeadLetter
+	if err := json.Unmarshal(data, &letters); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+func (s *DeadLetterStore) save(letters []DeadLetter) error {
+	if letters == nil {
+		letters = []DeadLetter{}
+	}
+	data, err := json.MarshalIndent(letters, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tempFile := s.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, s.path); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
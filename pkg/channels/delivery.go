@@ -0,0 +1,347 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mymmrac/telego/telegoapi"
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// deliveryQueueSize bounds the messages waiting per channel while an earlier
+// one is being retried.
+const deliveryQueueSize = 100
+
+// errDeliveryQueueFull is recorded for messages dead-lettered because their
+// channel's queue was full.
+var errDeliveryQueueFull = errors.New("delivery queue full")
+
+// RetryAfterError lets a channel ask for a retry no sooner than After, e.g.
+// when the platform rate-limits the bot.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// PermanentError marks a send failure that retrying cannot fix, such as an
+// unknown chat or a bot that was blocked.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// DeliveryStats counts outbound delivery results for one channel.
+type DeliveryStats struct {
+	Sent         int64     `json:"sent"`
+	Failed       int64     `json:"failed"`  // failed send attempts
+	Retried      int64     `json:"retried"` // attempts scheduled again
+	DeadLettered int64     `json:"dead_lettered"`
+	Queued       int       `json:"queued"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastErrorAt  time.Time `json:"last_error_at,omitzero"`
+}
+
+type deliveryCounters struct {
+	sent, failed, retried, deadLettered atomic.Int64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func (c *deliveryCounters) recordError(err error) {
+	c.failed.Add(1)
+	c.mu.Lock()
+	c.lastError = err.Error()
+	c.lastErrorAt = time.Now()
+	c.mu.Unlock()
+}
+
+// deliveryQueue sends one channel's messages in order, so retries on one
+// channel never hold up the others.
+type deliveryQueue struct {
+	name     string
+	messages chan bus.OutboundMessage
+	counters *deliveryCounters
+}
+
+// retryHint classifies a send error. It returns the platform's requested
+// delay, if any, and whether the send should be retried at all.
+func retryHint(err error) (time.Duration, bool) {
+	var retryAfter *RetryAfterError
+	if errors.As(err, &retryAfter) {
+		return retryAfter.After, true
+	}
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return 0, false
+	}
+
+	var tgErr *telegoapi.Error
+	if errors.As(err, &tgErr) {
+		if tgErr.ErrorCode == http.StatusTooManyRequests {
+			if tgErr.Parameters != nil {
+				return time.Duration(tgErr.Parameters.RetryAfter) * time.Second, true
+			}
+			return 0, true
+		}
+		return 0, tgErr.ErrorCode >= 500
+	}
+
+	var slackRateLimit *slack.RateLimitedError
+	if errors.As(err, &slackRateLimit) {
+		return slackRateLimit.RetryAfter, true
+	}
+
+	var discordRateLimit *discordgo.RateLimitError
+	if errors.As(err, &discordRateLimit) {
+		return discordRateLimit.RetryAfter, true
+	}
+	var discordErr *discordgo.RESTError
+	if errors.As(err, &discordErr) && discordErr.Response != nil {
+		code := discordErr.Response.StatusCode
+		return 0, code == http.StatusTooManyRequests || code >= 500
+	}
+
+	return 0, true
+}
+
+// retryDelay returns the backoff before the attempt following the given one.
+func retryDelay(policy config.RetryPolicy, attempt int, hint time.Duration) time.Duration {
+	base := time.Duration(policy.BaseDelay) * time.Second
+	maxDelay := time.Duration(policy.MaxDelay) * time.Second
+	delay := base << (attempt - 1)
+	if delay < base || (maxDelay > 0 && delay > maxDelay) {
+		delay = maxDelay
+	}
+	if hint > delay {
+		delay = hint
+	}
+	return delay
+}
+
+// enqueue hands msg to the channel's delivery queue, starting it if needed.
+func (m *Manager) enqueue(ctx context.Context, name string, msg bus.OutboundMessage) {
+	m.deliveryMu.Lock()
+	q, ok := m.queues[name]
+	if !ok {
+		q = &deliveryQueue{
+			name:     name,
+			messages: make(chan bus.OutboundMessage, deliveryQueueSize),
+			counters: m.countersFor(name),
+		}
+		m.queues[name] = q
+		go m.runQueue(ctx, q)
+	}
+	m.deliveryMu.Unlock()
+
+	// Never block the dispatcher: a channel that is stuck retrying must not
+	// hold up the others.
+	select {
+	case q.messages <- msg:
+	default:
+		m.deadLetter(q, msg, errDeliveryQueueFull, 0)
+	}
+}
+
+func (m *Manager) runQueue(ctx context.Context, q *deliveryQueue) {
+	for {
+		select {
+		case <-ctx.Done():
+			m.deliveryMu.Lock()
+			if m.queues[q.name] == q {
+				delete(m.queues, q.name)
+			}
+			m.deliveryMu.Unlock()
+			return
+		case msg := <-q.messages:
+			m.deliver(ctx, q, msg)
+		}
+	}
+}
+
+// deliver sends msg, retrying per the channel's policy. Messages that still
+// fail are moved to the dead-letter store.
+func (m *Manager) deliver(ctx context.Context, q *deliveryQueue, msg bus.OutboundMessage) {
+	policy := m.config.Channels.Delivery.PolicyFor(q.name)
+
+	// Messages the durable bus hands back for a retry carry their attempt.
+	for attempt := max(msg.Attempt, 1); ; attempt++ {
+		m.mu.RLock()
+		channel, exists := m.channels[q.name]
+		m.mu.RUnlock()
+		if !exists {
+			m.deadLetter(q, msg, fmt.Errorf("channel %s is not enabled", q.name), attempt-1)
+			return
+		}
+
+		err := channel.Send(ctx, msg)
+		if err == nil {
+			q.counters.sent.Add(1)
+			m.bus.AckOutbound(msg)
+			return
+		}
+		if ctx.Err() != nil {
+			// Shutting down; the durable bus resends on restart.
+			return
+		}
+		q.counters.recordError(err)
+
+		hint, retryable := retryHint(err)
+		if !retryable || attempt >= policy.MaxAttempts {
+			m.deadLetter(q, msg, err, attempt)
+			return
+		}
+
+		delay := retryDelay(policy, attempt, hint)
+		q.counters.retried.Add(1)
+		logger.WarnCF("channels", "Send failed, retrying", map[string]any{
+			"channel": q.name,
+			"chat_id": msg.ChatID,
+			"attempt": attempt,
+			"delay":   delay.String(),
+			"error":   err.Error(),
+		})
+
+		// The durable bus keeps the retry across restarts and hands the
+		// message back when it is due, so the queue moves on meanwhile.
+		if m.bus.RetryOutboundAfter(msg, err, delay) {
+			return
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (m *Manager) deadLetter(q *deliveryQueue, msg bus.OutboundMessage, err error, attempts int) {
+	q.counters.deadLettered.Add(1)
+	m.bus.AckOutbound(msg)
+
+	letter, storeErr := m.deadLetters.Add(msg, err, attempts)
+	if storeErr != nil {
+		logger.ErrorCF("channels", "Message undeliverable and could not be saved", map[string]any{
+			"channel":     q.name,
+			"chat_id":     msg.ChatID,
+			"error":       err.Error(),
+			"store_error": storeErr.Error(),
+		})
+		return
+	}
+	logger.ErrorCF("channels", "Message undeliverable, moved to dead letters", map[string]any{
+		"channel":  q.name,
+		"chat_id":  msg.ChatID,
+		"attempts": attempts,
+		"id":       letter.ID,
+		"error":    err.Error(),
+	})
+}
+
+func (m *Manager) countersFor(name string) *deliveryCounters {
+	c, ok := m.counters[name]
+	if !ok {
+		c = &deliveryCounters{}
+		m.counters[name] = c
+	}
+	return c
+}
+
+// DeadLetters returns the store of messages that could not be delivered.
+func (m *Manager) DeadLetters() *DeadLetterStore {
+	return m.deadLetters
+}
+
+// Resend tries to deliver a dead letter once more. On success the entry is
+// removed; otherwise it is kept with the new error.
+func (m *Manager) Resend(ctx context.Context, id string) error {
+	letter, ok, err := m.deadLetters.Get(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrDeadLetterNotFound
+	}
+
+	m.mu.RLock()
+	channel, exists := m.channels[letter.Channel]
+	m.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("channel %s is not enabled", letter.Channel)
+	}
+
+	m.deliveryMu.Lock()
+	counters := m.countersFor(letter.Channel)
+	m.deliveryMu.Unlock()
+
+	if err := channel.Send(ctx, letter.Message()); err != nil {
+		counters.recordError(err)
+		letter.Attempts++
+		letter.Error = err.Error()
+		letter.FailedAt = time.Now()
+		if updateErr := m.deadLetters.Update(letter); updateErr != nil {
+			logger.ErrorCF("channels", "Failed to update dead letter", map[string]any{
+				"id":    id,
+				"error": updateErr.Error(),
+			})
+		}
+		return err
+	}
+
+	counters.sent.Add(1)
+	_, err = m.deadLetters.Remove(id)
+	logger.InfoCF("channels", "Dead letter resent", map[string]any{
+		"id":      id,
+		"channel": letter.Channel,
+	})
+	return err
+}
+
+// DeliveryStats returns delivery counters per channel.
+func (m *Manager) DeliveryStats() map[string]DeliveryStats {
+	m.deliveryMu.Lock()
+	defer m.deliveryMu.Unlock()
+
+	stats := make(map[string]DeliveryStats, len(m.counters))
+	for name, c := range m.counters {
+		c.mu.Lock()
+		s := DeliveryStats{
+			Sent:         c.sent.Load(),
+			Failed:       c.failed.Load(),
+			Retried:      c.retried.Load(),
+			DeadLettered: c.deadLettered.Load(),
+			LastError:    c.lastError,
+			LastErrorAt:  c.lastErrorAt,
+		}
+		c.mu.Unlock()
+		if q, ok := m.queues[name]; ok {
+			s.Queued = len(q.messages)
+		}
+		stats[name] = s
+	}
+	return stats
+}
@@ -0,0 +1,259 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego/telegoapi"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// flakyChannel fails sends with the queued errors, then succeeds.
+type flakyChannel struct {
+	*BaseChannel
+	mu    sync.Mutex
+	errs  []error
+	sends []time.Time
+	sent  []string
+}
+
+func (c *flakyChannel) Start(ctx context.Context) error { return nil }
+func (c *flakyChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *flakyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sends = append(c.sends, time.Now())
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	c.sent = append(c.sent, msg.Content)
+	return nil
+}
+
+func newDeliveryTestManager(t *testing.T, policy config.RetryPolicy, errs ...error) (*Manager, *bus.MessageBus, *flakyChannel) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Channels.Delivery.Retry = policy
+
+	msgBus := bus.NewMessageBus()
+	m, err := NewManager(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("flaky", nil, msgBus, nil), errs: errs}
+	m.RegisterChannel("flaky", ch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go m.dispatchOutbound(ctx)
+	return m, msgBus, ch
+}
+
+func waitForDelivery(t *testing.T, m *Manager, cond func(DeliveryStats) bool) DeliveryStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := m.DeliveryStats()["flaky"]
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out, stats = %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDelivery_RetriesUntilSent(t *testing.T) {
+	m, msgBus, ch := newDeliveryTestManager(t, config.RetryPolicy{MaxAttempts: 3},
+		errors.New("connection reset"), errors.New("connection reset"))
+
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "hello"})
+
+	stats := waitForDelivery(t, m, func(s DeliveryStats) bool { return s.Sent == 1 })
+	if stats.Failed != 2 || stats.Retried != 2 || stats.DeadLettered != 0 {
+		t.Errorf("stats = %+v, want 2 failed and retried", stats)
+	}
+	if stats.LastError != "connection reset" {
+		t.Errorf("LastError = %q", stats.LastError)
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.sent) != 1 || ch.sent[0] != "hello" {
+		t.Errorf("sent = %v", ch.sent)
+	}
+}
+
+func TestDelivery_DurableBusRetriesWithoutHoldingTheQueue(t *testing.T) {
+	db, err := utils.InitDB(filepath.Join(t.TempDir(), "picoclaw.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	msgBus, err := bus.NewDurableMessageBus(db)
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus: %v", err)
+	}
+	t.Cleanup(func() {
+		msgBus.Close()
+		db.Close()
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Channels.Delivery.Retry = config.RetryPolicy{MaxAttempts: 3, BaseDelay: 1}
+	m, err := NewManager(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewManager() error: %v", err)
+	}
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("flaky", nil, msgBus, nil), errs: []error{errors.New("connection reset")}}
+	m.RegisterChannel("flaky", ch)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go m.dispatchOutbound(ctx)
+
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "first"})
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "second"})
+
+	stats := waitForDelivery(t, m, func(s DeliveryStats) bool { return s.Sent == 2 })
+	if stats.Retried != 1 || stats.DeadLettered != 0 {
+		t.Errorf("stats = %+v, want one retry", stats)
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.sent) != 2 || ch.sent[0] != "second" || ch.sent[1] != "first" {
+		t.Errorf("sent = %v, want the second message delivered while the first waited", ch.sent)
+	}
+}
+
+func TestDelivery_HonorsRetryAfter(t *testing.T) {
+	rateLimited := &telegoapi.Error{
+		ErrorCode:   429,
+		Description: "Too Many Requests",
+		Parameters:  &telegoapi.ResponseParameters{RetryAfter: 1},
+	}
+	m, msgBus, ch := newDeliveryTestManager(t, config.RetryPolicy{MaxAttempts: 2}, rateLimited)
+
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "hello"})
+	waitForDelivery(t, m, func(s DeliveryStats) bool { return s.Sent == 1 })
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if gap := ch.sends[1].Sub(ch.sends[0]); gap < time.Second {
+		t.Errorf("retried after %v, want at least the 1s retry-after", gap)
+	}
+}
+
+func TestDelivery_DeadLettersAndResend(t *testing.T) {
+	m, msgBus, ch := newDeliveryTestManager(t, config.RetryPolicy{MaxAttempts: 5},
+		&PermanentError{Err: errors.New("chat not found")})
+
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "lost"})
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "next"})
+
+	stats := waitForDelivery(t, m, func(s DeliveryStats) bool { return s.Sent == 1 })
+	if stats.DeadLettered != 1 || stats.Retried != 0 {
+		t.Errorf("stats = %+v, want one dead letter without retries", stats)
+	}
+
+	letters, err := m.DeadLetters().List()
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("List() = %v, %v", letters, err)
+	}
+	letter := letters[0]
+	if letter.Content != "lost" || letter.ChatID != "c1" || letter.Attempts != 1 || letter.Error != "chat not found" {
+		t.Errorf("unexpected dead letter: %+v", letter)
+	}
+
+	if err := m.Resend(context.Background(), letter.ID); err != nil {
+		t.Fatalf("Resend() error: %v", err)
+	}
+	if letters, _ := m.DeadLetters().List(); len(letters) != 0 {
+		t.Errorf("dead letter kept after resend: %v", letters)
+	}
+	if err := m.Resend(context.Background(), letter.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Resend() of removed entry = %v, want ErrDeadLetterNotFound", err)
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.sent) != 2 || ch.sent[1] != "lost" {
+		t.Errorf("sent = %v, want the resent message last", ch.sent)
+	}
+}
+
+func TestDelivery_SkipsAnsweredReplies(t *testing.T) {
+	m, msgBus, ch := newDeliveryTestManager(t, config.RetryPolicy{MaxAttempts: 1})
+
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "again", Final: true, Answered: true})
+	msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "next", Final: true})
+	waitForDelivery(t, m, func(s DeliveryStats) bool { return s.Sent == 1 })
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.sent) != 1 || ch.sent[0] != "next" {
+		t.Errorf("sent = %v, want the answered reply skipped", ch.sent)
+	}
+}
+
+func TestDelivery_FullQueueDoesNotBlockDispatcher(t *testing.T) {
+	m, msgBus, ch := newDeliveryTestManager(t, config.RetryPolicy{MaxAttempts: 100, BaseDelay: 60})
+	ch.errs = []error{errors.New("connection reset")}
+
+	for i := 0; i < deliveryQueueSize+2; i++ {
+		msgBus.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "c1", Content: "hello"})
+	}
+
+	// The first message waits out its backoff and the queue holds the next
+	// deliveryQueueSize; the last one is dead-lettered instead of blocking.
+	waitForDelivery(t, m, func(s DeliveryStats) bool { return s.DeadLettered == 1 })
+	letters, err := m.DeadLetters().List()
+	if err != nil || len(letters) != 1 || letters[0].Error != errDeliveryQueueFull.Error() {
+		t.Fatalf("List() = %+v, %v", letters, err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := config.RetryPolicy{MaxAttempts: 10, BaseDelay: 2, MaxDelay: 10}
+	tests := []struct {
+		attempt int
+		hint    time.Duration
+		want    time.Duration
+	}{
+		{1, 0, 2 * time.Second},
+		{2, 0, 4 * time.Second},
+		{3, 0, 8 * time.Second},
+		{4, 0, 10 * time.Second},
+		{60, 0, 10 * time.Second},
+		{1, 30 * time.Second, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(policy, tt.attempt, tt.hint); got != tt.want {
+			t.Errorf("retryDelay(attempt %d, hint %v) = %v, want %v", tt.attempt, tt.hint, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveryPolicyOverrides(t *testing.T) {
+	d := config.DeliveryConfig{
+		Retry:     config.RetryPolicy{MaxAttempts: 5, BaseDelay: 2, MaxDelay: 300},
+		Overrides: map[string]config.RetryPolicy{"telegram": {MaxAttempts: 8}},
+	}
+	got := d.PolicyFor("telegram")
+	if got.MaxAttempts != 8 || got.BaseDelay != 2 || got.MaxDelay != 300 {
+		t.Errorf("PolicyFor(telegram) = %+v", got)
+	}
+	if got := d.PolicyFor("slack"); got != d.Retry {
+		t.Errorf("PolicyFor(slack) = %+v, want default", got)
+	}
+}
@@ -31,6 +31,7 @@ type DiscordChannel struct {
 	typingMu    sync.Mutex
 	typingStop  map[string]chan struct{} // chatID → stop signal
 	botUserID   string                   // stored for mention checking
+	approvals   approvalGate
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -75,6 +76,7 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 	c.botUserID = botUser.ID
 
 	c.session.AddHandler(c.handleMessage)
+	c.session.AddHandler(c.handleInteraction)
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
@@ -138,22 +140,172 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 }
 
 func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content string) error {
-	// Use the passed ctx for timeout control
+	err := withSendTimeout(ctx, func() error {
+		_, err := c.session.ChannelMessageSend(channelID, content)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send discord message: %w", err)
+	}
+	return nil
+}
+
+// SendEditable sends content and returns the Discord message ID.
+func (c *DiscordChannel) SendEditable(ctx context.Context, chatID, content string) (string, error) {
+	c.stopTyping(chatID)
+
+	if !c.IsRunning() {
+		return "", fmt.Errorf("discord bot not running")
+	}
+
+	var messageID string
+	err := withSendTimeout(ctx, func() error {
+		m, err := c.session.ChannelMessageSend(chatID, content)
+		if err == nil {
+			messageID = m.ID
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send discord message: %w", err)
+	}
+	return messageID, nil
+}
+
+// EditMessage replaces the content of a message sent by SendEditable.
+func (c *DiscordChannel) EditMessage(ctx context.Context, chatID, messageID, content string) error {
+	err := withSendTimeout(ctx, func() error {
+		_, err := c.session.ChannelMessageEdit(chatID, messageID, content)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to edit discord message: %w", err)
+	}
+	return nil
+}
+
+// SendReasoning shows a reasoning summary behind a spoiler.
+func (c *DiscordChannel) SendReasoning(ctx context.Context, chatID, summary string) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+
+	// A "||" inside the summary would end the spoiler early
+	summary = strings.ReplaceAll(summary, "||", "| |")
+	return c.sendChunk(ctx, chatID, "**Reasoning**\n||"+utils.Truncate(summary, 1900)+"||")
+}
+
+// SendApprovalPrompt asks for approval with Approve and Deny buttons.
+func (c *DiscordChannel) SendApprovalPrompt(ctx context.Context, chatID string, prompt ApprovalPrompt) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+
+	msg := &discordgo.MessageSend{
+		Content: utils.Truncate(approvalTitle+"\n"+prompt.Summary, 2000),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: approvalAction(prompt.ID, true)},
+				discordgo.Button{Label: "Deny", Style: discordgo.DangerButton, CustomID: approvalAction(prompt.ID, false)},
+			}},
+		},
+	}
+	err := withSendTimeout(ctx, func() error {
+		_, err := c.session.ChannelMessageSendComplex(chatID, msg)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send discord message: %w", err)
+	}
+	c.approvals.remember(prompt)
+	return nil
+}
+
+// handleInteraction turns a press of an approval button into an approval
+// reply from the user who pressed it.
+func (c *DiscordChannel) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i == nil || i.Interaction == nil || i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	id, approve, ok := parseApprovalAction(i.MessageComponentData().CustomID)
+	if !ok {
+		return
+	}
+
+	user := i.User
+	if i.Member != nil && i.Member.User != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return
+	}
+	if !c.IsAllowed(user.ID) {
+		_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "You are not allowed to answer this.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+	if !c.approvals.allow(id, user.ID) {
+		_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Only the user who asked can answer this.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+
+	// Replacing the components drops the buttons, so the prompt can't be
+	// answered twice
+	content := approvalOutcome(approve, user.Username)
+	if i.Message != nil {
+		content = i.Message.Content + "\n\n" + content
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    utils.Truncate(content, 2000),
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		logger.DebugCF("discord", "Failed to update approval prompt", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	metadata := map[string]string{
+		"approval_id": id,
+		"user_id":     user.ID,
+		"username":    user.Username,
+	}
+	c.HandleMessage(user.ID, i.ChannelID, ApprovalReply(id, approve), nil, metadata)
+}
+
+// MaxMessageLength is Discord's 2000 character message limit.
+func (c *DiscordChannel) MaxMessageLength() int {
+	return 2000
+}
+
+// withSendTimeout runs a blocking discordgo call, giving up after sendTimeout
+// or when ctx is done.
+func withSendTimeout(ctx context.Context, call func() error) error {
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
 	defer cancel()
 
 	done := make(chan error, 1)
 	go func() {
-		_, err := c.session.ChannelMessageSend(channelID, content)
-		done <- err
+		done <- call()
 	}()
 
 	select {
 	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("failed to send discord message: %w", err)
-		}
-		return nil
+		return err
 	case <-sendCtx.Done():
 		return fmt.Errorf("send message timeout: %w", sendCtx.Err())
 	}
@@ -0,0 +1,811 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// emailIdleTimeout restarts IDLE before servers drop it (RFC 2177 allows 29 minutes).
+	emailIdleTimeout = 25 * time.Minute
+	emailMaxBackoff  = 5 * time.Minute
+
+	emailThreadsFileName = "email_threads.json"
+	// emailMaxThreads bounds the threads remembered for replies; the least
+	// recently active are forgotten first.
+	emailMaxThreads = 1000
+	// emailMaxReferences bounds the Message-IDs kept per thread. The first
+	// one, which identifies the thread, is always kept.
+	emailMaxReferences = 20
+)
+
+// emailReconnectDelay is the first reconnect delay after a mailbox error; it doubles up to emailMaxBackoff.
+var emailReconnectDelay = 5 * time.Second
+
+var (
+	emailMessageIDRe = regexp.MustCompile(`<[^<>\s]+>`)
+	emailHTMLBlockRe = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	emailHTMLBreakRe = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])>`)
+	emailHTMLTagRe   = regexp.MustCompile(`<[^>]*>`)
+	emailBlankRe     = regexp.MustCompile(`\n{3,}`)
+	emailQuoteHeadRe = regexp.MustCompile(`(?i)^on .+ wrote:$`)
+)
+
+// emailThread is what is needed to reply into a conversation. Threads are
+// persisted so replies still reach them after a restart.
+type emailThread struct {
+	ReplyTo    string    `json:"reply_to"`   // address replies are sent to
+	Subject    string    `json:"subject"`    // subject of the latest message
+	LastID     string    `json:"last_id"`    // Message-ID of the latest message
+	References []string  `json:"references"` // Message-IDs of the thread, oldest first
+	Updated    time.Time `json:"updated"`
+}
+
+type emailAttachment struct {
+	filename string
+	data     []byte
+}
+
+// EmailChannel receives mail from IMAP mailboxes and replies over SMTP.
+// Each thread is a chat, identified by the sender and the Message-ID of its
+// first message.
+type EmailChannel struct {
+	*BaseChannel
+	config      config.EmailConfig
+	fromAddress string
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	threadsFile string
+
+	mu      sync.Mutex
+	threads map[string]*emailThread // chatID -> thread
+}
+
+// NewEmailChannel creates a new email channel. Threads are saved in
+// stateDir; an empty stateDir keeps them in memory only.
+func NewEmailChannel(cfg config.EmailConfig, messageBus *bus.MessageBus, stateDir string) (*EmailChannel, error) {
+	if cfg.IMAPHost == "" || cfg.SMTPHost == "" || cfg.Username == "" {
+		return nil, fmt.Errorf("email imap_host, smtp_host and username are required")
+	}
+
+	from := cfg.FromAddress
+	if from == "" {
+		from = cfg.Username
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email from_address %q: %w", from, err)
+	}
+
+	if len(cfg.AllowFrom) > 0 && !cfg.VerifySender {
+		logger.WarnC("email", "allow_from is set but verify_sender is off; anyone can forge an allowed From address")
+	}
+
+	base := NewBaseChannel("email", cfg, messageBus, cfg.AllowFrom)
+
+	c := &EmailChannel{
+		BaseChannel: base,
+		config:      cfg,
+		fromAddress: strings.ToLower(addr.Address),
+		threads:     make(map[string]*emailThread),
+	}
+	if stateDir != "" {
+		c.threadsFile = filepath.Join(stateDir, emailThreadsFileName)
+		c.loadThreads()
+	}
+	return c, nil
+}
+
+// Start begins watching each configured mailbox.
+func (c *EmailChannel) Start(ctx context.Context) error {
+	logger.InfoC("email", "Starting email channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	mailboxes := c.config.Mailboxes
+	if len(mailboxes) == 0 {
+		mailboxes = []string{"INBOX"}
+	}
+	for _, mailbox := range mailboxes {
+		c.wg.Add(1)
+		go c.watchMailbox(mailbox)
+	}
+
+	c.setRunning(true)
+	logger.InfoCF("email", "Email channel started", map[string]any{
+		"address":   c.fromAddress,
+		"mailboxes": mailboxes,
+	})
+	return nil
+}
+
+// Stop stops watching the mailboxes.
+func (c *EmailChannel) Stop(ctx context.Context) error {
+	logger.InfoC("email", "Stopping email channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+
+	c.setRunning(false)
+	logger.InfoC("email", "Email channel stopped")
+	return nil
+}
+
+// Send replies into the thread identified by msg.ChatID. A ChatID that is a
+// plain address instead starts a new conversation with that address.
+func (c *EmailChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("email channel not running")
+	}
+
+	c.mu.Lock()
+	thread, ok := c.threads[msg.ChatID]
+	var to, subject, inReplyTo string
+	var references []string
+	if ok {
+		to, subject, inReplyTo = thread.ReplyTo, thread.Subject, thread.LastID
+		references = append(references, thread.References...)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		addr, err := mail.ParseAddress(msg.ChatID)
+		if err != nil || strings.Contains(msg.ChatID, "<") {
+			return fmt.Errorf("unknown email thread %s", msg.ChatID)
+		}
+		to, subject = addr.Address, "Message from PicoClaw"
+	} else if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	messageID := c.newMessageID()
+	data, err := buildEmail(c.fromAddress, to, subject, messageID, inReplyTo, references, msg.Content)
+	if err != nil {
+		return err
+	}
+	if err := c.sendMail(ctx, to, data); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	c.mu.Lock()
+	thread, ok = c.threads[msg.ChatID]
+	if ok {
+		thread.LastID = messageID
+		thread.References = trimReferences(append(thread.References, messageID))
+		thread.Updated = time.Now()
+	}
+	c.mu.Unlock()
+	if ok {
+		c.saveThreadsLogged()
+	}
+
+	logger.DebugCF("email", "Email sent", map[string]any{
+		"to":         to,
+		"chat_id":    msg.ChatID,
+		"message_id": messageID,
+	})
+	return nil
+}
+
+// watchMailbox keeps a connection to mailbox open, reconnecting with backoff.
+func (c *EmailChannel) watchMailbox(mailbox string) {
+	defer c.wg.Done()
+
+	delay := emailReconnectDelay
+	for {
+		err := c.runMailbox(mailbox, func() { delay = emailReconnectDelay })
+		if c.ctx.Err() != nil {
+			return
+		}
+		logger.ErrorCF("email", "Mailbox connection failed, reconnecting", map[string]any{
+			"mailbox": mailbox,
+			"error":   err.Error(),
+			"delay":   delay.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, emailMaxBackoff)
+	}
+}
+
+// runMailbox processes new mail in mailbox until the connection fails or
+// the channel stops. connected is called once the mailbox is selected.
+func (c *EmailChannel) runMailbox(mailbox string, connected func()) error {
+	addr := net.JoinHostPort(c.config.IMAPHost, strconv.Itoa(c.config.IMAPPort))
+	client, err := dialIMAP(c.ctx, addr, c.config.IMAPTLS, c.config.Insecure, emailTLSConfig(c.config.IMAPHost))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// Unblock any in-flight command when the channel stops.
+	stop := context.AfterFunc(c.ctx, func() { client.Close() })
+	defer stop()
+
+	if err := client.Login(c.config.Username, c.config.Password); err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	if err := client.Select(mailbox); err != nil {
+		return fmt.Errorf("select %s failed: %w", mailbox, err)
+	}
+	connected()
+
+	idle := c.config.UseIDLE && client.caps["IDLE"]
+	logger.InfoCF("email", "Watching mailbox", map[string]any{
+		"mailbox": mailbox,
+		"idle":    idle,
+	})
+
+	interval := time.Duration(c.config.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	for {
+		if err := c.fetchNew(client, mailbox); err != nil {
+			return err
+		}
+
+		if idle {
+			if _, err := client.Idle(c.ctx, emailIdleTimeout); err != nil {
+				if c.ctx.Err() != nil {
+					client.Logout()
+					return nil
+				}
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-c.ctx.Done():
+			client.Logout()
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fetchNew hands every unseen message to the bus and marks it \Seen.
+func (c *EmailChannel) fetchNew(client *imapClient, mailbox string) error {
+	uids, err := client.SearchUnseen()
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		raw, err := client.FetchRaw(uid)
+		if err != nil {
+			return err
+		}
+		c.processEmail(raw, mailbox)
+		if err := client.MarkSeen(uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *EmailChannel) processEmail(raw []byte, mailbox string) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		logger.WarnCF("email", "Failed to parse email", map[string]any{
+			"mailbox": mailbox,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	from, err := mail.ParseAddress(decodeHeader(msg.Header.Get("From")))
+	if err != nil {
+		return
+	}
+	senderID := strings.ToLower(from.Address)
+	if senderID == c.fromAddress {
+		return
+	}
+	// Never answer automatic mail (vacation notices, bounces), to avoid loops.
+	if auto := strings.ToLower(msg.Header.Get("Auto-Submitted")); auto != "" && auto != "no" {
+		return
+	}
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("email", "Email from sender not in allow list", map[string]any{
+			"sender_id": senderID,
+		})
+		return
+	}
+	if c.config.VerifySender && !senderAuthenticated(msg.Header, senderID) {
+		logger.WarnCF("email", "Email sender failed authentication, ignoring", map[string]any{
+			"sender_id": senderID,
+		})
+		return
+	}
+
+	messageID := firstMessageID(msg.Header.Get("Message-ID"))
+	if messageID == "" {
+		messageID = "<" + uuid.New().String() + "@picoclaw>"
+	}
+	references := emailMessageIDRe.FindAllString(msg.Header.Get("References"), -1)
+	if len(references) == 0 {
+		references = emailMessageIDRe.FindAllString(msg.Header.Get("In-Reply-To"), -1)
+	}
+	root := messageID
+	if len(references) > 0 {
+		root = references[0]
+	}
+	// The root Message-ID comes from the sender, so the chat is keyed by
+	// sender too: reusing another thread's ID must not take that thread over.
+	chatID := emailChatID(senderID, root)
+
+	// Replies go to the allow-listed From address only. Reply-To is chosen
+	// by the sender and could send the agent's answers anywhere.
+	subject := decodeHeader(msg.Header.Get("Subject"))
+	c.rememberThread(chatID, &emailThread{
+		ReplyTo:    senderID,
+		Subject:    subject,
+		LastID:     messageID,
+		References: trimReferences(append(references, messageID)),
+		Updated:    time.Now(),
+	})
+
+	text, attachments := parseEmailBody(textproto.MIMEHeader(msg.Header), msg.Body)
+	content := stripQuotedReply(text)
+	if root == messageID && subject != "" {
+		content = "Subject: " + subject + "\n\n" + content
+	}
+
+	var mediaPaths []string
+	for _, a := range attachments {
+		localPath, err := utils.SaveMediaFile(a.filename, a.data)
+		if err != nil {
+			logger.ErrorCF("email", "Failed to save attachment", map[string]any{
+				"filename": a.filename,
+				"error":    err.Error(),
+			})
+			continue
+		}
+		mediaPaths = append(mediaPaths, localPath)
+		content += fmt.Sprintf("\n[file: %s]", a.filename)
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+
+	metadata := map[string]string{
+		"platform":    "email",
+		"message_id":  messageID,
+		"subject":     subject,
+		"mailbox":     mailbox,
+		"sender_name": from.Name,
+		"peer_kind":   "direct",
+		"peer_id":     senderID,
+	}
+
+	logger.DebugCF("email", "Received email", map[string]any{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"mailbox":   mailbox,
+		"media":     len(mediaPaths),
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+}
+
+// emailChatID identifies the thread started by root with sender.
+func emailChatID(sender, root string) string {
+	return sender + "/" + root
+}
+
+// senderAuthenticated reports whether the topmost Authentication-Results
+// header, which the receiving server adds, shows that the domain of from
+// passed DMARC, or DKIM with a signature of that domain.
+func senderAuthenticated(header mail.Header, from string) bool {
+	results := textproto.MIMEHeader(header).Values("Authentication-Results")
+	if len(results) == 0 {
+		return false
+	}
+	_, domain, _ := strings.Cut(from, "@")
+	if domain == "" {
+		return false
+	}
+
+	clauses := strings.Split(strings.ToLower(results[0]), ";")
+	for _, clause := range clauses[1:] { // the first is the server's ID
+		fields := strings.Fields(clause)
+		if len(fields) == 0 {
+			continue
+		}
+		props := make(map[string]string)
+		for _, f := range fields[1:] {
+			if k, v, ok := strings.Cut(f, "="); ok {
+				props[k] = strings.Trim(v, `"`)
+			}
+		}
+		switch fields[0] {
+		case "dmarc=pass":
+			if d, ok := props["header.from"]; !ok || d == domain {
+				return true
+			}
+		case "dkim=pass":
+			if props["header.d"] == domain {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rememberThread records the latest state of a thread, forgets the least
+// recently active threads beyond emailMaxThreads and saves the result.
+func (c *EmailChannel) rememberThread(chatID string, thread *emailThread) {
+	c.mu.Lock()
+	c.threads[chatID] = thread
+	for len(c.threads) > emailMaxThreads {
+		oldest := ""
+		for id, t := range c.threads {
+			if oldest == "" || t.Updated.Before(c.threads[oldest].Updated) {
+				oldest = id
+			}
+		}
+		delete(c.threads, oldest)
+	}
+	c.mu.Unlock()
+	c.saveThreadsLogged()
+}
+
+// trimReferences keeps the first Message-ID of a thread and the most
+// recent ones, up to emailMaxReferences in total.
+func trimReferences(refs []string) []string {
+	if len(refs) <= emailMaxReferences {
+		return refs
+	}
+	return append([]string{refs[0]}, refs[len(refs)-emailMaxReferences+1:]...)
+}
+
+// loadThreads restores the threads saved by a previous run, if any.
+func (c *EmailChannel) loadThreads() {
+	data, err := os.ReadFile(c.threadsFile)
+	if err != nil {
+		return
+	}
+	var threads map[string]*emailThread
+	if err := json.Unmarshal(data, &threads); err != nil {
+		logger.WarnCF("email", "Failed to load email threads", map[string]any{
+			"path":  c.threadsFile,
+			"error": err.Error(),
+		})
+		return
+	}
+	for id, t := range threads {
+		if t != nil {
+			c.threads[id] = t
+		}
+	}
+}
+
+// saveThreads writes the threads atomically (temp file + rename).
+func (c *EmailChannel) saveThreads() error {
+	if c.threadsFile == "" {
+		return nil
+	}
+	c.mu.Lock()
+	data, err := json.Marshal(c.threads)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.threadsFile), 0o755); err != nil {
+		return err
+	}
+	tempFile := c.threadsFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, c.threadsFile); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
+
+func (c *EmailChannel) saveThreadsLogged() {
+	if err := c.saveThreads(); err != nil {
+		logger.WarnCF("email", "Failed to save email threads", map[string]any{
+			"path":  c.threadsFile,
+			"error": err.Error(),
+		})
+	}
+}
+
+// parseEmailBody returns the message text, preferring text/plain over HTML,
+// and its attachments.
+func parseEmailBody(header textproto.MIMEHeader, body io.Reader) (string, []emailAttachment) {
+	var plain, htmlText string
+	var attachments []emailAttachment
+
+	var walk func(header textproto.MIMEHeader, body io.Reader)
+	walk = func(header textproto.MIMEHeader, body io.Reader) {
+		mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+		if err != nil {
+			mediaType = "text/plain"
+		}
+
+		if strings.HasPrefix(mediaType, "multipart/") {
+			mr := multipart.NewReader(body, params["boundary"])
+			for {
+				part, err := mr.NextRawPart()
+				if err != nil {
+					return
+				}
+				walk(part.Header, part)
+			}
+		}
+
+		data, err := io.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+		if err != nil {
+			return
+		}
+
+		disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+		filename := decodeHeader(dispParams["filename"])
+		if filename == "" {
+			filename = decodeHeader(params["name"])
+		}
+		if disposition == "attachment" || (filename != "" && !strings.HasPrefix(mediaType, "text/")) {
+			if filename == "" {
+				filename = fmt.Sprintf("attachment_%d", len(attachments)+1)
+			}
+			attachments = append(attachments, emailAttachment{filename: filename, data: data})
+			return
+		}
+
+		text := decodeCharset(data, params["charset"])
+		switch mediaType {
+		case "text/plain":
+			if plain == "" {
+				plain = text
+			}
+		case "text/html":
+			if htmlText == "" {
+				htmlText = htmlToText(text)
+			}
+		}
+	}
+	walk(header, body)
+
+	if strings.TrimSpace(plain) == "" {
+		plain = htmlText
+	}
+	return strings.TrimSpace(strings.ReplaceAll(plain, "\r\n", "\n")), attachments
+}
+
+func decodeTransferEncoding(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// decodeCharset converts Latin-1 text to UTF-8; other charsets are passed through.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return string(data)
+	}
+}
+
+func decodeHeader(s string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+func htmlToText(s string) string {
+	s = emailHTMLBlockRe.ReplaceAllString(s, "")
+	s = emailHTMLBreakRe.ReplaceAllString(s, "\n")
+	s = emailHTMLTagRe.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return emailBlankRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
+
+// stripQuotedReply drops the quoted previous message from a reply: ">"
+// lines and the "On ... wrote:" line introducing them. The earlier messages
+// are already in the session history.
+func stripQuotedReply(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		if emailQuoteHeadRe.MatchString(trimmed) && i+1 < len(lines) &&
+			strings.HasPrefix(strings.TrimSpace(lines[i+1]), ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+func firstMessageID(s string) string {
+	return emailMessageIDRe.FindString(s)
+}
+
+func (c *EmailChannel) newMessageID() string {
+	domain := "picoclaw"
+	if at := strings.LastIndex(c.fromAddress, "@"); at >= 0 {
+		domain = c.fromAddress[at+1:]
+	}
+	return "<" + uuid.New().String() + "@" + domain + ">"
+}
+
+// buildEmail renders a plain-text message with threading headers.
+func buildEmail(from, to, subject, messageID, inReplyTo string, references []string, body string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: %s\r\n", messageID)
+	if inReplyTo != "" {
+		fmt.Fprintf(&buf, "In-Reply-To: %s\r\n", inReplyTo)
+	}
+	if len(references) > 0 {
+		fmt.Fprintf(&buf, "References: %s\r\n", strings.Join(references, " "))
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendMail delivers data over SMTP, using implicit TLS when smtp_tls is set
+// and STARTTLS otherwise. Like IMAP, a server without STARTTLS is refused
+// unless insecure is set.
+func (c *EmailChannel) sendMail(ctx context.Context, to string, data []byte) error {
+	host := c.config.SMTPHost
+	addr := net.JoinHostPort(host, strconv.Itoa(c.config.SMTPPort))
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if c.config.SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: emailTLSConfig(host)}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	encrypted := c.config.SMTPTLS
+	if !encrypted {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(emailTLSConfig(host)); err != nil {
+				return err
+			}
+			encrypted = true
+		} else if !c.config.Insecure {
+			return fmt.Errorf("%s does not offer STARTTLS; enable smtp_tls or set insecure to send without TLS", addr)
+		}
+	}
+	if c.config.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			var auth smtp.Auth = smtp.PlainAuth("", c.config.Username, c.config.Password, host)
+			if !encrypted {
+				auth = unencryptedAuth{auth}
+			}
+			if err := client.Auth(auth); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := client.Mail(c.fromAddress); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// unencryptedAuth lets PLAIN authentication run without TLS, which
+// net/smtp otherwise only allows towards localhost. It is used only when
+// insecure is set.
+type unencryptedAuth struct {
+	smtp.Auth
+}
+
+func (a unencryptedAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	info := *server
+	info.TLS = true
+	return a.Auth.Start(&info)
+}
+
+func emailTLSConfig(host string) *tls.Config {
+	return &tls.Config{ServerName: host}
+}
@@ -0,0 +1,315 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// imapCommandTimeout bounds how long a single IMAP command may take.
+	imapCommandTimeout = 2 * time.Minute
+	// imapMaxLiteralSize bounds a literal the server announces, so a
+	// misbehaving server cannot make the client allocate without limit.
+	imapMaxLiteralSize = 64 << 20
+)
+
+var (
+	imapLiteralRe = regexp.MustCompile(`\{(\d+)\}$`)
+	imapUIDRe     = regexp.MustCompile(`\bUID (\d+)`)
+)
+
+// imapResponse is one untagged server response. Literals ({n} followed by n
+// raw bytes) are cut out of Line and kept in Literals, in order.
+type imapResponse struct {
+	Line     string
+	Literals [][]byte
+}
+
+// imapClient is a minimal IMAP4rev1 client covering what the email channel
+// needs: LOGIN, SELECT, UID SEARCH/FETCH/STORE and IDLE.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+	caps map[string]bool
+}
+
+// dialIMAP connects to addr, using implicit TLS when useTLS is set and
+// STARTTLS otherwise. A server that does not offer STARTTLS is refused
+// unless insecure is set, so the password never crosses the network in
+// plain text by accident.
+func dialIMAP(ctx context.Context, addr string, useTLS, insecure bool, tlsConfig *tls.Config) (*imapClient, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+
+	if err := c.capability(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !useTLS && !c.caps["STARTTLS"] && !insecure {
+		conn.Close()
+		return nil, fmt.Errorf("%s does not offer STARTTLS; enable imap_tls or set insecure to log in without TLS", addr)
+	}
+	if !useTLS && c.caps["STARTTLS"] {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("STARTTLS handshake failed: %w", err)
+		}
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+		if err := c.capability(); err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *imapClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *imapClient) capability() error {
+	resps, err := c.command("CAPABILITY")
+	if err != nil {
+		return err
+	}
+	c.caps = make(map[string]bool)
+	for _, resp := range resps {
+		if fields := strings.Fields(resp.Line); len(fields) > 1 && strings.EqualFold(fields[1], "CAPABILITY") {
+			for _, name := range fields[2:] {
+				c.caps[strings.ToUpper(name)] = true
+			}
+		}
+	}
+	return nil
+}
+
+func (c *imapClient) Login(username, password string) error {
+	_, err := c.command("LOGIN %s %s", imapQuote(username), imapQuote(password))
+	if err != nil {
+		return err
+	}
+	// Servers may advertise more capabilities once authenticated.
+	return c.capability()
+}
+
+func (c *imapClient) Select(mailbox string) error {
+	_, err := c.command("SELECT %s", imapQuote(mailbox))
+	return err
+}
+
+// SearchUnseen returns the UIDs of messages without the \Seen flag.
+func (c *imapClient) SearchUnseen() ([]uint32, error) {
+	resps, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, resp := range resps {
+		fields := strings.Fields(resp.Line)
+		if len(fields) < 2 || !strings.EqualFold(fields[1], "SEARCH") {
+			continue
+		}
+		for _, f := range fields[2:] {
+			if uid, err := strconv.ParseUint(f, 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// FetchRaw returns the full RFC 5322 message without setting \Seen.
+func (c *imapClient) FetchRaw(uid uint32) ([]byte, error) {
+	resps, err := c.command("UID FETCH %d BODY.PEEK[]", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range resps {
+		if !strings.Contains(strings.ToUpper(resp.Line), " FETCH ") || len(resp.Literals) == 0 {
+			continue
+		}
+		if m := imapUIDRe.FindStringSubmatch(resp.Line); m != nil && m[1] != strconv.FormatUint(uint64(uid), 10) {
+			continue
+		}
+		return resp.Literals[0], nil
+	}
+	return nil, fmt.Errorf("message UID %d not found", uid)
+}
+
+func (c *imapClient) MarkSeen(uid uint32) error {
+	_, err := c.command(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+func (c *imapClient) Logout() {
+	c.command("LOGOUT")
+}
+
+// Idle waits in IDLE until the mailbox reports new mail, timeout passes or
+// ctx is canceled. It reports whether new mail arrived.
+func (c *imapClient) Idle(ctx context.Context, timeout time.Duration) (bool, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s IDLE\r\n", tag); err != nil {
+		return false, err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return false, err
+	}
+	if !strings.HasPrefix(line, "+") {
+		return false, fmt.Errorf("IDLE rejected: %s", line)
+	}
+
+	// Wake the blocked read when ctx is canceled.
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	newMail := false
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return false, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && (strings.EqualFold(fields[2], "EXISTS") || strings.EqualFold(fields[2], "RECENT")) {
+			newMail = true
+			break
+		}
+	}
+	stop()
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	c.conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	if _, err := io.WriteString(c.conn, "DONE\r\n"); err != nil {
+		return false, err
+	}
+	if _, err := c.readTagged(tag); err != nil {
+		return false, err
+	}
+	return newMail, nil
+}
+
+// command sends a tagged command and collects untagged responses until the
+// tagged completion, which must be OK.
+func (c *imapClient) command(format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+	return c.readTagged(tag)
+}
+
+func (c *imapClient) readTagged(tag string) ([]imapResponse, error) {
+	var resps []imapResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if rest, ok := strings.CutPrefix(resp.Line, tag+" "); ok {
+			if !strings.HasPrefix(strings.ToUpper(rest), "OK") {
+				return nil, fmt.Errorf("imap: %s", rest)
+			}
+			return resps, nil
+		}
+		resps = append(resps, resp)
+	}
+}
+
+// readResponse reads one response line, following any literals it contains.
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var resp imapResponse
+	var line strings.Builder
+	for {
+		part, err := c.readLine()
+		if err != nil {
+			return resp, err
+		}
+		m := imapLiteralRe.FindStringSubmatch(part)
+		if m == nil {
+			line.WriteString(part)
+			resp.Line = line.String()
+			return resp, nil
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n > imapMaxLiteralSize {
+			return resp, fmt.Errorf("imap: literal of %s bytes exceeds the %d byte limit", m[1], imapMaxLiteralSize)
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.Literals = append(resp.Literals, literal)
+		line.WriteString(part)
+	}
+}
+
+func (c *imapClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// imapQuote returns s as an IMAP quoted string.
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
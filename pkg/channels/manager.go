@@ -9,11 +9,13 @@ package channels
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"sync"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/egress"
 	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
@@ -23,6 +25,11 @@ type Manager struct {
 	config       *config.Config
 	dispatchTask *asyncTask
 	mu           sync.RWMutex
+
+	deadLetters *DeadLetterStore
+	queues      map[string]*deliveryQueue
+	counters    map[string]*deliveryCounters
+	deliveryMu  sync.Mutex
 }
 
 type asyncTask struct {
@@ -34,6 +41,12 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error
 		channels: make(map[string]Channel),
 		bus:      messageBus,
 		config:   cfg,
+		deadLetters: NewDeadLetterStore(
+			filepath.Join(cfg.WorkspacePath(), "state", "dead_letters.json"),
+			cfg.Channels.Delivery.MaxDeadLetters,
+		),
+		queues:   make(map[string]*deliveryQueue),
+		counters: make(map[string]*deliveryCounters),
 	}
 
 	if err := m.initChannels(); err != nil {
@@ -234,6 +247,48 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	if m.config.Channels.Webhook.Enabled && m.config.Channels.Webhook.Secret != "" {
+		logger.DebugC("channels", "Attempting to initialize webhook channel")
+		webhook, err := NewWebhookChannel(m.config.Channels.Webhook, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize webhook channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			webhook.SetEgressPolicy(egress.NewPolicy(m.config.Tools.Egress))
+			m.channels["webhook"] = webhook
+			logger.InfoC("channels", "Webhook channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Email.Enabled && m.config.Channels.Email.IMAPHost != "" {
+		logger.DebugC("channels", "Attempting to initialize email channel")
+		stateDir := filepath.Join(m.config.WorkspacePath(), "state")
+		email, err := NewEmailChannel(m.config.Channels.Email, m.bus, stateDir)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize email channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["email"] = email
+			logger.InfoC("channels", "Email channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Matrix.Enabled && m.config.Channels.Matrix.AccessToken != "" {
+		logger.DebugC("channels", "Attempting to initialize Matrix channel")
+		stateDir := filepath.Join(m.config.WorkspacePath(), "state")
+		matrix, err := NewMatrixChannel(m.config.Channels.Matrix, m.bus, stateDir)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Matrix channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["matrix"] = matrix
+			logger.InfoC("channels", "Matrix channel enabled successfully")
+		}
+	}
+
 	logger.InfoCF("channels", "Channel initialization completed", map[string]any{
 		"enabled_channels": len(m.channels),
 	})
@@ -316,26 +371,30 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 
 			// Silently skip internal channels
 			if constants.IsInternalChannel(msg.Channel) {
+				m.bus.AckOutbound(msg)
 				continue
 			}
 
 			m.mu.RLock()
-			channel, exists := m.channels[msg.Channel]
+			ch, exists := m.channels[msg.Channel]
 			m.mu.RUnlock()
 
 			if !exists {
 				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]any{
 					"channel": msg.Channel,
 				})
+				m.bus.AckOutbound(msg)
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
-				logger.ErrorCF("channels", "Error sending message to channel", map[string]any{
-					"channel": msg.Channel,
-					"error":   err.Error(),
-				})
+			// The chat has its answer already, unless the channel is
+			// holding a request open for the end of the turn
+			if _, waits := ch.(TurnWaiter); msg.Answered && !waits {
+				m.bus.AckOutbound(msg)
+				continue
 			}
+
+			m.enqueue(ctx, msg.Channel, msg)
 		}
 	}
 }
@@ -351,11 +410,13 @@ func (m *Manager) GetStatus() map[string]any {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	delivery := m.DeliveryStats()
 	status := make(map[string]any)
 	for name, channel := range m.channels {
 		status[name] = map[string]any{
-			"enabled": true,
-			"running": channel.IsRunning(),
+			"enabled":  true,
+			"running":  channel.IsRunning(),
+			"delivery": delivery[name],
 		}
 	}
 	return status
@@ -0,0 +1,913 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	matrixSyncTimeout   = 30 * time.Second
+	matrixMaxRetryDelay = time.Minute
+	matrixMaxMediaSize  = 20 << 20
+	matrixStateFileName = "matrix.json"
+)
+
+// matrixEncryptedNotice is posted once to end-to-end encrypted rooms, so
+// their members learn why the bot does not answer there. It carries no
+// conversation content.
+const matrixEncryptedNotice = "I can't read or send end-to-end encrypted messages, so I won't answer in this room. " +
+	"Please talk to me in a room without encryption."
+
+// matrixRetryDelay is the first delay after a failed sync; it doubles up to matrixMaxRetryDelay.
+var matrixRetryDelay = time.Second
+
+// matrixSyncFilter keeps sync responses small: no presence, lazy-loaded members.
+const matrixSyncFilter = `{"presence":{"not_types":["*"]},"room":{"state":{"lazy_load_members":true},"timeline":{"limit":50}}}`
+
+// matrixInitialFilter is used for the very first sync, whose timeline is
+// history and is skipped.
+const matrixInitialFilter = `{"presence":{"not_types":["*"]},"room":{"state":{"lazy_load_members":true},"timeline":{"limit":1}}}`
+
+// MatrixChannel implements the Channel interface for Matrix homeservers
+// using the client-server API. Rooms are chats; messages in a thread use
+// "roomID/threadRootEventID" as ChatID, like Slack threads. Inbound images
+// and files are downloaded, and outbound media is uploaded to the content
+// repository. End-to-end encryption is not implemented: encrypted rooms are
+// told so with a notice and otherwise left alone.
+type MatrixChannel struct {
+	*BaseChannel
+	config     config.MatrixConfig
+	homeserver string
+	userID     string
+	stateFile  string
+	client     *http.Client
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	txnID      atomic.Int64
+
+	mu          sync.Mutex
+	state       matrixState
+	displayName string
+	lastEvents  map[string]string // chatID -> latest inbound event ID
+}
+
+// matrixState is persisted across restarts so history is not replayed.
+// EncryptedRooms have end-to-end encryption enabled; the channel does not
+// implement it, so it neither joins nor writes to them.
+type matrixState struct {
+	UserID         string          `json:"user_id"`
+	NextBatch      string          `json:"next_batch"`
+	DirectRooms    map[string]bool `json:"direct_rooms"`
+	MemberCounts   map[string]int  `json:"member_counts"`
+	EncryptedRooms map[string]bool `json:"encrypted_rooms"`
+}
+
+type matrixEvent struct {
+	Type     string          `json:"type"`
+	Sender   string          `json:"sender"`
+	EventID  string          `json:"event_id"`
+	StateKey *string         `json:"state_key,omitempty"`
+	Content  json.RawMessage `json:"content"`
+}
+
+type matrixSyncResponse struct {
+	NextBatch   string `json:"next_batch"`
+	AccountData struct {
+		Events []matrixEvent `json:"events"`
+	} `json:"account_data"`
+	Rooms struct {
+		Join map[string]struct {
+			Summary struct {
+				JoinedMemberCount *int `json:"m.joined_member_count"`
+			} `json:"summary"`
+			State struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"state"`
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct {
+			InviteState struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"invite_state"`
+		} `json:"invite"`
+		Leave map[string]json.RawMessage `json:"leave"`
+	} `json:"rooms"`
+}
+
+type matrixMessageContent struct {
+	MsgType   string `json:"msgtype"`
+	Body      string `json:"body"`
+	URL       string `json:"url"`
+	RelatesTo *struct {
+		RelType   string `json:"rel_type"`
+		EventID   string `json:"event_id"`
+		InReplyTo *struct {
+			EventID string `json:"event_id"`
+		} `json:"m.in_reply_to"`
+	} `json:"m.relates_to"`
+	Mentions *struct {
+		UserIDs []string `json:"user_ids"`
+	} `json:"m.mentions"`
+}
+
+// NewMatrixChannel creates a new Matrix channel. The sync token is kept in
+// stateDir.
+func NewMatrixChannel(cfg config.MatrixConfig, messageBus *bus.MessageBus, stateDir string) (*MatrixChannel, error) {
+	if cfg.Homeserver == "" || cfg.AccessToken == "" {
+		return nil, fmt.Errorf("matrix homeserver and access_token are required")
+	}
+
+	base := NewBaseChannel("matrix", cfg, messageBus, cfg.AllowFrom)
+
+	return &MatrixChannel{
+		BaseChannel: base,
+		config:      cfg,
+		homeserver:  strings.TrimRight(cfg.Homeserver, "/"),
+		userID:      cfg.UserID,
+		stateFile:   filepath.Join(stateDir, matrixStateFileName),
+		client:      &http.Client{Timeout: matrixSyncTimeout + 30*time.Second},
+		lastEvents:  make(map[string]string),
+	}, nil
+}
+
+// Start resolves the bot's identity and starts the sync loop.
+func (c *MatrixChannel) Start(ctx context.Context) error {
+	logger.InfoC("matrix", "Starting Matrix channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.do(c.ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, nil, &whoami); err != nil {
+		return fmt.Errorf("matrix whoami failed: %w", err)
+	}
+	if c.userID != "" && c.userID != whoami.UserID {
+		return fmt.Errorf("matrix access token belongs to %s, not %s", whoami.UserID, c.userID)
+	}
+	c.userID = whoami.UserID
+
+	var profile struct {
+		DisplayName string `json:"displayname"`
+	}
+	if err := c.do(c.ctx, http.MethodGet, "/_matrix/client/v3/profile/"+url.PathEscape(c.userID)+"/displayname", nil, nil, &profile); err == nil {
+		c.displayName = profile.DisplayName
+	}
+
+	c.loadState()
+
+	c.wg.Add(1)
+	go c.syncLoop()
+
+	c.setRunning(true)
+	logger.InfoCF("matrix", "Matrix channel started", map[string]any{
+		"user_id":    c.userID,
+		"homeserver": c.homeserver,
+		"resuming":   c.state.NextBatch != "",
+	})
+	return nil
+}
+
+// Stop stops the sync loop.
+func (c *MatrixChannel) Stop(ctx context.Context) error {
+	logger.InfoC("matrix", "Stopping Matrix channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+
+	c.setRunning(false)
+	logger.InfoC("matrix", "Matrix channel stopped")
+	return nil
+}
+
+// Send posts a message to the room, followed by one event per attached
+// file. Messages to a thread ChatID are sent into that thread; in group rooms
+// the reply references the message it answers.
+func (c *MatrixChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("matrix channel not running")
+	}
+
+	roomID, threadRoot := parseMatrixChatID(msg.ChatID)
+
+	c.mu.Lock()
+	replyTo := c.lastEvents[msg.ChatID]
+	direct := c.isDirectLocked(roomID)
+	encrypted := c.state.EncryptedRooms[roomID]
+	c.mu.Unlock()
+
+	// Never leak a plaintext reply into a room its members expect to be
+	// end-to-end encrypted.
+	if encrypted {
+		return &PermanentError{Err: fmt.Errorf("matrix room %s is end-to-end encrypted, which is not supported", roomID)}
+	}
+
+	var relatesTo map[string]any
+	switch {
+	case threadRoot != "":
+		if replyTo == "" {
+			replyTo = threadRoot
+		}
+		relatesTo = map[string]any{
+			"rel_type":        "m.thread",
+			"event_id":        threadRoot,
+			"is_falling_back": true,
+			"m.in_reply_to":   map[string]string{"event_id": replyTo},
+		}
+	case replyTo != "" && !direct:
+		relatesTo = map[string]any{
+			"m.in_reply_to": map[string]string{"event_id": replyTo},
+		}
+	}
+
+	c.setTyping(roomID, false)
+
+	var contents []map[string]any
+	if strings.TrimSpace(msg.Content) != "" || len(msg.Media) == 0 {
+		contents = append(contents, map[string]any{
+			"msgtype": "m.text",
+			"body":    msg.Content,
+		})
+	}
+	for _, path := range msg.Media {
+		content, err := c.uploadMedia(ctx, path)
+		if err != nil {
+			return fmt.Errorf("failed to upload matrix media: %w", err)
+		}
+		contents = append(contents, content)
+	}
+
+	for _, content := range contents {
+		if relatesTo != nil {
+			content["m.relates_to"] = relatesTo
+		}
+		if err := c.sendEvent(ctx, roomID, content); err != nil {
+			return fmt.Errorf("failed to send matrix message: %w", err)
+		}
+	}
+	return nil
+}
+
+// sendEvent posts one m.room.message event to a room.
+func (c *MatrixChannel) sendEvent(ctx context.Context, roomID string, content map[string]any) error {
+	txnID := fmt.Sprintf("picoclaw-%d-%d", time.Now().UnixNano(), c.txnID.Add(1))
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/send/m.room.message/" + url.PathEscape(txnID)
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.do(ctx, http.MethodPut, path, nil, content, &resp); err != nil {
+		return err
+	}
+
+	logger.DebugCF("matrix", "Message sent", map[string]any{
+		"room_id":  roomID,
+		"msgtype":  content["msgtype"],
+		"event_id": resp.EventID,
+	})
+	return nil
+}
+
+// uploadMedia uploads a local file to the content repository and returns
+// the content of the message event that shares it.
+func (c *MatrixChannel) uploadMedia(ctx context.Context, path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &PermanentError{Err: err}
+	}
+	if len(data) > matrixMaxMediaSize {
+		return nil, &PermanentError{Err: fmt.Errorf("%s is larger than %d bytes", filepath.Base(path), matrixMaxMediaSize)}
+	}
+
+	filename := filepath.Base(path)
+	mimeType := mime.TypeByExtension(filepath.Ext(filename))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	endpoint := c.homeserver + "/_matrix/media/v3/upload?" + url.Values{"filename": {filename}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	req.Header.Set("Content-Type", mimeType)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var uploaded struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("matrix media upload returned status %d", resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, &PermanentError{Err: err}
+		}
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return nil, err
+	}
+	if uploaded.ContentURI == "" {
+		return nil, fmt.Errorf("matrix media upload returned no content_uri")
+	}
+
+	msgType := "m.file"
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		msgType = "m.image"
+	case strings.HasPrefix(mimeType, "audio/"):
+		msgType = "m.audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		msgType = "m.video"
+	}
+	return map[string]any{
+		"msgtype":  msgType,
+		"body":     filename,
+		"filename": filename,
+		"url":      uploaded.ContentURI,
+		"info": map[string]any{
+			"mimetype": mimeType,
+			"size":     len(data),
+		},
+	}, nil
+}
+
+func (c *MatrixChannel) syncLoop() {
+	defer c.wg.Done()
+
+	delay := matrixRetryDelay
+	for {
+		c.mu.Lock()
+		since := c.state.NextBatch
+		c.mu.Unlock()
+
+		resp, err := c.sync(since)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			logger.ErrorCF("matrix", "Sync failed, retrying", map[string]any{
+				"error": err.Error(),
+				"delay": delay.String(),
+			})
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, matrixMaxRetryDelay)
+			continue
+		}
+		delay = matrixRetryDelay
+
+		c.processSync(resp, since == "")
+
+		c.mu.Lock()
+		c.state.NextBatch = resp.NextBatch
+		c.mu.Unlock()
+		if err := c.saveState(); err != nil {
+			logger.ErrorCF("matrix", "Failed to save sync token", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+func (c *MatrixChannel) sync(since string) (*matrixSyncResponse, error) {
+	query := url.Values{}
+	if since == "" {
+		query.Set("filter", matrixInitialFilter)
+	} else {
+		query.Set("since", since)
+		query.Set("filter", matrixSyncFilter)
+		query.Set("timeout", strconv.FormatInt(matrixSyncTimeout.Milliseconds(), 10))
+	}
+
+	var resp matrixSyncResponse
+	if err := c.do(c.ctx, http.MethodGet, "/_matrix/client/v3/sync", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.NextBatch == "" {
+		return nil, fmt.Errorf("sync response without next_batch")
+	}
+	return &resp, nil
+}
+
+// processSync handles one sync response. The timeline of the first sync is
+// existing history and is not delivered.
+func (c *MatrixChannel) processSync(resp *matrixSyncResponse, initial bool) {
+	c.mu.Lock()
+	for _, ev := range resp.AccountData.Events {
+		if ev.Type != "m.direct" {
+			continue
+		}
+		var direct map[string][]string
+		if json.Unmarshal(ev.Content, &direct) == nil {
+			for _, rooms := range direct {
+				for _, roomID := range rooms {
+					c.state.DirectRooms[roomID] = true
+				}
+			}
+		}
+	}
+	for roomID, room := range resp.Rooms.Join {
+		if room.Summary.JoinedMemberCount != nil {
+			c.state.MemberCounts[roomID] = *room.Summary.JoinedMemberCount
+		}
+	}
+	for roomID := range resp.Rooms.Leave {
+		delete(c.state.DirectRooms, roomID)
+		delete(c.state.MemberCounts, roomID)
+		delete(c.state.EncryptedRooms, roomID)
+	}
+	c.mu.Unlock()
+
+	for roomID, room := range resp.Rooms.Join {
+		if hasMatrixEncryption(room.State.Events) || hasMatrixEncryption(room.Timeline.Events) {
+			c.markEncrypted(roomID)
+		}
+	}
+
+	for roomID, room := range resp.Rooms.Invite {
+		c.handleInvite(roomID, room.InviteState.Events)
+	}
+
+	if initial {
+		return
+	}
+	for roomID, room := range resp.Rooms.Join {
+		for _, ev := range room.Timeline.Events {
+			c.handleEvent(roomID, ev)
+		}
+	}
+}
+
+// handleInvite joins rooms the bot is invited to by allowed users and
+// rejects other invites.
+func (c *MatrixChannel) handleInvite(roomID string, events []matrixEvent) {
+	if !c.config.AutoJoin {
+		return
+	}
+
+	var inviter string
+	var isDirect bool
+	for _, ev := range events {
+		if ev.Type != "m.room.member" || ev.StateKey == nil || *ev.StateKey != c.userID {
+			continue
+		}
+		var member struct {
+			Membership string `json:"membership"`
+			IsDirect   bool   `json:"is_direct"`
+		}
+		if json.Unmarshal(ev.Content, &member) == nil && member.Membership == "invite" {
+			inviter, isDirect = ev.Sender, member.IsDirect
+		}
+	}
+
+	if inviter == "" || !c.IsAllowed(inviter) {
+		logger.InfoCF("matrix", "Rejecting room invite", map[string]any{
+			"room_id": roomID,
+			"inviter": inviter,
+		})
+		c.do(c.ctx, http.MethodPost, "/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/leave", nil, map[string]any{}, nil)
+		return
+	}
+	if hasMatrixEncryption(events) {
+		// Join only long enough to tell the inviter why the bot leaves
+		logger.WarnCF("matrix", "Leaving end-to-end encrypted room, which is not supported", map[string]any{
+			"room_id": roomID,
+			"inviter": inviter,
+		})
+		if err := c.do(c.ctx, http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(roomID), nil, map[string]any{}, nil); err == nil {
+			c.sendEncryptedNotice(roomID)
+		}
+		c.do(c.ctx, http.MethodPost, "/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/leave", nil, map[string]any{}, nil)
+		return
+	}
+
+	if err := c.do(c.ctx, http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(roomID), nil, map[string]any{}, nil); err != nil {
+		logger.ErrorCF("matrix", "Failed to join room", map[string]any{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if isDirect {
+		c.mu.Lock()
+		c.state.DirectRooms[roomID] = true
+		c.mu.Unlock()
+	}
+	logger.InfoCF("matrix", "Joined room", map[string]any{
+		"room_id": roomID,
+		"inviter": inviter,
+		"direct":  isDirect,
+	})
+}
+
+func (c *MatrixChannel) handleEvent(roomID string, ev matrixEvent) {
+	if ev.Sender == c.userID {
+		return
+	}
+	if ev.Type == "m.room.encrypted" {
+		c.markEncrypted(roomID)
+		return
+	}
+	if ev.Type != "m.room.message" {
+		return
+	}
+
+	var msg matrixMessageContent
+	if err := json.Unmarshal(ev.Content, &msg); err != nil {
+		return
+	}
+	// Edits repeat the message; only the original is handled.
+	if msg.RelatesTo != nil && msg.RelatesTo.RelType == "m.replace" {
+		return
+	}
+
+	if !c.IsAllowed(ev.Sender) {
+		logger.DebugCF("matrix", "Message rejected by allowlist", map[string]any{
+			"sender": ev.Sender,
+		})
+		return
+	}
+
+	c.mu.Lock()
+	direct := c.isDirectLocked(roomID)
+	c.mu.Unlock()
+
+	if !direct && c.config.MentionOnly && !c.isMentioned(msg) {
+		return
+	}
+
+	chatID := roomID
+	threadRoot := ""
+	if msg.RelatesTo != nil && msg.RelatesTo.RelType == "m.thread" && msg.RelatesTo.EventID != "" {
+		threadRoot = msg.RelatesTo.EventID
+		chatID = roomID + "/" + threadRoot
+	}
+
+	var content string
+	var mediaPaths []string
+	switch msg.MsgType {
+	case "m.text", "m.notice":
+		content = c.stripMention(stripMatrixReplyFallback(msg.Body))
+	case "m.emote":
+		content = "* " + msg.Body
+	case "m.image", "m.file", "m.audio", "m.video":
+		kind := strings.TrimPrefix(msg.MsgType, "m.")
+		content = fmt.Sprintf("[%s: %s]", kind, msg.Body)
+		if localPath := c.downloadMedia(msg.URL, msg.Body); localPath != "" {
+			mediaPaths = append(mediaPaths, localPath)
+		}
+	default:
+		return
+	}
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	c.mu.Lock()
+	c.lastEvents[chatID] = ev.EventID
+	c.mu.Unlock()
+
+	metadata := map[string]string{
+		"platform": "matrix",
+		"room_id":  roomID,
+		"event_id": ev.EventID,
+	}
+	if threadRoot != "" {
+		metadata["thread_id"] = threadRoot
+	}
+	if direct {
+		metadata["peer_kind"] = "direct"
+		metadata["peer_id"] = ev.Sender
+	} else {
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = roomID
+	}
+
+	logger.DebugCF("matrix", "Received message", map[string]any{
+		"sender":  ev.Sender,
+		"chat_id": chatID,
+		"direct":  direct,
+		"preview": utils.Truncate(content, 50),
+	})
+
+	c.setTyping(roomID, true)
+	c.HandleMessage(ev.Sender, chatID, content, mediaPaths, metadata)
+}
+
+// isDirectLocked reports whether roomID is a DM: listed in m.direct, joined
+// on a direct invite, or with only the bot and one other member.
+func (c *MatrixChannel) isDirectLocked(roomID string) bool {
+	return c.state.DirectRooms[roomID] || c.state.MemberCounts[roomID] == 2
+}
+
+func (c *MatrixChannel) isMentioned(msg matrixMessageContent) bool {
+	if msg.Mentions != nil {
+		for _, id := range msg.Mentions.UserIDs {
+			if id == c.userID {
+				return true
+			}
+		}
+	}
+	if strings.Contains(msg.Body, c.userID) {
+		return true
+	}
+	return c.displayName != "" && strings.Contains(strings.ToLower(msg.Body), strings.ToLower(c.displayName))
+}
+
+// stripMention removes a leading "Bot:" or "@bot:server" addressing the bot.
+func (c *MatrixChannel) stripMention(text string) string {
+	for _, name := range []string{c.userID, c.displayName} {
+		if name == "" {
+			continue
+		}
+		if len(text) >= len(name) && strings.EqualFold(text[:len(name)], name) {
+			text = strings.TrimLeft(text[len(name):], ":, ")
+			break
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// stripMatrixReplyFallback drops the "> " quote of the replied-to message
+// that clients prepend to reply bodies.
+func stripMatrixReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+}
+
+func parseMatrixChatID(chatID string) (roomID, threadRoot string) {
+	roomID, threadRoot, _ = strings.Cut(chatID, "/")
+	return roomID, threadRoot
+}
+
+// downloadMedia fetches an mxc:// URI into the local media directory.
+func (c *MatrixChannel) downloadMedia(mxc, filename string) string {
+	serverAndID, ok := strings.CutPrefix(mxc, "mxc://")
+	if !ok || !strings.Contains(serverAndID, "/") {
+		return ""
+	}
+
+	// Authenticated media (Matrix 1.11), falling back to the legacy endpoint.
+	var data []byte
+	var err error
+	for _, path := range []string{"/_matrix/client/v1/media/download/", "/_matrix/media/v3/download/"} {
+		data, err = c.fetch(c.ctx, path+serverAndID)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		logger.ErrorCF("matrix", "Failed to download media", map[string]any{
+			"url":   mxc,
+			"error": err.Error(),
+		})
+		return ""
+	}
+
+	if filename == "" {
+		filename = "attachment"
+	}
+	localPath, err := utils.SaveMediaFile(filename, data)
+	if err != nil {
+		logger.ErrorCF("matrix", "Failed to save media", map[string]any{
+			"error": err.Error(),
+		})
+		return ""
+	}
+	return localPath
+}
+
+func (c *MatrixChannel) setTyping(roomID string, typing bool) {
+	body := map[string]any{"typing": typing}
+	if typing {
+		body["timeout"] = 30000
+	}
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/typing/" + url.PathEscape(c.userID)
+	c.do(c.ctx, http.MethodPut, path, nil, body, nil)
+}
+
+// do calls the client-server API, decoding the JSON response into out.
+// Rate-limited requests are retried after the server's retry_after_ms.
+func (c *MatrixChannel) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	endpoint := c.homeserver + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			if out == nil {
+				return nil
+			}
+			return json.Unmarshal(data, out)
+		}
+
+		var apiErr struct {
+			ErrCode      string `json:"errcode"`
+			Error        string `json:"error"`
+			RetryAfterMs int64  `json:"retry_after_ms"`
+		}
+		json.Unmarshal(data, &apiErr)
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			wait := min(time.Duration(apiErr.RetryAfterMs)*time.Millisecond, 30*time.Second)
+			if wait <= 0 {
+				wait = time.Second
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+		err = fmt.Errorf("matrix API %s %s returned status %d: %s %s", method, path, resp.StatusCode, apiErr.ErrCode, apiErr.Error)
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return &RetryAfterError{Err: err, After: time.Duration(apiErr.RetryAfterMs) * time.Millisecond}
+		case resp.StatusCode >= 400 && resp.StatusCode < 500:
+			return &PermanentError{Err: err}
+		}
+		return err
+	}
+}
+
+// fetch downloads a binary resource, up to matrixMaxMediaSize bytes.
+func (c *MatrixChannel) fetch(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.homeserver+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, matrixMaxMediaSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > matrixMaxMediaSize {
+		return nil, fmt.Errorf("media larger than %d bytes", matrixMaxMediaSize)
+	}
+	return data, nil
+}
+
+// hasMatrixEncryption reports whether events enable end-to-end encryption.
+func hasMatrixEncryption(events []matrixEvent) bool {
+	for _, ev := range events {
+		if ev.Type == "m.room.encryption" && ev.StateKey != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// markEncrypted records that a room uses end-to-end encryption. Its
+// messages cannot be read and no replies are sent to it; the room is told
+// so once.
+func (c *MatrixChannel) markEncrypted(roomID string) {
+	c.mu.Lock()
+	known := c.state.EncryptedRooms[roomID]
+	c.state.EncryptedRooms[roomID] = true
+	c.mu.Unlock()
+	if !known {
+		logger.WarnCF("matrix", "Room is end-to-end encrypted, which is not supported; ignoring it", map[string]any{
+			"room_id": roomID,
+		})
+		c.sendEncryptedNotice(roomID)
+	}
+}
+
+// sendEncryptedNotice posts matrixEncryptedNotice to an encrypted room.
+func (c *MatrixChannel) sendEncryptedNotice(roomID string) {
+	err := c.sendEvent(c.ctx, roomID, map[string]any{
+		"msgtype": "m.notice",
+		"body":    matrixEncryptedNotice,
+	})
+	if err != nil {
+		logger.ErrorCF("matrix", "Failed to post encryption notice", map[string]any{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// loadState restores the sync token saved for this account, if any.
+func (c *MatrixChannel) loadState() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = matrixState{UserID: c.userID}
+	if data, err := os.ReadFile(c.stateFile); err == nil {
+		var saved matrixState
+		if json.Unmarshal(data, &saved) == nil && saved.UserID == c.userID {
+			c.state = saved
+		}
+	}
+	if c.state.DirectRooms == nil {
+		c.state.DirectRooms = make(map[string]bool)
+	}
+	if c.state.MemberCounts == nil {
+		c.state.MemberCounts = make(map[string]int)
+	}
+	if c.state.EncryptedRooms == nil {
+		c.state.EncryptedRooms = make(map[string]bool)
+	}
+}
+
+// saveState writes the state atomically (temp file + rename).
+func (c *MatrixChannel) saveState() error {
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.stateFile), 0o755); err != nil {
+		return err
+	}
+	tempFile := c.stateFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, c.stateFile); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,461 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const matrixTestUser = "@bot:example.org"
+
+// fakeHomeserver serves the client-server endpoints the Matrix channel uses.
+// Sync responses are queued by the test; once the queue is empty, sync
+// returns an empty batch.
+type fakeHomeserver struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	syncs   []string
+	since   []string
+	joined  []string
+	left    []string
+	sent    []map[string]any
+	media   map[string][]byte
+	uploads map[string]fakeUpload // content URI -> upload
+}
+
+type fakeUpload struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+func newFakeHomeserver(t *testing.T) *fakeHomeserver {
+	t.Helper()
+	hs := &fakeHomeserver{media: make(map[string][]byte), uploads: make(map[string]fakeUpload)}
+	hs.Server = httptest.NewServer(http.HandlerFunc(hs.handle))
+	t.Cleanup(hs.Close)
+	return hs
+}
+
+func (hs *fakeHomeserver) queueSync(body string) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.syncs = append(hs.syncs, body)
+}
+
+func (hs *fakeHomeserver) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test_token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"errcode":"M_UNKNOWN_TOKEN","error":"bad token"}`)
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	switch {
+	case path == "/_matrix/client/v3/account/whoami":
+		io.WriteString(w, `{"user_id":"`+matrixTestUser+`"}`)
+	case strings.HasPrefix(path, "/_matrix/client/v3/profile/"):
+		io.WriteString(w, `{"displayname":"Pico"}`)
+	case path == "/_matrix/client/v3/sync":
+		hs.since = append(hs.since, r.URL.Query().Get("since"))
+		if len(hs.syncs) == 0 {
+			hs.mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			hs.mu.Lock()
+			io.WriteString(w, `{"next_batch":"`+r.URL.Query().Get("since")+`"}`)
+			return
+		}
+		body := hs.syncs[0]
+		hs.syncs = hs.syncs[1:]
+		io.WriteString(w, body)
+	case strings.HasPrefix(path, "/_matrix/client/v3/join/"):
+		roomID, _ := url.PathUnescape(strings.TrimPrefix(path, "/_matrix/client/v3/join/"))
+		hs.joined = append(hs.joined, roomID)
+		io.WriteString(w, `{"room_id":"`+roomID+`"}`)
+	case strings.HasSuffix(path, "/leave"):
+		roomID, _ := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(path, "/_matrix/client/v3/rooms/"), "/leave"))
+		hs.left = append(hs.left, roomID)
+		io.WriteString(w, `{}`)
+	case strings.Contains(path, "/typing/"):
+		io.WriteString(w, `{}`)
+	case strings.Contains(path, "/send/m.room.message/"):
+		var content map[string]any
+		json.NewDecoder(r.Body).Decode(&content)
+		roomID, _ := url.PathUnescape(strings.Split(strings.TrimPrefix(path, "/_matrix/client/v3/rooms/"), "/")[0])
+		content["_room_id"] = roomID
+		hs.sent = append(hs.sent, content)
+		io.WriteString(w, `{"event_id":"$sent"}`)
+	case path == "/_matrix/media/v3/upload":
+		data, _ := io.ReadAll(r.Body)
+		uri := fmt.Sprintf("mxc://example.org/up%d", len(hs.uploads))
+		hs.uploads[uri] = fakeUpload{
+			filename:    r.URL.Query().Get("filename"),
+			contentType: r.Header.Get("Content-Type"),
+			data:        data,
+		}
+		io.WriteString(w, `{"content_uri":"`+uri+`"}`)
+	case strings.HasPrefix(path, "/_matrix/client/v1/media/download/"):
+		data, ok := hs.media[strings.TrimPrefix(path, "/_matrix/client/v1/media/download/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"errcode":"M_UNRECOGNIZED"}`)
+	}
+}
+
+func newTestMatrixChannel(t *testing.T, hs *fakeHomeserver, stateDir string) (*MatrixChannel, *bus.MessageBus) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	ch, err := NewMatrixChannel(config.MatrixConfig{
+		Homeserver:  hs.URL,
+		AccessToken: "test_token",
+		AutoJoin:    true,
+		MentionOnly: true,
+		AllowFrom:   config.FlexibleStringSlice{"@alice:example.org"},
+	}, msgBus, stateDir)
+	if err != nil {
+		t.Fatalf("NewMatrixChannel() error: %v", err)
+	}
+	return ch, msgBus
+}
+
+func startMatrixChannel(t *testing.T, ch *MatrixChannel) {
+	t.Helper()
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMatrixChannel_InvitesHistoryAndDirectMessage(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	hs.media["example.org/img1"] = []byte("png-bytes")
+	stateDir := t.TempDir()
+
+	// The first sync carries two invites and some room history.
+	hs.queueSync(`{
+		"next_batch": "s1",
+		"rooms": {
+			"invite": {
+				"!dm:example.org": {"invite_state": {"events": [
+					{"type": "m.room.member", "sender": "@alice:example.org", "state_key": "` + matrixTestUser + `",
+					 "content": {"membership": "invite", "is_direct": true}}
+				]}},
+				"!spam:example.org": {"invite_state": {"events": [
+					{"type": "m.room.member", "sender": "@mallory:example.org", "state_key": "` + matrixTestUser + `",
+					 "content": {"membership": "invite"}}
+				]}}
+			},
+			"join": {
+				"!old:example.org": {"timeline": {"events": [
+					{"type": "m.room.message", "sender": "@alice:example.org", "event_id": "$old",
+					 "content": {"msgtype": "m.text", "body": "old history"}}
+				]}}
+			}
+		}
+	}`)
+	hs.queueSync(`{
+		"next_batch": "s2",
+		"rooms": {"join": {"!dm:example.org": {"timeline": {"events": [
+			{"type": "m.room.message", "sender": "@mallory:example.org", "event_id": "$blocked",
+			 "content": {"msgtype": "m.text", "body": "let me in"}},
+			{"type": "m.room.message", "sender": "@alice:example.org", "event_id": "$img",
+			 "content": {"msgtype": "m.image", "body": "cat.png", "url": "mxc://example.org/img1"}}
+		]}}}}
+	}`)
+
+	ch, msgBus := newTestMatrixChannel(t, hs, stateDir)
+	startMatrixChannel(t, ch)
+
+	msg := consumeInbound(t, msgBus)
+	if msg.SenderID != "@alice:example.org" || msg.ChatID != "!dm:example.org" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if msg.Content != "[image: cat.png]" {
+		t.Errorf("Content = %q", msg.Content)
+	}
+	if msg.Metadata["peer_kind"] != "direct" || msg.Metadata["peer_id"] != "@alice:example.org" {
+		t.Errorf("peer = %s/%s, want direct/@alice:example.org", msg.Metadata["peer_kind"], msg.Metadata["peer_id"])
+	}
+	if len(msg.Media) != 1 {
+		t.Fatalf("Media = %v, want one file", msg.Media)
+	}
+	data, err := os.ReadFile(msg.Media[0])
+	if err != nil || string(data) != "png-bytes" {
+		t.Errorf("media file = %q, %v", data, err)
+	}
+	os.Remove(msg.Media[0])
+
+	hs.mu.Lock()
+	joined, left := hs.joined, hs.left
+	hs.mu.Unlock()
+	if len(joined) != 1 || joined[0] != "!dm:example.org" {
+		t.Errorf("joined = %v, want [!dm:example.org]", joined)
+	}
+	if len(left) != 1 || left[0] != "!spam:example.org" {
+		t.Errorf("left = %v, want [!spam:example.org]", left)
+	}
+
+	waitFor(t, "sync token to be saved", func() bool {
+		data, _ := os.ReadFile(filepath.Join(stateDir, matrixStateFileName))
+		var state matrixState
+		return json.Unmarshal(data, &state) == nil && state.NextBatch == "s2"
+	})
+
+	// A restart resumes from the saved token.
+	ch.Stop(context.Background())
+	ch2, _ := newTestMatrixChannel(t, hs, stateDir)
+	startMatrixChannel(t, ch2)
+	waitFor(t, "resumed sync", func() bool {
+		hs.mu.Lock()
+		defer hs.mu.Unlock()
+		for _, since := range hs.since[2:] {
+			if since == "" {
+				t.Errorf("restarted channel synced without a token")
+				return true
+			}
+		}
+		return len(hs.since) > 3
+	})
+	ch2.mu.Lock()
+	direct := ch2.isDirectLocked("!dm:example.org")
+	ch2.mu.Unlock()
+	if !direct {
+		t.Error("direct room not restored from state")
+	}
+}
+
+func TestMatrixChannel_GroupThreadReply(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	stateDir := t.TempDir()
+	os.WriteFile(filepath.Join(stateDir, matrixStateFileName),
+		[]byte(`{"user_id":"`+matrixTestUser+`","next_batch":"s5"}`), 0o600)
+
+	hs.queueSync(`{
+		"next_batch": "s6",
+		"rooms": {"join": {"!group:example.org": {
+			"summary": {"m.joined_member_count": 5},
+			"timeline": {"events": [
+				{"type": "m.room.message", "sender": "@alice:example.org", "event_id": "$chatter",
+				 "content": {"msgtype": "m.text", "body": "not for the bot"}},
+				{"type": "m.room.message", "sender": "@alice:example.org", "event_id": "$q",
+				 "content": {"msgtype": "m.text", "body": "Pico: what time is it?",
+				  "m.relates_to": {"rel_type": "m.thread", "event_id": "$root"}}}
+			]}
+		}}}
+	}`)
+
+	ch, msgBus := newTestMatrixChannel(t, hs, stateDir)
+	startMatrixChannel(t, ch)
+
+	msg := consumeInbound(t, msgBus)
+	if msg.ChatID != "!group:example.org/$root" {
+		t.Errorf("ChatID = %q", msg.ChatID)
+	}
+	if msg.Content != "what time is it?" {
+		t.Errorf("Content = %q", msg.Content)
+	}
+	if msg.Metadata["peer_kind"] != "group" || msg.Metadata["peer_id"] != "!group:example.org" {
+		t.Errorf("peer = %s/%s, want group/!group:example.org", msg.Metadata["peer_kind"], msg.Metadata["peer_id"])
+	}
+
+	hs.mu.Lock()
+	since := hs.since[0]
+	hs.mu.Unlock()
+	if since != "s5" {
+		t.Errorf("first sync since = %q, want saved token s5", since)
+	}
+
+	err := ch.Send(context.Background(), bus.OutboundMessage{
+		Channel: "matrix",
+		ChatID:  msg.ChatID,
+		Content: "Noon.",
+	})
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if len(hs.sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(hs.sent))
+	}
+	sent := hs.sent[0]
+	if sent["_room_id"] != "!group:example.org" || sent["body"] != "Noon." {
+		t.Errorf("unexpected message: %v", sent)
+	}
+	rel, _ := sent["m.relates_to"].(map[string]any)
+	if rel["rel_type"] != "m.thread" || rel["event_id"] != "$root" {
+		t.Errorf("m.relates_to = %v, want thread $root", rel)
+	}
+	if reply, _ := rel["m.in_reply_to"].(map[string]any); reply["event_id"] != "$q" {
+		t.Errorf("m.in_reply_to = %v, want $q", rel["m.in_reply_to"])
+	}
+}
+
+func TestMatrixChannel_EncryptedRoomsAreNotSupported(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	stateDir := t.TempDir()
+	os.WriteFile(filepath.Join(stateDir, matrixStateFileName),
+		[]byte(`{"user_id":"`+matrixTestUser+`","next_batch":"s5"}`), 0o600)
+
+	hs.queueSync(`{
+		"next_batch": "s6",
+		"rooms": {
+			"invite": {"!secret:example.org": {"invite_state": {"events": [
+				{"type": "m.room.encryption", "state_key": "", "sender": "@alice:example.org",
+				 "content": {"algorithm": "m.megolm.v1.aes-sha2"}},
+				{"type": "m.room.member", "state_key": "` + matrixTestUser + `", "sender": "@alice:example.org",
+				 "content": {"membership": "invite"}}
+			]}}},
+			"join": {"!team:example.org": {
+				"timeline": {"events": [
+					{"type": "m.room.encrypted", "sender": "@alice:example.org", "event_id": "$e1",
+					 "content": {"algorithm": "m.megolm.v1.aes-sha2", "ciphertext": "..."}},
+					{"type": "m.room.encrypted", "sender": "@alice:example.org", "event_id": "$e2",
+					 "content": {"algorithm": "m.megolm.v1.aes-sha2", "ciphertext": "..."}}
+				]}
+			}}
+		}
+	}`)
+
+	ch, _ := newTestMatrixChannel(t, hs, stateDir)
+	startMatrixChannel(t, ch)
+
+	waitFor(t, "encrypted rooms to be handled", func() bool {
+		hs.mu.Lock()
+		defer hs.mu.Unlock()
+		return len(hs.left) == 1 && len(hs.sent) == 2
+	})
+	hs.mu.Lock()
+	if len(hs.joined) != 1 || hs.joined[0] != "!secret:example.org" || hs.left[0] != "!secret:example.org" {
+		t.Errorf("joined %v, left %v; want the encrypted room joined only to leave it", hs.joined, hs.left)
+	}
+	// Each encrypted room is told once why the bot does not answer
+	noticed := map[string]bool{}
+	for _, sent := range hs.sent {
+		if sent["msgtype"] != "m.notice" || sent["body"] != matrixEncryptedNotice {
+			t.Errorf("sent %v, want only the encryption notice", sent)
+		}
+		noticed[sent["_room_id"].(string)] = true
+	}
+	if !noticed["!secret:example.org"] || !noticed["!team:example.org"] {
+		t.Errorf("notices went to %v, want both encrypted rooms", noticed)
+	}
+	hs.mu.Unlock()
+
+	waitFor(t, "room marked encrypted", func() bool {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		return ch.state.EncryptedRooms["!team:example.org"]
+	})
+	err := ch.Send(context.Background(), bus.OutboundMessage{Channel: "matrix", ChatID: "!team:example.org", Content: "hi"})
+	var permanent *PermanentError
+	if !errors.As(err, &permanent) {
+		t.Errorf("Send() to encrypted room error = %v, want a permanent error", err)
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if len(hs.sent) != 2 {
+		t.Errorf("sent %v to an encrypted room", hs.sent[2:])
+	}
+}
+
+func TestMatrixChannel_SendUploadsMedia(t *testing.T) {
+	hs := newFakeHomeserver(t)
+	stateDir := t.TempDir()
+	os.WriteFile(filepath.Join(stateDir, matrixStateFileName),
+		[]byte(`{"user_id":"`+matrixTestUser+`","next_batch":"s5"}`), 0o600)
+
+	ch, _ := newTestMatrixChannel(t, hs, stateDir)
+	startMatrixChannel(t, ch)
+
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "chart.png")
+	report := filepath.Join(dir, "report.txt")
+	os.WriteFile(chart, []byte("\x89PNG\r\n\x1a\nchart"), 0o600)
+	os.WriteFile(report, []byte("numbers"), 0o600)
+
+	err := ch.Send(context.Background(), bus.OutboundMessage{
+		Channel: "matrix",
+		ChatID:  "!room:example.org",
+		Content: "Here you go.",
+		Media:   []string{chart, report},
+	})
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if len(hs.sent) != 3 {
+		t.Fatalf("sent %d events, want text plus two files", len(hs.sent))
+	}
+	if hs.sent[0]["msgtype"] != "m.text" || hs.sent[0]["body"] != "Here you go." {
+		t.Errorf("first event = %v, want the text", hs.sent[0])
+	}
+	for i, want := range []struct{ msgtype, name, mime string }{
+		{"m.image", "chart.png", "image/png"},
+		{"m.file", "report.txt", "text/plain; charset=utf-8"},
+	} {
+		sent := hs.sent[i+1]
+		uri, _ := sent["url"].(string)
+		if sent["msgtype"] != want.msgtype || sent["body"] != want.name {
+			t.Errorf("event %d = %v, want %s %s", i+1, sent, want.msgtype, want.name)
+		}
+		upload, ok := hs.uploads[uri]
+		if !ok {
+			t.Errorf("event %d url %q was not uploaded", i+1, uri)
+			continue
+		}
+		if upload.filename != want.name || upload.contentType != want.mime {
+			t.Errorf("upload %d = %+v, want %s as %s", i+1, upload, want.name, want.mime)
+		}
+	}
+	if string(hs.uploads[hs.sent[2]["url"].(string)].data) != "numbers" {
+		t.Error("uploaded file content differs")
+	}
+}
+
+func TestStripMatrixReplyFallback(t *testing.T) {
+	body := "> <@alice:example.org> original\n> second line\n\nthe reply"
+	if got := stripMatrixReplyFallback(body); got != "the reply" {
+		t.Errorf("stripMatrixReplyFallback() = %q", got)
+	}
+	if got := stripMatrixReplyFallback("plain"); got != "plain" {
+		t.Errorf("stripMatrixReplyFallback() = %q", got)
+	}
+}
@@ -0,0 +1,38 @@
+package channels
+
+import (
+	"context"
+	"strings"
+)
+
+// ReasoningSender is implemented by channels that can show a model's
+// reasoning collapsed, behind a spoiler or in a quote, so it stays out of
+// the way of the reply.
+type ReasoningSender interface {
+	SendReasoning(ctx context.Context, chatID, summary string) error
+}
+
+// SendReasoning shows summary collapsed in chatID on the named channel.
+// Channels that cannot collapse text are skipped.
+func (m *Manager) SendReasoning(ctx context.Context, channelName, chatID, summary string) error {
+	m.mu.RLock()
+	ch, exists := m.channels[channelName]
+	m.mu.RUnlock()
+	if !exists {
+		return nil
+	}
+	sender, ok := ch.(ReasoningSender)
+	if !ok {
+		return nil
+	}
+	return sender.SendReasoning(ctx, chatID, summary)
+}
+
+// quoteLines prefixes every line of text with a markdown quote marker.
+func quoteLines(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = "> " + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -30,6 +30,7 @@ type SlackChannel struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	pendingAcks  sync.Map
+	approvals    approvalGate
 }
 
 type slackMessageRef struct {
@@ -148,6 +149,117 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// SendEditable posts content and returns the message timestamp, which Slack
+// uses as the message ID.
+func (c *SlackChannel) SendEditable(ctx context.Context, chatID, content string) (string, error) {
+	if !c.IsRunning() {
+		return "", fmt.Errorf("slack channel not running")
+	}
+
+	channelID, threadTS := parseSlackChatID(chatID)
+	if channelID == "" {
+		return "", fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+
+	opts := []slack.MsgOption{
+		slack.MsgOptionText(content, false),
+	}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+
+	_, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
+	if err != nil {
+		return "", fmt.Errorf("failed to send slack message: %w", err)
+	}
+
+	if ref, ok := c.pendingAcks.LoadAndDelete(chatID); ok {
+		msgRef := ref.(slackMessageRef)
+		c.api.AddReaction("white_check_mark", slack.ItemRef{
+			Channel:   msgRef.ChannelID,
+			Timestamp: msgRef.Timestamp,
+		})
+	}
+
+	return ts, nil
+}
+
+// EditMessage updates a message posted by SendEditable via chat.update.
+func (c *SlackChannel) EditMessage(ctx context.Context, chatID, messageID, content string) error {
+	channelID, _ := parseSlackChatID(chatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+
+	_, _, _, err := c.api.UpdateMessageContext(ctx, channelID, messageID, slack.MsgOptionText(content, false))
+	if err != nil {
+		return fmt.Errorf("failed to update slack message: %w", err)
+	}
+	return nil
+}
+
+// SendReasoning shows a reasoning summary as a quote; Slack folds long
+// messages behind "Show more".
+func (c *SlackChannel) SendReasoning(ctx context.Context, chatID, summary string) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+
+	channelID, threadTS := parseSlackChatID(chatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+
+	text := "*Reasoning*\n" + quoteLines(utils.Truncate(summary, c.MaxMessageLength()-200))
+	opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := c.api.PostMessageContext(ctx, channelID, opts...); err != nil {
+		return fmt.Errorf("failed to send slack message: %w", err)
+	}
+	return nil
+}
+
+// SendApprovalPrompt asks for approval with Approve and Deny buttons.
+func (c *SlackChannel) SendApprovalPrompt(ctx context.Context, chatID string, prompt ApprovalPrompt) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+
+	channelID, threadTS := parseSlackChatID(chatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+
+	text := utils.Truncate(approvalTitle+"\n"+prompt.Summary, 2900)
+	opts := []slack.MsgOption{
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.PlainTextType, text, false, false), nil, nil),
+			slack.NewActionBlock("approval",
+				slack.NewButtonBlockElement("approve", approvalAction(prompt.ID, true),
+					slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false)).WithStyle(slack.StylePrimary),
+				slack.NewButtonBlockElement("deny", approvalAction(prompt.ID, false),
+					slack.NewTextBlockObject(slack.PlainTextType, "Deny", false, false)).WithStyle(slack.StyleDanger),
+			),
+		),
+	}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := c.api.PostMessageContext(ctx, channelID, opts...); err != nil {
+		return fmt.Errorf("failed to send slack message: %w", err)
+	}
+	c.approvals.remember(prompt)
+	return nil
+}
+
+// MaxMessageLength is Slack's recommended limit for the text field.
+func (c *SlackChannel) MaxMessageLength() int {
+	return 4000
+}
+
 func (c *SlackChannel) eventLoop() {
 	for {
 		select {
@@ -163,14 +275,76 @@ func (c *SlackChannel) eventLoop() {
 			case socketmode.EventTypeSlashCommand:
 				c.handleSlashCommand(event)
 			case socketmode.EventTypeInteractive:
-				if event.Request != nil {
-					c.socketClient.Ack(*event.Request)
-				}
+				c.handleInteractive(event)
 			}
 		}
 	}
 }
 
+// handleInteractive turns a press of an approval button into an approval
+// reply from the user who pressed it.
+func (c *SlackChannel) handleInteractive(event socketmode.Event) {
+	if event.Request != nil {
+		c.socketClient.Ack(*event.Request)
+	}
+
+	callback, ok := event.Data.(slack.InteractionCallback)
+	if !ok || callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+	for _, action := range callback.ActionCallback.BlockActions {
+		if id, approve, ok := parseApprovalAction(action.Value); ok {
+			c.handleApprovalAction(callback, id, approve)
+		}
+	}
+}
+
+func (c *SlackChannel) handleApprovalAction(callback slack.InteractionCallback, id string, approve bool) {
+	senderID := callback.User.ID
+	channelID := callback.Channel.ID
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("slack", "Approval rejected by allowlist", map[string]any{
+			"user_id": senderID,
+		})
+		return
+	}
+	if !c.approvals.allow(id, senderID) {
+		_, err := c.api.PostEphemeralContext(c.ctx, channelID, senderID,
+			slack.MsgOptionText("Only the user who asked can answer this.", false))
+		if err != nil {
+			logger.DebugCF("slack", "Failed to refuse approval answer", map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	// Replacing the blocks drops the buttons, so the prompt can't be
+	// answered twice
+	text := callback.Message.Text + "\n\n" + approvalOutcome(approve, "<@"+senderID+">")
+	_, _, _, err := c.api.UpdateMessageContext(c.ctx, channelID, callback.Message.Timestamp,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)),
+	)
+	if err != nil {
+		logger.DebugCF("slack", "Failed to update approval prompt", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	chatID := channelID
+	if threadTS := callback.Message.ThreadTimestamp; threadTS != "" {
+		chatID = channelID + "/" + threadTS
+	}
+	metadata := map[string]string{
+		"approval_id": id,
+		"channel_id":  channelID,
+		"platform":    "slack",
+		"team_id":     c.teamID,
+	}
+	c.HandleMessage(senderID, chatID, ApprovalReply(id, approve), nil, metadata)
+}
+
 func (c *SlackChannel) handleEventsAPI(event socketmode.Event) {
 	if event.Request != nil {
 		c.socketClient.Ack(*event.Request)
@@ -0,0 +1,174 @@
+package channels
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// DefaultStreamInterval is the minimum time between two progressive edits of
+// a streamed reply. Chat platforms rate-limit edits, roughly one per second.
+const DefaultStreamInterval = time.Second
+
+// MessageEditor is implemented by channels that can edit a message after it
+// was sent. Streamed replies are rendered by editing one message in place.
+type MessageEditor interface {
+	// SendEditable sends content to chatID and returns an ID for EditMessage.
+	SendEditable(ctx context.Context, chatID, content string) (string, error)
+	// EditMessage replaces the content of a message returned by SendEditable.
+	EditMessage(ctx context.Context, chatID, messageID, content string) error
+	// MaxMessageLength is the longest content a single message can hold.
+	MaxMessageLength() int
+}
+
+// Stream progressively renders a reply into a single editable message.
+// Updates are throttled; Finish always delivers the complete content.
+type Stream struct {
+	channel  Channel
+	editor   MessageEditor
+	chatID   string
+	interval time.Duration
+
+	mu        sync.Mutex
+	messageID string
+	lastText  string
+	lastEdit  time.Time
+	broken    bool
+}
+
+// NewStream returns a stream for chatID on ch, or nil if ch cannot edit messages.
+func NewStream(ch Channel, chatID string, interval time.Duration) *Stream {
+	editor, ok := ch.(MessageEditor)
+	if !ok {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DefaultStreamInterval
+	}
+	return &Stream{
+		channel:  ch,
+		editor:   editor,
+		chatID:   chatID,
+		interval: interval,
+	}
+}
+
+// OpenStream returns a stream for chatID on the named channel, or nil if the
+// channel is unknown, internal, or does not support editing.
+func (m *Manager) OpenStream(channelName, chatID string) *Stream {
+	m.mu.RLock()
+	ch, ok := m.channels[channelName]
+	m.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return NewStream(ch, chatID, DefaultStreamInterval)
+}
+
+// Update shows content, the full text generated so far. Calls that arrive
+// within the throttle interval of the previous edit are skipped.
+func (s *Stream) Update(ctx context.Context, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.broken || content == "" || time.Since(s.lastEdit) < s.interval {
+		return
+	}
+
+	text := s.truncate(content)
+	if text == s.lastText {
+		return
+	}
+
+	var err error
+	if s.messageID == "" {
+		s.messageID, err = s.editor.SendEditable(ctx, s.chatID, text)
+	} else {
+		err = s.editor.EditMessage(ctx, s.chatID, s.messageID, text)
+	}
+	s.lastEdit = time.Now()
+	if err != nil {
+		// Stop editing; Finish still delivers the final content.
+		s.broken = true
+		logger.DebugCF("channels", "Stream update failed", map[string]any{
+			"channel": s.channel.Name(),
+			"chat_id": s.chatID,
+			"error":   err.Error(),
+		})
+		return
+	}
+	s.lastText = text
+}
+
+// Started reports whether a message has been sent for this stream.
+func (s *Stream) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messageID != ""
+}
+
+// Finish writes the complete content. Content that does not fit into one
+// message is continued in follow-up messages. If nothing was streamed yet,
+// the content is sent as an ordinary message.
+func (s *Stream) Finish(ctx context.Context, content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if content == "" {
+		return nil
+	}
+	if s.messageID == "" {
+		return s.channel.Send(ctx, bus.OutboundMessage{
+			Channel: s.channel.Name(),
+			ChatID:  s.chatID,
+			Content: content,
+		})
+	}
+
+	chunks := []string{content}
+	if maxLen := s.editor.MaxMessageLength(); maxLen > 0 {
+		chunks = utils.SplitMessage(content, maxLen)
+	}
+	first, rest := chunks[0], chunks[1:]
+	if first != s.lastText {
+		if err := s.editor.EditMessage(ctx, s.chatID, s.messageID, first); err != nil {
+			logger.WarnCF("channels", "Final stream edit failed, sending as new message", map[string]any{
+				"channel": s.channel.Name(),
+				"chat_id": s.chatID,
+				"error":   err.Error(),
+			})
+			rest = []string{content}
+		}
+	}
+	s.lastText = first
+
+	for _, chunk := range rest {
+		if err := s.channel.Send(ctx, bus.OutboundMessage{
+			Channel: s.channel.Name(),
+			ChatID:  s.chatID,
+			Content: chunk,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate keeps in-progress text within the message limit; Finish splits
+// the final content properly.
+func (s *Stream) truncate(content string) string {
+	maxLen := s.editor.MaxMessageLength()
+	if maxLen <= 0 || len(content) <= maxLen {
+		return content
+	}
+	cut := maxLen - len("…")
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + "…"
+}
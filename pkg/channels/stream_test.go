@@ -0,0 +1,157 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+var (
+	_ MessageEditor = (*TelegramChannel)(nil)
+	_ MessageEditor = (*DiscordChannel)(nil)
+	_ MessageEditor = (*SlackChannel)(nil)
+)
+
+type editableChannel struct {
+	*BaseChannel
+	maxLen  int
+	editErr error
+	sent    []string
+	edits   []string
+}
+
+func newEditableChannel(maxLen int) *editableChannel {
+	return &editableChannel{
+		BaseChannel: NewBaseChannel("editable", nil, nil, nil),
+		maxLen:      maxLen,
+	}
+}
+
+func (c *editableChannel) Start(ctx context.Context) error { return nil }
+func (c *editableChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *editableChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.sent = append(c.sent, msg.Content)
+	return nil
+}
+
+func (c *editableChannel) SendEditable(ctx context.Context, chatID, content string) (string, error) {
+	c.sent = append(c.sent, content)
+	return "msg-1", nil
+}
+
+func (c *editableChannel) EditMessage(ctx context.Context, chatID, messageID, content string) error {
+	if c.editErr != nil {
+		return c.editErr
+	}
+	c.edits = append(c.edits, content)
+	return nil
+}
+
+func (c *editableChannel) MaxMessageLength() int { return c.maxLen }
+
+type plainChannel struct {
+	*BaseChannel
+}
+
+func (c *plainChannel) Start(ctx context.Context) error                         { return nil }
+func (c *plainChannel) Stop(ctx context.Context) error                          { return nil }
+func (c *plainChannel) Send(ctx context.Context, msg bus.OutboundMessage) error { return nil }
+
+func TestNewStream_RequiresEditor(t *testing.T) {
+	plain := &plainChannel{BaseChannel: NewBaseChannel("plain", nil, nil, nil)}
+	if s := NewStream(plain, "chat", time.Second); s != nil {
+		t.Fatal("expected nil stream for channel without editing support")
+	}
+	if s := NewStream(newEditableChannel(100), "chat", time.Second); s == nil {
+		t.Fatal("expected stream for editable channel")
+	}
+}
+
+func TestStream_ThrottlesUpdates(t *testing.T) {
+	ch := newEditableChannel(100)
+	s := NewStream(ch, "chat", time.Hour)
+	ctx := context.Background()
+
+	s.Update(ctx, "Hel")
+	s.Update(ctx, "Hello")
+	s.Update(ctx, "Hello wor")
+
+	if len(ch.sent) != 1 || ch.sent[0] != "Hel" {
+		t.Fatalf("expected only the first update to be sent, got %v", ch.sent)
+	}
+	if len(ch.edits) != 0 {
+		t.Fatalf("expected throttled edits, got %v", ch.edits)
+	}
+
+	if err := s.Finish(ctx, "Hello world"); err != nil {
+		t.Fatalf("Finish() error: %v", err)
+	}
+	if len(ch.edits) != 1 || ch.edits[0] != "Hello world" {
+		t.Fatalf("expected final edit with full content, got %v", ch.edits)
+	}
+}
+
+func TestStream_FinishWithoutUpdatesSendsOnce(t *testing.T) {
+	ch := newEditableChannel(100)
+	s := NewStream(ch, "chat", time.Second)
+
+	if err := s.Finish(context.Background(), "done"); err != nil {
+		t.Fatalf("Finish() error: %v", err)
+	}
+	if len(ch.sent) != 1 || ch.sent[0] != "done" || len(ch.edits) != 0 {
+		t.Fatalf("expected a single plain send, got sent=%v edits=%v", ch.sent, ch.edits)
+	}
+}
+
+func TestStream_FinishSplitsLongContent(t *testing.T) {
+	ch := newEditableChannel(60)
+	s := NewStream(ch, "chat", time.Nanosecond)
+	ctx := context.Background()
+
+	s.Update(ctx, "start")
+	long := strings.Repeat("word ", 30)
+	if err := s.Finish(ctx, long); err != nil {
+		t.Fatalf("Finish() error: %v", err)
+	}
+
+	if len(ch.edits) != 1 || len(ch.edits[0]) > 60 {
+		t.Fatalf("expected first chunk edited in place within limit, got %v", ch.edits)
+	}
+	if len(ch.sent) < 2 {
+		t.Fatalf("expected overflow to be sent as follow-up messages, got %v", ch.sent)
+	}
+	got := ch.edits[0] + strings.Join(ch.sent[1:], "")
+	if strings.ReplaceAll(got, " ", "") != strings.ReplaceAll(long, " ", "") {
+		t.Fatalf("content lost while splitting: %q", got)
+	}
+}
+
+func TestStream_UpdateTruncatesToLimit(t *testing.T) {
+	ch := newEditableChannel(10)
+	s := NewStream(ch, "chat", time.Second)
+
+	s.Update(context.Background(), "abcdefghijklmnop")
+	if len(ch.sent) != 1 || len(ch.sent[0]) > 10 || !strings.HasSuffix(ch.sent[0], "…") {
+		t.Fatalf("expected truncated in-progress text, got %v", ch.sent)
+	}
+}
+
+func TestStream_FinishFallsBackWhenEditFails(t *testing.T) {
+	ch := newEditableChannel(100)
+	s := NewStream(ch, "chat", time.Second)
+	ctx := context.Background()
+
+	s.Update(ctx, "partial")
+	ch.editErr = errors.New("message deleted")
+	if err := s.Finish(ctx, "partial and complete"); err != nil {
+		t.Fatalf("Finish() error: %v", err)
+	}
+	if len(ch.sent) != 2 || ch.sent[1] != "partial and complete" {
+		t.Fatalf("expected full content resent as new message, got %v", ch.sent)
+	}
+}
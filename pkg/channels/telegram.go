@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -32,6 +33,7 @@ type TelegramChannel struct {
 	transcriber  *voice.GroqTranscriber
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
+	approvals    approvalGate
 }
 
 type thinkingCancel struct {
@@ -142,6 +144,10 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return c.handleMessage(ctx, &message)
 	}, th.AnyMessage())
 
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handleApprovalCallback(ctx, query)
+	}, th.CallbackDataPrefix(approvalActionPrefix))
+
 	c.setRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]any{
 		"username": c.bot.Username(),
@@ -174,12 +180,7 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	}
 
 	// Stop thinking animation for this chat context
-	if stop, ok := c.stopThinking.Load(msg.ChatID); ok {
-		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
-		}
-		c.stopThinking.Delete(msg.ChatID)
-	}
+	c.stopThinkingFor(msg.ChatID)
 
 	htmlContent := markdownToTelegramHTML(msg.Content)
 
@@ -218,6 +219,169 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return lastErr
 }
 
+// SendEditable sends content to a single chat and returns the message ID,
+// reusing the "Thinking..." placeholder when there is one.
+func (c *TelegramChannel) SendEditable(ctx context.Context, chatID, content string) (string, error) {
+	if !c.IsRunning() {
+		return "", fmt.Errorf("telegram bot not running")
+	}
+
+	id, err := parseSingleChatID(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	c.stopThinkingFor(chatID)
+
+	if pID, ok := c.placeholders.LoadAndDelete(chatID); ok {
+		messageID := strconv.Itoa(pID.(int))
+		if err := c.EditMessage(ctx, chatID, messageID, content); err == nil {
+			return messageID, nil
+		}
+	}
+
+	tgMsg := tu.Message(tu.ID(id), markdownToTelegramHTML(content))
+	tgMsg.ParseMode = telego.ModeHTML
+	sent, err := c.bot.SendMessage(ctx, tgMsg)
+	if err != nil {
+		tgMsg = tu.Message(tu.ID(id), content)
+		if sent, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+			return "", err
+		}
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// EditMessage replaces the text of a message sent by SendEditable.
+func (c *TelegramChannel) EditMessage(ctx context.Context, chatID, messageID, content string) error {
+	id, err := parseSingleChatID(chatID)
+	if err != nil {
+		return err
+	}
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID %q: %w", messageID, err)
+	}
+
+	editMsg := tu.EditMessageText(tu.ID(id), msgID, markdownToTelegramHTML(content))
+	editMsg.ParseMode = telego.ModeHTML
+	if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
+		return nil
+	}
+
+	// Partially streamed markdown can produce HTML that Telegram rejects.
+	_, err = c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(id), msgID, content))
+	return err
+}
+
+// SendReasoning shows a reasoning summary as an expandable quote, which
+// Telegram renders collapsed to a few lines.
+func (c *TelegramChannel) SendReasoning(ctx context.Context, chatID, summary string) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+
+	id, err := parseSingleChatID(chatID)
+	if err != nil {
+		return err
+	}
+
+	text := "<b>Reasoning</b>\n<blockquote expandable>" +
+		escapeHTML(utils.Truncate(summary, c.MaxMessageLength())) + "</blockquote>"
+	tgMsg := tu.Message(tu.ID(id), text)
+	tgMsg.ParseMode = telego.ModeHTML
+	_, err = c.bot.SendMessage(ctx, tgMsg)
+	return err
+}
+
+// SendApprovalPrompt asks for approval with inline Approve and Deny buttons.
+func (c *TelegramChannel) SendApprovalPrompt(ctx context.Context, chatID string, prompt ApprovalPrompt) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+
+	id, err := parseSingleChatID(chatID)
+	if err != nil {
+		return err
+	}
+
+	tgMsg := tu.Message(tu.ID(id), approvalTitle+"\n"+prompt.Summary).WithReplyMarkup(tu.InlineKeyboard(
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("✅ Approve").WithCallbackData(approvalAction(prompt.ID, true)),
+			tu.InlineKeyboardButton("❌ Deny").WithCallbackData(approvalAction(prompt.ID, false)),
+		),
+	))
+	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+		return err
+	}
+	c.approvals.remember(prompt)
+	return nil
+}
+
+// handleApprovalCallback turns a press of an approval button into an
+// approval reply from the user who pressed it.
+func (c *TelegramChannel) handleApprovalCallback(ctx context.Context, query telego.CallbackQuery) error {
+	id, approve, ok := parseApprovalAction(query.Data)
+	if !ok || query.Message == nil {
+		return nil
+	}
+
+	user := query.From
+	senderID := fmt.Sprintf("%d", user.ID)
+	if user.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", user.ID, user.Username)
+	}
+	if !c.IsAllowed(senderID) {
+		return c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID).WithText("You are not allowed to answer this."))
+	}
+	if !c.approvals.allow(id, fmt.Sprintf("%d", user.ID)) {
+		return c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID).WithText("Only the user who asked can answer this."))
+	}
+	if err := c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID)); err != nil {
+		logger.DebugCF("telegram", "Failed to answer callback query", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	chatID := query.Message.GetChat().ID
+
+	// Editing the text drops the buttons, so the prompt can't be answered twice
+	if msg := query.Message.Message(); msg != nil {
+		by := user.FirstName
+		if user.Username != "" {
+			by = "@" + user.Username
+		}
+		text := msg.Text + "\n\n" + approvalOutcome(approve, by)
+		if _, err := c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), msg.MessageID, text)); err != nil {
+			logger.DebugCF("telegram", "Failed to update approval prompt", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	metadata := map[string]string{
+		"approval_id": id,
+		"user_id":     fmt.Sprintf("%d", user.ID),
+		"username":    user.Username,
+	}
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chatID), ApprovalReply(id, approve), nil, metadata)
+	return nil
+}
+
+// MaxMessageLength leaves headroom below Telegram's 4096 character limit
+// for the markup added by markdownToTelegramHTML.
+func (c *TelegramChannel) MaxMessageLength() int {
+	return 3500
+}
+
+func (c *TelegramChannel) stopThinkingFor(chatID string) {
+	if stop, ok := c.stopThinking.LoadAndDelete(chatID); ok {
+		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
+			cf.Cancel()
+		}
+	}
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Message) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
@@ -449,6 +613,17 @@ func parseChatIDs(chatIDStr string) ([]int64, error) {
 	return res, nil
 }
 
+func parseSingleChatID(chatIDStr string) (int64, error) {
+	ids, err := parseChatIDs(chatIDStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chat ID(s): %w", err)
+	}
+	if len(ids) != 1 {
+		return 0, fmt.Errorf("expected a single chat ID, got %q", chatIDStr)
+	}
+	return ids[0], nil
+}
+
 func markdownToTelegramHTML(text string) string {
 	if text == "" {
 		return ""
@@ -0,0 +1,589 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/egress"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// WebhookSignatureHeader carries "sha256=<hex>", the HMAC-SHA256 of
+	// "<timestamp>.<body>" keyed with the channel secret.
+	WebhookSignatureHeader = "X-Picoclaw-Signature"
+	// WebhookTimestampHeader carries the Unix time the request was signed at.
+	WebhookTimestampHeader = "X-Picoclaw-Timestamp"
+
+	webhookMaxSkew     = 5 * time.Minute
+	webhookMaxBodySize = 20 << 20
+
+	// webhookMetadataPrefix namespaces caller-supplied metadata, so callers
+	// cannot set keys the channel layer uses for routing or approvals.
+	webhookMetadataPrefix = "webhook_"
+)
+
+// webhookRetryBaseDelay is the first callback retry delay; it doubles on each attempt.
+var webhookRetryBaseDelay = time.Second
+
+// webhookRequest is the JSON body accepted by the webhook channel.
+type webhookRequest struct {
+	SenderID   string            `json:"sender_id"`
+	SenderName string            `json:"sender_name,omitempty"`
+	ChatID     string            `json:"chat_id,omitempty"`
+	ChatType   string            `json:"chat_type,omitempty"` // "direct" (default) or "group"
+	MessageID  string            `json:"message_id,omitempty"`
+	Content    string            `json:"content"`
+	Media      []webhookMedia    `json:"media,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	// Sync asks for the reply in the HTTP response. It is implied when no
+	// callback URL is configured.
+	Sync bool `json:"sync,omitempty"`
+}
+
+// webhookMedia is an attachment, given either as a URL to download or as
+// base64-encoded data.
+type webhookMedia struct {
+	URL      string `json:"url,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// webhookReply is returned for synchronous requests and posted to the
+// callback URL for asynchronous ones.
+type webhookReply struct {
+	Channel string `json:"channel"`
+	ChatID  string `json:"chat_id"`
+	Content string `json:"content"`
+	// Messages are the ones sent to the chat during a synchronous request's
+	// turn, before its reply, when there is no callback URL to post them to.
+	Messages  []string `json:"messages,omitempty"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// webhookWaiter is a synchronous request waiting for the reply that ends
+// its turn.
+type webhookWaiter struct {
+	reply    chan string
+	messages []string // guarded by WebhookChannel.mu
+}
+
+// WebhookChannel is a generic HTTP channel for custom integrations. Callers
+// POST signed JSON messages; replies are returned in the HTTP response or
+// delivered to a callback URL.
+type WebhookChannel struct {
+	*BaseChannel
+	config     config.WebhookConfig
+	httpServer *http.Server
+	client     *http.Client
+	egress     *egress.Policy
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mu      sync.Mutex
+	waiters map[string][]*webhookWaiter // chatID -> pending synchronous requests, oldest first
+}
+
+// NewWebhookChannel creates a new generic webhook channel.
+func NewWebhookChannel(cfg config.WebhookConfig, messageBus *bus.MessageBus) (*WebhookChannel, error) {
+	if cfg.Secret == "" {
+		return nil, fmt.Errorf("webhook secret is required")
+	}
+
+	base := NewBaseChannel("webhook", cfg, messageBus, cfg.AllowFrom)
+
+	return &WebhookChannel{
+		BaseChannel: base,
+		config:      cfg,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		waiters:     make(map[string][]*webhookWaiter),
+	}, nil
+}
+
+// SetEgressPolicy sets which hosts media URLs may be downloaded from.
+// Without one, non-public addresses are blocked.
+func (c *WebhookChannel) SetEgressPolicy(policy *egress.Policy) {
+	c.egress = policy
+}
+
+// Start launches the HTTP server that receives messages.
+func (c *WebhookChannel) Start(ctx context.Context) error {
+	logger.InfoC("webhook", "Starting webhook channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	mux := http.NewServeMux()
+	path := c.config.WebhookPath
+	if path == "" {
+		path = "/webhook/generic"
+	}
+	mux.HandleFunc(path, c.webhookHandler)
+
+	addr := fmt.Sprintf("%s:%d", c.config.WebhookHost, c.config.WebhookPort)
+	c.httpServer = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		logger.InfoCF("webhook", "Webhook server listening", map[string]any{
+			"addr": addr,
+			"path": path,
+		})
+		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("webhook", "Webhook server error", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	c.setRunning(true)
+	logger.InfoC("webhook", "Webhook channel started")
+	return nil
+}
+
+// Stop shuts down the HTTP server.
+func (c *WebhookChannel) Stop(ctx context.Context) error {
+	logger.InfoC("webhook", "Stopping webhook channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	if c.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := c.httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.ErrorCF("webhook", "Webhook server shutdown error", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	c.setRunning(false)
+	logger.InfoC("webhook", "Webhook channel stopped")
+	return nil
+}
+
+// Send hands the final reply of a turn to the oldest synchronous request
+// waiting on the chat, or else posts it to the callback URL, with retries.
+// Other messages sent while a request waits go to the callback URL too, or
+// are returned along with the reply when there is none. Send returns once
+// the callback has accepted the message, so failed deliveries are counted
+// and dead-lettered like on any other channel.
+func (c *WebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("webhook channel not running")
+	}
+
+	if msg.Final {
+		if waiter := c.popWaiter(msg.ChatID); waiter != nil {
+			waiter.reply <- msg.Content
+			return nil
+		}
+		if msg.Answered {
+			// The message tool's answer has been delivered already
+			return nil
+		}
+	} else if c.config.CallbackURL == "" && c.holdMessage(msg.ChatID, msg.Content) {
+		return nil
+	}
+
+	if c.config.CallbackURL == "" {
+		return &PermanentError{Err: fmt.Errorf("no callback URL configured and no request waiting on chat %s", msg.ChatID)}
+	}
+
+	body, err := json.Marshal(webhookReply{
+		Channel:   c.Name(),
+		ChatID:    msg.ChatID,
+		Content:   msg.Content,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal callback payload: %w", err)
+	}
+
+	// Stopping the channel abandons pending retries.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
+
+	if err := c.deliver(ctx, body); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		// deliver has already retried per max_retries.
+		return &PermanentError{Err: fmt.Errorf("callback delivery failed: %w", err)}
+	}
+	return nil
+}
+
+// deliver posts body to the callback URL, retrying network errors, 429 and
+// 5xx responses with exponential backoff. A Retry-After header overrides the
+// backoff delay.
+func (c *WebhookChannel) deliver(ctx context.Context, body []byte) error {
+	backoff := webhookRetryBaseDelay
+	var wait time.Duration
+	var lastErr error
+
+	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			logger.DebugCF("webhook", "Retrying callback", map[string]any{
+				"attempt": attempt,
+				"delay":   wait.String(),
+				"error":   lastErr.Error(),
+			})
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		retryAfter, err := c.postCallback(ctx, body)
+		if err == nil {
+			return nil
+		}
+		var permanent *webhookPermanentError
+		if errors.As(err, &permanent) {
+			return err
+		}
+		lastErr = err
+
+		wait = backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		backoff *= 2
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", c.config.MaxRetries+1, lastErr)
+}
+
+// webhookPermanentError marks a callback failure that retrying will not fix.
+type webhookPermanentError struct {
+	err error
+}
+
+func (e *webhookPermanentError) Error() string {
+	return e.err.Error()
+}
+
+func (c *WebhookChannel) postCallback(ctx context.Context, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, &webhookPermanentError{err: err}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(c.config.Secret, timestamp, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		var retryAfter time.Duration
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return retryAfter, fmt.Errorf("callback returned status %d", resp.StatusCode)
+	default:
+		return 0, &webhookPermanentError{err: fmt.Errorf("callback returned status %d", resp.StatusCode)}
+	}
+}
+
+// webhookHandler handles incoming webhook requests.
+func (c *WebhookChannel) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBodySize))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if !c.verifySignature(body, r.Header.Get(WebhookTimestampHeader), r.Header.Get(WebhookSignatureHeader)) {
+		logger.WarnC("webhook", "Invalid webhook signature")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req webhookRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.SenderID == "" || (strings.TrimSpace(req.Content) == "" && len(req.Media) == 0) {
+		http.Error(w, "sender_id and content or media are required", http.StatusBadRequest)
+		return
+	}
+	if req.ChatID == "" {
+		req.ChatID = req.SenderID
+	}
+
+	if !c.IsAllowed(req.SenderID) {
+		logger.DebugCF("webhook", "Message from sender not in allow list", map[string]any{
+			"sender_id": req.SenderID,
+		})
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	wantSync := req.Sync || c.config.CallbackURL == ""
+	var waiter *webhookWaiter
+	if wantSync {
+		waiter = c.addWaiter(req.ChatID)
+	}
+
+	c.processRequest(req)
+
+	if !wantSync {
+		writeWebhookJSON(w, http.StatusAccepted, map[string]string{"status": "accepted", "chat_id": req.ChatID})
+		return
+	}
+
+	timeout := time.Duration(c.config.ReplyTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case content := <-waiter.reply:
+		c.writeSyncReply(w, req.ChatID, waiter, content)
+		return
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+
+	// The reply was not ready in time. If it still arrives, it goes to the
+	// callback URL when one is configured.
+	if !c.removeWaiter(req.ChatID, waiter) {
+		// Send claimed the waiter just now; the reply is already in the channel.
+		c.writeSyncReply(w, req.ChatID, waiter, <-waiter.reply)
+		return
+	}
+	if c.config.CallbackURL != "" {
+		writeWebhookJSON(w, http.StatusAccepted, map[string]string{"status": "pending", "chat_id": req.ChatID})
+		return
+	}
+	http.Error(w, "Timed out waiting for reply", http.StatusGatewayTimeout)
+}
+
+func (c *WebhookChannel) writeSyncReply(w http.ResponseWriter, chatID string, waiter *webhookWaiter, content string) {
+	// Send has popped the waiter, so nothing is added to messages any more
+	writeWebhookJSON(w, http.StatusOK, webhookReply{
+		Channel:   c.Name(),
+		ChatID:    chatID,
+		Content:   content,
+		Messages:  waiter.messages,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+func (c *WebhookChannel) processRequest(req webhookRequest) {
+	content := req.Content
+	var mediaPaths []string
+	for i, m := range req.Media {
+		filename := m.Filename
+		if filename == "" {
+			filename = fmt.Sprintf("attachment_%d", i+1)
+		}
+		localPath := c.saveMedia(m, filename)
+		if localPath == "" {
+			continue
+		}
+		mediaPaths = append(mediaPaths, localPath)
+		if content != "" {
+			content += "\n"
+		}
+		content += fmt.Sprintf("[file: %s]", filename)
+	}
+
+	metadata := make(map[string]string, len(req.Metadata)+5)
+	for k, v := range req.Metadata {
+		metadata[webhookMetadataPrefix+k] = v
+	}
+	metadata["platform"] = "webhook"
+	if req.MessageID != "" {
+		metadata["message_id"] = req.MessageID
+	}
+	if req.SenderName != "" {
+		metadata["sender_name"] = req.SenderName
+	}
+	if req.ChatType == "group" {
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = req.ChatID
+	} else {
+		metadata["peer_kind"] = "direct"
+		metadata["peer_id"] = req.SenderID
+	}
+
+	logger.DebugCF("webhook", "Received message", map[string]any{
+		"sender_id": req.SenderID,
+		"chat_id":   req.ChatID,
+		"media":     len(mediaPaths),
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(req.SenderID, req.ChatID, content, mediaPaths, metadata)
+}
+
+// saveMedia stores an attachment locally and returns its path, or "" on failure.
+func (c *WebhookChannel) saveMedia(m webhookMedia, filename string) string {
+	if m.URL != "" {
+		// The URL comes from the caller, so it must not reach internal hosts
+		return utils.DownloadFile(m.URL, filename, utils.DownloadOptions{
+			LoggerPrefix: "webhook",
+			Client:       c.egress.NewClient(60*time.Second, 0),
+		})
+	}
+	if m.Data == "" {
+		return ""
+	}
+
+	data, err := base64.StdEncoding.DecodeString(m.Data)
+	if err != nil {
+		logger.WarnCF("webhook", "Invalid base64 media data", map[string]any{
+			"filename": filename,
+			"error":    err.Error(),
+		})
+		return ""
+	}
+	localPath, err := utils.SaveMediaFile(filename, data)
+	if err != nil {
+		logger.ErrorCF("webhook", "Failed to write media file", map[string]any{
+			"error": err.Error(),
+		})
+		return ""
+	}
+	return localPath
+}
+
+// verifySignature checks the HMAC-SHA256 signature and rejects requests
+// signed too long ago, so captured requests cannot be replayed later.
+func (c *WebhookChannel) verifySignature(body []byte, timestamp, signature string) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > webhookMaxSkew || skew < -webhookMaxSkew {
+		return false
+	}
+
+	expected := "sha256=" + signWebhook(c.config.Secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *WebhookChannel) addWaiter(chatID string) *webhookWaiter {
+	waiter := &webhookWaiter{reply: make(chan string, 1)}
+	c.mu.Lock()
+	c.waiters[chatID] = append(c.waiters[chatID], waiter)
+	c.mu.Unlock()
+	return waiter
+}
+
+func (c *WebhookChannel) popWaiter(chatID string) *webhookWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := c.waiters[chatID]
+	if len(queue) == 0 {
+		return nil
+	}
+	waiter := queue[0]
+	if len(queue) == 1 {
+		delete(c.waiters, chatID)
+	} else {
+		c.waiters[chatID] = queue[1:]
+	}
+	return waiter
+}
+
+// holdMessage keeps content for the oldest synchronous request waiting on
+// the chat, to return along with its reply. It reports false if no request
+// is waiting.
+func (c *WebhookChannel) holdMessage(chatID, content string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := c.waiters[chatID]
+	if len(queue) == 0 {
+		return false
+	}
+	queue[0].messages = append(queue[0].messages, content)
+	return true
+}
+
+// removeWaiter drops waiter from the chat's queue. It reports false if the
+// waiter was no longer queued because Send already claimed it.
+func (c *WebhookChannel) removeWaiter(chatID string, waiter *webhookWaiter) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue := c.waiters[chatID]
+	for i, w := range queue {
+		if w == waiter {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			if len(queue) == 0 {
+				delete(c.waiters, chatID)
+			} else {
+				c.waiters[chatID] = queue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// WaitsForTurnEnd marks the webhook channel as a TurnWaiter: a synchronous
+// request is answered with its turn's final reply, even when the message
+// tool has already sent one.
+func (c *WebhookChannel) WaitsForTurnEnd() {}
+
+func writeWebhookJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,339 @@
+package channels
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/egress"
+)
+
+func newTestWebhookChannel(t *testing.T, cfg config.WebhookConfig) (*WebhookChannel, *bus.MessageBus) {
+	t.Helper()
+	if cfg.Secret == "" {
+		cfg.Secret = "test_secret"
+	}
+	msgBus := bus.NewMessageBus()
+	ch, err := NewWebhookChannel(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewWebhookChannel() error: %v", err)
+	}
+	ch.ctx, ch.cancel = context.WithCancel(context.Background())
+	t.Cleanup(ch.cancel)
+	ch.setRunning(true)
+	return ch, msgBus
+}
+
+func signedWebhookRequest(secret, body string) *http.Request {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/webhook/generic", strings.NewReader(body))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(secret, timestamp, []byte(body)))
+	return req
+}
+
+func consumeInbound(t *testing.T, msgBus *bus.MessageBus) bus.InboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message published")
+	}
+	return msg
+}
+
+func TestNewWebhookChannel_RequiresSecret(t *testing.T) {
+	if _, err := NewWebhookChannel(config.WebhookConfig{}, bus.NewMessageBus()); err == nil {
+		t.Error("expected error without secret")
+	}
+}
+
+func TestWebhookVerifySignature(t *testing.T) {
+	ch, _ := newTestWebhookChannel(t, config.WebhookConfig{})
+	body := []byte(`{"sender_id":"a"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		want      bool
+	}{
+		{"valid", now, "sha256=" + signWebhook("test_secret", now, body), true},
+		{"wrong secret", now, "sha256=" + signWebhook("other", now, body), false},
+		{"missing prefix", now, signWebhook("test_secret", now, body), false},
+		{"stale timestamp", stale, "sha256=" + signWebhook("test_secret", stale, body), false},
+		{"missing timestamp", "", "sha256=" + signWebhook("test_secret", "", body), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ch.verifySignature(body, tt.timestamp, tt.signature); got != tt.want {
+				t.Errorf("verifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_Rejections(t *testing.T) {
+	ch, _ := newTestWebhookChannel(t, config.WebhookConfig{
+		CallbackURL: "http://127.0.0.1:1/callback",
+		AllowFrom:   config.FlexibleStringSlice{"alice"},
+	})
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"bad signature", signedWebhookRequest("wrong", `{"sender_id":"alice","content":"hi"}`), http.StatusForbidden},
+		{"not allowed", signedWebhookRequest("test_secret", `{"sender_id":"mallory","content":"hi"}`), http.StatusForbidden},
+		{"missing content", signedWebhookRequest("test_secret", `{"sender_id":"alice"}`), http.StatusBadRequest},
+		{"invalid json", signedWebhookRequest("test_secret", `nope`), http.StatusBadRequest},
+		{"wrong method", httptest.NewRequest(http.MethodGet, "/webhook/generic", nil), http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ch.webhookHandler(w, tt.req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_SyncReply(t *testing.T) {
+	ch, msgBus := newTestWebhookChannel(t, config.WebhookConfig{ReplyTimeout: 5})
+
+	data := base64.StdEncoding.EncodeToString([]byte("report contents"))
+	body := `{"sender_id":"ops","chat_id":"ticket-42","chat_type":"group","content":"Summarize",` +
+		`"media":[{"data":"` + data + `","filename":"report.txt"}],"metadata":{"account_id":"helpdesk","ticket":"42"}}`
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		ch.webhookHandler(w, signedWebhookRequest("test_secret", body))
+		close(done)
+	}()
+
+	msg := consumeInbound(t, msgBus)
+	if msg.Channel != "webhook" || msg.SenderID != "ops" || msg.ChatID != "ticket-42" {
+		t.Errorf("inbound = %+v", msg)
+	}
+	if msg.Metadata["peer_kind"] != "group" || msg.Metadata["peer_id"] != "ticket-42" || msg.Metadata["webhook_ticket"] != "42" {
+		t.Errorf("metadata = %v, want group peer and namespaced caller metadata", msg.Metadata)
+	}
+	if _, ok := msg.Metadata["account_id"]; ok {
+		t.Errorf("caller metadata set account_id: %v", msg.Metadata)
+	}
+	if len(msg.Media) != 1 || !strings.Contains(msg.Content, "[file: report.txt]") {
+		t.Fatalf("media = %v, content = %q", msg.Media, msg.Content)
+	}
+	defer os.Remove(msg.Media[0])
+	if got, _ := os.ReadFile(msg.Media[0]); string(got) != "report contents" {
+		t.Errorf("media file = %q", got)
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{Channel: "webhook", ChatID: "ticket-42", Content: "Done.", Final: true}); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	<-done
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var reply webhookReply
+	json.Unmarshal(w.Body.Bytes(), &reply)
+	if reply.ChatID != "ticket-42" || reply.Content != "Done." {
+		t.Errorf("reply = %+v", reply)
+	}
+}
+
+func TestWebhookHandler_SyncReplyWaitsForFinalReply(t *testing.T) {
+	ch, msgBus := newTestWebhookChannel(t, config.WebhookConfig{ReplyTimeout: 5})
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		ch.webhookHandler(w, signedWebhookRequest("test_secret", `{"sender_id":"ops","content":"Clean up /tmp"}`))
+		close(done)
+	}()
+	consumeInbound(t, msgBus)
+
+	for _, msg := range []bus.OutboundMessage{
+		{Channel: "webhook", ChatID: "ops", Content: "Approve exec?"},
+		{Channel: "webhook", ChatID: "ops", Content: "Memory threshold reached."},
+		{Channel: "webhook", ChatID: "ops", Content: "Cleaned /tmp.", Final: true},
+	} {
+		if err := ch.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send(%q) error: %v", msg.Content, err)
+		}
+	}
+	<-done
+
+	var reply webhookReply
+	json.Unmarshal(w.Body.Bytes(), &reply)
+	if w.Code != http.StatusOK || reply.Content != "Cleaned /tmp." {
+		t.Fatalf("status = %d, reply = %+v, want the final reply", w.Code, reply)
+	}
+	if strings.Join(reply.Messages, "|") != "Approve exec?|Memory threshold reached." {
+		t.Errorf("messages = %q, want the messages sent before the reply", reply.Messages)
+	}
+}
+
+func TestWebhookHandler_SyncReplyAfterMessageTool(t *testing.T) {
+	ch, msgBus := newTestWebhookChannel(t, config.WebhookConfig{ReplyTimeout: 5})
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		ch.webhookHandler(w, signedWebhookRequest("test_secret", `{"sender_id":"ops","content":"hi"}`))
+		close(done)
+	}()
+	consumeInbound(t, msgBus)
+
+	ch.Send(context.Background(), bus.OutboundMessage{Channel: "webhook", ChatID: "ops", Content: "Hello!"})
+	ch.Send(context.Background(), bus.OutboundMessage{
+		Channel: "webhook", ChatID: "ops", Content: "Greeted the user.", Final: true, Answered: true,
+	})
+	<-done
+
+	var reply webhookReply
+	json.Unmarshal(w.Body.Bytes(), &reply)
+	if reply.Content != "Greeted the user." || len(reply.Messages) != 1 || reply.Messages[0] != "Hello!" {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	// With no request waiting, the message tool's answer was all the chat needed
+	err := ch.Send(context.Background(), bus.OutboundMessage{
+		Channel: "webhook", ChatID: "ops", Content: "Greeted the user.", Final: true, Answered: true,
+	})
+	if err != nil {
+		t.Errorf("Send() of an answered reply error: %v", err)
+	}
+}
+
+func TestWebhookSaveMedia_AppliesEgressPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "internal data")
+	}))
+	defer srv.Close()
+	ch, _ := newTestWebhookChannel(t, config.WebhookConfig{})
+	media := webhookMedia{URL: srv.URL + "/secret.txt"}
+
+	if path := ch.saveMedia(media, "secret.txt"); path != "" {
+		os.Remove(path)
+		t.Fatal("downloaded media from a loopback address")
+	}
+
+	ch.SetEgressPolicy(egress.NewPolicy(config.EgressConfig{AllowCIDRs: []string{"127.0.0.0/8", "::1"}}))
+	path := ch.saveMedia(media, "secret.txt")
+	if path == "" {
+		t.Fatal("download failed with the address allowed")
+	}
+	defer os.Remove(path)
+	if got, _ := os.ReadFile(path); string(got) != "internal data" {
+		t.Errorf("media file = %q", got)
+	}
+}
+
+func TestWebhookHandler_SyncTimeout(t *testing.T) {
+	ch, msgBus := newTestWebhookChannel(t, config.WebhookConfig{ReplyTimeout: 1})
+
+	w := httptest.NewRecorder()
+	ch.webhookHandler(w, signedWebhookRequest("test_secret", `{"sender_id":"ops","content":"hi"}`))
+	consumeInbound(t, msgBus)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", w.Code)
+	}
+	if len(ch.waiters) != 0 {
+		t.Errorf("waiters left behind: %v", ch.waiters)
+	}
+}
+
+func TestWebhookHandler_AsyncCallbackWithRetries(t *testing.T) {
+	old := webhookRetryBaseDelay
+	webhookRetryBaseDelay = 10 * time.Millisecond
+	t.Cleanup(func() { webhookRetryBaseDelay = old })
+
+	var attempts atomic.Int32
+	received := make(chan webhookReply, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + signWebhook("test_secret", r.Header.Get(WebhookTimestampHeader), body)
+		if r.Header.Get(WebhookSignatureHeader) != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var reply webhookReply
+		json.Unmarshal(body, &reply)
+		received <- reply
+	}))
+	t.Cleanup(callback.Close)
+
+	ch, msgBus := newTestWebhookChannel(t, config.WebhookConfig{CallbackURL: callback.URL, MaxRetries: 3})
+
+	w := httptest.NewRecorder()
+	ch.webhookHandler(w, signedWebhookRequest("test_secret", `{"sender_id":"alerts","content":"disk full"}`))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", w.Code)
+	}
+	msg := consumeInbound(t, msgBus)
+	if msg.ChatID != "alerts" || msg.Metadata["peer_kind"] != "direct" {
+		t.Errorf("inbound = %+v, want chat_id defaulting to sender", msg)
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{Channel: "webhook", ChatID: "alerts", Content: "Cleaned /tmp."}); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	select {
+	case reply := <-received:
+		if reply.ChatID != "alerts" || reply.Content != "Cleaned /tmp." {
+			t.Errorf("callback reply = %+v", reply)
+		}
+	default:
+		t.Fatal("callback not delivered before Send returned")
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+}
+
+func TestWebhookSend_StopsOnClientError(t *testing.T) {
+	var attempts atomic.Int32
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(callback.Close)
+
+	ch, _ := newTestWebhookChannel(t, config.WebhookConfig{CallbackURL: callback.URL, MaxRetries: 3})
+	err := ch.Send(context.Background(), bus.OutboundMessage{Channel: "webhook", ChatID: "alerts", Content: "hi"})
+	var permanent *PermanentError
+	if !errors.As(err, &permanent) {
+		t.Errorf("Send() error = %v, want a permanent error for a 400 response", err)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
@@ -0,0 +1,409 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package chatapi serves an OpenAI-compatible chat completions API, so any
+// OpenAI SDK client can talk to a picoclaw agent as if it were a model. The
+// model name selects the agent; tools run server-side in the agent loop.
+package chatapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+const (
+	// Channel is the channel name API turns run under.
+	Channel = "api"
+
+	// SessionHeader carries a caller-chosen session, overriding the "user" field.
+	SessionHeader = "X-Picoclaw-Session"
+
+	maxRequestBody = 4 << 20
+)
+
+// AgentRunner is what the API needs from the agent loop. *agent.AgentLoop implements it.
+type AgentRunner interface {
+	ListAgentIDs() []string
+	GetAgent(agentID string) (*agent.AgentInstance, bool)
+	ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error)
+}
+
+// Handler serves /v1/chat/completions and /v1/models.
+type Handler struct {
+	agents  AgentRunner
+	token   string
+	created int64
+
+	sessions sync.Map // session key -> *sync.Mutex
+}
+
+// NewHandler creates the API handler. token must be non-empty; every request
+// has to present it as a bearer token.
+func NewHandler(agents AgentRunner, token string) *Handler {
+	return &Handler{agents: agents, token: token, created: time.Now().Unix()}
+}
+
+// RegisterRoutes mounts the API on mux.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("POST /v1/chat/completions", h.auth(h.handleChatCompletions))
+	mux.Handle("GET /v1/models", h.auth(h.handleModels))
+}
+
+func (h *Handler) auth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer " + h.token
+		if h.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Invalid or missing bearer token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+type model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func (h *Handler) handleModels(w http.ResponseWriter, r *http.Request) {
+	ids := h.agents.ListAgentIDs()
+	sort.Strings(ids)
+
+	models := make([]model, 0, len(ids))
+	for _, id := range ids {
+		models = append(models, model{ID: id, Object: "model", Created: h.created, OwnedBy: "picoclaw"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": models})
+}
+
+// chatRequest is the subset of the OpenAI request picoclaw honors. Sampling
+// parameters are ignored: the agent's own model settings apply.
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	User     string        `json:"user"`
+
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message content, which may be a string or an array of parts.
+func (m chatMessage) text() string {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(m.Content, &parts) != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "Invalid JSON body: "+err.Error())
+		return
+	}
+
+	ag, ok := h.agents.GetAgent(req.Model)
+	if !ok {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+			fmt.Sprintf("The model %q does not exist; use an agent ID from /v1/models", req.Model))
+		return
+	}
+
+	prompt, earlier, ok := splitConversation(req.Messages)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", "messages must end with a user message")
+		return
+	}
+
+	// A named session keeps its history on the server, so only the newest
+	// message is needed. Without one, the request is a one-off conversation
+	// seeded with the messages it carries and deleted once answered.
+	session := strings.TrimSpace(r.Header.Get(SessionHeader))
+	if session == "" {
+		session = strings.TrimSpace(req.User)
+	}
+	oneOff := session == ""
+	if oneOff {
+		session = "oneoff-" + randomID()
+	}
+	sessionKey := fmt.Sprintf("agent:%s:%s:%s", ag.ID, Channel, sanitizeSession(session))
+	if oneOff && len(earlier) > 0 {
+		ag.Sessions.GetOrCreate(sessionKey)
+		ag.Sessions.SetHistory(sessionKey, earlier)
+	}
+
+	lock, _ := h.sessions.LoadOrStore(sessionKey, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	if oneOff {
+		defer func() {
+			h.sessions.Delete(sessionKey)
+			if err := ag.Sessions.Delete(sessionKey); err != nil {
+				logger.WarnCF("chatapi", "Failed to delete one-off session", map[string]any{
+					"session_key": sessionKey,
+					"error":       err.Error(),
+				})
+			}
+		}()
+	}
+
+	// Agent turns routinely outlast the gateway's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	id := "chatcmpl-" + randomID()
+	created := time.Now().Unix()
+
+	logger.InfoCF("chatapi", "Chat completion request", map[string]any{
+		"agent_id":    ag.ID,
+		"session_key": sessionKey,
+		"stream":      req.Stream,
+	})
+
+	meter := &usage.Meter{}
+	ctx := usage.WithMeter(r.Context(), meter)
+
+	if req.Stream {
+		h.stream(ctx, w, id, created, ag.ID, prompt, sessionKey, session, meter, req.StreamOptions.IncludeUsage)
+		return
+	}
+
+	response, err := h.agents.ProcessDirectWithChannel(ctx, prompt, sessionKey, Channel, session)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "", err.Error())
+		return
+	}
+
+	stop := "stop"
+	writeJSON(w, http.StatusOK, completion{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   ag.ID,
+		Choices: []choice{{
+			Message:      &message{Role: "assistant", Content: response},
+			FinishReason: &stop,
+		}},
+		Usage: meterUsage(meter),
+	})
+}
+
+func (h *Handler) stream(
+	ctx context.Context,
+	w http.ResponseWriter,
+	id string,
+	created int64,
+	agentID, prompt, sessionKey, session string,
+	meter *usage.Meter,
+	includeUsage bool,
+) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		rc.Flush()
+	}
+	chunk := func(d delta, finish *string) completion {
+		return completion{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   agentID,
+			Choices: []choice{{Delta: &d, FinishReason: finish}},
+		}
+	}
+
+	send(chunk(delta{Role: "assistant"}, nil))
+
+	streamed := false
+	ctx = agent.WithReplyDeltas(ctx, func(text string) {
+		streamed = true
+		send(chunk(delta{Content: text}, nil))
+	})
+
+	response, err := h.agents.ProcessDirectWithChannel(ctx, prompt, sessionKey, Channel, session)
+	if err != nil {
+		send(map[string]any{"error": apiError{Message: err.Error(), Type: "server_error"}})
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		rc.Flush()
+		return
+	}
+	// Providers that cannot stream deliver the whole reply at the end.
+	if !streamed && response != "" {
+		send(chunk(delta{Content: response}, nil))
+	}
+
+	stop := "stop"
+	send(chunk(delta{}, &stop))
+	if includeUsage {
+		send(completion{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   agentID,
+			Choices: []choice{},
+			Usage:   meterUsage(meter),
+		})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	rc.Flush()
+}
+
+// splitConversation returns the text of the final user message, to be sent
+// to the agent, and the messages before it as session history. System and
+// developer messages are prepended to the prompt as instructions.
+func splitConversation(msgs []chatMessage) (string, []providers.Message, bool) {
+	if len(msgs) == 0 || msgs[len(msgs)-1].Role != "user" {
+		return "", nil, false
+	}
+
+	var instructions []string
+	var history []providers.Message
+	for _, m := range msgs[:len(msgs)-1] {
+		text := m.text()
+		if text == "" {
+			continue
+		}
+		switch m.Role {
+		case "system", "developer":
+			instructions = append(instructions, text)
+		case "user", "assistant":
+			history = append(history, providers.Message{Role: m.Role, Content: text})
+		}
+	}
+
+	prompt := msgs[len(msgs)-1].text()
+	if prompt == "" {
+		return "", nil, false
+	}
+	if len(instructions) > 0 {
+		prompt = "[Instructions from the API client]\n" + strings.Join(instructions, "\n\n") + "\n\n" + prompt
+	}
+	return prompt, history, true
+}
+
+type completion struct {
+	ID      string      `json:"id"`
+	Object  string      `json:"object"`
+	Created int64       `json:"created"`
+	Model   string      `json:"model"`
+	Choices []choice    `json:"choices"`
+	Usage   *tokenUsage `json:"usage,omitempty"`
+}
+
+type choice struct {
+	Index        int      `json:"index"`
+	Message      *message `json:"message,omitempty"`
+	Delta        *delta   `json:"delta,omitempty"`
+	FinishReason *string  `json:"finish_reason"`
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type delta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// tokenUsage totals every LLM call the agent made to answer a request,
+// including tool iterations.
+type tokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func meterUsage(m *usage.Meter) *tokenUsage {
+	prompt, completion := m.Tokens()
+	return &tokenUsage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, errType, code, message string) {
+	writeJSON(w, status, map[string]any{"error": apiError{Message: message, Type: errType, Code: code}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// sanitizeSession makes a caller-chosen session name safe for use in a
+// session key and as a file name.
+func sanitizeSession(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == '@':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+		if b.Len() >= 128 {
+			break
+		}
+	}
+	return b.String()
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
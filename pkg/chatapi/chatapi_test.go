@@ -0,0 +1,292 @@
+package chatapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+type streamingProvider struct {
+	mu       sync.Mutex
+	requests [][]providers.Message
+}
+
+func (p *streamingProvider) record(messages []providers.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, messages)
+}
+
+func (p *streamingProvider) last() []providers.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests[len(p.requests)-1]
+}
+
+func (p *streamingProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.record(messages)
+	return &providers.LLMResponse{
+		Content:      "Hello world",
+		FinishReason: "stop",
+		Usage:        &providers.UsageInfo{PromptTokens: 5, CompletionTokens: 2},
+	}, nil
+}
+
+func (p *streamingProvider) ChatStream(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+	onDelta func(providers.StreamDelta),
+) (*providers.LLMResponse, error) {
+	p.record(messages)
+	onDelta(providers.StreamDelta{Content: "Hello"})
+	onDelta(providers.StreamDelta{Content: " world"})
+	return &providers.LLMResponse{
+		Content:      "Hello world",
+		FinishReason: "stop",
+		Usage:        &providers.UsageInfo{PromptTokens: 5, CompletionTokens: 2},
+	}, nil
+}
+
+func (p *streamingProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func newTestAPI(t *testing.T) (*httptest.Server, *agent.AgentLoop, *streamingProvider) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+			List: []config.AgentConfig{
+				{ID: "main", Default: true, Workspace: tmpDir + "/main"},
+				{ID: "work", Workspace: tmpDir + "/work"},
+			},
+		},
+	}
+	provider := &streamingProvider{}
+	al := agent.NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	mux := http.NewServeMux()
+	NewHandler(al, "secret").RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, al, provider
+}
+
+func post(t *testing.T, srv *httptest.Server, body string, headers map[string]string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestModels(t *testing.T) {
+	srv, _, _ := newTestAPI(t)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Object string  `json:"object"`
+		Data   []model `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	if list.Object != "list" || len(list.Data) != 2 || list.Data[0].ID != "main" || list.Data[1].ID != "work" {
+		t.Errorf("models = %+v, want main and work", list)
+	}
+}
+
+func TestRequiresBearerToken(t *testing.T) {
+	srv, _, _ := newTestAPI(t)
+
+	for _, auth := range []string{"", "Bearer wrong"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/models", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("auth %q: status %d, want 401", auth, resp.StatusCode)
+		}
+	}
+}
+
+func TestChatCompletion_SessionMapsToAgentSession(t *testing.T) {
+	srv, al, provider := newTestAPI(t)
+
+	resp := post(t, srv, `{"model":"work","user":"Alice","messages":[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":[{"type":"text","text":"Hi there"}]}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	var out completion
+	json.NewDecoder(resp.Body).Decode(&out)
+	if out.Object != "chat.completion" || out.Model != "work" || len(out.Choices) != 1 ||
+		out.Choices[0].Message.Content != "Hello world" || *out.Choices[0].FinishReason != "stop" {
+		t.Errorf("completion = %+v", out)
+	}
+	if out.Usage == nil || *out.Usage != (tokenUsage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}) {
+		t.Errorf("usage = %+v, want the provider's token counts", out.Usage)
+	}
+
+	msgs := provider.last()
+	if got := msgs[len(msgs)-1].Content; !strings.Contains(got, "Be brief.") || !strings.HasSuffix(got, "Hi there") {
+		t.Errorf("prompt = %q, want instructions and user text", got)
+	}
+
+	work, _ := al.GetAgent("work")
+	if h := work.Sessions.GetHistory("agent:work:api:alice"); len(h) != 2 {
+		t.Errorf("session history has %d messages, want 2", len(h))
+	}
+
+	// The header overrides the user field and continues the same session.
+	post(t, srv, `{"model":"work","user":"bob","messages":[{"role":"user","content":"again"}]}`,
+		map[string]string{SessionHeader: "alice"})
+	if h := work.Sessions.GetHistory("agent:work:api:alice"); len(h) != 4 {
+		t.Errorf("session history has %d messages after second turn, want 4", len(h))
+	}
+}
+
+func TestChatCompletion_OneOffConversationIsSeeded(t *testing.T) {
+	srv, al, provider := newTestAPI(t)
+
+	resp := post(t, srv, `{"model":"","messages":[
+		{"role":"user","content":"My name is Ada."},
+		{"role":"assistant","content":"Nice to meet you, Ada."},
+		{"role":"user","content":"What is my name?"}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	var seen []string
+	for _, m := range provider.last() {
+		seen = append(seen, m.Role+":"+m.Content)
+	}
+	joined := strings.Join(seen, "|")
+	if !strings.Contains(joined, "user:My name is Ada.|assistant:Nice to meet you, Ada.|user:What is my name?") {
+		t.Errorf("provider messages = %v, want seeded conversation", seen)
+	}
+
+	main, _ := al.GetAgent("main")
+	files, _ := filepath.Glob(filepath.Join(main.Workspace, "sessions", "*oneoff*"))
+	if len(files) != 0 {
+		t.Errorf("one-off session files left behind: %v", files)
+	}
+}
+
+func TestChatCompletion_Streaming(t *testing.T) {
+	srv, _, _ := newTestAPI(t)
+
+	resp := post(t, srv, `{"model":"main","stream":true,"stream_options":{"include_usage":true},
+		"messages":[{"role":"user","content":"hi"}]}`, nil)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	var content strings.Builder
+	var finish string
+	var total int
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk completion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("chunk object = %q", chunk.Object)
+		}
+		if chunk.Usage != nil {
+			total = chunk.Usage.TotalTokens
+			continue
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+		if chunk.Choices[0].FinishReason != nil {
+			finish = *chunk.Choices[0].FinishReason
+		}
+	}
+	if !done || content.String() != "Hello world" || finish != "stop" {
+		t.Errorf("stream content = %q, finish = %q, done = %v", content.String(), finish, done)
+	}
+	if total != 7 {
+		t.Errorf("usage chunk total_tokens = %d, want 7", total)
+	}
+}
+
+func TestChatCompletion_Errors(t *testing.T) {
+	srv, _, _ := newTestAPI(t)
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"model":"nope","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound},
+		{`{"model":"main","messages":[{"role":"assistant","content":"hi"}]}`, http.StatusBadRequest},
+		{`{"model":"main","messages":[]}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp := post(t, srv, tt.body, nil)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.body, resp.StatusCode, tt.status)
+		}
+		var out struct {
+			Error apiError `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&out); out.Error.Message == "" {
+			t.Errorf("%s: missing error message", tt.body)
+		}
+	}
+}
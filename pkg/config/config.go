@@ -130,13 +130,71 @@ func (m AgentModelConfig) MarshalJSON() ([]byte, error) {
 }
 
 type AgentConfig struct {
-	ID        string            `json:"id"`
-	Default   bool              `json:"default,omitempty"`
-	Name      string            `json:"name,omitempty"`
-	Workspace string            `json:"workspace,omitempty"`
-	Model     *AgentModelConfig `json:"model,omitempty"`
-	Skills    []string          `json:"skills,omitempty"`
-	Subagents *SubagentsConfig  `json:"subagents,omitempty"`
+	ID               string            `json:"id"`
+	Default          bool              `json:"default,omitempty"`
+	Name             string            `json:"name,omitempty"`
+	Workspace        string            `json:"workspace,omitempty"`
+	Model            *AgentModelConfig `json:"model,omitempty"`
+	Skills           []string          `json:"skills,omitempty"`
+	Subagents        *SubagentsConfig  `json:"subagents,omitempty"`
+	MaxConcurrency   int               `json:"max_concurrency,omitempty"`    // per-agent cap on parallel sessions, 0 = global cap only
+	MaxParallelTools int               `json:"max_parallel_tools,omitempty"` // overrides agents.defaults.max_parallel_tools
+	Budget           *BudgetConfig     `json:"budget,omitempty"`             // overrides agents.defaults.budget
+	Routing          *RoutingConfig    `json:"routing,omitempty"`            // overrides agents.defaults.routing
+	Reasoning        *ReasoningConfig  `json:"reasoning,omitempty"`          // overrides agents.defaults.reasoning
+	ExecNetwork      *bool             `json:"exec_network,omitempty"`       // overrides tools.exec.sandbox.network
+	Egress           *EgressConfig     `json:"egress,omitempty"`             // overrides tools.egress
+	Tools            *ToolPolicyConfig `json:"tools,omitempty"`              // restricts the agent's tools
+}
+
+// ToolPolicyConfig restricts which tools an agent may use and the arguments
+// it may pass them. Tools that are not allowed are hidden from the model and
+// refused if called anyway.
+type ToolPolicyConfig struct {
+	Allow []string                            `json:"allow,omitempty"` // tool names or globs such as "mcp_github_*"; empty allows every tool
+	Deny  []string                            `json:"deny,omitempty"`  // tool names or globs, wins over allow
+	Args  map[string]map[string]ArgConstraint `json:"args,omitempty"`  // tool name -> argument name -> constraint
+}
+
+// ArgConstraint limits the values of one tool argument, in the manner of a
+// JSON schema. A call that leaves the argument out is not checked.
+type ArgConstraint struct {
+	Enum    []any    `json:"enum,omitempty"`    // allowed values
+	Pattern string   `json:"pattern,omitempty"` // regular expression the value must match
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	Within  []string `json:"within,omitempty"` // directories a path value must be inside
+}
+
+// BudgetConfig limits what an agent may spend on LLM calls, in USD as priced
+// by the model_list. Once a limit is reached the agent either switches to
+// DowngradeModel or, if none is set, refuses new turns until the period ends.
+type BudgetConfig struct {
+	Daily          float64 `json:"daily,omitempty"`           // 0 = unlimited
+	Monthly        float64 `json:"monthly,omitempty"`         // 0 = unlimited
+	DowngradeModel string  `json:"downgrade_model,omitempty"` // cheaper model to use once exceeded
+}
+
+// RoutingConfig sends each turn to a model tier, such as "fast", "default"
+// or "deep", picked from the message by heuristics or a classifier model.
+// Tiers not listed fall back to the agent's regular model.
+type RoutingConfig struct {
+	Enabled         bool                        `json:"enabled"`
+	Tiers           map[string]AgentModelConfig `json:"tiers,omitempty"`
+	ClassifierModel string                      `json:"classifier_model,omitempty"` // optional small model that picks the tier
+	FastMaxChars    int                         `json:"fast_max_chars,omitempty"`   // shorter plain messages go to "fast", default 160
+	DeepMinChars    int                         `json:"deep_min_chars,omitempty"`   // longer messages go to "deep", default 2000
+	DeepKeywords    []string                    `json:"deep_keywords,omitempty"`    // words that send a message to "deep"
+}
+
+// ReasoningConfig turns on extended thinking for models that support it.
+// Effort is "low", "medium" or "high"; Budget sets the thinking tokens
+// directly for providers that take a budget (Anthropic, Gemini) and takes
+// precedence over Effort there.
+type ReasoningConfig struct {
+	Effort string `json:"effort,omitempty"`
+	Budget int    `json:"budget,omitempty"`
+	Show   bool   `json:"show,omitempty"` // send a collapsed reasoning summary on channels with spoilers or quotes
 }
 
 type SubagentsConfig struct {
@@ -168,16 +226,22 @@ type SessionConfig struct {
 }
 
 type AgentDefaults struct {
-	Workspace           string   `json:"workspace"                       env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
-	RestrictToWorkspace bool     `json:"restrict_to_workspace"           env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
-	Provider            string   `json:"provider"                        env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
-	Model               string   `json:"model"                           env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
-	ModelFallbacks      []string `json:"model_fallbacks,omitempty"`
-	ImageModel          string   `json:"image_model,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
-	ImageModelFallbacks []string `json:"image_model_fallbacks,omitempty"`
-	MaxTokens           int      `json:"max_tokens"                      env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
-	Temperature         *float64 `json:"temperature,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
-	MaxToolIterations   int      `json:"max_tool_iterations"             env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Workspace           string          `json:"workspace"                       env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
+	RestrictToWorkspace bool            `json:"restrict_to_workspace"           env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
+	Provider            string          `json:"provider"                        env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
+	Model               string          `json:"model"                           env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
+	ModelFallbacks      []string        `json:"model_fallbacks,omitempty"`
+	ImageModel          string          `json:"image_model,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
+	ImageModelFallbacks []string        `json:"image_model_fallbacks,omitempty"`
+	MaxTokens           int             `json:"max_tokens"                      env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
+	Temperature         *float64        `json:"temperature,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
+	MaxToolIterations   int             `json:"max_tool_iterations"             env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	MaxConcurrentTurns  int             `json:"max_concurrent_turns"            env:"PICOCLAW_AGENTS_DEFAULTS_MAX_CONCURRENT_TURNS"` // global cap on sessions processed in parallel
+	MaxParallelTools    int             `json:"max_parallel_tools"              env:"PICOCLAW_AGENTS_DEFAULTS_MAX_PARALLEL_TOOLS"`   // tool calls from one response run at once, 1 = one at a time
+	Streaming           bool            `json:"streaming"                       env:"PICOCLAW_AGENTS_DEFAULTS_STREAMING"`            // progressively edit replies on channels that support it
+	Budget              BudgetConfig    `json:"budget,omitempty"`
+	Routing             RoutingConfig   `json:"routing,omitempty"`
+	Reasoning           ReasoningConfig `json:"reasoning,omitempty"`
 }
 
 type ChannelsConfig struct {
@@ -194,6 +258,10 @@ type ChannelsConfig struct {
 	OneBot   OneBotConfig   `json:"onebot"`
 	WeCom    WeComConfig    `json:"wecom"`
 	WeComApp WeComAppConfig `json:"wecom_app"`
+	Webhook  WebhookConfig  `json:"webhook"`
+	Email    EmailConfig    `json:"email"`
+	Matrix   MatrixConfig   `json:"matrix"`
+	Delivery DeliveryConfig `json:"delivery"`
 }
 
 type WhatsAppConfig struct {
@@ -307,6 +375,83 @@ type WeComAppConfig struct {
 	ReplyTimeout   int                 `json:"reply_timeout"    env:"PICOCLAW_CHANNELS_WECOM_APP_REPLY_TIMEOUT"`
 }
 
+type WebhookConfig struct {
+	Enabled      bool                `json:"enabled"       env:"PICOCLAW_CHANNELS_WEBHOOK_ENABLED"`
+	Secret       string              `json:"secret"        env:"PICOCLAW_CHANNELS_WEBHOOK_SECRET"`
+	WebhookHost  string              `json:"webhook_host"  env:"PICOCLAW_CHANNELS_WEBHOOK_WEBHOOK_HOST"`
+	WebhookPort  int                 `json:"webhook_port"  env:"PICOCLAW_CHANNELS_WEBHOOK_WEBHOOK_PORT"`
+	WebhookPath  string              `json:"webhook_path"  env:"PICOCLAW_CHANNELS_WEBHOOK_WEBHOOK_PATH"`
+	CallbackURL  string              `json:"callback_url"  env:"PICOCLAW_CHANNELS_WEBHOOK_CALLBACK_URL"`
+	MaxRetries   int                 `json:"max_retries"   env:"PICOCLAW_CHANNELS_WEBHOOK_MAX_RETRIES"`
+	ReplyTimeout int                 `json:"reply_timeout" env:"PICOCLAW_CHANNELS_WEBHOOK_REPLY_TIMEOUT"`
+	AllowFrom    FlexibleStringSlice `json:"allow_from"    env:"PICOCLAW_CHANNELS_WEBHOOK_ALLOW_FROM"`
+}
+
+type EmailConfig struct {
+	Enabled      bool                `json:"enabled"       env:"PICOCLAW_CHANNELS_EMAIL_ENABLED"`
+	IMAPHost     string              `json:"imap_host"     env:"PICOCLAW_CHANNELS_EMAIL_IMAP_HOST"`
+	IMAPPort     int                 `json:"imap_port"     env:"PICOCLAW_CHANNELS_EMAIL_IMAP_PORT"`
+	IMAPTLS      bool                `json:"imap_tls"      env:"PICOCLAW_CHANNELS_EMAIL_IMAP_TLS"`
+	SMTPHost     string              `json:"smtp_host"     env:"PICOCLAW_CHANNELS_EMAIL_SMTP_HOST"`
+	SMTPPort     int                 `json:"smtp_port"     env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PORT"`
+	SMTPTLS      bool                `json:"smtp_tls"      env:"PICOCLAW_CHANNELS_EMAIL_SMTP_TLS"`
+	Username     string              `json:"username"      env:"PICOCLAW_CHANNELS_EMAIL_USERNAME"`
+	Password     string              `json:"password"      env:"PICOCLAW_CHANNELS_EMAIL_PASSWORD"`
+	FromAddress  string              `json:"from_address"  env:"PICOCLAW_CHANNELS_EMAIL_FROM_ADDRESS"`
+	Mailboxes    FlexibleStringSlice `json:"mailboxes"     env:"PICOCLAW_CHANNELS_EMAIL_MAILBOXES"`
+	PollInterval int                 `json:"poll_interval" env:"PICOCLAW_CHANNELS_EMAIL_POLL_INTERVAL"`
+	UseIDLE      bool                `json:"use_idle"      env:"PICOCLAW_CHANNELS_EMAIL_USE_IDLE"`
+	AllowFrom    FlexibleStringSlice `json:"allow_from"    env:"PICOCLAW_CHANNELS_EMAIL_ALLOW_FROM"`
+	VerifySender bool                `json:"verify_sender" env:"PICOCLAW_CHANNELS_EMAIL_VERIFY_SENDER"`
+	Insecure     bool                `json:"insecure"      env:"PICOCLAW_CHANNELS_EMAIL_INSECURE"`
+}
+
+type MatrixConfig struct {
+	Enabled     bool                `json:"enabled"      env:"PICOCLAW_CHANNELS_MATRIX_ENABLED"`
+	Homeserver  string              `json:"homeserver"   env:"PICOCLAW_CHANNELS_MATRIX_HOMESERVER"`
+	UserID      string              `json:"user_id"      env:"PICOCLAW_CHANNELS_MATRIX_USER_ID"`
+	AccessToken string              `json:"access_token" env:"PICOCLAW_CHANNELS_MATRIX_ACCESS_TOKEN"`
+	AutoJoin    bool                `json:"auto_join"    env:"PICOCLAW_CHANNELS_MATRIX_AUTO_JOIN"`
+	MentionOnly bool                `json:"mention_only" env:"PICOCLAW_CHANNELS_MATRIX_MENTION_ONLY"`
+	AllowFrom   FlexibleStringSlice `json:"allow_from"   env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_FROM"`
+}
+
+// RetryPolicy controls how a failed outbound send is retried. Delays are in
+// seconds and double after each attempt; a platform's retry-after hint takes
+// precedence when it is longer.
+type RetryPolicy struct {
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	BaseDelay   int `json:"base_delay,omitempty"`
+	MaxDelay    int `json:"max_delay,omitempty"`
+}
+
+type DeliveryConfig struct {
+	Retry          RetryPolicy            `json:"retry"`
+	Overrides      map[string]RetryPolicy `json:"overrides,omitempty"` // by channel name
+	MaxDeadLetters int                    `json:"max_dead_letters" env:"PICOCLAW_CHANNELS_DELIVERY_MAX_DEAD_LETTERS"`
+}
+
+// PolicyFor returns the retry policy for a channel, with unset override
+// fields taken from the default policy.
+func (d DeliveryConfig) PolicyFor(channel string) RetryPolicy {
+	policy := d.Retry
+	if o, ok := d.Overrides[channel]; ok {
+		if o.MaxAttempts > 0 {
+			policy.MaxAttempts = o.MaxAttempts
+		}
+		if o.BaseDelay > 0 {
+			policy.BaseDelay = o.BaseDelay
+		}
+		if o.MaxDelay > 0 {
+			policy.MaxDelay = o.MaxDelay
+		}
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	return policy
+}
+
 type HeartbeatConfig struct {
 	Enabled  bool `json:"enabled"  env:"PICOCLAW_HEARTBEAT_ENABLED"`
 	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
@@ -321,6 +466,9 @@ const (
 
 type PersistenceConfig struct {
 	Type PersistenceType `json:"type" env:"PICOCLAW_PERSISTENCE_TYPE"`
+	// DurableBus keeps in-flight messages in the SQLite database so they
+	// survive a restart. Off by default to keep tiny boards on the in-memory bus.
+	DurableBus bool `json:"durable_bus" env:"PICOCLAW_PERSISTENCE_DURABLE_BUS"`
 }
 
 type DevicesConfig struct {
@@ -415,7 +563,13 @@ type ModelConfig struct {
 
 	// Optional optimizations
 	RPM            int    `json:"rpm,omitempty"`              // Requests per minute limit
+	TPM            int    `json:"tpm,omitempty"`              // Tokens per minute limit
 	MaxTokensField string `json:"max_tokens_field,omitempty"` // Field name for max tokens (e.g., "max_completion_tokens")
+	KeepAlive      string `json:"keep_alive,omitempty"`       // Ollama: how long the model stays loaded (e.g., "10m", "-1")
+
+	// Pricing for the usage ledger, in USD per million tokens
+	InputPrice  float64 `json:"input_price,omitempty"`
+	OutputPrice float64 `json:"output_price,omitempty"`
 }
 
 // Validate checks if the ModelConfig has all required fields.
@@ -430,8 +584,16 @@ func (c *ModelConfig) Validate() error {
 }
 
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host string           `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
+	Port int              `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	API  GatewayAPIConfig `json:"api"`
+}
+
+// GatewayAPIConfig enables the OpenAI-compatible chat API on the gateway.
+// Requests must carry Token as a bearer token.
+type GatewayAPIConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_GATEWAY_API_ENABLED"`
+	Token   string `json:"token"   env:"PICOCLAW_GATEWAY_API_TOKEN"`
 }
 
 type BraveConfig struct {
@@ -470,15 +632,83 @@ type CronToolsConfig struct {
 }
 
 type ExecConfig struct {
-	EnableDenyPatterns bool     `json:"enable_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_ENABLE_DENY_PATTERNS"`
-	CustomDenyPatterns []string `json:"custom_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
+	EnableDenyPatterns bool              `json:"enable_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_ENABLE_DENY_PATTERNS"`
+	CustomDenyPatterns []string          `json:"custom_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
+	Sandbox            ExecSandboxConfig `json:"sandbox"`
+}
+
+// ExecSandboxConfig runs exec commands in a Linux sandbox: new user, mount,
+// PID and network namespaces in which only the workspace is writable and
+// system directories are read-only, with Landlock rules, a seccomp syscall
+// filter and resource limits on top. Deny patterns are still checked first.
+type ExecSandboxConfig struct {
+	Enabled       bool     `json:"enabled" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_ENABLED"`
+	Network       bool     `json:"network" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_NETWORK"` // agents can override with exec_network
+	ReadOnlyPaths []string `json:"read_only_paths,omitempty"`                         // extra host paths, visible read-only
+	WritablePaths []string `json:"writable_paths,omitempty"`                          // extra host paths, visible read-write
+	CPUSeconds    int      `json:"cpu_seconds,omitempty"`                             // CPU time per command, default 120
+	MemoryMB      int      `json:"memory_mb,omitempty"`                               // data segment size, default 1024
+	MaxProcesses  int      `json:"max_processes,omitempty"`                           // counts all processes of the user, default 1024
+	MaxFileSizeMB int      `json:"max_file_size_mb,omitempty"`                        // largest file a command may write, default 512
 }
 
 type ToolsConfig struct {
-	Web    WebToolsConfig    `json:"web"`
-	Cron   CronToolsConfig   `json:"cron"`
-	Exec   ExecConfig        `json:"exec"`
-	Skills SkillsToolsConfig `json:"skills"`
+	Web      WebToolsConfig    `json:"web"`
+	Cron     CronToolsConfig   `json:"cron"`
+	Exec     ExecConfig        `json:"exec"`
+	Skills   SkillsToolsConfig `json:"skills"`
+	MCP      MCPConfig         `json:"mcp"`
+	Approval ApprovalConfig    `json:"approval"`
+	Egress   EgressConfig      `json:"egress"`
+}
+
+// EgressConfig limits the hosts web_fetch, skill downloads and other
+// HTTP-calling tools may connect to. Private, loopback, link-local and cloud
+// metadata addresses are always blocked unless AllowCIDRs covers them.
+type EgressConfig struct {
+	AllowDomains []string `json:"allow_domains,omitempty"` // if set, only these domains and their subdomains
+	DenyDomains  []string `json:"deny_domains,omitempty"`  // domains and subdomains never reached
+	AllowCIDRs   []string `json:"allow_cidrs,omitempty"`   // non-public ranges to permit, e.g. "192.168.1.0/24"
+}
+
+// ApprovalConfig makes matching tool calls wait until the user approves them
+// in the chat the turn came from. Calls that are denied, time out or come
+// from a turn without a chat to ask in are not run.
+type ApprovalConfig struct {
+	RequireApproval []ApprovalRule `json:"require_approval,omitempty"`
+	TimeoutSeconds  int            `json:"timeout_seconds,omitempty"` // default 300
+	// Approvers may answer every approval request; otherwise only the
+	// user whose message started the turn may.
+	Approvers []string `json:"approvers,omitempty"` // sender IDs
+}
+
+// ApprovalRule matches the tool calls that need approval. A rule with
+// neither patterns nor paths matches every call of the tool.
+type ApprovalRule struct {
+	Tool         string   `json:"tool"`                    // tool name, or "*" for every tool
+	Arg          string   `json:"arg,omitempty"`           // argument to test; empty tests every string argument
+	Patterns     []string `json:"patterns,omitempty"`      // regular expressions, any match needs approval
+	UnlessWithin []string `json:"unless_within,omitempty"` // paths needing no approval; Arg defaults to "path"
+}
+
+// MCPConfig lists Model Context Protocol servers whose tools are exposed to agents.
+type MCPConfig struct {
+	Servers map[string]MCPServerConfig `json:"servers,omitempty"`
+}
+
+// MCPServerConfig describes how to reach one MCP server. Type is "stdio"
+// (spawn Command), "http" (streamable HTTP at URL) or "sse" (legacy
+// HTTP+SSE at URL). When Type is empty it is inferred from Command/URL.
+type MCPServerConfig struct {
+	Disabled bool              `json:"disabled,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Command  string            `json:"command,omitempty"`
+	Args     []string          `json:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Dir      string            `json:"dir,omitempty"`
+	URL      string            `json:"url,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Timeout  int               `json:"timeout,omitempty"` // per-request timeout in seconds, default 60
 }
 
 type SkillsToolsConfig struct {
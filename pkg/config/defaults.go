@@ -17,6 +17,9 @@ func DefaultConfig() *Config {
 				MaxTokens:           8192,
 				Temperature:         nil, // nil means use provider default
 				MaxToolIterations:   20,
+				MaxConcurrentTurns:  4,
+				MaxParallelTools:    4,
+				Streaming:           false,
 			},
 		},
 		Bindings: []AgentBinding{},
@@ -113,6 +116,52 @@ func DefaultConfig() *Config {
 				AllowFrom:      FlexibleStringSlice{},
 				ReplyTimeout:   5,
 			},
+			Webhook: WebhookConfig{
+				Enabled:      false,
+				Secret:       "",
+				WebhookHost:  "0.0.0.0",
+				WebhookPort:  18794,
+				WebhookPath:  "/webhook/generic",
+				CallbackURL:  "",
+				MaxRetries:   3,
+				ReplyTimeout: 120,
+				AllowFrom:    FlexibleStringSlice{},
+			},
+			Email: EmailConfig{
+				Enabled:      false,
+				IMAPHost:     "",
+				IMAPPort:     993,
+				IMAPTLS:      true,
+				SMTPHost:     "",
+				SMTPPort:     587,
+				SMTPTLS:      false,
+				Username:     "",
+				Password:     "",
+				FromAddress:  "",
+				Mailboxes:    FlexibleStringSlice{"INBOX"},
+				PollInterval: 60,
+				UseIDLE:      true,
+				AllowFrom:    FlexibleStringSlice{},
+				VerifySender: true,
+				Insecure:     false,
+			},
+			Matrix: MatrixConfig{
+				Enabled:     false,
+				Homeserver:  "https://matrix.org",
+				UserID:      "",
+				AccessToken: "",
+				AutoJoin:    true,
+				MentionOnly: false,
+				AllowFrom:   FlexibleStringSlice{},
+			},
+			Delivery: DeliveryConfig{
+				Retry: RetryPolicy{
+					MaxAttempts: 5,
+					BaseDelay:   2,
+					MaxDelay:    300,
+				},
+				MaxDeadLetters: 500,
+			},
 		},
 		Providers: ProvidersConfig{
 			OpenAI: OpenAIProviderConfig{WebSearch: true},
@@ -7,6 +7,8 @@ var internalChannels = map[string]struct{}{
 	"cli":      {},
 	"system":   {},
 	"subagent": {},
+	"api":      {},
+	"mcp":      {},
 }
 
 // IsInternalChannel returns true if the channel is an internal channel.
@@ -29,6 +29,16 @@ type CronPayload struct {
 	Deliver bool   `json:"deliver"`
 	Channel string `json:"channel,omitempty"`
 	To      string `json:"to,omitempty"`
+	// AgentID is the agent that created the job; its tools, tool policy
+	// and approval rules apply to the job's command. Empty means the
+	// default agent.
+	AgentID string `json:"agentId,omitempty"`
+	// SenderID is the user who scheduled the job; approval requests of
+	// its runs are theirs to answer.
+	SenderID string `json:"senderId,omitempty"`
+	// ResponseSchema asks the agent turn for a JSON answer matching it;
+	// an empty schema asks for any JSON object.
+	ResponseSchema map[string]any `json:"responseSchema,omitempty"`
 }
 
 type CronJobState struct {
@@ -36,6 +46,9 @@ type CronJobState struct {
 	LastRunAtMS *int64 `json:"lastRunAtMs,omitempty"`
 	LastStatus  string `json:"lastStatus,omitempty"`
 	LastError   string `json:"lastError,omitempty"`
+	// LastResult is the JSON answer of the last run of a job with a
+	// response schema, after validation against it.
+	LastResult json.RawMessage `json:"lastResult,omitempty"`
 }
 
 type CronJob struct {
@@ -409,6 +422,20 @@ func (cs *CronService) UpdateJob(job *CronJob) error {
 	return fmt.Errorf("job not found")
 }
 
+// SetLastResult records the structured result of a job's run.
+func (cs *CronService) SetLastResult(jobID string, result json.RawMessage) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for i := range cs.store.Jobs {
+		if cs.store.Jobs[i].ID == jobID {
+			cs.store.Jobs[i].State.LastResult = result
+			return cs.saveStoreUnsafe()
+		}
+	}
+	return fmt.Errorf("job not found")
+}
+
 func (cs *CronService) RemoveJob(jobID string) bool {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
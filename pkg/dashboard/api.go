@@ -1,7 +1,9 @@
 package dashboard
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"os/exec"
@@ -12,10 +14,13 @@ import (
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/egress"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/usage"
 )
 
 var startTime = time.Now()
@@ -41,11 +46,14 @@ func NewAPI(cfgFile string, cfg *config.Config, ch *channels.Manager, tr *tools.
 	cwd, _ := os.Getwd()
 	builtinSkillsDir := filepath.Join(cwd, "skills")
 
+	installer := skills.NewSkillInstaller(workspace)
+	installer.SetEgressPolicy(egress.NewPolicy(cfg.Tools.Egress))
+
 	return &API{
 		cfgFile:   cfgFile,
 		cfg:       cfg,
 		loader:    skills.NewSkillsLoader(workspace, filepath.Join(globalConfigDir, "skills"), builtinSkillsDir),
-		installer: skills.NewSkillInstaller(workspace),
+		installer: installer,
 		channels:  ch,
 		tools:     tr,
 		state:     sm,
@@ -83,6 +91,22 @@ func (api *API) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/v1/cron/jobs/test", api.handleTestCronJob)
 	mux.HandleFunc("POST /api/v1/cron/jobs/enable", api.handleEnableCronJob)
 
+	// Delivery endpoints
+	mux.HandleFunc("GET /api/v1/deliveries", api.handleDeliveryStats)
+	mux.HandleFunc("GET /api/v1/deliveries/dead-letters", api.handleListDeadLetters)
+	mux.HandleFunc("DELETE /api/v1/deliveries/dead-letters", api.handleDeleteDeadLetter)
+	mux.HandleFunc("POST /api/v1/deliveries/dead-letters/resend", api.handleResendDeadLetter)
+
+	// Provider rate limits
+	mux.HandleFunc("GET /api/v1/rate-limits", api.handleRateLimits)
+
+	// Usage ledger
+	mux.HandleFunc("GET /api/v1/usage", api.handleUsage)
+
+	// Ollama model management
+	mux.HandleFunc("GET /api/v1/ollama/models", api.handleOllamaModels)
+	mux.HandleFunc("POST /api/v1/ollama/pull", api.handleOllamaPull)
+
 	// Serve the React matching /dashboard/
 	staticFS := getStaticFS()
 	fileServer := http.StripPrefix("/dashboard/", http.FileServer(staticFS))
@@ -335,6 +359,7 @@ func (api *API) handleSystemStatus(w http.ResponseWriter, r *http.Request) {
 	if api.tools != nil {
 		response["total_tools_count"] = api.tools.Count()
 	}
+	response["rate_limits"] = providers.RateLimitStatus()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -590,3 +615,182 @@ func (api *API) handleEnableCronJob(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(job)
 }
+
+func (api *API) handleDeliveryStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if api.channels == nil {
+		http.Error(w, "Channel manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.channels.DeliveryStats())
+}
+
+func (api *API) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if api.channels == nil {
+		http.Error(w, "Channel manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	letters, err := api.channels.DeadLetters().List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if letters == nil {
+		letters = []channels.DeadLetter{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letters)
+}
+
+// handleDeleteDeadLetter removes one dead letter (?id=...) or all of them (?all=true).
+func (api *API) handleDeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if api.channels == nil {
+		http.Error(w, "Channel manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	store := api.channels.DeadLetters()
+	if r.URL.Query().Get("all") == "true" {
+		count, err := store.Clear()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"status": "success", "removed": count})
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return
+	}
+	found, err := store.Remove(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (api *API) handleResendDeadLetter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if api.channels == nil {
+		http.Error(w, "Channel manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := api.channels.Resend(r.Context(), req.ID); err != nil {
+		if errors.Is(err, channels.ErrDeadLetterNotFound) {
+			http.Error(w, "Dead letter not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleRateLimits returns the state of the shared provider rate limiters,
+// including how long requests have been waiting for them.
+func (api *API) handleRateLimits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(providers.RateLimitStatus())
+}
+
+// handleUsage totals the usage ledger for ?period=today|month|all, grouped
+// by ?by=agent|session|channel|model|kind|day, with each agent's budget.
+func (api *API) handleUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	query := r.URL.Query()
+	report, err := usage.BuildReport(api.cfg, query.Get("period"), query.Get("by"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleOllamaModels lists the models installed on each Ollama server in
+// model_list.
+func (api *API) handleOllamaModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	type serverModels struct {
+		APIBase string                  `json:"api_base"`
+		Models  []providers.OllamaModel `json:"models"`
+		Error   string                  `json:"error,omitempty"`
+	}
+	result := []serverModels{}
+	for _, server := range providers.OllamaServers(api.cfg.ModelList) {
+		entry := serverModels{APIBase: server.APIBase, Models: []providers.OllamaModel{}}
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		models, err := server.Provider.ListModels(ctx)
+		cancel()
+		if err != nil {
+			entry.Error = err.Error()
+		} else if models != nil {
+			entry.Models = models
+		}
+		result = append(result, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleOllamaPull pulls {"model": "..."} onto its Ollama server, streaming
+// progress as JSON lines. The last line reports success or the error.
+func (api *API) handleOllamaPull(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	server, model, err := providers.ResolveOllamaPull(api.cfg.ModelList, req.Model)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	err = server.Provider.PullModel(r.Context(), model, func(p providers.OllamaPullProgress) {
+		enc.Encode(p)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		enc.Encode(map[string]string{"status": "error", "error": err.Error()})
+	}
+}
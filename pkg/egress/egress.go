@@ -0,0 +1,319 @@
+// Package egress decides which hosts the agent's HTTP-calling tools may
+// reach. Private, loopback, link-local, cloud metadata and other non-public
+// addresses are blocked unless explicitly allowed, and domain allow and deny
+// lists narrow things further.
+//
+// Checks happen when a connection is dialed: the host is resolved once, every
+// address is checked, and the connection goes to one of the checked
+// addresses, so a DNS answer that changes between check and use cannot
+// redirect it. Redirects are checked hop by hop as well.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ErrBlocked is wrapped by every error caused by the policy.
+var ErrBlocked = errors.New("blocked by egress policy")
+
+// blockedPrefixes are never dialed unless an allow_cidrs entry covers them.
+var blockedPrefixes = mustPrefixes(
+	"0.0.0.0/8",       // "this" network
+	"10.0.0.0/8",      // private
+	"100.64.0.0/10",   // carrier-grade NAT, also Alibaba Cloud metadata
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local, also AWS/GCP/Azure metadata
+	"172.16.0.0/12",   // private
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"192.168.0.0/16",  // private
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved, including broadcast
+	"::/128",          // unspecified
+	"::1/128",         // loopback
+	"100::/64",        // discard
+	"2001:db8::/32",   // documentation
+	"fc00::/7",        // unique local, also AWS metadata fd00:ec2::254
+	"fe80::/10",       // link-local
+	"fec0::/10",       // deprecated site-local
+	"ff00::/8",        // multicast
+)
+
+// nat64Prefix embeds an IPv4 address in its last four bytes.
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+func mustPrefixes(cidrs ...string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(cidrs))
+	for i, cidr := range cidrs {
+		prefixes[i] = netip.MustParsePrefix(cidr)
+	}
+	return prefixes
+}
+
+// Policy checks hosts and addresses against the egress rules. A nil Policy
+// applies the defaults.
+type Policy struct {
+	allowDomains []string
+	denyDomains  []string
+	allowNets    []netip.Prefix
+
+	// lookup resolves host names; tests replace it.
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+var defaultPolicy = &Policy{}
+
+// Default returns the policy used when nothing is configured: every public
+// address is allowed and every non-public one blocked.
+func Default() *Policy {
+	return defaultPolicy
+}
+
+// NewPolicy builds a policy from config. Invalid allow_cidrs entries are
+// skipped with a warning.
+func NewPolicy(cfg config.EgressConfig) *Policy {
+	p := &Policy{
+		allowDomains: normalizeDomains(cfg.AllowDomains),
+		denyDomains:  normalizeDomains(cfg.DenyDomains),
+	}
+	for _, cidr := range cfg.AllowCIDRs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			logger.WarnCF("egress", "Ignoring invalid allow_cidrs entry", map[string]any{
+				"cidr":  cidr,
+				"error": err.Error(),
+			})
+			continue
+		}
+		p.allowNets = append(p.allowNets, prefix)
+	}
+	return p
+}
+
+// parsePrefix accepts a CIDR or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func normalizeDomains(domains []string) []string {
+	var out []string
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.TrimPrefix(normalizeHost(d), "*"), ".")
+		if d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// matchDomain reports whether host is one of domains or a subdomain of one.
+// IP literals only match exactly.
+func matchDomain(host string, domains []string) bool {
+	_, err := netip.ParseAddr(host)
+	isIP := err == nil
+	for _, d := range domains {
+		if host == d || !isIP && strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHost checks a host name or IP literal against the domain lists and,
+// for IP literals, the address rules. Host names are resolved and checked
+// when dialing.
+func (p *Policy) CheckHost(host string) error {
+	if p == nil {
+		p = defaultPolicy
+	}
+	host = normalizeHost(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrBlocked)
+	}
+	if matchDomain(host, p.denyDomains) {
+		return blocked(host, "", "domain is denied")
+	}
+	if len(p.allowDomains) > 0 && !matchDomain(host, p.allowDomains) {
+		return blocked(host, "", "domain is not in the allow list")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.CheckAddr(addr)
+	}
+	return nil
+}
+
+// CheckURL checks that u is an http or https URL whose host passes CheckHost.
+func (p *Policy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrBlocked, u.Scheme)
+	}
+	return p.CheckHost(u.Hostname())
+}
+
+// CheckAddr checks an address against the blocked ranges and allow_cidrs.
+func (p *Policy) CheckAddr(addr netip.Addr) error {
+	if p == nil {
+		p = defaultPolicy
+	}
+	if !p.allowsAddr(addr) {
+		return blocked(addr.String(), "", "address is not public")
+	}
+	return nil
+}
+
+func (p *Policy) allowsAddr(addr netip.Addr) bool {
+	addr = addr.WithZone("")
+	for _, prefix := range p.allowNets {
+		if prefix.Contains(addr) || prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return !isBlocked(addr)
+}
+
+func isBlocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if nat64Prefix.Contains(addr) {
+		b := addr.As16()
+		if isBlocked(netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]})) {
+			return true
+		}
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func blocked(host, addr, reason string) error {
+	fields := map[string]any{"host": host, "reason": reason}
+	if addr != "" {
+		fields["address"] = addr
+		reason = fmt.Sprintf("%s resolves to %s: %s", host, addr, reason)
+	} else {
+		reason = fmt.Sprintf("%s: %s", host, reason)
+	}
+	logger.WarnCF("egress", "Blocked outbound connection", fields)
+	return fmt.Errorf("%w: %s", ErrBlocked, reason)
+}
+
+// DialContext resolves the host once, checks every address it resolves to
+// and connects to the first checked address that answers. Use it as an
+// http.Transport's DialContext.
+func (p *Policy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if p == nil {
+		p = defaultPolicy
+	}
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+	if err := p.CheckHost(host); err != nil {
+		return nil, err
+	}
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		lookup := p.lookup
+		if lookup == nil {
+			lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+				return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+			}
+		}
+		if addrs, err = lookup(ctx, host); err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses found for %s", host)
+		}
+	}
+	// One bad address rejects the host, since which one gets dialed is
+	// up to the order of the answer
+	for _, addr := range addrs {
+		if !p.allowsAddr(addr) {
+			return nil, blocked(host, addr.String(), "address is not public")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, netip.AddrPortFrom(addr.Unmap(), uint16(port)).String())
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// CheckRedirect checks each redirect target, stopping after maxRedirects
+// hops. It has the signature of http.Client's CheckRedirect.
+func (p *Policy) CheckRedirect(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return p.CheckURL(req.URL)
+	}
+}
+
+// NewClient returns an HTTP client that only connects where the policy
+// allows. Proxy settings from the environment are ignored, since a proxy
+// would make the connection on the client's behalf unchecked. maxRedirects
+// of 0 or less means 10.
+func (p *Policy) NewClient(timeout time.Duration, maxRedirects int) *http.Client {
+	if maxRedirects <= 0 {
+		maxRedirects = 10
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         p.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+			TLSHandshakeTimeout: 15 * time.Second,
+		},
+		CheckRedirect: p.CheckRedirect(maxRedirects),
+	}
+}
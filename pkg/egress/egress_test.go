@@ -0,0 +1,124 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestPolicy_CheckAddr(t *testing.T) {
+	blocked := []string{
+		"127.0.0.1", "10.1.2.3", "172.31.255.255", "192.168.1.1", "169.254.169.254",
+		"100.100.100.200", "0.0.0.0", "255.255.255.255", "224.0.0.1",
+		"::1", "::", "fe80::1%eth0", "fd00:ec2::254", "ff02::1",
+		"::ffff:127.0.0.1", "64:ff9b::a9fe:a9fe",
+	}
+	allowed := []string{"1.1.1.1", "93.184.216.34", "2606:4700:4700::1111", "64:ff9b::101:101"}
+
+	var p *Policy
+	for _, s := range blocked {
+		if err := p.CheckAddr(netip.MustParseAddr(s)); !errors.Is(err, ErrBlocked) {
+			t.Errorf("CheckAddr(%s) = %v, want blocked", s, err)
+		}
+	}
+	for _, s := range allowed {
+		if err := p.CheckAddr(netip.MustParseAddr(s)); err != nil {
+			t.Errorf("CheckAddr(%s) = %v, want allowed", s, err)
+		}
+	}
+
+	p = NewPolicy(config.EgressConfig{AllowCIDRs: []string{"192.168.1.0/24", "::1", "not-a-cidr"}})
+	for s, want := range map[string]bool{"192.168.1.20": true, "::1": true, "192.168.2.1": false, "127.0.0.1": false} {
+		if err := p.CheckAddr(netip.MustParseAddr(s)); (err == nil) != want {
+			t.Errorf("with allow_cidrs, CheckAddr(%s) = %v, want allowed=%v", s, err, want)
+		}
+	}
+}
+
+func TestPolicy_CheckURL(t *testing.T) {
+	p := NewPolicy(config.EgressConfig{
+		AllowDomains: []string{"example.com", "*.wikipedia.org"},
+		DenyDomains:  []string{"private.example.com"},
+	})
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/a", true},
+		{"https://docs.EXAMPLE.com./a", true},
+		{"https://en.wikipedia.org/wiki/Go", true},
+		{"https://wikipedia.org/", true},
+		{"https://private.example.com/", false},
+		{"https://x.private.example.com/", false},
+		{"https://notexample.com/", false},
+		{"https://example.com.evil.net/", false},
+		{"ftp://example.com/", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if err := p.CheckURL(u); (err == nil) != tt.want {
+			t.Errorf("CheckURL(%s) = %v, want allowed=%v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestPolicy_DialPinsResolvedAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	lookups := 0
+	p := NewPolicy(config.EgressConfig{AllowCIDRs: []string{"127.0.0.1"}})
+	p.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		lookups++
+		switch host {
+		case "pinned.test":
+			return []netip.Addr{netip.MustParseAddr("127.0.0.1")}, nil
+		case "mixed.test":
+			return []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("10.0.0.1")}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	client := p.NewClient(5*time.Second, 0)
+
+	resp, err := client.Get("http://pinned.test:" + port + "/")
+	if err != nil {
+		t.Fatalf("GET pinned.test: %v", err)
+	}
+	resp.Body.Close()
+	if lookups != 1 {
+		t.Errorf("resolved %d times, want once", lookups)
+	}
+
+	// Any blocked address in the answer rejects the host
+	if _, err := client.Get("http://mixed.test:" + port + "/"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("GET mixed.test = %v, want blocked", err)
+	}
+}
+
+func TestPolicy_RedirectsAreChecked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := NewPolicy(config.EgressConfig{AllowCIDRs: []string{"127.0.0.1"}}).NewClient(5*time.Second, 0)
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrBlocked) {
+		t.Errorf("redirect to metadata = %v, want blocked", err)
+	}
+
+	// The default policy refuses the loopback server itself
+	if _, err := Default().NewClient(5*time.Second, 0).Get(server.URL); !errors.Is(err, ErrBlocked) {
+		t.Errorf("GET loopback = %v, want blocked", err)
+	}
+}
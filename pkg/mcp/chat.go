@@ -0,0 +1,87 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// ChatExecutor runs one agent turn. *agent.AgentLoop implements it.
+type ChatExecutor interface {
+	ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error)
+}
+
+// ChatTool lets MCP clients talk to an agent. Each caller-chosen session
+// keeps its own history; turns within a session run one at a time.
+type ChatTool struct {
+	executor ChatExecutor
+	agentID  string
+	sessions sync.Map // session key -> *sync.Mutex
+}
+
+func NewChatTool(executor ChatExecutor, agentID string) *ChatTool {
+	return &ChatTool{executor: executor, agentID: routing.NormalizeAgentID(agentID)}
+}
+
+func (t *ChatTool) Name() string {
+	return "chat"
+}
+
+func (t *ChatTool) Description() string {
+	return fmt.Sprintf("Send a message to the picoclaw agent %q and get its reply. "+
+		"The agent can use its own tools, memory and skills. Reuse the same session to continue a conversation.", t.agentID)
+}
+
+func (t *ChatTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"message": map[string]any{
+				"type":        "string",
+				"description": "Message for the agent",
+			},
+			"session": map[string]any{
+				"type":        "string",
+				"description": "Conversation name; messages in the same session share history (default: \"default\")",
+			},
+		},
+		"required": []string{"message"},
+	}
+}
+
+func (t *ChatTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	message, _ := args["message"].(string)
+	if strings.TrimSpace(message) == "" {
+		return tools.ErrorResult("message is required")
+	}
+	session, _ := args["session"].(string)
+	session = strings.TrimSpace(session)
+	if session == "" {
+		session = "default"
+	}
+
+	sessionKey := t.SessionKey(session)
+	lock, _ := t.sessions.LoadOrStore(sessionKey, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	response, err := t.executor.ProcessDirectWithChannel(ctx, message, sessionKey, ServeChannel, session)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("agent error: %v", err)).WithError(err)
+	}
+	return tools.NewToolResult(response)
+}
+
+// SessionKey returns the agent-scoped session key used for session.
+func (t *ChatTool) SessionKey(session string) string {
+	return fmt.Sprintf("agent:%s:%s:%s", t.agentID, ServeChannel, strings.ToLower(session))
+}
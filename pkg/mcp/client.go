@@ -0,0 +1,290 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// DefaultTimeout bounds a single request when the server config sets none.
+const DefaultTimeout = 60 * time.Second
+
+// ClientName is reported to servers in clientInfo.
+const ClientName = "picoclaw"
+
+// Client is a connected, initialized MCP session with one server.
+type Client struct {
+	name     string
+	t        transport
+	timeout  time.Duration
+	onNotify func(method string)
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan *Message
+
+	info InitializeResult
+}
+
+// Connect starts the transport described by cfg and performs the MCP
+// initialize handshake. onNotify, if set, receives the method of every
+// notification the server sends, e.g. "notifications/tools/list_changed".
+func Connect(ctx context.Context, name string, cfg config.MCPServerConfig, onNotify func(method string)) (*Client, error) {
+	t, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := DefaultTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+
+	c := &Client{
+		name:     name,
+		t:        t,
+		timeout:  timeout,
+		onNotify: onNotify,
+		pending:  make(map[string]chan *Message),
+	}
+
+	if err := t.start(ctx, c.dispatch); err != nil {
+		return nil, err
+	}
+	if err := c.initialize(ctx); err != nil {
+		t.close()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	params := InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: ClientName, Version: "1.0"},
+	}
+	if err := c.call(ctx, "initialize", params, &c.info); err != nil {
+		return err
+	}
+	return c.notify(ctx, "notifications/initialized", nil)
+}
+
+// ServerInfo returns what the server reported during initialize.
+func (c *Client) ServerInfo() InitializeResult {
+	return c.info
+}
+
+// Done is closed when the connection to the server is lost.
+func (c *Client) Done() <-chan struct{} {
+	return c.t.done()
+}
+
+// Close ends the session and stops the server process, if any.
+func (c *Client) Close() error {
+	return c.t.close()
+}
+
+// ListTools returns all tools of the server, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var all []Tool
+	cursor := ""
+	for {
+		var res ListToolsResult
+		if err := c.call(ctx, "tools/list", cursorParams(cursor), &res); err != nil {
+			return nil, err
+		}
+		all = append(all, res.Tools...)
+		if res.NextCursor == "" {
+			return all, nil
+		}
+		cursor = res.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*CallToolResult, error) {
+	var res CallToolResult
+	if err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListResources returns all resources of the server, following pagination.
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	var all []Resource
+	cursor := ""
+	for {
+		var res ListResourcesResult
+		if err := c.call(ctx, "resources/list", cursorParams(cursor), &res); err != nil {
+			return nil, err
+		}
+		all = append(all, res.Resources...)
+		if res.NextCursor == "" {
+			return all, nil
+		}
+		cursor = res.NextCursor
+	}
+}
+
+// ReadResource returns the contents of the resource at uri.
+func (c *Client) ReadResource(ctx context.Context, uri string) (*ReadResourceResult, error) {
+	var res ReadResourceResult
+	if err := c.call(ctx, "resources/read", map[string]any{"uri": uri}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListPrompts returns all prompts of the server, following pagination.
+func (c *Client) ListPrompts(ctx context.Context) ([]Prompt, error) {
+	var all []Prompt
+	cursor := ""
+	for {
+		var res ListPromptsResult
+		if err := c.call(ctx, "prompts/list", cursorParams(cursor), &res); err != nil {
+			return nil, err
+		}
+		all = append(all, res.Prompts...)
+		if res.NextCursor == "" {
+			return all, nil
+		}
+		cursor = res.NextCursor
+	}
+}
+
+// GetPrompt renders a prompt template with the given arguments.
+func (c *Client) GetPrompt(ctx context.Context, name string, args map[string]string) (*GetPromptResult, error) {
+	params := map[string]any{"name": name}
+	if len(args) > 0 {
+		params["arguments"] = args
+	}
+	var res GetPromptResult
+	if err := c.call(ctx, "prompts/get", params, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func cursorParams(cursor string) any {
+	if cursor == "" {
+		return nil
+	}
+	return map[string]any{"cursor": cursor}
+}
+
+// call sends a request and waits for the matching response.
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	id := c.nextID.Add(1)
+	rawID := json.RawMessage(strconv.FormatInt(id, 10))
+	msg := &Message{JSONRPC: jsonrpcVersion, ID: rawID, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("marshal params: %w", err)
+		}
+		msg.Params = data
+	}
+
+	ch := make(chan *Message, 1)
+	c.mu.Lock()
+	c.pending[string(rawID)] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(rawID))
+		c.mu.Unlock()
+	}()
+
+	if err := c.t.send(ctx, msg); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %w", method, resp.Error)
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("%s: decode result: %w", method, err)
+		}
+		return nil
+	case <-c.t.done():
+		return fmt.Errorf("%s: connection to server %q lost", method, c.name)
+	case <-ctx.Done():
+		// Let the server stop working on a request nobody waits for.
+		c.notify(context.Background(), "notifications/cancelled", map[string]any{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	msg := &Message{JSONRPC: jsonrpcVersion, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("marshal params: %w", err)
+		}
+		msg.Params = data
+	}
+	return c.t.send(ctx, msg)
+}
+
+// dispatch routes an incoming message: responses go to their waiting call,
+// server requests are answered, notifications are forwarded to onNotify.
+func (c *Client) dispatch(msg *Message) {
+	switch {
+	case msg.IsResponse():
+		c.mu.Lock()
+		ch, ok := c.pending[string(msg.ID)]
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	case msg.IsRequest():
+		reply := &Message{JSONRPC: jsonrpcVersion, ID: msg.ID}
+		if msg.Method == "ping" {
+			reply.Result = json.RawMessage("{}")
+		} else {
+			reply.Error = &RPCError{Code: CodeMethodNotFound, Message: "method not supported: " + msg.Method}
+		}
+		// Reply asynchronously: the transport may be delivering from inside send.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			defer cancel()
+			if err := c.t.send(ctx, reply); err != nil {
+				logger.DebugCF("mcp", "Failed to answer server request", map[string]any{
+					"server": c.name,
+					"method": msg.Method,
+					"error":  err.Error(),
+				})
+			}
+		}()
+	case msg.IsNotification():
+		if c.onNotify != nil {
+			c.onNotify(msg.Method)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func connectTest(t *testing.T, cfg config.MCPServerConfig) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Connect(ctx, "fake", cfg, nil)
+	if err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func exerciseClient(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+
+	if got := c.ServerInfo().ServerInfo.Name; got != "fake" {
+		t.Errorf("ServerInfo name = %q, want fake", got)
+	}
+
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error: %v", err)
+	}
+	if len(tools) != 2 || tools[0].Name != "echo" || tools[1].Name != "fail" {
+		t.Fatalf("ListTools() = %+v, want echo and fail", tools)
+	}
+
+	res, err := c.CallTool(ctx, "echo", map[string]any{"text": "hi"})
+	if err != nil {
+		t.Fatalf("CallTool() error: %v", err)
+	}
+	if res.IsError || len(res.Content) != 1 || res.Content[0].Text != "echo: hi" {
+		t.Errorf("CallTool() = %+v, want echo: hi", res)
+	}
+
+	if _, err := c.CallTool(ctx, "missing", nil); err == nil {
+		t.Error("CallTool(missing) expected error")
+	}
+}
+
+func TestClient_StreamableHTTP(t *testing.T) {
+	for _, sse := range []bool{false, true} {
+		name := "json"
+		if sse {
+			name = "sse"
+		}
+		t.Run(name, func(t *testing.T) {
+			f := newFakeServer()
+			srv := httptest.NewServer(f.httpHandler(sse))
+			t.Cleanup(srv.Close)
+
+			c := connectTest(t, config.MCPServerConfig{URL: srv.URL})
+			exerciseClient(t, c)
+		})
+	}
+}
+
+func TestClient_LegacySSE(t *testing.T) {
+	f := newFakeServer()
+	srv := httptest.NewServer(f.legacySSEHandler())
+	t.Cleanup(srv.Close)
+
+	c := connectTest(t, config.MCPServerConfig{Type: "sse", URL: srv.URL + "/sse"})
+	exerciseClient(t, c)
+}
+
+func TestClient_Stdio(t *testing.T) {
+	c := connectTest(t, config.MCPServerConfig{
+		Command: os.Args[0],
+		Env:     map[string]string{fakeServerEnv: "1"},
+	})
+	exerciseClient(t, c)
+
+	// A crashing server fails the pending call and closes Done.
+	if _, err := c.CallTool(context.Background(), "crash", nil); err == nil {
+		t.Error("CallTool(crash) expected error")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done not closed after server exit")
+	}
+}
+
+func TestClient_ListToolsFollowsPagination(t *testing.T) {
+	f := newFakeServer()
+	f.pageSize = 1
+	srv := httptest.NewServer(f.httpHandler(false))
+	t.Cleanup(srv.Close)
+
+	c := connectTest(t, config.MCPServerConfig{URL: srv.URL})
+	tools, err := c.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools() error: %v", err)
+	}
+	if len(tools) != 2 {
+		t.Errorf("ListTools() returned %d tools, want 2", len(tools))
+	}
+}
+
+func TestClient_RequestTimeout(t *testing.T) {
+	f := newFakeServer()
+	srv := httptest.NewServer(f.legacySSEHandler())
+	t.Cleanup(srv.Close)
+
+	c := connectTest(t, config.MCPServerConfig{Type: "sse", URL: srv.URL + "/sse"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.CallTool(ctx, "echo", nil)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("CallTool() with canceled ctx error = %v, want context canceled", err)
+	}
+}
+
+func TestNewTransport_InfersType(t *testing.T) {
+	tests := []struct {
+		cfg     config.MCPServerConfig
+		want    string
+		wantErr bool
+	}{
+		{config.MCPServerConfig{Command: "server"}, "*mcp.stdioTransport", false},
+		{config.MCPServerConfig{URL: "http://localhost/mcp"}, "*mcp.httpTransport", false},
+		{config.MCPServerConfig{URL: "http://localhost/sse"}, "*mcp.sseTransport", false},
+		{config.MCPServerConfig{Type: "sse", URL: "http://localhost/events"}, "*mcp.sseTransport", false},
+		{config.MCPServerConfig{Type: "stdio"}, "", true},
+		{config.MCPServerConfig{}, "", true},
+		{config.MCPServerConfig{Type: "grpc", URL: "http://localhost"}, "", true},
+	}
+	for _, tt := range tests {
+		tr, err := newTransport(tt.cfg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("newTransport(%+v) expected error", tt.cfg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("newTransport(%+v) error: %v", tt.cfg, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", tr); got != tt.want {
+			t.Errorf("newTransport(%+v) = %s, want %s", tt.cfg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServerEnv makes the test binary act as a stdio MCP server.
+const fakeServerEnv = "PICOCLAW_MCP_FAKE_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		runStdioFakeServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeServer is a minimal in-process MCP server.
+type fakeServer struct {
+	mu        sync.Mutex
+	tools     []Tool
+	pageSize  int
+	sessionID string
+	sessions  int
+	calls     []CallToolParams
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		tools: []Tool{
+			{
+				Name:        "echo",
+				Description: "Echo the text back",
+				InputSchema: map[string]any{
+					"$schema":    "https://json-schema.org/draft/2020-12/schema",
+					"type":       "object",
+					"properties": map[string]any{"text": map[string]any{"type": "string"}},
+				},
+			},
+			{Name: "fail", Description: "Always fails", InputSchema: map[string]any{"type": "object"}},
+		},
+	}
+}
+
+func (f *fakeServer) setTools(tools []Tool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tools = tools
+}
+
+func (f *fakeServer) handle(msg *Message) *Message {
+	if !msg.IsRequest() {
+		return nil
+	}
+	result, rpcErr := f.dispatch(msg)
+	resp := &Message{JSONRPC: jsonrpcVersion, ID: msg.ID, Error: rpcErr}
+	if rpcErr == nil {
+		resp.Result, _ = json.Marshal(result)
+	}
+	return resp
+}
+
+func (f *fakeServer) dispatch(msg *Message) (any, *RPCError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch msg.Method {
+	case "initialize":
+		return InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities: ServerCapabilities{
+				Tools:     &ListChangedCapability{ListChanged: true},
+				Resources: &ListChangedCapability{},
+				Prompts:   &ListChangedCapability{},
+			},
+			ServerInfo: Implementation{Name: "fake", Version: "0.1"},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		if f.pageSize == 0 || params.Cursor == "" && len(f.tools) <= f.pageSize {
+			return ListToolsResult{Tools: f.tools}, nil
+		}
+		if params.Cursor == "" {
+			return ListToolsResult{Tools: f.tools[:f.pageSize], NextCursor: "page2"}, nil
+		}
+		return ListToolsResult{Tools: f.tools[f.pageSize:]}, nil
+	case "tools/call":
+		var params CallToolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		f.calls = append(f.calls, params)
+		switch params.Name {
+		case "echo":
+			return CallToolResult{Content: []Content{TextContent(fmt.Sprintf("echo: %v", params.Arguments["text"]))}}, nil
+		case "fail":
+			return CallToolResult{Content: []Content{TextContent("it broke")}, IsError: true}, nil
+		default:
+			for _, t := range f.tools {
+				if t.Name == params.Name {
+					return CallToolResult{Content: []Content{TextContent(t.Name + " ok")}}, nil
+				}
+			}
+			return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool " + params.Name}
+		}
+	case "resources/list":
+		return ListResourcesResult{Resources: []Resource{
+			{URI: "file:///notes.txt", Name: "notes", MimeType: "text/plain", Description: "Team notes"},
+		}}, nil
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		return ReadResourceResult{Contents: []ResourceContents{
+			{URI: params.URI, MimeType: "text/plain", Text: "remember the milk"},
+		}}, nil
+	case "prompts/list":
+		return ListPromptsResult{Prompts: []Prompt{
+			{Name: "review", Description: "Review code", Arguments: []PromptArgument{{Name: "lang", Required: true}}},
+		}}, nil
+	case "prompts/get":
+		var params struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		return GetPromptResult{Messages: []PromptMessage{
+			{Role: "user", Content: TextContent("Please review this " + params.Arguments["lang"] + " code")},
+		}}, nil
+	default:
+		return nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+}
+
+// restart drops the current session, as a crashed and restarted server would.
+func (f *fakeServer) restart() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessionID = ""
+}
+
+// httpHandler serves the streamable HTTP transport. With sse set, replies
+// are sent as event streams instead of plain JSON.
+func (f *fakeServer) httpHandler(sse bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		if msg.Method == "initialize" {
+			f.sessions++
+			f.sessionID = fmt.Sprintf("session-%d", f.sessions)
+			w.Header().Set(headerSessionID, f.sessionID)
+		} else if got := r.Header.Get(headerSessionID); got != f.sessionID {
+			f.mu.Unlock()
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		f.mu.Unlock()
+
+		resp := f.handle(&msg)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if sse {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
+
+// legacySSEHandler serves the legacy HTTP+SSE transport on /sse and /messages.
+func (f *fakeServer) legacySSEHandler() http.Handler {
+	replies := make(chan []byte, 16)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case data := <-replies:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if resp := f.handle(&msg); resp != nil {
+			data, _ := json.Marshal(resp)
+			replies <- data
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return mux
+}
+
+func runStdioFakeServer() {
+	f := newFakeServer()
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			continue
+		}
+		if msg.Method == "tools/call" && strings.Contains(string(msg.Params), `"crash"`) {
+			os.Exit(1)
+		}
+		if resp := f.handle(&msg); resp != nil {
+			data, _ := json.Marshal(resp)
+			fmt.Fprintf(os.Stdout, "%s\n", data)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Reconnect backoff for servers that crashed or could not be reached.
+var (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = time.Minute
+)
+
+// Manager keeps connections to the configured MCP servers and mirrors their
+// tools into the registered tool registries. Servers that go away are
+// reconnected with backoff, and their tools are refreshed on reconnect or
+// when the server announces a change.
+type Manager struct {
+	servers []*server
+
+	mu         sync.RWMutex
+	registries []*tools.ToolRegistry
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// ServerStatus is a snapshot of one server connection.
+type ServerStatus struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Tools     int    `json:"tools"`
+	Error     string `json:"error,omitempty"`
+}
+
+type server struct {
+	name string
+	cfg  config.MCPServerConfig
+	mgr  *Manager
+
+	mu      sync.RWMutex
+	client  *Client
+	tools   []string // namespaced names currently registered
+	lastErr error
+
+	refresh chan struct{}
+}
+
+// NewManager creates a manager for the enabled servers in servers.
+// Nothing is started until Start is called.
+func NewManager(servers map[string]config.MCPServerConfig) *Manager {
+	names := make([]string, 0, len(servers))
+	for name, cfg := range servers {
+		if !cfg.Disabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	m := &Manager{}
+	for _, name := range names {
+		m.servers = append(m.servers, &server{
+			name:    name,
+			cfg:     servers[name],
+			mgr:     m,
+			refresh: make(chan struct{}, 1),
+		})
+	}
+	return m
+}
+
+// AddRegistry registers the resource and prompt tools in r and keeps the
+// servers' tools in sync with it.
+func (m *Manager) AddRegistry(r *tools.ToolRegistry) {
+	if len(m.servers) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	m.registries = append(m.registries, r)
+	m.mu.Unlock()
+
+	r.Register(NewResourcesTool(m))
+	r.Register(NewPromptsTool(m))
+
+	for _, s := range m.servers {
+		s.mu.RLock()
+		client, names := s.client, s.tools
+		s.mu.RUnlock()
+		if client == nil || len(names) == 0 {
+			continue
+		}
+		// Late registries pick up tools of servers that are already connected.
+		s.requestRefresh()
+	}
+}
+
+// Start connects to all servers. It waits until each server has been tried
+// once, so tools of reachable servers are available when it returns, and
+// keeps reconnecting in the background until ctx ends or Close.
+func (m *Manager) Start(ctx context.Context) {
+	if len(m.servers) == 0 {
+		return
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+
+	var initial sync.WaitGroup
+	for _, s := range m.servers {
+		initial.Add(1)
+		m.wg.Add(1)
+		go func(s *server) {
+			defer m.wg.Done()
+			s.run(runCtx, initial.Done)
+		}(s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		initial.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// Close disconnects all servers and stops reconnecting.
+func (m *Manager) Close() {
+	m.once.Do(func() {
+		if m.cancel != nil {
+			m.cancel()
+		}
+		m.wg.Wait()
+	})
+}
+
+// Status returns the connection state of every server.
+func (m *Manager) Status() []ServerStatus {
+	out := make([]ServerStatus, 0, len(m.servers))
+	for _, s := range m.servers {
+		s.mu.RLock()
+		st := ServerStatus{
+			Name:      s.name,
+			Connected: s.client != nil,
+			Tools:     len(s.tools),
+		}
+		if s.lastErr != nil {
+			st.Error = s.lastErr.Error()
+		}
+		s.mu.RUnlock()
+		out = append(out, st)
+	}
+	return out
+}
+
+// client returns the live client of the named server.
+func (m *Manager) client(name string) (*Client, error) {
+	for _, s := range m.servers {
+		if s.name == name {
+			if c := s.current(); c != nil {
+				return c, nil
+			}
+			return nil, fmt.Errorf("MCP server %q is not connected", name)
+		}
+	}
+	return nil, fmt.Errorf("unknown MCP server %q", name)
+}
+
+func (m *Manager) serverNames() []string {
+	names := make([]string, 0, len(m.servers))
+	for _, s := range m.servers {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func (s *server) current() *Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.client
+}
+
+func (s *server) requestRefresh() {
+	select {
+	case s.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// run connects, serves until the connection drops, and reconnects with
+// exponential backoff. tried is called after the first attempt.
+func (s *server) run(ctx context.Context, tried func()) {
+	delay := reconnectMinDelay
+	for {
+		err := s.connect(ctx)
+		if tried != nil {
+			tried()
+			tried = nil
+		}
+
+		if err == nil {
+			delay = reconnectMinDelay
+			s.serve(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.WarnCF("mcp", "MCP server disconnected, reconnecting", map[string]any{
+				"server": s.name,
+			})
+		} else {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.WarnCF("mcp", "Failed to connect to MCP server", map[string]any{
+				"server": s.name,
+				"error":  err.Error(),
+				"retry":  delay.String(),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+func (s *server) connect(ctx context.Context) error {
+	timeout := DefaultTimeout
+	if s.cfg.Timeout > 0 {
+		timeout = time.Duration(s.cfg.Timeout) * time.Second
+	}
+	connectCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, err := Connect(connectCtx, s.name, s.cfg, s.onNotify)
+	if err != nil {
+		s.setError(err)
+		return err
+	}
+
+	if err := s.syncTools(connectCtx, client); err != nil {
+		client.Close()
+		s.setError(err)
+		return err
+	}
+
+	s.mu.Lock()
+	s.client = client
+	s.lastErr = nil
+	s.mu.Unlock()
+
+	info := client.ServerInfo()
+	logger.InfoCF("mcp", "Connected to MCP server", map[string]any{
+		"server":  s.name,
+		"name":    info.ServerInfo.Name,
+		"version": info.ServerInfo.Version,
+		"tools":   len(s.tools),
+	})
+	return nil
+}
+
+// serve blocks until the connection drops or ctx ends, refreshing tools on request.
+func (s *server) serve(ctx context.Context) {
+	client := s.current()
+	defer func() {
+		s.mu.Lock()
+		s.client = nil
+		s.mu.Unlock()
+		client.Close()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-client.Done():
+			s.setError(fmt.Errorf("connection lost"))
+			return
+		case <-s.refresh:
+			refreshCtx, cancel := context.WithTimeout(ctx, client.timeout)
+			if err := s.syncTools(refreshCtx, client); err != nil {
+				logger.WarnCF("mcp", "Failed to refresh MCP tools", map[string]any{
+					"server": s.name,
+					"error":  err.Error(),
+				})
+			}
+			cancel()
+		}
+	}
+}
+
+func (s *server) onNotify(method string) {
+	if method == "notifications/tools/list_changed" {
+		s.requestRefresh()
+	}
+}
+
+func (s *server) setError(err error) {
+	s.mu.Lock()
+	s.lastErr = err
+	s.mu.Unlock()
+}
+
+// syncTools lists the server's tools and replaces the previously registered
+// set in every registry. A tool whose name is already taken, by another tool
+// of the server or by a tool of another server, is skipped with a warning
+// rather than replacing it.
+func (s *server) syncTools(ctx context.Context, client *Client) error {
+	defs, err := client.ListTools(ctx)
+	if err != nil {
+		return fmt.Errorf("list tools: %w", err)
+	}
+
+	s.mgr.mu.Lock()
+	defer s.mgr.mu.Unlock()
+
+	taken := s.mgr.toolNamesExcept(s)
+	proxies := make([]*RemoteTool, 0, len(defs))
+	names := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		p := newRemoteTool(s, def)
+		if names[p.Name()] || taken[p.Name()] {
+			logger.WarnCF("mcp", "Skipping MCP tool with duplicate name", map[string]any{
+				"server": s.name,
+				"tool":   def.Name,
+				"name":   p.Name(),
+			})
+			continue
+		}
+		names[p.Name()] = true
+		proxies = append(proxies, p)
+	}
+
+	s.mu.Lock()
+	stale := s.tools
+	s.tools = make([]string, 0, len(proxies))
+	for _, p := range proxies {
+		s.tools = append(s.tools, p.Name())
+	}
+	s.mu.Unlock()
+
+	for _, r := range s.mgr.registries {
+		for _, name := range stale {
+			if !names[name] {
+				r.Unregister(name)
+			}
+		}
+		for _, p := range proxies {
+			r.Register(p)
+		}
+	}
+	return nil
+}
+
+// toolNamesExcept returns the names registered for every server but skip.
+// Callers must hold m.mu.
+func (m *Manager) toolNamesExcept(skip *server) map[string]bool {
+	names := make(map[string]bool)
+	for _, s := range m.servers {
+		if s == skip {
+			continue
+		}
+		s.mu.RLock()
+		for _, name := range s.tools {
+			names[name] = true
+		}
+		s.mu.RUnlock()
+	}
+	return names
+}
@@ -0,0 +1,256 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func startManager(t *testing.T, servers map[string]config.MCPServerConfig, registries ...*tools.ToolRegistry) *Manager {
+	t.Helper()
+	m := NewManager(servers)
+	for _, r := range registries {
+		m.AddRegistry(r)
+	}
+	// The servers stay connected until ctx ends, so it lives as long as the test
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	m.Start(ctx)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// shortReconnectDelay speeds up reconnects for the duration of the test.
+// Registered before startManager, the restore runs after the manager closed.
+func shortReconnectDelay(t *testing.T) {
+	old := reconnectMinDelay
+	reconnectMinDelay = 10 * time.Millisecond
+	t.Cleanup(func() { reconnectMinDelay = old })
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	tests := []struct {
+		server, tool, want string
+	}{
+		{"github", "create_issue", "mcp_github_create_issue"},
+		{"my.server", "read file", "mcp_my_server_read_file"},
+		{"fs", "list-dir", "mcp_fs_list-dir"},
+	}
+	for _, tt := range tests {
+		if got := ToolName(tt.server, tt.tool); got != tt.want {
+			t.Errorf("ToolName(%q, %q) = %q, want %q", tt.server, tt.tool, got, tt.want)
+		}
+	}
+}
+
+func TestToolName_LongNamesStayDistinct(t *testing.T) {
+	a := ToolName("s", strings.Repeat("x", 100)+"_a")
+	b := ToolName("s", strings.Repeat("x", 100)+"_b")
+	if len(a) != maxToolNameLen || len(b) != maxToolNameLen {
+		t.Fatalf("lengths = %d, %d, want %d", len(a), len(b), maxToolNameLen)
+	}
+	if !strings.HasPrefix(a, "mcp_s_xxx") {
+		t.Errorf("ToolName() = %q, want the readable prefix kept", a)
+	}
+	if a == b {
+		t.Errorf("long names collide: %q", a)
+	}
+	if again := ToolName("s", strings.Repeat("x", 100)+"_a"); again != a {
+		t.Errorf("ToolName() not stable: %q then %q", a, again)
+	}
+}
+
+func TestManager_RegistersToolsInAllRegistries(t *testing.T) {
+	f := newFakeServer()
+	srv := httptest.NewServer(f.httpHandler(false))
+	t.Cleanup(srv.Close)
+
+	r1, r2 := tools.NewToolRegistry(), tools.NewToolRegistry()
+	m := startManager(t, map[string]config.MCPServerConfig{
+		"fake":     {URL: srv.URL},
+		"disabled": {URL: srv.URL, Disabled: true},
+	}, r1)
+	// Registries added after Start are synced too.
+	m.AddRegistry(r2)
+	waitFor(t, "late registry sync", func() bool {
+		_, ok := r2.Get("mcp_fake_echo")
+		return ok
+	})
+
+	for _, name := range []string{"mcp_fake_echo", "mcp_fake_fail", "mcp_resources", "mcp_prompts"} {
+		if _, ok := r1.Get(name); !ok {
+			t.Errorf("tool %s not registered", name)
+		}
+	}
+
+	echo, _ := r1.Get("mcp_fake_echo")
+	if !strings.HasPrefix(echo.Description(), "[MCP server fake]") {
+		t.Errorf("Description() = %q, want server prefix", echo.Description())
+	}
+	if _, ok := echo.Parameters()["$schema"]; ok {
+		t.Error("Parameters() should drop $schema")
+	}
+
+	result := r1.Execute(context.Background(), "mcp_fake_echo", map[string]any{"text": "hello"})
+	if result.IsError || result.ForLLM != "echo: hello" {
+		t.Errorf("echo result = %+v, want echo: hello", result)
+	}
+	result = r1.Execute(context.Background(), "mcp_fake_fail", nil)
+	if !result.IsError || result.ForLLM != "it broke" {
+		t.Errorf("fail result = %+v, want error it broke", result)
+	}
+
+	status := m.Status()
+	if len(status) != 1 || !status[0].Connected || status[0].Tools != 2 {
+		t.Errorf("Status() = %+v, want one connected server with 2 tools", status)
+	}
+}
+
+func TestManager_ReconnectsAndRefreshesTools(t *testing.T) {
+	shortReconnectDelay(t)
+
+	f := newFakeServer()
+	srv := httptest.NewServer(f.httpHandler(false))
+	t.Cleanup(srv.Close)
+
+	r := tools.NewToolRegistry()
+	startManager(t, map[string]config.MCPServerConfig{"fake": {URL: srv.URL}}, r)
+	if _, ok := r.Get("mcp_fake_echo"); !ok {
+		t.Fatal("mcp_fake_echo not registered")
+	}
+
+	// The server restarts with a different tool set; the next call finds
+	// the session gone, which triggers a reconnect.
+	f.setTools([]Tool{{Name: "search", InputSchema: map[string]any{"type": "object"}}})
+	f.restart()
+	if result := r.Execute(context.Background(), "mcp_fake_echo", nil); !result.IsError {
+		t.Errorf("call on expired session should fail, got %+v", result)
+	}
+
+	waitFor(t, "tools refresh after reconnect", func() bool {
+		_, ok := r.Get("mcp_fake_search")
+		return ok
+	})
+	if _, ok := r.Get("mcp_fake_echo"); ok {
+		t.Error("stale tool mcp_fake_echo still registered")
+	}
+	result := r.Execute(context.Background(), "mcp_fake_search", nil)
+	if result.IsError || result.ForLLM != "search ok" {
+		t.Errorf("search result = %+v, want search ok", result)
+	}
+}
+
+func TestManager_UnreachableServerKeepsRetrying(t *testing.T) {
+	shortReconnectDelay(t)
+
+	f := newFakeServer()
+	var down atomic.Bool
+	down.Store(true)
+	handler := f.httpHandler(false)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "starting up", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	r := tools.NewToolRegistry()
+	m := startManager(t, map[string]config.MCPServerConfig{"late": {URL: srv.URL}}, r)
+
+	status := m.Status()
+	if len(status) != 1 || status[0].Connected || status[0].Error == "" {
+		t.Fatalf("Status() = %+v, want disconnected with error", status)
+	}
+
+	down.Store(false)
+	waitFor(t, "connect once server is up", func() bool {
+		_, ok := r.Get("mcp_late_echo")
+		return ok
+	})
+}
+
+func TestResourcesAndPromptsTools(t *testing.T) {
+	f := newFakeServer()
+	srv := httptest.NewServer(f.httpHandler(true))
+	t.Cleanup(srv.Close)
+
+	r := tools.NewToolRegistry()
+	startManager(t, map[string]config.MCPServerConfig{"fake": {URL: srv.URL}}, r)
+	ctx := context.Background()
+
+	tests := []struct {
+		tool string
+		args map[string]any
+		want string
+	}{
+		{"mcp_resources", map[string]any{"action": "list"}, "file:///notes.txt (notes) [text/plain]: Team notes"},
+		{"mcp_resources", map[string]any{"action": "read", "server": "fake", "uri": "file:///notes.txt"}, "remember the milk"},
+		{"mcp_prompts", map[string]any{"action": "list", "server": "fake"}, "review: Review code"},
+		{"mcp_prompts", map[string]any{
+			"action": "get", "server": "fake", "name": "review",
+			"arguments": map[string]any{"lang": "Go"},
+		}, "Please review this Go code"},
+	}
+	for _, tt := range tests {
+		result := r.Execute(ctx, tt.tool, tt.args)
+		if result.IsError || !strings.Contains(result.ForLLM, tt.want) {
+			t.Errorf("%s %v = %+v, want containing %q", tt.tool, tt.args, result, tt.want)
+		}
+		if !result.Silent {
+			t.Errorf("%s result should be silent", tt.tool)
+		}
+	}
+
+	result := r.Execute(ctx, "mcp_resources", map[string]any{"action": "read", "server": "nope", "uri": "x"})
+	if !result.IsError {
+		t.Error("read from unknown server should fail")
+	}
+}
+
+func TestManager_SkipsToolNamesTakenByAnotherServer(t *testing.T) {
+	srv1 := httptest.NewServer(newFakeServer().httpHandler(false))
+	t.Cleanup(srv1.Close)
+	srv2 := httptest.NewServer(newFakeServer().httpHandler(false))
+	t.Cleanup(srv2.Close)
+
+	// Both server names sanitize to "f_x", so their tools map to the same names
+	r := tools.NewToolRegistry()
+	m := startManager(t, map[string]config.MCPServerConfig{
+		"f.x": {URL: srv1.URL},
+		"f_x": {URL: srv2.URL},
+	}, r)
+
+	if _, ok := r.Get("mcp_f_x_echo"); !ok {
+		t.Fatal("mcp_f_x_echo not registered")
+	}
+	total := 0
+	for _, st := range m.Status() {
+		if !st.Connected {
+			t.Errorf("server %s not connected", st.Name)
+		}
+		total += st.Tools
+	}
+	if total != 2 {
+		t.Errorf("servers registered %d tools, want 2 with the duplicates skipped", total)
+	}
+}
@@ -0,0 +1,465 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// ServeChannel is the channel name tool calls and chats served over MCP run under.
+const ServeChannel = "mcp"
+
+// supportedVersions are the protocol revisions the server can speak, newest first.
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// Server publishes the tools of a ToolRegistry, plus any extra tools, to MCP
+// clients. Tools run through the registry, so their own restrictions (such
+// as the workspace sandbox and exec deny patterns) keep applying.
+type Server struct {
+	info     Implementation
+	registry *tools.ToolRegistry
+
+	mu    sync.RWMutex
+	extra map[string]tools.Tool
+}
+
+// NewServer creates a server exposing the tools in registry.
+func NewServer(info Implementation, registry *tools.ToolRegistry) *Server {
+	return &Server{
+		info:     info,
+		registry: registry,
+		extra:    make(map[string]tools.Tool),
+	}
+}
+
+// AddTool publishes a tool that is not part of the registry. It takes
+// precedence over a registry tool of the same name.
+func (s *Server) AddTool(t tools.Tool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.extra[t.Name()] = t
+}
+
+// Tools returns the published tool definitions, sorted by name.
+func (s *Server) Tools() []Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byName := make(map[string]tools.Tool)
+	if s.registry != nil {
+		// Tools the agent's tool policy hides are not published either
+		for _, t := range s.registry.Available() {
+			byName[t.Name()] = t
+		}
+	}
+	for name, t := range s.extra {
+		byName[name] = t
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]Tool, 0, len(names))
+	for _, name := range names {
+		t := byName[name]
+		defs = append(defs, Tool{
+			Name:        name,
+			Description: t.Description(),
+			InputSchema: t.Parameters(),
+		})
+	}
+	return defs
+}
+
+// Handle processes one incoming message and returns the response to send,
+// or nil for notifications.
+func (s *Server) Handle(ctx context.Context, msg *Message) *Message {
+	if !msg.IsRequest() {
+		return nil
+	}
+
+	result, rpcErr := s.dispatch(ctx, msg)
+	resp := &Message{JSONRPC: jsonrpcVersion, ID: msg.ID, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		} else {
+			resp.Result = data
+		}
+	}
+	return resp
+}
+
+func (s *Server) dispatch(ctx context.Context, msg *Message) (any, *RPCError) {
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if len(msg.Params) > 0 {
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+			}
+		}
+		return InitializeResult{
+			ProtocolVersion: negotiateVersion(params.ProtocolVersion),
+			Capabilities:    ServerCapabilities{Tools: &ListChangedCapability{}},
+			ServerInfo:      s.info,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return ListToolsResult{Tools: s.Tools()}, nil
+	case "tools/call":
+		var params CallToolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		return s.callTool(ctx, params)
+	default:
+		return nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+}
+
+func negotiateVersion(requested string) string {
+	for _, v := range supportedVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return ProtocolVersion
+}
+
+func (s *Server) callTool(ctx context.Context, params CallToolParams) (any, *RPCError) {
+	args := params.Arguments
+	if args == nil {
+		args = map[string]any{}
+	}
+
+	s.mu.RLock()
+	extra, isExtra := s.extra[params.Name]
+	s.mu.RUnlock()
+
+	var result *tools.ToolResult
+	switch {
+	case isExtra:
+		result = extra.Execute(ctx, args)
+	case s.registry != nil:
+		if _, ok := s.registry.Get(params.Name); !ok {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + params.Name}
+		}
+		result = s.registry.ExecuteWithContext(ctx, params.Name, args, ServeChannel, "serve", nil)
+	default:
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+
+	text := result.ForLLM
+	if text == "" && result.Err != nil {
+		text = result.Err.Error()
+	}
+	return CallToolResult{
+		Content: []Content{TextContent(text)},
+		IsError: result.IsError,
+	}, nil
+}
+
+// ServeStdio serves newline-delimited JSON-RPC on r and w until r is
+// exhausted or ctx ends. Requests run concurrently so a long agent turn
+// does not block pings or other calls.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		writeMu  sync.Mutex
+		wg       sync.WaitGroup
+		pendMu   sync.Mutex
+		inFlight = make(map[string]context.CancelFunc)
+	)
+	defer wg.Wait()
+
+	write := func(msg *Message) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		w.Write(append(data, '\n'))
+	}
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		var line []byte
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case line = <-lines:
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			write(&Message{
+				JSONRPC: jsonrpcVersion,
+				ID:      json.RawMessage("null"),
+				Error:   &RPCError{Code: CodeParseError, Message: err.Error()},
+			})
+			continue
+		}
+
+		if msg.Method == "notifications/cancelled" {
+			var params struct {
+				RequestID json.RawMessage `json:"requestId"`
+			}
+			if json.Unmarshal(msg.Params, &params) == nil {
+				pendMu.Lock()
+				if cancelReq, ok := inFlight[string(params.RequestID)]; ok {
+					cancelReq()
+				}
+				pendMu.Unlock()
+			}
+			continue
+		}
+		if !msg.IsRequest() {
+			continue
+		}
+
+		reqCtx, cancelReq := context.WithCancel(ctx)
+		key := string(msg.ID)
+		pendMu.Lock()
+		inFlight[key] = cancelReq
+		pendMu.Unlock()
+
+		wg.Add(1)
+		go func(msg *Message) {
+			defer wg.Done()
+			defer func() {
+				pendMu.Lock()
+				delete(inFlight, key)
+				pendMu.Unlock()
+				cancelReq()
+			}()
+			if resp := s.Handle(reqCtx, msg); resp != nil && reqCtx.Err() == nil {
+				write(resp)
+			}
+		}(&msg)
+	}
+}
+
+// sessionIdleTimeout is how long an HTTP session may go unused before it
+// is forgotten.
+const sessionIdleTimeout = time.Hour
+
+// HTTPHandler serves the streamable HTTP transport with plain JSON
+// responses. If token is set, requests must carry it as a bearer token.
+//
+// Browsers may only call the handler from a loopback origin, or from the
+// server's own origin when a token is set. Without a token, the Host header
+// must name a loopback address too, so a DNS-rebound page cannot reach a
+// server bound to localhost.
+func (s *Server) HTTPHandler(token string) http.Handler {
+	return &httpServer{srv: s, token: token, sessions: make(map[string]time.Time)}
+}
+
+type httpServer struct {
+	srv   *Server
+	token string
+
+	mu       sync.Mutex
+	sessions map[string]time.Time // session ID -> last use
+}
+
+func (h *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.allowedOrigin(r) {
+		http.Error(w, "forbidden origin", http.StatusForbidden)
+		return
+	}
+	if h.token != "" {
+		want := "Bearer " + h.token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.post(w, r)
+	case http.MethodDelete:
+		id := r.Header.Get(headerSessionID)
+		known := h.touchSession(id)
+		h.mu.Lock()
+		delete(h.sessions, id)
+		h.mu.Unlock()
+		if !known {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		// No server-initiated stream: the server never sends requests.
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *httpServer) post(w http.ResponseWriter, r *http.Request) {
+	var msg Message
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxMessageSize)).Decode(&msg); err != nil {
+		writeJSON(w, http.StatusBadRequest, &Message{
+			JSONRPC: jsonrpcVersion,
+			ID:      json.RawMessage("null"),
+			Error:   &RPCError{Code: CodeParseError, Message: err.Error()},
+		})
+		return
+	}
+
+	if msg.Method == "initialize" {
+		id, err := newSessionID()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		h.mu.Lock()
+		for sid, last := range h.sessions {
+			if now.Sub(last) > sessionIdleTimeout {
+				delete(h.sessions, sid)
+			}
+		}
+		h.sessions[id] = now
+		h.mu.Unlock()
+		w.Header().Set(headerSessionID, id)
+	} else {
+		id := r.Header.Get(headerSessionID)
+		if id == "" {
+			http.Error(w, "missing "+headerSessionID+" header", http.StatusBadRequest)
+			return
+		}
+		if !h.touchSession(id) {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+
+	resp := h.srv.Handle(r.Context(), &msg)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// touchSession reports whether id names a live session and marks it used.
+// An expired session is dropped.
+func (h *httpServer) touchSession(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	last, ok := h.sessions[id]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(last) > sessionIdleTimeout {
+		delete(h.sessions, id)
+		return false
+	}
+	h.sessions[id] = now
+	return true
+}
+
+// allowedOrigin guards against DNS rebinding, as the streamable HTTP
+// transport requires.
+func (h *httpServer) allowedOrigin(r *http.Request) bool {
+	if h.token == "" && !isLoopbackHost(r.Host) {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Not a browser
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if isLoopbackHost(u.Host) {
+		return true
+	}
+	return h.token != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// isLoopbackHost reports whether host, with or without a port, names the
+// local machine.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, msg *Message) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		logger.DebugCF("mcp", "Failed to write response", map[string]any{
+			"error": err.Error(),
+		})
+	}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate session id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
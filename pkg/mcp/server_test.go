@@ -0,0 +1,282 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+type fakeExecutor struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (e *fakeExecutor) ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, strings.Join([]string{content, sessionKey, channel, chatID}, "|"))
+	return "reply to " + content, nil
+}
+
+func newTestServer(t *testing.T) (*Server, *fakeExecutor, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "hello.txt"), []byte("hello from workspace"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := tools.NewToolRegistry()
+	registry.Register(tools.NewReadFileTool(workspace, true))
+	registry.Register(tools.NewExecTool(workspace, true))
+
+	exec := &fakeExecutor{}
+	srv := NewServer(Implementation{Name: "picoclaw", Version: "test"}, registry)
+	srv.AddTool(NewChatTool(exec, "Work"))
+	return srv, exec, workspace
+}
+
+func TestServer_OverHTTPWithClient(t *testing.T) {
+	srv, exec, workspace := newTestServer(t)
+	httpSrv := httptest.NewServer(srv.HTTPHandler("secret"))
+	t.Cleanup(httpSrv.Close)
+
+	c := connectTest(t, config.MCPServerConfig{
+		URL:     httpSrv.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	})
+	ctx := context.Background()
+
+	if got := c.ServerInfo().ServerInfo.Name; got != "picoclaw" {
+		t.Errorf("server name = %q, want picoclaw", got)
+	}
+
+	defs, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error: %v", err)
+	}
+	var names []string
+	for _, d := range defs {
+		names = append(names, d.Name)
+		if d.InputSchema["type"] != "object" {
+			t.Errorf("tool %s schema type = %v, want object", d.Name, d.InputSchema["type"])
+		}
+	}
+	if strings.Join(names, ",") != "chat,exec,read_file" {
+		t.Errorf("tools = %v, want chat, exec, read_file", names)
+	}
+
+	res, err := c.CallTool(ctx, "read_file", map[string]any{"path": filepath.Join(workspace, "hello.txt")})
+	if err != nil || res.IsError || res.Content[0].Text != "hello from workspace" {
+		t.Errorf("read_file in workspace = %+v, %v", res, err)
+	}
+
+	// The workspace restriction still applies.
+	res, err = c.CallTool(ctx, "read_file", map[string]any{"path": "/etc/passwd"})
+	if err != nil || !res.IsError {
+		t.Errorf("read_file outside workspace = %+v, %v, want tool error", res, err)
+	}
+
+	// So do the exec deny patterns.
+	res, err = c.CallTool(ctx, "exec", map[string]any{"command": "rm -rf /"})
+	if err != nil || !res.IsError {
+		t.Errorf("denied exec = %+v, %v, want tool error", res, err)
+	}
+
+	res, err = c.CallTool(ctx, "chat", map[string]any{"message": "hi", "session": "Review"})
+	if err != nil || res.IsError || res.Content[0].Text != "reply to hi" {
+		t.Errorf("chat = %+v, %v", res, err)
+	}
+	if len(exec.calls) != 1 || exec.calls[0] != "hi|agent:work:mcp:review|mcp|Review" {
+		t.Errorf("executor calls = %v", exec.calls)
+	}
+
+	if _, err := c.CallTool(ctx, "missing", nil); err == nil {
+		t.Error("unknown tool should return an RPC error")
+	}
+}
+
+func TestServer_ListHidesToolsDeniedByPolicy(t *testing.T) {
+	srv, _, workspace := newTestServer(t)
+	srv.registry.SetToolPolicy(tools.NewToolPolicy(&config.ToolPolicyConfig{Deny: []string{"exec"}}, workspace))
+
+	resp := srv.Handle(context.Background(), &Message{JSONRPC: "2.0", ID: json.RawMessage(`1`), Method: "tools/list"})
+	if resp == nil || resp.Error != nil {
+		t.Fatalf("tools/list = %+v", resp)
+	}
+	var res ListToolsResult
+	if err := json.Unmarshal(resp.Result, &res); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range res.Tools {
+		names = append(names, d.Name)
+	}
+	if strings.Join(names, ",") != "chat,read_file" {
+		t.Errorf("tools = %v, want chat, read_file without the denied exec", names)
+	}
+}
+
+func TestServer_HTTPRejectsBadTokenAndSession(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	httpSrv := httptest.NewServer(srv.HTTPHandler("secret"))
+	t.Cleanup(httpSrv.Close)
+
+	post := func(auth, session, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, httpSrv.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		if session != "" {
+			req.Header.Set(headerSessionID, session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	list := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+	if got := post("", "", list); got != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", got)
+	}
+	if got := post("Bearer wrong", "", list); got != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", got)
+	}
+	if got := post("Bearer secret", "nope", list); got != http.StatusNotFound {
+		t.Errorf("unknown session: status %d, want 404", got)
+	}
+	if got := post("Bearer secret", "", list); got != http.StatusBadRequest {
+		t.Errorf("missing session: status %d, want 400", got)
+	}
+}
+
+func TestServer_Stdio(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.ServeStdio(ctx, inR, outW)
+		outW.Close()
+	}()
+
+	responses := bufio.NewScanner(outR)
+	roundTrip := func(req string) Message {
+		t.Helper()
+		if _, err := io.WriteString(inW, req+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		if !responses.Scan() {
+			t.Fatalf("no response to %s", req)
+		}
+		var msg Message
+		if err := json.Unmarshal(responses.Bytes(), &msg); err != nil {
+			t.Fatalf("bad response %q: %v", responses.Text(), err)
+		}
+		return msg
+	}
+
+	initResp := roundTrip(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"t","version":"1"}}}`)
+	var info InitializeResult
+	json.Unmarshal(initResp.Result, &info)
+	if info.ProtocolVersion != "2024-11-05" || info.Capabilities.Tools == nil {
+		t.Errorf("initialize = %+v, want negotiated 2024-11-05 with tools", info)
+	}
+
+	io.WriteString(inW, `{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n")
+
+	call := roundTrip(`{"jsonrpc":"2.0","id":"two","method":"tools/call","params":{"name":"chat","arguments":{"message":"ping"}}}`)
+	var res CallToolResult
+	json.Unmarshal(call.Result, &res)
+	if string(call.ID) != `"two"` || len(res.Content) != 1 || res.Content[0].Text != "reply to ping" {
+		t.Errorf("chat over stdio = id %s, %+v", call.ID, res)
+	}
+
+	unknown := roundTrip(`{"jsonrpc":"2.0","id":3,"method":"resources/list"}`)
+	if unknown.Error == nil || unknown.Error.Code != CodeMethodNotFound {
+		t.Errorf("resources/list error = %+v, want method not found", unknown.Error)
+	}
+
+	inW.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeStdio() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeStdio did not return after stdin closed")
+	}
+}
+
+func TestServer_HTTPChecksOrigin(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	tests := []struct {
+		name   string
+		token  string
+		host   string
+		origin string
+		want   int
+	}{
+		{"no origin", "", "127.0.0.1:18791", "", http.StatusOK},
+		{"loopback origin", "", "localhost:18791", "http://localhost:3000", http.StatusOK},
+		{"foreign origin", "", "127.0.0.1:18791", "http://evil.example", http.StatusForbidden},
+		{"rebound host", "", "evil.example:18791", "http://evil.example:18791", http.StatusForbidden},
+		{"rebound host without origin", "", "evil.example:18791", "", http.StatusForbidden},
+		{"same origin with token", "secret", "mcp.example", "https://mcp.example", http.StatusOK},
+		{"foreign origin with token", "secret", "mcp.example", "https://evil.example", http.StatusForbidden},
+	}
+	init := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"t","version":"1"}}}`
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(init))
+			req.Host = tt.host
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			srv.HTTPHandler(tt.token).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_HTTPExpiresIdleSessions(t *testing.T) {
+	srv, _, _ := newTestServer(t)
+	h := srv.HTTPHandler("").(*httpServer)
+	h.sessions["stale"] = time.Now().Add(-2 * sessionIdleTimeout)
+	h.sessions["fresh"] = time.Now()
+
+	if h.touchSession("stale") {
+		t.Error("idle session should have expired")
+	}
+	if _, ok := h.sessions["stale"]; ok {
+		t.Error("expired session should be dropped")
+	}
+	if !h.touchSession("fresh") {
+		t.Error("recently used session should be live")
+	}
+}
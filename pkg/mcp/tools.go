@@ -0,0 +1,371 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// maxToolNameLen is the longest function name LLM APIs accept.
+const maxToolNameLen = 64
+
+// ToolName returns the namespaced registry name of an MCP tool,
+// "mcp_<server>_<tool>", restricted to characters LLM APIs accept. Names
+// that are too long are cut and end in a hash of the full name, so tools
+// sharing a long prefix keep distinct names.
+func ToolName(serverName, toolName string) string {
+	name := "mcp_" + sanitizeName(serverName) + "_" + sanitizeName(toolName)
+	if len(name) > maxToolNameLen {
+		sum := sha256.Sum256([]byte(serverName + "\x00" + toolName))
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		name = name[:maxToolNameLen-len(suffix)] + suffix
+	}
+	return name
+}
+
+func sanitizeName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// RemoteTool exposes one tool of an MCP server as a local tool. Calls are
+// proxied to tools/call on whatever connection the server currently has, so
+// the tool survives reconnects.
+type RemoteTool struct {
+	server *server
+	name   string
+	def    Tool
+}
+
+func newRemoteTool(s *server, def Tool) *RemoteTool {
+	return &RemoteTool{
+		server: s,
+		name:   ToolName(s.name, def.Name),
+		def:    def,
+	}
+}
+
+func (t *RemoteTool) Name() string {
+	return t.name
+}
+
+func (t *RemoteTool) Description() string {
+	desc := t.def.Description
+	if desc == "" {
+		desc = t.def.Title
+	}
+	return fmt.Sprintf("[MCP server %s] %s", t.server.name, desc)
+}
+
+func (t *RemoteTool) Parameters() map[string]any {
+	schema := make(map[string]any, len(t.def.InputSchema)+2)
+	for k, v := range t.def.InputSchema {
+		// Providers reject JSON Schema meta keys in function parameters.
+		if k == "$schema" {
+			continue
+		}
+		schema[k] = v
+	}
+	if _, ok := schema["type"]; !ok {
+		schema["type"] = "object"
+	}
+	if _, ok := schema["properties"]; !ok {
+		schema["properties"] = map[string]any{}
+	}
+	return schema
+}
+
+func (t *RemoteTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	client := t.server.current()
+	if client == nil {
+		return tools.ErrorResult(fmt.Sprintf("MCP server %q is not connected, try again later", t.server.name))
+	}
+
+	res, err := client.CallTool(ctx, t.def.Name, args)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("MCP tool %s failed: %v", t.def.Name, err)).WithError(err)
+	}
+
+	text := formatContent(res.Content)
+	if text == "" && res.StructuredContent != nil {
+		if data, err := json.Marshal(res.StructuredContent); err == nil {
+			text = string(data)
+		}
+	}
+	if res.IsError {
+		return tools.ErrorResult(text)
+	}
+	return tools.NewToolResult(text)
+}
+
+// formatContent renders MCP content items as text for the LLM.
+func formatContent(items []Content) string {
+	parts := make([]string, 0, len(items))
+	for _, c := range items {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "image", "audio":
+			parts = append(parts, fmt.Sprintf("[%s: %s, %d bytes base64]", c.Type, c.MimeType, len(c.Data)))
+		case "resource":
+			if c.Resource != nil {
+				parts = append(parts, formatResourceContents(*c.Resource))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource: %s %s]", c.Name, c.URI))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func formatResourceContents(rc ResourceContents) string {
+	if rc.Text != "" || rc.Blob == "" {
+		return rc.Text
+	}
+	return fmt.Sprintf("[binary resource %s: %s, %d bytes base64]", rc.URI, rc.MimeType, len(rc.Blob))
+}
+
+// ResourcesTool lets the agent list and read resources of MCP servers.
+type ResourcesTool struct {
+	mgr *Manager
+}
+
+func NewResourcesTool(mgr *Manager) *ResourcesTool {
+	return &ResourcesTool{mgr: mgr}
+}
+
+func (t *ResourcesTool) Name() string {
+	return "mcp_resources"
+}
+
+func (t *ResourcesTool) Description() string {
+	return "List or read resources (files, documents, data) offered by connected MCP servers. " +
+		"Use action 'list' to see available resources, then 'read' with the server and uri."
+}
+
+func (t *ResourcesTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        []string{"list", "read"},
+				"description": "list: list resources; read: read one resource",
+			},
+			"server": map[string]any{
+				"type":        "string",
+				"enum":        t.mgr.serverNames(),
+				"description": "MCP server name. Optional for list (all servers)",
+			},
+			"uri": map[string]any{
+				"type":        "string",
+				"description": "Resource URI (for read)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ResourcesTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	action, _ := args["action"].(string)
+	serverName, _ := args["server"].(string)
+
+	switch action {
+	case "list":
+		var sb strings.Builder
+		for _, name := range t.targets(serverName) {
+			client, err := t.mgr.client(name)
+			if err != nil {
+				fmt.Fprintf(&sb, "## %s\n(%v)\n\n", name, err)
+				continue
+			}
+			resources, err := client.ListResources(ctx)
+			if err != nil {
+				fmt.Fprintf(&sb, "## %s\n(error: %v)\n\n", name, err)
+				continue
+			}
+			fmt.Fprintf(&sb, "## %s\n", name)
+			if len(resources) == 0 {
+				sb.WriteString("(no resources)\n")
+			}
+			for _, r := range resources {
+				fmt.Fprintf(&sb, "- %s (%s)", r.URI, r.Name)
+				if r.MimeType != "" {
+					fmt.Fprintf(&sb, " [%s]", r.MimeType)
+				}
+				if r.Description != "" {
+					fmt.Fprintf(&sb, ": %s", r.Description)
+				}
+				sb.WriteString("\n")
+			}
+			sb.WriteString("\n")
+		}
+		return tools.SilentResult(strings.TrimSpace(sb.String()))
+	case "read":
+		uri, _ := args["uri"].(string)
+		if serverName == "" || uri == "" {
+			return tools.ErrorResult("server and uri are required for read")
+		}
+		client, err := t.mgr.client(serverName)
+		if err != nil {
+			return tools.ErrorResult(err.Error())
+		}
+		res, err := client.ReadResource(ctx, uri)
+		if err != nil {
+			return tools.ErrorResult(fmt.Sprintf("reading %s failed: %v", uri, err)).WithError(err)
+		}
+		parts := make([]string, 0, len(res.Contents))
+		for _, c := range res.Contents {
+			parts = append(parts, formatResourceContents(c))
+		}
+		return tools.SilentResult(strings.Join(parts, "\n"))
+	default:
+		return tools.ErrorResult(fmt.Sprintf("unknown action %q, use list or read", action))
+	}
+}
+
+func (t *ResourcesTool) targets(serverName string) []string {
+	if serverName != "" {
+		return []string{serverName}
+	}
+	return t.mgr.serverNames()
+}
+
+// PromptsTool lets the agent list and render prompt templates of MCP servers.
+type PromptsTool struct {
+	mgr *Manager
+}
+
+func NewPromptsTool(mgr *Manager) *PromptsTool {
+	return &PromptsTool{mgr: mgr}
+}
+
+func (t *PromptsTool) Name() string {
+	return "mcp_prompts"
+}
+
+func (t *PromptsTool) Description() string {
+	return "List or get prompt templates offered by connected MCP servers. " +
+		"Use action 'list' to see available prompts, then 'get' with the server, name and arguments."
+}
+
+func (t *PromptsTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        []string{"list", "get"},
+				"description": "list: list prompts; get: render one prompt",
+			},
+			"server": map[string]any{
+				"type":        "string",
+				"enum":        t.mgr.serverNames(),
+				"description": "MCP server name. Optional for list (all servers)",
+			},
+			"name": map[string]any{
+				"type":        "string",
+				"description": "Prompt name (for get)",
+			},
+			"arguments": map[string]any{
+				"type":                 "object",
+				"description":          "Prompt arguments as string values (for get)",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *PromptsTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	action, _ := args["action"].(string)
+	serverName, _ := args["server"].(string)
+
+	switch action {
+	case "list":
+		names := t.mgr.serverNames()
+		if serverName != "" {
+			names = []string{serverName}
+		}
+		var sb strings.Builder
+		for _, name := range names {
+			client, err := t.mgr.client(name)
+			if err != nil {
+				fmt.Fprintf(&sb, "## %s\n(%v)\n\n", name, err)
+				continue
+			}
+			prompts, err := client.ListPrompts(ctx)
+			if err != nil {
+				fmt.Fprintf(&sb, "## %s\n(error: %v)\n\n", name, err)
+				continue
+			}
+			fmt.Fprintf(&sb, "## %s\n", name)
+			if len(prompts) == 0 {
+				sb.WriteString("(no prompts)\n")
+			}
+			for _, p := range prompts {
+				fmt.Fprintf(&sb, "- %s", p.Name)
+				if p.Description != "" {
+					fmt.Fprintf(&sb, ": %s", p.Description)
+				}
+				for _, a := range p.Arguments {
+					required := ""
+					if a.Required {
+						required = ", required"
+					}
+					fmt.Fprintf(&sb, "\n  - %s (argument%s) %s", a.Name, required, a.Description)
+				}
+				sb.WriteString("\n")
+			}
+			sb.WriteString("\n")
+		}
+		return tools.SilentResult(strings.TrimSpace(sb.String()))
+	case "get":
+		name, _ := args["name"].(string)
+		if serverName == "" || name == "" {
+			return tools.ErrorResult("server and name are required for get")
+		}
+		promptArgs := make(map[string]string)
+		if raw, ok := args["arguments"].(map[string]any); ok {
+			for k, v := range raw {
+				promptArgs[k] = fmt.Sprint(v)
+			}
+		}
+		client, err := t.mgr.client(serverName)
+		if err != nil {
+			return tools.ErrorResult(err.Error())
+		}
+		res, err := client.GetPrompt(ctx, name, promptArgs)
+		if err != nil {
+			return tools.ErrorResult(fmt.Sprintf("getting prompt %s failed: %v", name, err)).WithError(err)
+		}
+		var sb strings.Builder
+		if res.Description != "" {
+			sb.WriteString(res.Description + "\n\n")
+		}
+		for _, m := range res.Messages {
+			fmt.Fprintf(&sb, "[%s]\n%s\n\n", m.Role, formatContent([]Content{m.Content}))
+		}
+		return tools.SilentResult(strings.TrimSpace(sb.String()))
+	default:
+		return tools.ErrorResult(fmt.Sprintf("unknown action %q, use list or get", action))
+	}
+}
@@ -0,0 +1,199 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxMessageSize bounds a single newline-delimited or SSE message.
+const maxMessageSize = 16 * 1024 * 1024
+
+// transport moves JSON-RPC messages between the client and one server.
+type transport interface {
+	// start connects and begins delivering incoming messages to handle.
+	start(ctx context.Context, handle func(*Message)) error
+	// send delivers msg to the server. Transports that receive replies in
+	// the same exchange pass them to handle before returning.
+	send(ctx context.Context, msg *Message) error
+	// done is closed when the connection is lost.
+	done() <-chan struct{}
+	close() error
+}
+
+// newTransport picks the transport for cfg. Without an explicit type, a
+// command means stdio and a URL means streamable HTTP.
+func newTransport(cfg config.MCPServerConfig) (transport, error) {
+	kind := strings.ToLower(cfg.Type)
+	if kind == "" {
+		switch {
+		case cfg.Command != "":
+			kind = "stdio"
+		case strings.HasSuffix(strings.TrimRight(cfg.URL, "/"), "/sse"):
+			// Legacy HTTP+SSE servers conventionally serve their stream on /sse.
+			kind = "sse"
+		case cfg.URL != "":
+			kind = "http"
+		}
+	}
+
+	switch kind {
+	case "stdio":
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("stdio transport requires a command")
+		}
+		return newStdioTransport(cfg), nil
+	case "http", "streamable-http", "streamable_http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("http transport requires a url")
+		}
+		return newHTTPTransport(cfg), nil
+	case "sse":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("sse transport requires a url")
+		}
+		return newSSETransport(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown transport type %q", cfg.Type)
+	}
+}
+
+// stdioTransport runs the server as a subprocess and exchanges
+// newline-delimited JSON over its stdin/stdout.
+type stdioTransport struct {
+	cfg config.MCPServerConfig
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func newStdioTransport(cfg config.MCPServerConfig) *stdioTransport {
+	return &stdioTransport{
+		cfg:    cfg,
+		doneCh: make(chan struct{}),
+	}
+}
+
+func (t *stdioTransport) start(ctx context.Context, handle func(*Message)) error {
+	cmd := exec.Command(t.cfg.Command, t.cfg.Args...)
+	cmd.Dir = t.cfg.Dir
+	cmd.Env = os.Environ()
+	for k, v := range t.cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting %s: %w", t.cfg.Command, err)
+	}
+	t.cmd = cmd
+	t.stdin = stdin
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger.DebugCF("mcp", "Server stderr", map[string]any{
+				"command": t.cfg.Command,
+				"line":    scanner.Text(),
+			})
+		}
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(strings.TrimSpace(string(line))) == 0 {
+				continue
+			}
+			var msg Message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				logger.WarnCF("mcp", "Ignoring malformed message from server", map[string]any{
+					"command": t.cfg.Command,
+					"error":   err.Error(),
+				})
+				continue
+			}
+			handle(&msg)
+		}
+		// Wait must only be called after all reads from stdout are done.
+		err := cmd.Wait()
+		logger.InfoCF("mcp", "Server process exited", map[string]any{
+			"command": t.cfg.Command,
+			"error":   fmt.Sprint(err),
+		})
+		close(t.doneCh)
+	}()
+
+	return nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	data = append(data, '\n')
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if _, err := t.stdin.Write(data); err != nil {
+		return fmt.Errorf("write to server: %w", err)
+	}
+	return nil
+}
+
+func (t *stdioTransport) done() <-chan struct{} {
+	return t.doneCh
+}
+
+// close asks the server to exit by closing stdin, as the MCP spec suggests,
+// and kills it if it does not exit in time.
+func (t *stdioTransport) close() error {
+	t.closeOnce.Do(func() {
+		if t.cmd == nil {
+			close(t.doneCh)
+			return
+		}
+		t.stdin.Close()
+		select {
+		case <-t.doneCh:
+		case <-time.After(2 * time.Second):
+			t.cmd.Process.Kill()
+			<-t.doneCh
+		}
+	})
+	return nil
+}
@@ -0,0 +1,348 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const (
+	headerSessionID       = "Mcp-Session-Id"
+	headerProtocolVersion = "MCP-Protocol-Version"
+)
+
+// httpTransport implements the streamable HTTP transport: every message is
+// POSTed to a single endpoint, and replies come back in the response body as
+// JSON or as a server-sent event stream.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	handle    func(*Message)
+	mu        sync.Mutex
+	sessionID string
+
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func newHTTPTransport(cfg config.MCPServerConfig) *httpTransport {
+	return &httpTransport{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{},
+		doneCh:  make(chan struct{}),
+	}
+}
+
+func (t *httpTransport) start(ctx context.Context, handle func(*Message)) error {
+	t.handle = handle
+	return nil
+}
+
+func (t *httpTransport) send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			t.markDone()
+		}
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if id := resp.Header.Get(headerSessionID); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		return nil
+	case resp.StatusCode == http.StatusNotFound && t.session() != "":
+		// The server forgot our session, e.g. after a restart.
+		t.markDone()
+		return fmt.Errorf("session expired")
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return readSSE(resp.Body, func(event, data string) bool {
+			if event == "" || event == "message" {
+				t.deliver([]byte(data))
+			}
+			return true
+		})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	t.deliver(body)
+	return nil
+}
+
+// deliver passes a JSON message or batch to the handler.
+func (t *httpTransport) deliver(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return
+	}
+	if data[0] == '[' {
+		var batch []*Message
+		if json.Unmarshal(data, &batch) == nil {
+			for _, msg := range batch {
+				t.handle(msg)
+			}
+		}
+		return
+	}
+	var msg Message
+	if json.Unmarshal(data, &msg) == nil {
+		t.handle(&msg)
+	}
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(headerProtocolVersion, ProtocolVersion)
+	if id := t.session(); id != "" {
+		req.Header.Set(headerSessionID, id)
+	}
+}
+
+func (t *httpTransport) session() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+func (t *httpTransport) done() <-chan struct{} {
+	return t.doneCh
+}
+
+func (t *httpTransport) markDone() {
+	t.closeOnce.Do(func() { close(t.doneCh) })
+}
+
+// close terminates the session on the server, best effort.
+func (t *httpTransport) close() error {
+	if id := t.session(); id != "" {
+		if req, err := http.NewRequest(http.MethodDelete, t.url, nil); err == nil {
+			t.setHeaders(req)
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	t.markDone()
+	return nil
+}
+
+// sseTransport implements the legacy HTTP+SSE transport: the client holds a
+// GET event stream open, learns a POST endpoint from its first "endpoint"
+// event, and receives all replies on the stream.
+type sseTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	endpoint string
+	cancel   context.CancelFunc
+
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSSETransport(cfg config.MCPServerConfig) *sseTransport {
+	return &sseTransport{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{},
+		doneCh:  make(chan struct{}),
+	}
+}
+
+func (t *sseTransport) start(ctx context.Context, handle func(*Message)) error {
+	// The stream outlives ctx, which only bounds the connection attempt.
+	streamCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, t.url, nil)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("open event stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("event stream returned %d", resp.StatusCode)
+	}
+
+	endpoint := make(chan string, 1)
+	go func() {
+		defer t.markDone()
+		defer resp.Body.Close()
+		readSSE(resp.Body, func(event, data string) bool {
+			switch event {
+			case "endpoint":
+				select {
+				case endpoint <- data:
+				default:
+				}
+			case "", "message":
+				var msg Message
+				if json.Unmarshal([]byte(data), &msg) == nil {
+					handle(&msg)
+				}
+			}
+			return true
+		})
+	}()
+
+	select {
+	case ep := <-endpoint:
+		base, err := url.Parse(t.url)
+		if err != nil {
+			t.close()
+			return fmt.Errorf("parse url: %w", err)
+		}
+		ref, err := url.Parse(ep)
+		if err != nil {
+			t.close()
+			return fmt.Errorf("parse endpoint %q: %w", ep, err)
+		}
+		t.endpoint = base.ResolveReference(ref).String()
+		return nil
+	case <-t.doneCh:
+		t.close()
+		return fmt.Errorf("event stream closed before endpoint was announced")
+	case <-ctx.Done():
+		t.close()
+		return ctx.Err()
+	}
+}
+
+func (t *sseTransport) send(ctx context.Context, msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (t *sseTransport) done() <-chan struct{} {
+	return t.doneCh
+}
+
+func (t *sseTransport) markDone() {
+	t.closeOnce.Do(func() { close(t.doneCh) })
+}
+
+func (t *sseTransport) close() error {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.markDone()
+	return nil
+}
+
+// readSSE parses a server-sent event stream, calling fn for each event until
+// fn returns false or the stream ends.
+func readSSE(r io.Reader, fn func(event, data string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				if !fn(event, strings.Join(data, "\n")) {
+					return nil
+				}
+			}
+			event, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if len(data) > 0 {
+		fn(event, strings.Join(data, "\n"))
+	}
+	return scanner.Err()
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
@@ -21,14 +22,23 @@ type (
 	Message                = protocoltypes.Message
 	ToolDefinition         = protocoltypes.ToolDefinition
 	ToolFunctionDefinition = protocoltypes.ToolFunctionDefinition
+	StreamDelta            = protocoltypes.StreamDelta
+	ToolCallDelta          = protocoltypes.ToolCallDelta
 )
 
 const defaultBaseURL = "https://api.anthropic.com"
 
+// defaultStreamIdleTimeout aborts a stream that sends no event for this
+// long. The API sends ping events while the model is thinking, so a silent
+// stream has stalled.
+const defaultStreamIdleTimeout = 120 * time.Second
+
 type Provider struct {
 	client      *anthropic.Client
 	tokenSource func() (string, error)
 	baseURL     string
+	// streamIdleTimeout aborts a stream that sends nothing for this long
+	streamIdleTimeout time.Duration
 }
 
 func NewProvider(token string) *Provider {
@@ -42,15 +52,17 @@ func NewProviderWithBaseURL(token, apiBase string) *Provider {
 		option.WithBaseURL(baseURL),
 	)
 	return &Provider{
-		client:  &client,
-		baseURL: baseURL,
+		client:            &client,
+		baseURL:           baseURL,
+		streamIdleTimeout: defaultStreamIdleTimeout,
 	}
 }
 
 func NewProviderWithClient(client *anthropic.Client) *Provider {
 	return &Provider{
-		client:  client,
-		baseURL: defaultBaseURL,
+		client:            client,
+		baseURL:           defaultBaseURL,
+		streamIdleTimeout: defaultStreamIdleTimeout,
 	}
 }
 
@@ -71,13 +83,9 @@ func (p *Provider) Chat(
 	model string,
 	options map[string]any,
 ) (*LLMResponse, error) {
-	var opts []option.RequestOption
-	if p.tokenSource != nil {
-		tok, err := p.tokenSource()
-		if err != nil {
-			return nil, fmt.Errorf("refreshing token: %w", err)
-		}
-		opts = append(opts, option.WithAuthToken(tok))
+	opts, err := p.requestOptions()
+	if err != nil {
+		return nil, err
 	}
 
 	params, err := buildParams(messages, tools, model, options)
@@ -90,7 +98,100 @@ func (p *Provider) Chat(
 		return nil, fmt.Errorf("claude API call: %w", err)
 	}
 
-	return parseResponse(resp), nil
+	return structuredResponse(parseResponse(resp), options), nil
+}
+
+// ChatStream is like Chat but uses the streaming Messages API and calls
+// onDelta for every text or tool-input fragment as it arrives.
+func (p *Provider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(StreamDelta),
+) (*LLMResponse, error) {
+	opts, err := p.requestOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := buildParams(messages, tools, model, options)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, watchdog := protocoltypes.WatchStream(ctx, p.streamIdleTimeout)
+	defer watchdog.Stop()
+
+	stream := p.client.Messages.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
+
+	var message anthropic.Message
+	// Tool-use blocks are numbered by their content block index; deltas
+	// report their position among tool calls only.
+	toolIndex := make(map[int64]int)
+	started := false
+	for stream.Next() {
+		watchdog.Touch()
+		started = true
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return nil, fmt.Errorf("claude stream: %w", err)
+		}
+		if onDelta == nil {
+			continue
+		}
+
+		switch ev := event.AsAny().(type) {
+		case anthropic.ContentBlockStartEvent:
+			if ev.ContentBlock.Type == "tool_use" {
+				idx := len(toolIndex)
+				toolIndex[ev.Index] = idx
+				onDelta(StreamDelta{ToolCall: &ToolCallDelta{
+					Index: idx,
+					ID:    ev.ContentBlock.ID,
+					Name:  ev.ContentBlock.Name,
+				}})
+			}
+		case anthropic.ContentBlockDeltaEvent:
+			switch delta := ev.Delta.AsAny().(type) {
+			case anthropic.TextDelta:
+				if delta.Text != "" {
+					onDelta(StreamDelta{Content: delta.Text})
+				}
+			case anthropic.InputJSONDelta:
+				if idx, ok := toolIndex[ev.Index]; ok && delta.PartialJSON != "" {
+					onDelta(StreamDelta{ToolCall: &ToolCallDelta{
+						Index:     idx,
+						Arguments: delta.PartialJSON,
+					}})
+				}
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		if started {
+			err = watchdog.ReadErr(err)
+		} else {
+			err = watchdog.StartErr(err)
+		}
+		return nil, fmt.Errorf("claude API call: %w", err)
+	}
+
+	return structuredResponse(parseResponse(&message), options), nil
+}
+
+func (p *Provider) requestOptions() ([]option.RequestOption, error) {
+	var opts []option.RequestOption
+	if p.tokenSource != nil {
+		tok, err := p.tokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("refreshing token: %w", err)
+		}
+		opts = append(opts, option.WithAuthToken(tok))
+	}
+	return opts, nil
 }
 
 func (p *Provider) GetDefaultModel() string {
@@ -109,11 +210,12 @@ func buildParams(
 ) (anthropic.MessageNewParams, error) {
 	var system []anthropic.TextBlockParam
 	var anthropicMessages []anthropic.MessageParam
+	budget := thinkingBudget(messages, options)
 
 	for _, msg := range messages {
 		switch msg.Role {
 		case "system":
-			system = append(system, anthropic.TextBlockParam{Text: msg.Content})
+			system = append(system, systemBlocks(msg)...)
 		case "user":
 			if msg.ToolCallID != "" {
 				anthropicMessages = append(anthropicMessages,
@@ -121,12 +223,15 @@ func buildParams(
 				)
 			} else {
 				anthropicMessages = append(anthropicMessages,
-					anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)),
+					anthropic.NewUserMessage(userBlocks(msg)...),
 				)
 			}
 		case "assistant":
 			if len(msg.ToolCalls) > 0 {
 				var blocks []anthropic.ContentBlockParamUnion
+				if budget > 0 {
+					blocks = append(blocks, thinkingBlocks(msg.Thinking)...)
+				}
 				if msg.Content != "" {
 					blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
 				}
@@ -161,7 +266,14 @@ func buildParams(
 		params.System = system
 	}
 
-	if temp, ok := options["temperature"].(float64); ok {
+	if budget > 0 {
+		// max_tokens covers thinking too; keep the configured room for the answer
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(int64(budget))
+		if params.MaxTokens <= int64(budget) {
+			params.MaxTokens += int64(budget)
+		}
+	} else if temp, ok := options["temperature"].(float64); ok {
+		// Extended thinking only works with the default temperature
 		params.Temperature = anthropic.Float(temp)
 	}
 
@@ -169,9 +281,133 @@ func buildParams(
 		params.Tools = translateTools(tools)
 	}
 
+	// Claude has no JSON mode, so a structured answer is forced through a
+	// tool whose input schema is the requested one.
+	if rf := protocoltypes.ResponseFormatFrom(options); rf != nil {
+		params.Tools = append(params.Tools, structuredOutputTool(rf))
+		if len(tools) == 0 {
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{
+				OfTool: &anthropic.ToolChoiceToolParam{Name: protocoltypes.StructuredOutputTool},
+			}
+		} else {
+			// The model may still call other tools before answering.
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}}
+		}
+	}
+
 	return params, nil
 }
 
+// systemBlocks converts a system message to text blocks, with a cache
+// breakpoint after each part marked for caching. Text appended to Content
+// after the parts were built goes in a last, uncached block; if the parts no
+// longer match Content, Content is sent whole.
+func systemBlocks(msg Message) []anthropic.TextBlockParam {
+	rest := msg.Content
+	var blocks []anthropic.TextBlockParam
+	for _, part := range msg.SystemParts {
+		if !strings.HasPrefix(rest, part.Text) {
+			return []anthropic.TextBlockParam{{Text: msg.Content}}
+		}
+		rest = rest[len(part.Text):]
+		if part.Text == "" {
+			continue
+		}
+		block := anthropic.TextBlockParam{Text: part.Text}
+		if part.CacheControl != nil {
+			block.CacheControl = anthropic.NewCacheControlEphemeralParam()
+		}
+		blocks = append(blocks, block)
+	}
+	if rest != "" || len(blocks) == 0 {
+		blocks = append(blocks, anthropic.TextBlockParam{Text: rest})
+	}
+	return blocks
+}
+
+// minThinkingBudget is the smallest thinking budget the API accepts.
+const minThinkingBudget = 1024
+
+// thinkingBudget returns the extended thinking budget for a request, or 0 to
+// leave thinking off. Thinking cannot be combined with a forced tool choice,
+// and a tool loop can only continue with thinking when the assistant turn
+// that called the tools kept its signed thinking blocks.
+func thinkingBudget(messages []Message, options map[string]any) int {
+	budget := protocoltypes.ReasoningBudget(options)
+	if budget == 0 || protocoltypes.ResponseFormatFrom(options) != nil {
+		return 0
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" {
+			if len(messages[i].ToolCalls) > 0 && len(messages[i].Thinking) == 0 {
+				return 0
+			}
+			break
+		}
+	}
+	return max(budget, minThinkingBudget)
+}
+
+// thinkingBlocks converts stored thinking blocks back to content blocks.
+func thinkingBlocks(thinking []protocoltypes.ThinkingBlock) []anthropic.ContentBlockParamUnion {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(thinking))
+	for _, t := range thinking {
+		if t.Redacted != "" {
+			blocks = append(blocks, anthropic.NewRedactedThinkingBlock(t.Redacted))
+		} else {
+			blocks = append(blocks, anthropic.NewThinkingBlock(t.Signature, t.Thinking))
+		}
+	}
+	return blocks
+}
+
+// structuredOutputTool builds the tool carrying a structured answer.
+func structuredOutputTool(rf *protocoltypes.ResponseFormat) anthropic.ToolUnionParam {
+	schema := rf.ToolSchema()
+	inputSchema := anthropic.ToolInputSchemaParam{
+		Properties:  schema["properties"],
+		Required:    schemaRequired(schema["required"]),
+		ExtraFields: map[string]any{},
+	}
+	for key, value := range schema {
+		if key != "type" && key != "properties" && key != "required" {
+			inputSchema.ExtraFields[key] = value
+		}
+	}
+
+	return anthropic.ToolUnionParam{OfTool: &anthropic.ToolParam{
+		Name:        protocoltypes.StructuredOutputTool,
+		Description: anthropic.String("Give your final answer. Call this once you have everything you need."),
+		InputSchema: inputSchema,
+	}}
+}
+
+// structuredResponse moves a structured answer given through the tool into
+// the response content.
+func structuredResponse(resp *LLMResponse, options map[string]any) *LLMResponse {
+	if rf := protocoltypes.ResponseFormatFrom(options); rf != nil {
+		return rf.ApplyToolAnswer(resp)
+	}
+	return resp
+}
+
+// userBlocks converts a user message into content blocks, placing image
+// attachments before the text as Anthropic recommends. Attachment types the
+// API cannot read are dropped.
+func userBlocks(msg Message) []anthropic.ContentBlockParamUnion {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(msg.Attachments)+1)
+	for _, att := range msg.Attachments {
+		switch att.MimeType {
+		case "image/jpeg", "image/png", "image/gif", "image/webp":
+			blocks = append(blocks, anthropic.NewImageBlockBase64(att.MimeType, att.Data))
+		}
+	}
+	if msg.Content != "" || len(blocks) == 0 {
+		blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
+	}
+	return blocks
+}
+
 func translateTools(tools []ToolDefinition) []anthropic.ToolUnionParam {
 	result := make([]anthropic.ToolUnionParam, 0, len(tools))
 	for _, t := range tools {
@@ -184,26 +420,50 @@ func translateTools(tools []ToolDefinition) []anthropic.ToolUnionParam {
 		if desc := t.Function.Description; desc != "" {
 			tool.Description = anthropic.String(desc)
 		}
-		if req, ok := t.Function.Parameters["required"].([]any); ok {
-			required := make([]string, 0, len(req))
-			for _, r := range req {
-				if s, ok := r.(string); ok {
-					required = append(required, s)
-				}
-			}
+		if required := schemaRequired(t.Function.Parameters["required"]); len(required) > 0 {
 			tool.InputSchema.Required = required
 		}
 		result = append(result, anthropic.ToolUnionParam{OfTool: &tool})
 	}
+	// Tools lead the cached prefix; a breakpoint on the last one caches them
+	// even when the system prompt is not split
+	if len(result) > 0 {
+		result[len(result)-1].OfTool.CacheControl = anthropic.NewCacheControlEphemeralParam()
+	}
 	return result
 }
 
+// schemaRequired reads the required property names of a schema, which are
+// []any when decoded from JSON and []string when written in Go.
+func schemaRequired(v any) []string {
+	switch req := v.(type) {
+	case []string:
+		return req
+	case []any:
+		required := make([]string, 0, len(req))
+		for _, r := range req {
+			if s, ok := r.(string); ok {
+				required = append(required, s)
+			}
+		}
+		return required
+	}
+	return nil
+}
+
 func parseResponse(resp *anthropic.Message) *LLMResponse {
 	var content string
 	var toolCalls []ToolCall
+	var reasoning []string
+	var thinking []protocoltypes.ThinkingBlock
 
 	for _, block := range resp.Content {
 		switch block.Type {
+		case "thinking":
+			reasoning = append(reasoning, block.Thinking)
+			thinking = append(thinking, protocoltypes.ThinkingBlock{Thinking: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			thinking = append(thinking, protocoltypes.ThinkingBlock{Redacted: block.Data})
 		case "text":
 			tb := block.AsText()
 			content += tb.Text
@@ -236,11 +496,21 @@ func parseResponse(resp *anthropic.Message) *LLMResponse {
 		Content:      content,
 		ToolCalls:    toolCalls,
 		FinishReason: finishReason,
-		Usage: &UsageInfo{
-			PromptTokens:     int(resp.Usage.InputTokens),
-			CompletionTokens: int(resp.Usage.OutputTokens),
-			TotalTokens:      int(resp.Usage.InputTokens + resp.Usage.OutputTokens),
-		},
+		Usage:        usageInfo(resp.Usage),
+		Reasoning:    strings.Join(reasoning, "\n\n"),
+		Thinking:     thinking,
+	}
+}
+
+// usageInfo converts Anthropic usage, where input_tokens leaves out tokens
+// read from or written to the prompt cache, to totals that include them.
+func usageInfo(u anthropic.Usage) *UsageInfo {
+	prompt := int(u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens)
+	return &UsageInfo{
+		PromptTokens:     prompt,
+		CompletionTokens: int(u.OutputTokens),
+		TotalTokens:      prompt + int(u.OutputTokens),
+		CachedTokens:     int(u.CacheReadInputTokens),
 	}
 }
 
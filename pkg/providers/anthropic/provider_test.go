@@ -2,13 +2,18 @@ package anthropicprovider
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 func TestBuildParams_BasicMessage(t *testing.T) {
@@ -77,6 +82,33 @@ func TestBuildParams_ToolCallMessage(t *testing.T) {
 	}
 }
 
+func TestBuildParams_ImageAttachments(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "What is this?", Attachments: []protocoltypes.Attachment{
+			{MimeType: "image/jpeg", Data: "aGVsbG8="},
+			{MimeType: "application/pdf", Data: "cGRm"},
+		}},
+	}
+	params, err := buildParams(messages, nil, "claude-sonnet-4.6", map[string]any{})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+	blocks := params.Messages[0].Content
+	if len(blocks) != 2 {
+		t.Fatalf("len(Content) = %d, want image and text", len(blocks))
+	}
+	img := blocks[0].OfImage
+	if img == nil || img.Source.OfBase64 == nil {
+		t.Fatalf("first block = %+v, want base64 image", blocks[0])
+	}
+	if img.Source.OfBase64.MediaType != "image/jpeg" || img.Source.OfBase64.Data != "aGVsbG8=" {
+		t.Errorf("image source = %+v", img.Source.OfBase64)
+	}
+	if blocks[1].OfText == nil || blocks[1].OfText.Text != "What is this?" {
+		t.Errorf("second block = %+v, want the text", blocks[1])
+	}
+}
+
 func TestBuildParams_WithTools(t *testing.T) {
 	tools := []ToolDefinition{
 		{
@@ -103,6 +135,162 @@ func TestBuildParams_WithTools(t *testing.T) {
 	}
 }
 
+func TestBuildParams_ReasoningEnablesThinking(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "Hi"}}
+	params, err := buildParams(messages, nil, "claude-sonnet-4.6", map[string]any{
+		"max_tokens":                        2048,
+		"temperature":                       0.7,
+		protocoltypes.ReasoningEffortOption: "medium",
+	})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+	if params.Thinking.OfEnabled == nil || params.Thinking.OfEnabled.BudgetTokens != 4096 {
+		t.Fatalf("Thinking = %+v, want enabled with budget 4096", params.Thinking)
+	}
+	if params.MaxTokens != 2048+4096 {
+		t.Errorf("MaxTokens = %d, want %d", params.MaxTokens, 2048+4096)
+	}
+	if params.Temperature.Valid() {
+		t.Error("Temperature should not be sent with thinking enabled")
+	}
+}
+
+func TestBuildParams_ThinkingBlocksPrecedeToolUse(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "What's the weather?"},
+		{
+			Role:      "assistant",
+			ToolCalls: []ToolCall{{ID: "call_1", Name: "get_weather", Arguments: map[string]any{"city": "SF"}}},
+			Thinking: []protocoltypes.ThinkingBlock{
+				{Thinking: "check the weather", Signature: "sig"},
+				{Redacted: "opaque"},
+			},
+		},
+		{Role: "tool", Content: `{"temp": 72}`, ToolCallID: "call_1"},
+	}
+	params, err := buildParams(messages, nil, "claude-sonnet-4.6", map[string]any{
+		protocoltypes.ReasoningBudgetOption: 2000,
+	})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+	content := params.Messages[1].Content
+	if len(content) != 3 {
+		t.Fatalf("len(assistant content) = %d, want 3", len(content))
+	}
+	if content[0].OfThinking == nil || content[0].OfThinking.Signature != "sig" {
+		t.Errorf("content[0] = %+v, want signed thinking block", content[0])
+	}
+	if content[1].OfRedactedThinking == nil || content[1].OfRedactedThinking.Data != "opaque" {
+		t.Errorf("content[1] = %+v, want redacted thinking block", content[1])
+	}
+	if content[2].OfToolUse == nil {
+		t.Errorf("content[2] = %+v, want tool_use", content[2])
+	}
+}
+
+func TestBuildParams_ThinkingOffWithoutSignedBlocks(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "What's the weather?"},
+		{
+			Role:      "assistant",
+			ToolCalls: []ToolCall{{ID: "call_1", Name: "get_weather", Arguments: map[string]any{"city": "SF"}}},
+		},
+		{Role: "tool", Content: `{"temp": 72}`, ToolCallID: "call_1"},
+	}
+	params, err := buildParams(messages, nil, "claude-sonnet-4.6", map[string]any{
+		protocoltypes.ReasoningEffortOption: "high",
+	})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+	if params.Thinking.OfEnabled != nil {
+		t.Error("thinking must stay off when the tool-call turn has no signed blocks")
+	}
+}
+
+func TestParseResponse_Thinking(t *testing.T) {
+	var resp anthropic.Message
+	raw := `{
+		"content": [
+			{"type": "thinking", "thinking": "first idea", "signature": "sig1"},
+			{"type": "redacted_thinking", "data": "opaque"},
+			{"type": "text", "text": "Answer"}
+		],
+		"stop_reason": "end_turn"
+	}`
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatalf("json.Unmarshal() error: %v", err)
+	}
+	result := parseResponse(&resp)
+	if result.Content != "Answer" {
+		t.Errorf("Content = %q, want %q", result.Content, "Answer")
+	}
+	if result.Reasoning != "first idea" {
+		t.Errorf("Reasoning = %q, want %q", result.Reasoning, "first idea")
+	}
+	want := []protocoltypes.ThinkingBlock{{Thinking: "first idea", Signature: "sig1"}, {Redacted: "opaque"}}
+	if len(result.Thinking) != 2 || result.Thinking[0] != want[0] || result.Thinking[1] != want[1] {
+		t.Errorf("Thinking = %+v, want %+v", result.Thinking, want)
+	}
+}
+
+func TestBuildParams_CacheBreakpoints(t *testing.T) {
+	stable := "You are a helpful assistant."
+	messages := []Message{
+		{
+			Role:    "system",
+			Content: stable + "\n\nTime: now\n\nAnswer in JSON.",
+			SystemParts: []protocoltypes.ContentBlock{
+				{Type: "text", Text: stable, CacheControl: &protocoltypes.CacheControl{Type: "ephemeral"}},
+				{Type: "text", Text: "\n\nTime: now"},
+			},
+		},
+		{Role: "user", Content: "Hi"},
+	}
+	tools := []ToolDefinition{
+		{Type: "function", Function: ToolFunctionDefinition{Name: "a", Parameters: map[string]any{}}},
+		{Type: "function", Function: ToolFunctionDefinition{Name: "b", Parameters: map[string]any{}}},
+	}
+	params, err := buildParams(messages, tools, "claude-sonnet-4.6", map[string]any{})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+
+	body, _ := json.Marshal(params.System)
+	want := `[{"text":"You are a helpful assistant.","cache_control":{"type":"ephemeral"},"type":"text"},` +
+		`{"text":"\n\nTime: now","type":"text"},{"text":"\n\nAnswer in JSON.","type":"text"}]`
+	if string(body) != want {
+		t.Errorf("System = %s\nwant %s", body, want)
+	}
+	if params.Tools[0].OfTool.CacheControl.Type != "" || params.Tools[1].OfTool.CacheControl.Type != "ephemeral" {
+		t.Error("expected a cache breakpoint on the last tool only")
+	}
+
+	// Parts that no longer match the content are ignored
+	messages[0].Content = "Replaced prompt"
+	params, _ = buildParams(messages, nil, "claude-sonnet-4.6", map[string]any{})
+	if len(params.System) != 1 || params.System[0].Text != "Replaced prompt" {
+		t.Errorf("System = %+v, want content sent whole", params.System)
+	}
+}
+
+func TestParseResponse_CacheUsage(t *testing.T) {
+	resp := &anthropic.Message{
+		Usage: anthropic.Usage{
+			InputTokens:              10,
+			CacheReadInputTokens:     3000,
+			CacheCreationInputTokens: 200,
+			OutputTokens:             20,
+		},
+	}
+	usage := parseResponse(resp).Usage
+	if usage.PromptTokens != 3210 || usage.CachedTokens != 3000 || usage.TotalTokens != 3230 {
+		t.Errorf("Usage = %+v, want prompt 3210, cached 3000, total 3230", usage)
+	}
+}
+
 func TestParseResponse_TextOnly(t *testing.T) {
 	resp := &anthropic.Message{
 		Content: []anthropic.ContentBlockUnion{},
@@ -269,3 +457,138 @@ func createAnthropicTestClient(baseURL, token string) *anthropic.Client {
 	)
 	return &c
 }
+
+func TestProvider_ChatStreamAssemblesResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		var reqBody map[string]any
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if reqBody["stream"] != true {
+			http.Error(w, "expected stream", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4.6","content":[],"usage":{"input_tokens":12,"output_tokens":0}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"check."}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"SF\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, event := range events {
+			var typed struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(event), &typed)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}))
+	defer server.Close()
+
+	var text string
+	var toolDeltas []ToolCallDelta
+	provider := NewProviderWithClient(createAnthropicTestClient(server.URL, "test-token"))
+	resp, err := provider.ChatStream(
+		t.Context(),
+		[]Message{{Role: "user", Content: "Weather?"}},
+		nil,
+		"claude-sonnet-4.6",
+		map[string]any{"max_tokens": 1024},
+		func(d StreamDelta) {
+			if d.ToolCall != nil {
+				toolDeltas = append(toolDeltas, *d.ToolCall)
+				return
+			}
+			text += d.Content
+		},
+	)
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+
+	if text != "Let me check." || resp.Content != "Let me check." {
+		t.Errorf("streamed text = %q, Content = %q", text, resp.Content)
+	}
+	if len(toolDeltas) != 3 || toolDeltas[0].Name != "get_weather" || toolDeltas[0].Index != 0 {
+		t.Errorf("unexpected tool deltas: %+v", toolDeltas)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["city"] != "SF" {
+		t.Fatalf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.FinishReason)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 9 {
+		t.Errorf("Usage = %+v", resp.Usage)
+	}
+}
+
+func TestProvider_ChatStreamStalledStreamTimesOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		event := `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4.6","content":[],"usage":{"input_tokens":1,"output_tokens":0}}}`
+		fmt.Fprintf(w, "event: message_start\ndata: %s\n\n", event)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	provider := NewProviderWithClient(createAnthropicTestClient(server.URL, "test-token"))
+	provider.streamIdleTimeout = 50 * time.Millisecond
+	_, err := provider.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil,
+		"claude-sonnet-4.6", map[string]any{"max_tokens": 1024}, nil)
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Fatalf("expected a stalled stream error, got %v", err)
+	}
+}
+
+func TestProvider_ChatStructuredOutputThroughTool(t *testing.T) {
+	var reqBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		resp := map[string]any{
+			"id":          "msg_test",
+			"type":        "message",
+			"role":        "assistant",
+			"model":       reqBody["model"],
+			"stop_reason": "tool_use",
+			"content": []map[string]any{
+				{"type": "tool_use", "id": "toolu_1", "name": "structured_output", "input": map[string]any{"city": "Oslo"}},
+			},
+			"usage": map[string]any{"input_tokens": 5, "output_tokens": 3},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	provider := NewProviderWithClient(createAnthropicTestClient(server.URL, "test-token"))
+	format := &protocoltypes.ResponseFormat{Type: protocoltypes.ResponseFormatJSONSchema, Schema: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"city": map[string]any{"type": "string"}},
+		"required":   []any{"city"},
+	}}
+	resp, err := provider.Chat(t.Context(), []Message{{Role: "user", Content: "Capital of Norway?"}}, nil,
+		"claude-sonnet-4.6", map[string]any{protocoltypes.ResponseFormatOption: format})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+
+	choice, _ := json.Marshal(reqBody["tool_choice"])
+	if string(choice) != `{"name":"structured_output","type":"tool"}` {
+		t.Errorf("tool_choice = %s", choice)
+	}
+	if resp.Content != `{"city":"Oslo"}` || len(resp.ToolCalls) != 0 || resp.FinishReason != "stop" {
+		t.Errorf("response = %+v", resp)
+	}
+}
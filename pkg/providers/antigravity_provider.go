@@ -14,6 +14,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 const (
@@ -147,7 +148,7 @@ func (p *AntigravityProvider) Chat(
 		)
 	}
 
-	return llmResp, nil
+	return applyStructuredToolAnswer(llmResp, options), nil
 }
 
 // GetDefaultModel returns the default model identifier.
@@ -160,6 +161,7 @@ func (p *AntigravityProvider) GetDefaultModel() string {
 type antigravityRequest struct {
 	Contents     []antigravityContent     `json:"contents"`
 	Tools        []antigravityTool        `json:"tools,omitempty"`
+	ToolConfig   *geminiToolConfig        `json:"toolConfig,omitempty"`
 	SystemPrompt *antigravitySystemPrompt `json:"systemInstruction,omitempty"`
 	Config       *antigravityGenConfig    `json:"generationConfig,omitempty"`
 }
@@ -208,8 +210,10 @@ type antigravitySystemPrompt struct {
 }
 
 type antigravityGenConfig struct {
-	MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
-	Temperature     float64 `json:"temperature,omitempty"`
+	MaxOutputTokens  int            `json:"maxOutputTokens,omitempty"`
+	Temperature      float64        `json:"temperature,omitempty"`
+	ResponseMimeType string         `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]any `json:"responseSchema,omitempty"`
 }
 
 func (p *AntigravityProvider) buildRequest(
@@ -311,26 +315,44 @@ func (p *AntigravityProvider) buildRequest(
 	}
 
 	// Build tools (sanitize schemas for Gemini compatibility)
-	if len(tools) > 0 {
-		var funcDecls []antigravityFuncDecl
-		for _, t := range tools {
-			if t.Type != "function" {
-				continue
+	var funcDecls []antigravityFuncDecl
+	for _, t := range tools {
+		if t.Type != "function" {
+			continue
+		}
+		params := sanitizeSchemaForGemini(t.Function.Parameters)
+		funcDecls = append(funcDecls, antigravityFuncDecl{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  params,
+		})
+	}
+
+	// Generation config
+	config := &antigravityGenConfig{}
+
+	// Structured output: JSON mode without tools, a forced function call with
+	// them, as Gemini cannot combine the two
+	if rf := protocoltypes.ResponseFormatFrom(options); rf != nil {
+		if len(funcDecls) == 0 {
+			config.ResponseMimeType = "application/json"
+			if rf.Type == ResponseFormatJSONSchema {
+				config.ResponseSchema = sanitizeSchemaForGemini(rf.Schema)
 			}
-			params := sanitizeSchemaForGemini(t.Function.Parameters)
+		} else {
 			funcDecls = append(funcDecls, antigravityFuncDecl{
-				Name:        t.Function.Name,
-				Description: t.Function.Description,
-				Parameters:  params,
+				Name:        protocoltypes.StructuredOutputTool,
+				Description: "Give your final answer. Call this once you have everything you need.",
+				Parameters:  sanitizeSchemaForGemini(rf.ToolSchema()),
 			})
-		}
-		if len(funcDecls) > 0 {
-			req.Tools = []antigravityTool{{FunctionDeclarations: funcDecls}}
+			req.ToolConfig = &geminiToolConfig{}
+			req.ToolConfig.FunctionCallingConfig.Mode = "ANY"
 		}
 	}
+	if len(funcDecls) > 0 {
+		req.Tools = []antigravityTool{{FunctionDeclarations: funcDecls}}
+	}
 
-	// Generation config
-	config := &antigravityGenConfig{}
 	if val, ok := options["max_tokens"]; ok {
 		if maxTokens, ok := val.(int); ok && maxTokens > 0 {
 			config.MaxOutputTokens = maxTokens
@@ -341,7 +363,7 @@ func (p *AntigravityProvider) buildRequest(
 	if temp, ok := options["temperature"].(float64); ok {
 		config.Temperature = temp
 	}
-	if config.MaxOutputTokens > 0 || config.Temperature > 0 {
+	if config.MaxOutputTokens > 0 || config.Temperature > 0 || config.ResponseMimeType != "" {
 		req.Config = config
 	}
 
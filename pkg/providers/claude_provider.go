@@ -51,6 +51,13 @@ func (p *ClaudeProvider) Chat(
 	return resp, nil
 }
 
+func (p *ClaudeProvider) ChatStream(
+	ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]any,
+	onDelta func(StreamDelta),
+) (*LLMResponse, error) {
+	return p.delegate.ChatStream(ctx, messages, tools, model, options, onDelta)
+}
+
 func (p *ClaudeProvider) GetDefaultModel() string {
 	return p.delegate.GetDefaultModel()
 }
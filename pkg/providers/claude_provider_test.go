@@ -12,6 +12,11 @@ import (
 	anthropicprovider "github.com/sipeed/picoclaw/pkg/providers/anthropic"
 )
 
+var (
+	_ StreamingProvider = (*ClaudeProvider)(nil)
+	_ StreamingProvider = (*HTTPProvider)(nil)
+)
+
 func TestClaudeProvider_ChatRoundTrip(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/v1/messages" {
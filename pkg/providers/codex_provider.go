@@ -10,9 +10,11 @@ import (
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
 	"github.com/openai/openai-go/v3/responses"
+	"github.com/openai/openai-go/v3/shared"
 
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 const (
@@ -293,9 +295,35 @@ func buildCodexParams(
 		params.Tools = translateToolsForCodex(tools, enableWebSearch)
 	}
 
+	if rf := protocoltypes.ResponseFormatFrom(options); rf != nil {
+		params.Text = responses.ResponseTextConfigParam{Format: codexTextFormat(rf)}
+	}
+
+	if effort := protocoltypes.ReasoningEffort(options); effort != "" {
+		params.Reasoning = shared.ReasoningParam{
+			Effort:  shared.ReasoningEffort(effort),
+			Summary: shared.ReasoningSummaryAuto,
+		}
+	}
+
 	return params
 }
 
+// codexTextFormat converts rf to the Responses API text format.
+func codexTextFormat(rf *ResponseFormat) responses.ResponseFormatTextConfigUnionParam {
+	if rf.Type != ResponseFormatJSONSchema || rf.Schema == nil {
+		return responses.ResponseFormatTextConfigUnionParam{
+			OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+		}
+	}
+	return responses.ResponseFormatTextConfigUnionParam{
+		OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
+			Name:   rf.SchemaName(),
+			Schema: rf.Schema,
+		},
+	}
+}
+
 func resolveCodexToolCall(tc ToolCall) (name string, arguments string, ok bool) {
 	name = tc.Name
 	if name == "" && tc.Function != nil {
@@ -352,9 +380,14 @@ func translateToolsForCodex(tools []ToolDefinition, enableWebSearch bool) []resp
 func parseCodexResponse(resp *responses.Response) *LLMResponse {
 	var content strings.Builder
 	var toolCalls []ToolCall
+	var reasoning []string
 
 	for _, item := range resp.Output {
 		switch item.Type {
+		case "reasoning":
+			for _, summary := range item.Summary {
+				reasoning = append(reasoning, summary.Text)
+			}
 		case "message":
 			for _, c := range item.Content {
 				if c.Type == "output_text" {
@@ -388,6 +421,7 @@ func parseCodexResponse(resp *responses.Response) *LLMResponse {
 			PromptTokens:     int(resp.Usage.InputTokens),
 			CompletionTokens: int(resp.Usage.OutputTokens),
 			TotalTokens:      int(resp.Usage.TotalTokens),
+			CachedTokens:     int(resp.Usage.InputTokensDetails.CachedTokens),
 		}
 	}
 
@@ -396,6 +430,7 @@ func parseCodexResponse(resp *responses.Response) *LLMResponse {
 		ToolCalls:    toolCalls,
 		FinishReason: finishReason,
 		Usage:        usage,
+		Reasoning:    strings.Join(reasoning, "\n\n"),
 	}
 }
 
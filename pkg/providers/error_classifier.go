@@ -78,6 +78,14 @@ var (
 		substr("invalid request format"),
 	}
 
+	// Content withheld by the provider's safety filters (Gemini finish and
+	// block reasons, OpenAI-style content_filter).
+	safetyPatterns = []errorPattern{
+		rxp(`blocked by safety`),
+		rxp(`(finish|block)[_ ]?reason\W+(safety|recitation|blocklist|prohibited_content|spii|image_safety)`),
+		substr("content_filter"),
+	}
+
 	imageDimensionPatterns = []errorPattern{
 		rxp(`image dimensions exceed max`),
 	}
@@ -176,6 +184,9 @@ func classifyByStatus(status int) FailoverReason {
 // classifyByMessage matches error messages against patterns.
 // Priority order matters (from OpenClaw classifyFailoverReason).
 func classifyByMessage(msg string) FailoverReason {
+	if matchesAny(msg, safetyPatterns) {
+		return FailoverSafety
+	}
 	if matchesAny(msg, rateLimitPatterns) {
 		return FailoverRateLimit
 	}
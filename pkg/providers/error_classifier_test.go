@@ -207,6 +207,30 @@ func TestClassifyError_FormatPatterns(t *testing.T) {
 	}
 }
 
+func TestClassifyError_SafetyPatterns(t *testing.T) {
+	patterns := []string{
+		"gemini: response blocked by safety filters (finish reason SAFETY)",
+		"gemini: prompt blocked by safety filters (block reason PROHIBITED_CONTENT)",
+		`{"finishReason": "RECITATION"}`,
+		"finish_reason: content_filter",
+	}
+
+	for _, msg := range patterns {
+		err := errors.New(msg)
+		result := ClassifyError(err, "gemini", "gemini-2.5-flash")
+		if result == nil {
+			t.Errorf("pattern %q: expected non-nil", msg)
+			continue
+		}
+		if result.Reason != FailoverSafety {
+			t.Errorf("pattern %q: reason = %q, want safety", msg, result.Reason)
+		}
+		if result.IsRetriable() {
+			t.Errorf("pattern %q: safety block should not be retriable", msg)
+		}
+	}
+}
+
 func TestClassifyError_ImageDimensionError(t *testing.T) {
 	err := errors.New("image dimensions exceed max allowed 2048x2048")
 	result := ClassifyError(err, "openai", "gpt-4o")
@@ -265,6 +289,7 @@ func TestFailoverError_IsRetriable(t *testing.T) {
 		{FailoverTimeout, true},
 		{FailoverOverloaded, true},
 		{FailoverFormat, false},
+		{FailoverSafety, false},
 		{FailoverUnknown, true},
 	}
 
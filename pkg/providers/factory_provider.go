@@ -53,9 +53,29 @@ func ExtractProtocol(model string) (protocol, modelID string) {
 
 // CreateProviderFromConfig creates a provider based on the ModelConfig.
 // It uses the protocol prefix in the Model field to determine which provider to create.
-// Supported protocols: openai, anthropic, antigravity, claude-cli, codex-cli, github-copilot
+// Supported protocols: openai, anthropic, gemini, ollama, antigravity, claude-cli, codex-cli, github-copilot
 // Returns the provider, the model ID (without protocol prefix), and any error.
+// Providers for entries with an rpm or tpm limit share a rate limiter with
+// every other provider using the same model and API key.
 func CreateProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, error) {
+	provider, modelID, err := createProviderFromConfig(cfg)
+	if err != nil || (cfg.RPM <= 0 && cfg.TPM <= 0) {
+		return provider, modelID, err
+	}
+	key := strings.Join([]string{cfg.Model, cfg.APIBase, cfg.APIKey}, "\x00")
+	limiter := SharedRateLimiter(key, rateLimiterName(cfg), cfg.RPM, cfg.TPM)
+	return WithRateLimit(provider, limiter), modelID, nil
+}
+
+// rateLimiterName labels a model's limiter without revealing its API key.
+func rateLimiterName(cfg *config.ModelConfig) string {
+	if len(cfg.APIKey) > 8 {
+		return cfg.Model + " (key …" + cfg.APIKey[len(cfg.APIKey)-4:] + ")"
+	}
+	return cfg.Model
+}
+
+func createProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, error) {
 	if cfg == nil {
 		return nil, "", fmt.Errorf("config is nil")
 	}
@@ -86,8 +106,8 @@ func CreateProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, err
 		}
 		return NewHTTPProviderWithMaxTokensField(cfg.APIKey, apiBase, cfg.Proxy, cfg.MaxTokensField), modelID, nil
 
-	case "openrouter", "groq", "zhipu", "gemini", "nvidia",
-		"ollama", "moonshot", "shengsuanyun", "deepseek", "cerebras",
+	case "openrouter", "groq", "zhipu", "nvidia",
+		"moonshot", "shengsuanyun", "deepseek", "cerebras",
 		"volcengine", "vllm", "qwen":
 		// All other OpenAI-compatible HTTP providers
 		if cfg.APIKey == "" && cfg.APIBase == "" {
@@ -99,6 +119,17 @@ func CreateProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, err
 		}
 		return NewHTTPProviderWithMaxTokensField(cfg.APIKey, apiBase, cfg.Proxy, cfg.MaxTokensField), modelID, nil
 
+	case "gemini":
+		// Native generateContent API with an API key
+		if cfg.APIKey == "" && cfg.APIBase == "" {
+			return nil, "", fmt.Errorf("api_key or api_base is required for HTTP-based protocol %q", protocol)
+		}
+		return NewGeminiProvider(cfg.APIKey, cfg.APIBase, cfg.Proxy), modelID, nil
+
+	case "ollama":
+		// Native API; no key needed for a local server
+		return NewOllamaProvider(cfg.APIKey, cfg.APIBase, cfg.Proxy, cfg.KeepAlive), modelID, nil
+
 	case "anthropic":
 		if cfg.AuthMethod == "oauth" || cfg.AuthMethod == "token" {
 			// Use OAuth credentials from auth store
@@ -107,7 +107,6 @@ func TestCreateProviderFromConfig_DefaultAPIBase(t *testing.T) {
 		{"qwen", "qwen"},
 		{"vllm", "vllm"},
 		{"deepseek", "deepseek"},
-		{"ollama", "ollama"},
 	}
 
 	for _, tt := range tests {
@@ -131,6 +130,49 @@ func TestCreateProviderFromConfig_DefaultAPIBase(t *testing.T) {
 	}
 }
 
+func TestCreateProviderFromConfig_OllamaNative(t *testing.T) {
+	cfg := &config.ModelConfig{
+		ModelName: "llama3",
+		Model:     "ollama/llama3",
+		APIBase:   "http://localhost:11434/v1",
+	}
+
+	provider, modelID, err := CreateProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("CreateProviderFromConfig() error = %v", err)
+	}
+	if _, ok := provider.(*OllamaProvider); !ok {
+		t.Fatalf("expected *OllamaProvider, got %T", provider)
+	}
+	if modelID != "llama3" {
+		t.Errorf("modelID = %q, want %q", modelID, "llama3")
+	}
+}
+
+func TestCreateProviderFromConfig_GeminiNative(t *testing.T) {
+	cfg := &config.ModelConfig{
+		ModelName: "gemini",
+		Model:     "gemini/gemini-2.5-flash",
+		APIKey:    "test-key",
+		APIBase:   "https://generativelanguage.googleapis.com/v1beta/openai/",
+	}
+
+	provider, modelID, err := CreateProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("CreateProviderFromConfig() error = %v", err)
+	}
+	gemini, ok := provider.(*GeminiProvider)
+	if !ok {
+		t.Fatalf("expected *GeminiProvider, got %T", provider)
+	}
+	if gemini.apiBase != "https://generativelanguage.googleapis.com/v1beta" {
+		t.Errorf("apiBase = %q, want the native endpoint", gemini.apiBase)
+	}
+	if modelID != "gemini-2.5-flash" {
+		t.Errorf("modelID = %q, want %q", modelID, "gemini-2.5-flash")
+	}
+}
+
 func TestCreateProviderFromConfig_Anthropic(t *testing.T) {
 	cfg := &config.ModelConfig{
 		ModelName: "test-anthropic",
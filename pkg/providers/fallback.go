@@ -16,6 +16,18 @@ type FallbackChain struct {
 type FallbackCandidate struct {
 	Provider string
 	Model    string
+	// Key identifies the credentials serving the candidate when it comes
+	// from a model_list entry. Cooldowns are tracked per Key if set, and per
+	// Provider otherwise.
+	Key string
+}
+
+// cooldownKey returns the key the candidate's cooldown is tracked under.
+func (c FallbackCandidate) cooldownKey() string {
+	if c.Key != "" {
+		return c.Key
+	}
+	return c.Provider
 }
 
 // FallbackResult contains the successful response and metadata about all attempts.
@@ -87,6 +99,19 @@ func (fc *FallbackChain) Execute(
 	ctx context.Context,
 	candidates []FallbackCandidate,
 	run func(ctx context.Context, provider, model string) (*LLMResponse, error),
+) (*FallbackResult, error) {
+	return fc.ExecuteCandidates(ctx, candidates,
+		func(ctx context.Context, c FallbackCandidate) (*LLMResponse, error) {
+			return run(ctx, c.Provider, c.Model)
+		})
+}
+
+// ExecuteCandidates is like Execute but hands run the whole candidate, so
+// callers can pick the provider instance that serves it.
+func (fc *FallbackChain) ExecuteCandidates(
+	ctx context.Context,
+	candidates []FallbackCandidate,
+	run func(ctx context.Context, candidate FallbackCandidate) (*LLMResponse, error),
 ) (*FallbackResult, error) {
 	if len(candidates) == 0 {
 		return nil, fmt.Errorf("fallback: no candidates configured")
@@ -103,8 +128,8 @@ func (fc *FallbackChain) Execute(
 		}
 
 		// Check cooldown.
-		if !fc.cooldown.IsAvailable(candidate.Provider) {
-			remaining := fc.cooldown.CooldownRemaining(candidate.Provider)
+		if !fc.cooldown.IsAvailable(candidate.cooldownKey()) {
+			remaining := fc.cooldown.CooldownRemaining(candidate.cooldownKey())
 			result.Attempts = append(result.Attempts, FallbackAttempt{
 				Provider: candidate.Provider,
 				Model:    candidate.Model,
@@ -121,12 +146,12 @@ func (fc *FallbackChain) Execute(
 
 		// Execute the run function.
 		start := time.Now()
-		resp, err := run(ctx, candidate.Provider, candidate.Model)
+		resp, err := run(ctx, candidate)
 		elapsed := time.Since(start)
 
 		if err == nil {
 			// Success.
-			fc.cooldown.MarkSuccess(candidate.Provider)
+			fc.cooldown.MarkSuccess(candidate.cooldownKey())
 			result.Response = resp
 			result.Provider = candidate.Provider
 			result.Model = candidate.Model
@@ -172,7 +197,7 @@ func (fc *FallbackChain) Execute(
 		}
 
 		// Retriable error: mark failure and continue to next candidate.
-		fc.cooldown.MarkFailure(candidate.Provider, failErr.Reason)
+		fc.cooldown.MarkFailure(candidate.cooldownKey(), failErr.Reason)
 		result.Attempts = append(result.Attempts, FallbackAttempt{
 			Provider: candidate.Provider,
 			Model:    candidate.Model,
@@ -198,6 +223,19 @@ func (fc *FallbackChain) ExecuteImage(
 	ctx context.Context,
 	candidates []FallbackCandidate,
 	run func(ctx context.Context, provider, model string) (*LLMResponse, error),
+) (*FallbackResult, error) {
+	return fc.ExecuteImageCandidates(ctx, candidates,
+		func(ctx context.Context, c FallbackCandidate) (*LLMResponse, error) {
+			return run(ctx, c.Provider, c.Model)
+		})
+}
+
+// ExecuteImageCandidates is like ExecuteImage but hands run the whole
+// candidate.
+func (fc *FallbackChain) ExecuteImageCandidates(
+	ctx context.Context,
+	candidates []FallbackCandidate,
+	run func(ctx context.Context, candidate FallbackCandidate) (*LLMResponse, error),
 ) (*FallbackResult, error) {
 	if len(candidates) == 0 {
 		return nil, fmt.Errorf("image fallback: no candidates configured")
@@ -213,7 +251,7 @@ func (fc *FallbackChain) ExecuteImage(
 		}
 
 		start := time.Now()
-		resp, err := run(ctx, candidate.Provider, candidate.Model)
+		resp, err := run(ctx, candidate)
 		elapsed := time.Since(start)
 
 		if err == nil {
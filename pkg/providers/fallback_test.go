@@ -300,6 +300,43 @@ func TestFallback_SuccessResetsCooldown(t *testing.T) {
 
 // --- Image Fallback Tests ---
 
+func TestFallback_CooldownPerCredentialKey(t *testing.T) {
+	ct := NewCooldownTracker()
+	fc := NewFallbackChain(ct)
+
+	candidates := []FallbackCandidate{
+		{Provider: "groq", Model: "llama", Key: "groq#key1"},
+		{Provider: "groq", Model: "llama", Key: "groq#key2"},
+	}
+	var keys []string
+	run := func(ctx context.Context, c FallbackCandidate) (*LLMResponse, error) {
+		keys = append(keys, c.Key)
+		if c.Key == "groq#key1" {
+			return nil, errors.New("429 rate limit exceeded")
+		}
+		return &LLMResponse{Content: "ok", FinishReason: "stop"}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := fc.ExecuteCandidates(context.Background(), candidates, run); err != nil {
+			t.Fatalf("call %d: unexpected error: %v", i, err)
+		}
+	}
+
+	want := []string{"groq#key1", "groq#key2", "groq#key2"}
+	if len(keys) != len(want) {
+		t.Fatalf("attempted keys = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("attempted keys = %v, want %v", keys, want)
+		}
+	}
+	if ct.IsAvailable("groq#key1") || !ct.IsAvailable("groq#key2") || !ct.IsAvailable("groq") {
+		t.Error("cooldown should apply to the failing key only")
+	}
+}
+
 func TestImageFallback_Success(t *testing.T) {
 	ct := NewCooldownTracker()
 	fc := NewFallbackChain(ct)
@@ -0,0 +1,542 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+// geminiDefaultAPIBase is the public Gemini API endpoint.
+const geminiDefaultAPIBase = "https://generativelanguage.googleapis.com/v1beta"
+
+// geminiBlockReasons are the finish reasons Gemini uses when it withholds a
+// response; the response then carries no usable content.
+var geminiBlockReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+	"IMAGE_SAFETY":       true,
+}
+
+// geminiStreamIdleTimeout matches the timeout of non-streaming requests, but
+// applies to the gap between chunks rather than to the whole response.
+const geminiStreamIdleTimeout = 120 * time.Second
+
+// GeminiProvider talks to the Gemini API directly with an API key, using
+// generateContent and streamGenerateContent rather than the OpenAI-compatible
+// shim, so thought signatures and inline images survive the round trip.
+type GeminiProvider struct {
+	apiKey     string
+	apiBase    string
+	httpClient *http.Client
+	// streamIdleTimeout aborts a stream that sends nothing for this long
+	streamIdleTimeout time.Duration
+}
+
+func NewGeminiProvider(apiKey, apiBase, proxy string) *GeminiProvider {
+	client := &http.Client{
+		Timeout: 120 * time.Second,
+	}
+
+	if proxy != "" {
+		parsed, err := url.Parse(proxy)
+		if err == nil {
+			client.Transport = &http.Transport{
+				Proxy: http.ProxyURL(parsed),
+			}
+		} else {
+			log.Printf("gemini: invalid proxy URL %q: %v", proxy, err)
+		}
+	}
+
+	// Configs written for the OpenAI-compatible endpoint point at .../openai.
+	apiBase = strings.TrimSuffix(strings.TrimRight(strings.TrimSpace(apiBase), "/"), "/openai")
+	if apiBase == "" {
+		apiBase = geminiDefaultAPIBase
+	}
+
+	return &GeminiProvider{
+		apiKey:     apiKey,
+		apiBase:    apiBase,
+		httpClient: client,
+
+		streamIdleTimeout: geminiStreamIdleTimeout,
+	}
+}
+
+func (p *GeminiProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	resp, err := p.post(ctx, p.httpClient, model, "generateContent", buildGeminiRequest(messages, tools, options))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chunk geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var acc geminiAccumulator
+	if err := acc.add(chunk, nil); err != nil {
+		return nil, err
+	}
+	return acc.structuredResponse(options)
+}
+
+// ChatStream is like Chat but uses streamGenerateContent, calling onDelta for
+// every text fragment and function call as it arrives.
+func (p *GeminiProvider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(StreamDelta),
+) (*LLMResponse, error) {
+	ctx, watchdog := protocoltypes.WatchStream(ctx, p.streamIdleTimeout)
+	defer watchdog.Stop()
+
+	resp, err := p.post(ctx, protocoltypes.StreamClient(p.httpClient), model, "streamGenerateContent?alt=sse",
+		buildGeminiRequest(messages, tools, options))
+	if err != nil {
+		return nil, watchdog.StartErr(err)
+	}
+	defer resp.Body.Close()
+
+	var acc geminiAccumulator
+	scanner := bufio.NewScanner(watchdog.Reader(resp.Body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if err := acc.add(chunk, onDelta); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, watchdog.ReadErr(fmt.Errorf("failed to read stream: %w", err))
+	}
+	// The last chunk always carries a finish reason.
+	if acc.finishReason == "" {
+		return nil, fmt.Errorf("stream ended before the response was done")
+	}
+	return acc.structuredResponse(options)
+}
+
+func (p *GeminiProvider) GetDefaultModel() string {
+	return ""
+}
+
+// --- Request building ---
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+	InlineData       *geminiInlineData       `json:"inlineData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFunctionCall struct {
+	ID   string         `json:"id,omitempty"`
+	Name string         `json:"name"`
+	Args map[string]any `json:"args"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode string `json:"mode"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiGenerationConfig struct {
+	MaxOutputTokens  int                   `json:"maxOutputTokens,omitempty"`
+	Temperature      *float64              `json:"temperature,omitempty"`
+	ResponseMimeType string                `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]any        `json:"responseSchema,omitempty"`
+	ThinkingConfig   *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type geminiThinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget"`
+	IncludeThoughts bool `json:"includeThoughts"`
+}
+
+// buildGeminiRequest converts messages to Gemini contents. System messages
+// become the system instruction, images travel as inline data, and tool
+// results answering the same assistant turn are grouped into one content as
+// Gemini expects.
+func buildGeminiRequest(messages []Message, tools []ToolDefinition, options map[string]any) geminiRequest {
+	var req geminiRequest
+	var system []string
+	toolCallNames := make(map[string]string)
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+		case "assistant":
+			content := geminiContent{Role: "model"}
+			if msg.Content != "" {
+				content.Parts = append(content.Parts, geminiPart{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				name, args, thoughtSignature := normalizeStoredToolCall(tc)
+				if name == "" {
+					continue
+				}
+				if thoughtSignature == "" {
+					thoughtSignature = tc.ThoughtSignature
+				}
+				if tc.ID != "" {
+					toolCallNames[tc.ID] = name
+				}
+				content.Parts = append(content.Parts, geminiPart{
+					ThoughtSignature: thoughtSignature,
+					FunctionCall:     &geminiFunctionCall{Name: name, Args: args},
+				})
+			}
+			if len(content.Parts) > 0 {
+				req.Contents = append(req.Contents, content)
+			}
+		case "tool":
+			// Calls are matched by name; Gemini's optional call IDs are not
+			// kept in history.
+			part := geminiPart{FunctionResponse: &geminiFunctionResponse{
+				Name:     resolveToolResponseName(msg.ToolCallID, toolCallNames),
+				Response: map[string]any{"result": msg.Content},
+			}}
+			if n := len(req.Contents); n > 0 && req.Contents[n-1].isFunctionResponses() {
+				req.Contents[n-1].Parts = append(req.Contents[n-1].Parts, part)
+			} else {
+				req.Contents = append(req.Contents, geminiContent{Role: "user", Parts: []geminiPart{part}})
+			}
+		default:
+			content := geminiContent{Role: "user"}
+			if msg.Content != "" {
+				content.Parts = append(content.Parts, geminiPart{Text: msg.Content})
+			}
+			for _, att := range msg.Attachments {
+				content.Parts = append(content.Parts, geminiPart{
+					InlineData: &geminiInlineData{MimeType: att.MimeType, Data: att.Data},
+				})
+			}
+			if len(content.Parts) > 0 {
+				req.Contents = append(req.Contents, content)
+			}
+		}
+	}
+
+	if len(system) > 0 {
+		req.SystemInstruction = &geminiContent{
+			Parts: []geminiPart{{Text: strings.Join(system, "\n\n")}},
+		}
+	}
+
+	var decls []geminiFunctionDeclaration
+	for _, t := range tools {
+		if t.Type != "function" {
+			continue
+		}
+		decls = append(decls, geminiFunctionDeclaration{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  sanitizeSchemaForGemini(t.Function.Parameters),
+		})
+	}
+
+	config := &geminiGenerationConfig{}
+	if rf := protocoltypes.ResponseFormatFrom(options); rf != nil {
+		// Gemini cannot combine JSON mode with function calling, so with
+		// tools the answer goes through a forced function call instead.
+		if len(decls) == 0 {
+			config.ResponseMimeType = "application/json"
+			if rf.Type == ResponseFormatJSONSchema {
+				config.ResponseSchema = sanitizeSchemaForGemini(rf.Schema)
+			}
+		} else {
+			decls = append(decls, geminiFunctionDeclaration{
+				Name:        protocoltypes.StructuredOutputTool,
+				Description: "Give your final answer. Call this once you have everything you need.",
+				Parameters:  sanitizeSchemaForGemini(rf.ToolSchema()),
+			})
+			req.ToolConfig = &geminiToolConfig{}
+			req.ToolConfig.FunctionCallingConfig.Mode = "ANY"
+		}
+	}
+	if len(decls) > 0 {
+		req.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+
+	switch maxTokens := options["max_tokens"].(type) {
+	case int:
+		config.MaxOutputTokens = maxTokens
+	case float64:
+		config.MaxOutputTokens = int(maxTokens)
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		config.Temperature = &temperature
+	}
+	if budget := protocoltypes.ReasoningBudget(options); budget > 0 {
+		config.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: budget, IncludeThoughts: true}
+	}
+	if config.MaxOutputTokens > 0 || config.Temperature != nil || config.ResponseMimeType != "" ||
+		config.ThinkingConfig != nil {
+		req.GenerationConfig = config
+	}
+
+	return req
+}
+
+func (c geminiContent) isFunctionResponses() bool {
+	if c.Role != "user" || len(c.Parts) == 0 {
+		return false
+	}
+	for _, part := range c.Parts {
+		if part.FunctionResponse == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// --- Response parsing ---
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []geminiPart `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback,omitempty"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	} `json:"usageMetadata,omitempty"`
+}
+
+// geminiAccumulator assembles a response from one or more response chunks.
+type geminiAccumulator struct {
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    []ToolCall
+	finishReason string
+	usage        *UsageInfo
+}
+
+func (a *geminiAccumulator) add(chunk geminiResponse, onDelta func(StreamDelta)) error {
+	if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+		return fmt.Errorf("gemini: prompt blocked by safety filters (block reason %s)",
+			chunk.PromptFeedback.BlockReason)
+	}
+
+	if len(chunk.Candidates) > 0 {
+		candidate := chunk.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.Thought:
+				// Thought summaries are not part of the answer.
+				a.reasoning.WriteString(part.Text)
+			case part.FunctionCall != nil:
+				a.addToolCall(part, onDelta)
+			case part.Text != "":
+				a.content.WriteString(part.Text)
+				if onDelta != nil {
+					onDelta(StreamDelta{Content: part.Text})
+				}
+			}
+		}
+		if candidate.FinishReason != "" {
+			a.finishReason = candidate.FinishReason
+		}
+	}
+
+	if u := chunk.UsageMetadata; u != nil && u.TotalTokenCount > 0 {
+		a.usage = &UsageInfo{
+			PromptTokens:     u.PromptTokenCount,
+			CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+			TotalTokens:      u.TotalTokenCount,
+			CachedTokens:     u.CachedContentTokenCount,
+		}
+	}
+	return nil
+}
+
+// addToolCall records a function call with its thought signature, which
+// Gemini requires back verbatim on the next turn.
+func (a *geminiAccumulator) addToolCall(part geminiPart, onDelta func(StreamDelta)) {
+	fc := part.FunctionCall
+	args := fc.Args
+	if args == nil {
+		args = map[string]any{}
+	}
+	id := fc.ID
+	if id == "" {
+		id = fmt.Sprintf("call_%s_%d", fc.Name, time.Now().UnixNano())
+	}
+	raw, _ := json.Marshal(args)
+
+	a.toolCalls = append(a.toolCalls, ToolCall{
+		ID:               id,
+		Type:             "function",
+		Name:             fc.Name,
+		Arguments:        args,
+		ThoughtSignature: part.ThoughtSignature,
+		Function: &FunctionCall{
+			Name:             fc.Name,
+			Arguments:        string(raw),
+			ThoughtSignature: part.ThoughtSignature,
+		},
+	})
+	if onDelta != nil {
+		onDelta(StreamDelta{ToolCall: &ToolCallDelta{
+			Index:     len(a.toolCalls) - 1,
+			ID:        id,
+			Name:      fc.Name,
+			Arguments: string(raw),
+		}})
+	}
+}
+
+func (a *geminiAccumulator) response() (*LLMResponse, error) {
+	if geminiBlockReasons[a.finishReason] && a.content.Len() == 0 && len(a.toolCalls) == 0 {
+		return nil, fmt.Errorf("gemini: response blocked by safety filters (finish reason %s)", a.finishReason)
+	}
+
+	finishReason := "stop"
+	switch {
+	case len(a.toolCalls) > 0:
+		finishReason = "tool_calls"
+	case a.finishReason == "MAX_TOKENS":
+		finishReason = "length"
+	}
+
+	return &LLMResponse{
+		Content:      a.content.String(),
+		ToolCalls:    a.toolCalls,
+		FinishReason: finishReason,
+		Usage:        a.usage,
+		Reasoning:    a.reasoning.String(),
+	}, nil
+}
+
+// structuredResponse is response with a structured answer given through the
+// forced function call moved into the content.
+func (a *geminiAccumulator) structuredResponse(options map[string]any) (*LLMResponse, error) {
+	resp, err := a.response()
+	if err != nil {
+		return nil, err
+	}
+	return applyStructuredToolAnswer(resp, options), nil
+}
+
+// post sends a request to a model method and returns the response if the
+// status is 200. The caller must close the response body.
+func (p *GeminiProvider) post(
+	ctx context.Context,
+	client *http.Client,
+	model, method string,
+	requestBody geminiRequest,
+) (*http.Response, error) {
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	model = strings.TrimPrefix(strings.TrimPrefix(model, "gemini/"), "models/")
+	endpoint := fmt.Sprintf("%s/models/%s:%s", p.apiBase, model, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("x-goog-api-key", p.apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(respBody))
+	}
+
+	return resp, nil
+}
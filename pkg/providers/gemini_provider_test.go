@@ -0,0 +1,233 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGeminiProviderChat_RequestAndThoughtSignatures(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-2.5-flash:generateContent" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.Header.Get("x-goog-api-key"); got != "test-key" {
+			t.Errorf("x-goog-api-key = %q", got)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[`+
+			`{"text":"thinking it over","thought":true},`+
+			`{"functionCall":{"name":"read_file","args":{"path":"notes.txt"}},"thoughtSignature":"sig-2"}]},`+
+			`"finishReason":"STOP"}],`+
+			`"usageMetadata":{"promptTokenCount":40,"candidatesTokenCount":5,"thoughtsTokenCount":3,"totalTokenCount":48}}`)
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key", server.URL, "")
+	messages := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "what is this?", Attachments: []Attachment{
+			{MimeType: "image/png", Data: "iVBORw0KGgo="},
+		}},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "call_a", Name: "list_dir", Arguments: map[string]any{"path": "."},
+				Function: &FunctionCall{Name: "list_dir", ThoughtSignature: "sig-1"}},
+			{ID: "call_b", Name: "list_dir", Arguments: map[string]any{"path": "docs"}},
+		}},
+		{Role: "tool", ToolCallID: "call_a", Content: "notes.txt"},
+		{Role: "tool", ToolCallID: "call_b", Content: "README.md"},
+	}
+	tools := []ToolDefinition{{
+		Type: "function",
+		Function: ToolFunctionDefinition{
+			Name: "read_file",
+			Parameters: map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties":           map[string]any{"path": map[string]any{"type": "string", "minLength": 1}},
+			},
+		},
+	}}
+	resp, err := p.Chat(context.Background(), messages, tools, "gemini-2.5-flash",
+		map[string]any{"max_tokens": 512, "temperature": 0.0})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+
+	raw, _ := json.Marshal(body)
+	request := string(raw)
+	for _, want := range []string{
+		`"systemInstruction":{"parts":[{"text":"be brief"}]}`,
+		`"inlineData":{"data":"iVBORw0KGgo=","mimeType":"image/png"}`,
+		`"thoughtSignature":"sig-1"`,
+		`"generationConfig":{"maxOutputTokens":512,"temperature":0}`,
+	} {
+		if !strings.Contains(request, want) {
+			t.Errorf("request missing %s:\n%s", want, request)
+		}
+	}
+	if strings.Contains(request, "additionalProperties") || strings.Contains(request, "minLength") {
+		t.Errorf("tool schema was not sanitized: %s", request)
+	}
+	contents := body["contents"].([]any)
+	if len(contents) != 3 {
+		t.Fatalf("contents = %d, want user, model and one grouped function response", len(contents))
+	}
+	responses := contents[2].(map[string]any)["parts"].([]any)
+	if len(responses) != 2 {
+		t.Errorf("function responses = %d, want 2 in one content", len(responses))
+	}
+
+	if resp.Content != "" || resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 {
+		t.Fatalf("response = %+v", resp)
+	}
+	tc := resp.ToolCalls[0]
+	if tc.Name != "read_file" || tc.Function.ThoughtSignature != "sig-2" || tc.Function.Arguments != `{"path":"notes.txt"}` {
+		t.Errorf("tool call = %+v (function %+v)", tc, tc.Function)
+	}
+	if resp.Usage == nil || resp.Usage.CompletionTokens != 8 || resp.Usage.TotalTokens != 48 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestGeminiProviderChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-2.5-pro:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("url = %q", r.URL.String())
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hel\"}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"lo\"}]},\"finishReason\":\"MAX_TOKENS\"}],"+
+			"\"usageMetadata\":{\"promptTokenCount\":3,\"candidatesTokenCount\":2,\"totalTokenCount\":5}}\n\n")
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key", server.URL, "")
+	var deltas []string
+	resp, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil,
+		"gemini/gemini-2.5-pro", nil, func(d StreamDelta) { deltas = append(deltas, d.Content) })
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if resp.Content != "Hello" || resp.FinishReason != "length" || strings.Join(deltas, "|") != "Hel|lo" {
+		t.Errorf("response = %+v, deltas = %v", resp, deltas)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 5 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestGeminiProviderChatStream_IncompleteStream(t *testing.T) {
+	var stall atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hel\"}]}}]}\n\n")
+		w.(http.Flusher).Flush()
+		if stall.Load() {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key", server.URL, "")
+	p.streamIdleTimeout = 50 * time.Millisecond
+	messages := []Message{{Role: "user", Content: "hi"}}
+
+	_, err := p.ChatStream(t.Context(), messages, nil, "gemini-2.5-pro", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "ended before") {
+		t.Errorf("expected a truncated stream error, got %v", err)
+	}
+
+	stall.Store(true)
+	_, err = p.ChatStream(t.Context(), messages, nil, "gemini-2.5-pro", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Errorf("expected a stalled stream error, got %v", err)
+	}
+}
+
+func TestGeminiProviderChat_SafetyBlock(t *testing.T) {
+	tests := map[string]string{
+		"finish reason": `{"candidates":[{"content":{"parts":[]},"finishReason":"SAFETY"}]}`,
+		"prompt block":  `{"promptFeedback":{"blockReason":"PROHIBITED_CONTENT"}}`,
+	}
+	for name, reply := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, reply)
+			}))
+			defer server.Close()
+
+			p := NewGeminiProvider("test-key", server.URL, "")
+			_, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "gemini-2.5-flash", nil)
+			if err == nil {
+				t.Fatal("expected an error for a blocked response")
+			}
+			classified := ClassifyError(err, "gemini", "gemini-2.5-flash")
+			if classified == nil || classified.Reason != FailoverSafety {
+				t.Fatalf("ClassifyError(%v) = %+v, want safety", err, classified)
+			}
+			if classified.IsRetriable() {
+				t.Error("safety block should not be retriable")
+			}
+		})
+	}
+}
+
+func TestGeminiProviderChat_ResponseFormat(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"{\"n\":1}"}]},"finishReason":"STOP"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key", server.URL, "")
+	format := NewResponseFormat(map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           map[string]any{"n": map[string]any{"type": "integer"}},
+	})
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "count"}}, nil,
+		"gemini-2.5-flash", map[string]any{ResponseFormatOption: format})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	config, _ := json.Marshal(body["generationConfig"])
+	if want := `{"responseMimeType":"application/json","responseSchema":{"properties":{"n":{"type":"integer"}},"type":"object"}}`; string(config) != want {
+		t.Errorf("generationConfig = %s, want %s", config, want)
+	}
+	if resp.Content != `{"n":1}` {
+		t.Errorf("content = %q", resp.Content)
+	}
+}
+
+func TestGeminiProviderChat_Reasoning(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[`+
+			`{"text":"Weighing the options","thought":true},{"text":"Take the train."}]},"finishReason":"STOP"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key", server.URL, "")
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "train or bus?"}}, nil,
+		"gemini-2.5-pro", map[string]any{ReasoningBudgetOption: 2048})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	config, _ := json.Marshal(body["generationConfig"])
+	if want := `{"thinkingConfig":{"includeThoughts":true,"thinkingBudget":2048}}`; string(config) != want {
+		t.Errorf("generationConfig = %s, want %s", config, want)
+	}
+	if resp.Content != "Take the train." || resp.Reasoning != "Weighing the options" {
+		t.Errorf("response = %+v", resp)
+	}
+}
@@ -0,0 +1,129 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoder
+	"image/jpeg"
+	_ "image/png" // register decoder
+	"strings"
+)
+
+const (
+	// maxImageDimension is the longest side accepted by all supported vision
+	// APIs without server-side rejection.
+	maxImageDimension = 2000
+	// maxImageBytes keeps each re-encoded image well under the 5 MB limit of
+	// the strictest provider once base64 overhead is added.
+	maxImageBytes = 3 * 1024 * 1024
+	// minImageDimension stops shrinking before images become unreadable.
+	minImageDimension = 256
+)
+
+// DownscaleAttachments returns a copy of messages whose image attachments are
+// re-encoded as JPEG, scaled to fit maxImageDimension and maxImageBytes. It is
+// used to retry a request after the provider rejected an image for its size or
+// dimensions. Attachments that cannot be decoded are kept as they are. The
+// second result reports whether any attachment changed.
+func DownscaleAttachments(messages []Message) ([]Message, bool) {
+	out := make([]Message, len(messages))
+	changed := false
+	for i, msg := range messages {
+		out[i] = msg
+		if len(msg.Attachments) == 0 {
+			continue
+		}
+		attachments := make([]Attachment, len(msg.Attachments))
+		for j, att := range msg.Attachments {
+			attachments[j] = att
+			if !strings.HasPrefix(att.MimeType, "image/") {
+				continue
+			}
+			if shrunk, ok := downscaleImage(att.Data); ok {
+				attachments[j] = Attachment{MimeType: "image/jpeg", Data: shrunk}
+				changed = true
+			}
+		}
+		out[i].Attachments = attachments
+	}
+	return out, changed
+}
+
+// downscaleImage decodes base64 image data and re-encodes it as a smaller
+// JPEG. The image always shrinks by at least a quarter, since the provider
+// rejected it as-is and its limits may be stricter than ours.
+func downscaleImage(data string) (string, bool) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", false
+	}
+	src, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", false
+	}
+
+	b := src.Bounds()
+	longest := max(b.Dx(), b.Dy())
+	target := min(maxImageDimension, longest*3/4)
+
+	for {
+		target = max(target, minImageDimension)
+		scale := float64(target) / float64(longest)
+		if scale > 1 {
+			scale = 1
+		}
+		w := max(1, int(float64(b.Dx())*scale))
+		h := max(1, int(float64(b.Dy())*scale))
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resizeImage(src, w, h), &jpeg.Options{Quality: 85}); err != nil {
+			return "", false
+		}
+		if buf.Len() <= maxImageBytes || target == minImageDimension {
+			return base64.StdEncoding.EncodeToString(buf.Bytes()), true
+		}
+		target = target * 3 / 4
+	}
+}
+
+// resizeImage scales src to w×h by averaging the source pixels covered by
+// each destination pixel. Transparent areas are flattened onto white, as JPEG
+// has no alpha channel.
+func resizeImage(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, b.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max((y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max((x+1)*sw/w, x0+1)
+
+			var r, g, bl, n int
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+3]
+					r += int(p[0])
+					g += int(p[1])
+					bl += int(p[2])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
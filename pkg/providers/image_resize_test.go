@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPNG(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestDownscaleAttachments(t *testing.T) {
+	original := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "look", Attachments: []Attachment{
+			{MimeType: "image/png", Data: encodeTestPNG(t, 3000, 1500)},
+			{MimeType: "image/png", Data: encodeTestPNG(t, 400, 300)},
+			{MimeType: "audio/ogg", Data: "b2dn"},
+			{MimeType: "image/webp", Data: "bm90IGFuIGltYWdl"},
+		}},
+	}
+
+	got, changed := DownscaleAttachments(original)
+	if !changed {
+		t.Fatal("DownscaleAttachments() reported no change")
+	}
+	if original[1].Attachments[0].MimeType != "image/png" {
+		t.Error("input messages were modified")
+	}
+
+	atts := got[1].Attachments
+	wantBounds := []image.Point{{2000, 1000}, {300, 225}}
+	for i, want := range wantBounds {
+		if atts[i].MimeType != "image/jpeg" {
+			t.Fatalf("attachment %d mime = %q, want image/jpeg", i, atts[i].MimeType)
+		}
+		raw, _ := base64.StdEncoding.DecodeString(atts[i].Data)
+		img, err := jpeg.Decode(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("attachment %d is not a JPEG: %v", i, err)
+		}
+		if size := img.Bounds().Size(); size != want {
+			t.Errorf("attachment %d size = %v, want %v", i, size, want)
+		}
+	}
+	if atts[2] != original[1].Attachments[2] || atts[3] != original[1].Attachments[3] {
+		t.Error("non-decodable attachments should be left unchanged")
+	}
+}
+
+func TestDownscaleAttachments_NoImages(t *testing.T) {
+	if _, changed := DownscaleAttachments([]Message{{Role: "user", Content: "hi"}}); changed {
+		t.Error("DownscaleAttachments() changed messages without images")
+	}
+}
@@ -0,0 +1,90 @@
+package ollama
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Model is a model installed on the Ollama server.
+type Model struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// PullProgress is one status update of a model download.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+// ListModels returns the models installed on the server (/api/tags).
+func (p *Provider) ListModels(ctx context.Context) ([]Model, error) {
+	resp, err := p.do(ctx, p.httpClient, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []Model `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return tags.Models, nil
+}
+
+// PullModel downloads a model to the server (/api/pull), calling onProgress
+// with each status update. It returns once the pull has succeeded or failed.
+func (p *Provider) PullModel(ctx context.Context, name string, onProgress func(PullProgress)) error {
+	// Large downloads are bounded by ctx rather than the client timeout.
+	client := *p.httpClient
+	client.Timeout = 0
+
+	resp, err := p.do(ctx, &client, http.MethodPost, "/api/pull", map[string]any{
+		"model":  name,
+		"stream": true,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+	for scanner.Scan() {
+		var update struct {
+			PullProgress
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			continue
+		}
+		if update.Error != "" {
+			return fmt.Errorf("pull %s failed: %s", name, update.Error)
+		}
+		if onProgress != nil {
+			onProgress(update.PullProgress)
+		}
+		if update.Status == "success" {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read pull progress: %w", err)
+	}
+	return fmt.Errorf("pull %s ended without success", name)
+}
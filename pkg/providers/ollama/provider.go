@@ -0,0 +1,446 @@
+// Package ollama talks to a local Ollama server through its native API, which
+// unlike the OpenAI-compatible shim supports keep_alive, num_ctx and model
+// management.
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+type (
+	ToolCall       = protocoltypes.ToolCall
+	FunctionCall   = protocoltypes.FunctionCall
+	LLMResponse    = protocoltypes.LLMResponse
+	UsageInfo      = protocoltypes.UsageInfo
+	Message        = protocoltypes.Message
+	ToolDefinition = protocoltypes.ToolDefinition
+	StreamDelta    = protocoltypes.StreamDelta
+	ToolCallDelta  = protocoltypes.ToolCallDelta
+)
+
+// DefaultAPIBase is where a local Ollama server listens.
+const DefaultAPIBase = "http://localhost:11434"
+
+// maxStreamLineSize bounds a single NDJSON line of a streamed response.
+const maxStreamLineSize = 1024 * 1024
+
+// defaultStreamIdleTimeout matches the timeout of non-streaming requests, but
+// applies to the gap between chunks rather than to the whole response.
+const defaultStreamIdleTimeout = 300 * time.Second
+
+type Provider struct {
+	apiKey     string
+	apiBase    string
+	keepAlive  string
+	httpClient *http.Client
+	// streamIdleTimeout aborts a stream that sends nothing for this long
+	streamIdleTimeout time.Duration
+}
+
+// NewProvider creates a provider for the server at apiBase. A trailing /v1
+// (the OpenAI-compatible endpoint) is ignored, so existing configs keep
+// working. keepAlive is passed through to Ollama as-is, e.g. "10m" or "-1".
+func NewProvider(apiKey, apiBase, proxy, keepAlive string) *Provider {
+	client := &http.Client{
+		Timeout: 300 * time.Second, // local models can take a while to load
+	}
+
+	if proxy != "" {
+		parsed, err := url.Parse(proxy)
+		if err == nil {
+			client.Transport = &http.Transport{
+				Proxy: http.ProxyURL(parsed),
+			}
+		} else {
+			log.Printf("ollama: invalid proxy URL %q: %v", proxy, err)
+		}
+	}
+
+	return &Provider{
+		apiKey:     apiKey,
+		apiBase:    NormalizeAPIBase(apiBase),
+		keepAlive:  keepAlive,
+		httpClient: client,
+
+		streamIdleTimeout: defaultStreamIdleTimeout,
+	}
+}
+
+// NormalizeAPIBase returns the native API root for a configured base URL.
+func NormalizeAPIBase(apiBase string) string {
+	apiBase = strings.TrimRight(strings.TrimSpace(apiBase), "/")
+	if apiBase == "" {
+		return DefaultAPIBase
+	}
+	return strings.TrimSuffix(apiBase, "/v1")
+}
+
+func (p *Provider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	requestBody := p.buildRequestBody(messages, tools, model, options)
+	requestBody["stream"] = false
+
+	resp, err := p.do(ctx, p.httpClient, http.MethodPost, "/api/chat", requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chunk chatChunk
+	if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if chunk.Error != "" {
+		return nil, fmt.Errorf("API request failed: %s", chunk.Error)
+	}
+
+	toolCalls := make([]ToolCall, 0, len(chunk.Message.ToolCalls))
+	for i, tc := range chunk.Message.ToolCalls {
+		toolCalls = append(toolCalls, buildToolCall(i, tc))
+	}
+	return &LLMResponse{
+		Content:      chunk.Message.Content,
+		ToolCalls:    toolCalls,
+		FinishReason: finishReason(chunk.DoneReason, len(toolCalls) > 0),
+		Usage:        chunk.usage(),
+		Reasoning:    chunk.Message.Thinking,
+	}, nil
+}
+
+// ChatStream is like Chat but streams the response, calling onDelta for
+// every content fragment and tool call as it arrives.
+func (p *Provider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(StreamDelta),
+) (*LLMResponse, error) {
+	requestBody := p.buildRequestBody(messages, tools, model, options)
+	requestBody["stream"] = true
+
+	ctx, watchdog := protocoltypes.WatchStream(ctx, p.streamIdleTimeout)
+	defer watchdog.Stop()
+
+	resp, err := p.do(ctx, protocoltypes.StreamClient(p.httpClient), http.MethodPost, "/api/chat", requestBody)
+	if err != nil {
+		return nil, watchdog.StartErr(err)
+	}
+	defer resp.Body.Close()
+
+	out, err := parseStream(watchdog.Reader(resp.Body), onDelta)
+	return out, watchdog.ReadErr(err)
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return ""
+}
+
+type wireToolCall struct {
+	Function struct {
+		Index     int            `json:"index,omitempty"`
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type wireMessage struct {
+	Role      string         `json:"role"`
+	Content   string         `json:"content"`
+	Images    []string       `json:"images,omitempty"`
+	ToolCalls []wireToolCall `json:"tool_calls,omitempty"`
+	ToolName  string         `json:"tool_name,omitempty"`
+}
+
+type chatChunk struct {
+	Message struct {
+		Content   string         `json:"content"`
+		Thinking  string         `json:"thinking"`
+		ToolCalls []wireToolCall `json:"tool_calls"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+func (c *chatChunk) usage() *UsageInfo {
+	if !c.Done {
+		return nil
+	}
+	return &UsageInfo{
+		PromptTokens:     c.PromptEvalCount,
+		CompletionTokens: c.EvalCount,
+		TotalTokens:      c.PromptEvalCount + c.EvalCount,
+	}
+}
+
+func (p *Provider) buildRequestBody(
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) map[string]any {
+	requestBody := map[string]any{
+		"model":    strings.TrimPrefix(model, "ollama/"),
+		"messages": serializeMessages(messages),
+	}
+	if len(tools) > 0 {
+		requestBody["tools"] = tools
+	}
+	if p.keepAlive != "" {
+		requestBody["keep_alive"] = p.keepAlive
+	}
+
+	modelOptions := map[string]any{}
+	if maxTokens, ok := asInt(options["max_tokens"]); ok {
+		modelOptions["num_predict"] = maxTokens
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		modelOptions["temperature"] = temperature
+	}
+	if contextWindow, ok := asInt(options["context_window"]); ok && contextWindow > 0 {
+		modelOptions["num_ctx"] = contextWindow
+	}
+	if len(modelOptions) > 0 {
+		requestBody["options"] = modelOptions
+	}
+	if rf := protocoltypes.ResponseFormatFrom(options); rf != nil {
+		if rf.Type == protocoltypes.ResponseFormatJSONSchema && rf.Schema != nil {
+			requestBody["format"] = rf.Schema
+		} else {
+			requestBody["format"] = "json"
+		}
+	}
+	// gpt-oss takes an effort level; other thinking models only on or off
+	if effort := protocoltypes.ReasoningEffort(options); effort != "" && strings.Contains(model, "gpt-oss") {
+		requestBody["think"] = effort
+	} else if protocoltypes.ReasoningBudget(options) > 0 {
+		requestBody["think"] = true
+	}
+	return requestBody
+}
+
+// serializeMessages converts messages to the /api/chat format. Images travel
+// as raw base64 in "images"; tool results are matched to the name of the call
+// they answer, since Ollama has no call IDs.
+func serializeMessages(messages []Message) []wireMessage {
+	toolNames := make(map[string]string)
+	out := make([]wireMessage, 0, len(messages))
+	for _, msg := range messages {
+		wire := wireMessage{Role: msg.Role, Content: msg.Content}
+		for _, att := range msg.Attachments {
+			if strings.HasPrefix(att.MimeType, "image/") {
+				wire.Images = append(wire.Images, att.Data)
+			}
+		}
+		for _, tc := range msg.ToolCalls {
+			var call wireToolCall
+			call.Function.Name, call.Function.Arguments = toolCallNameAndArguments(tc)
+			toolNames[tc.ID] = call.Function.Name
+			wire.ToolCalls = append(wire.ToolCalls, call)
+		}
+		if msg.Role == "tool" {
+			wire.ToolName = toolNames[msg.ToolCallID]
+		}
+		out = append(out, wire)
+	}
+	return out
+}
+
+func toolCallNameAndArguments(tc ToolCall) (string, map[string]any) {
+	name, arguments := tc.Name, tc.Arguments
+	if tc.Function != nil {
+		if name == "" {
+			name = tc.Function.Name
+		}
+		if arguments == nil && tc.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(tc.Function.Arguments), &arguments); err != nil {
+				arguments = map[string]any{"raw": tc.Function.Arguments}
+			}
+		}
+	}
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+	return name, arguments
+}
+
+// buildToolCall converts a returned tool call, giving it the ID Ollama omits.
+func buildToolCall(index int, tc wireToolCall) ToolCall {
+	arguments := tc.Function.Arguments
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+	raw, _ := json.Marshal(arguments)
+	return ToolCall{
+		ID:        fmt.Sprintf("call_%d", index),
+		Type:      "function",
+		Name:      tc.Function.Name,
+		Arguments: arguments,
+		Function: &FunctionCall{
+			Name:      tc.Function.Name,
+			Arguments: string(raw),
+		},
+	}
+}
+
+// parseStream reads an NDJSON /api/chat stream, forwarding deltas to onDelta,
+// and assembles the final response.
+func parseStream(r io.Reader, onDelta func(StreamDelta)) (*LLMResponse, error) {
+	var (
+		content   strings.Builder
+		thinking  strings.Builder
+		toolCalls []ToolCall
+		last      chatChunk
+		done      bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk chatChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("API stream failed: %s", chunk.Error)
+		}
+
+		thinking.WriteString(chunk.Message.Thinking)
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			emit(onDelta, StreamDelta{Content: chunk.Message.Content})
+		}
+		// Ollama sends each tool call whole rather than in fragments.
+		for _, tc := range chunk.Message.ToolCalls {
+			call := buildToolCall(len(toolCalls), tc)
+			toolCalls = append(toolCalls, call)
+			emit(onDelta, StreamDelta{ToolCall: &ToolCallDelta{
+				Index:     len(toolCalls) - 1,
+				ID:        call.ID,
+				Name:      call.Name,
+				Arguments: call.Function.Arguments,
+			}})
+		}
+		if chunk.Done {
+			last = chunk
+			done = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	if !done {
+		return nil, fmt.Errorf("stream ended before the response was done")
+	}
+
+	return &LLMResponse{
+		Content:      content.String(),
+		ToolCalls:    toolCalls,
+		FinishReason: finishReason(last.DoneReason, len(toolCalls) > 0),
+		Usage:        last.usage(),
+		Reasoning:    thinking.String(),
+	}, nil
+}
+
+// finishReason maps Ollama's done_reason to the OpenAI-style values the
+// agent loop expects.
+func finishReason(doneReason string, hasToolCalls bool) string {
+	switch {
+	case hasToolCalls:
+		return "tool_calls"
+	case doneReason == "length":
+		return "length"
+	default:
+		return "stop"
+	}
+}
+
+// do sends a JSON request and returns the response if the status is 200.
+// The caller must close the response body.
+func (p *Provider) do(
+	ctx context.Context,
+	client *http.Client,
+	method, path string,
+	requestBody any,
+) (*http.Response, error) {
+	var body io.Reader
+	if requestBody != nil {
+		jsonData, err := json.Marshal(requestBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.apiBase+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(respBody))
+	}
+
+	return resp, nil
+}
+
+func emit(onDelta func(StreamDelta), delta StreamDelta) {
+	if onDelta != nil {
+		onDelta(delta)
+	}
+}
+
+func asInt(v any) (int, bool) {
+	switch val := v.(type) {
+	case int:
+		return val, true
+	case int64:
+		return int(val), true
+	case float64:
+		return int(val), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,222 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+func TestNormalizeAPIBase(t *testing.T) {
+	tests := map[string]string{
+		"":                           DefaultAPIBase,
+		"http://localhost:11434/v1":  "http://localhost:11434",
+		"http://gpu-box:11434/":      "http://gpu-box:11434",
+		"https://ollama.example.com": "https://ollama.example.com",
+	}
+	for in, want := range tests {
+		if got := NormalizeAPIBase(in); got != want {
+			t.Errorf("NormalizeAPIBase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestProviderChat_NativeRequestAndResponse(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %q, want /api/chat", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"",`+
+			`"tool_calls":[{"function":{"name":"read_file","arguments":{"path":"notes.txt"}}}]},`+
+			`"done":true,"done_reason":"stop","prompt_eval_count":42,"eval_count":7}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("", server.URL+"/v1", "", "10m")
+	messages := []Message{
+		{Role: "user", Content: "what is this?", Attachments: []protocoltypes.Attachment{
+			{MimeType: "image/png", Data: "iVBORw0KGgo="},
+		}},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_0", Name: "list_dir", Arguments: map[string]any{"path": "."}}}},
+		{Role: "tool", ToolCallID: "call_0", Content: "notes.txt"},
+	}
+	resp, err := p.Chat(context.Background(), messages, nil, "llama3.2-vision", map[string]any{
+		"max_tokens":     512,
+		"temperature":    0.2,
+		"context_window": 16384,
+	})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+
+	if body["model"] != "llama3.2-vision" || body["keep_alive"] != "10m" || body["stream"] != false {
+		t.Errorf("request = %v", body)
+	}
+	wantOptions := map[string]any{"num_ctx": 16384.0, "num_predict": 512.0, "temperature": 0.2}
+	if !reflect.DeepEqual(body["options"], wantOptions) {
+		t.Errorf("options = %v, want %v", body["options"], wantOptions)
+	}
+	wire := body["messages"].([]any)
+	if images := wire[0].(map[string]any)["images"]; !reflect.DeepEqual(images, []any{"iVBORw0KGgo="}) {
+		t.Errorf("images = %v", images)
+	}
+	if name := wire[2].(map[string]any)["tool_name"]; name != "list_dir" {
+		t.Errorf("tool result tool_name = %v, want list_dir", name)
+	}
+
+	if resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 {
+		t.Fatalf("response = %+v, want one tool call", resp)
+	}
+	tc := resp.ToolCalls[0]
+	if tc.ID == "" || tc.Name != "read_file" || tc.Arguments["path"] != "notes.txt" ||
+		tc.Function == nil || tc.Function.Arguments != `{"path":"notes.txt"}` {
+		t.Errorf("tool call = %+v", tc)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 42 || resp.Usage.CompletionTokens != 7 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestProviderChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["stream"] != true {
+			t.Errorf("stream = %v, want true", body["stream"])
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hel"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"lo"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":5,"eval_count":2}`)
+	}))
+	defer server.Close()
+
+	var deltas []string
+	resp, err := NewProvider("", server.URL, "", "").ChatStream(context.Background(),
+		[]Message{{Role: "user", Content: "hi"}}, nil, "ollama/llama3", nil,
+		func(d StreamDelta) { deltas = append(deltas, d.Content) })
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if resp.Content != "Hello" || resp.FinishReason != "length" || resp.Usage.TotalTokens != 7 {
+		t.Errorf("response = %+v", resp)
+	}
+	if !reflect.DeepEqual(deltas, []string{"Hel", "lo"}) {
+		t.Errorf("deltas = %q", deltas)
+	}
+}
+
+func TestProviderChatStream_IncompleteStream(t *testing.T) {
+	var stall atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hel"},"done":false}`)
+		w.(http.Flusher).Flush()
+		if stall.Load() {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	p := NewProvider("", server.URL, "", "")
+	p.streamIdleTimeout = 50 * time.Millisecond
+	messages := []Message{{Role: "user", Content: "hi"}}
+
+	_, err := p.ChatStream(t.Context(), messages, nil, "llama3", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "ended before") {
+		t.Errorf("expected a truncated stream error, got %v", err)
+	}
+
+	stall.Store(true)
+	_, err = p.ChatStream(t.Context(), messages, nil, "llama3", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Errorf("expected a stalled stream error, got %v", err)
+	}
+}
+
+func TestProviderListAndPullModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"llama3:latest","size":4661224676,"details":{"parameter_size":"8.0B"}}]}`)
+		case "/api/pull":
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["model"] == "missing" {
+				fmt.Fprintln(w, `{"error":"pull model manifest: file does not exist"}`)
+				return
+			}
+			fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+			fmt.Fprintln(w, `{"status":"pulling abc","digest":"sha256:abc","total":100,"completed":50}`)
+			fmt.Fprintln(w, `{"status":"success"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p := NewProvider("", server.URL, "", "")
+	models, err := p.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error: %v", err)
+	}
+	if len(models) != 1 || models[0].Name != "llama3:latest" || models[0].Details.ParameterSize != "8.0B" {
+		t.Errorf("models = %+v", models)
+	}
+
+	var statuses []string
+	if err := p.PullModel(context.Background(), "qwen2.5", func(pp PullProgress) {
+		statuses = append(statuses, pp.Status)
+	}); err != nil {
+		t.Fatalf("PullModel() error: %v", err)
+	}
+	if len(statuses) != 3 || statuses[2] != "success" {
+		t.Errorf("statuses = %q", statuses)
+	}
+
+	if err := p.PullModel(context.Background(), "missing", nil); err == nil {
+		t.Error("PullModel() of a missing model should fail")
+	}
+}
+
+func TestProviderChat_Thinking(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"4","thinking":"2 plus 2"},"done":true}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("", server.URL, "", "")
+	tests := []struct {
+		model   string
+		options map[string]any
+		want    any
+	}{
+		{"qwen3", map[string]any{protocoltypes.ReasoningEffortOption: "low"}, true},
+		{"gpt-oss:20b", map[string]any{protocoltypes.ReasoningEffortOption: "high"}, "high"},
+		{"qwen3", nil, nil},
+	}
+	for _, tt := range tests {
+		body = nil
+		resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "2+2?"}}, nil, tt.model, tt.options)
+		if err != nil {
+			t.Fatalf("Chat() error: %v", err)
+		}
+		if body["think"] != tt.want {
+			t.Errorf("%s: think = %v, want %v", tt.model, body["think"], tt.want)
+		}
+		if resp.Reasoning != "2 plus 2" {
+			t.Errorf("Reasoning = %q, want %q", resp.Reasoning, "2 plus 2")
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers/ollama"
+)
+
+type (
+	OllamaModel        = ollama.Model
+	OllamaPullProgress = ollama.PullProgress
+)
+
+// OllamaProvider speaks Ollama's native /api/chat and can list and pull the
+// server's models.
+type OllamaProvider struct {
+	delegate *ollama.Provider
+}
+
+func NewOllamaProvider(apiKey, apiBase, proxy, keepAlive string) *OllamaProvider {
+	return &OllamaProvider{
+		delegate: ollama.NewProvider(apiKey, apiBase, proxy, keepAlive),
+	}
+}
+
+func (p *OllamaProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	return p.delegate.Chat(ctx, messages, tools, model, options)
+}
+
+func (p *OllamaProvider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(StreamDelta),
+) (*LLMResponse, error) {
+	return p.delegate.ChatStream(ctx, messages, tools, model, options, onDelta)
+}
+
+func (p *OllamaProvider) GetDefaultModel() string {
+	return p.delegate.GetDefaultModel()
+}
+
+// ListModels returns the models installed on the server.
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]OllamaModel, error) {
+	return p.delegate.ListModels(ctx)
+}
+
+// PullModel downloads a model to the server, reporting progress.
+func (p *OllamaProvider) PullModel(ctx context.Context, name string, onProgress func(OllamaPullProgress)) error {
+	return p.delegate.PullModel(ctx, name, onProgress)
+}
+
+// OllamaServer is an Ollama server referenced by model_list.
+type OllamaServer struct {
+	APIBase  string
+	Provider *OllamaProvider
+}
+
+// OllamaServers returns the distinct Ollama servers used by model_list
+// entries with the ollama protocol, in order of first use.
+func OllamaServers(models []config.ModelConfig) []OllamaServer {
+	var servers []OllamaServer
+	seen := make(map[string]bool)
+	for _, m := range models {
+		if protocol, _ := ExtractProtocol(m.Model); protocol != "ollama" {
+			continue
+		}
+		apiBase := ollama.NormalizeAPIBase(m.APIBase)
+		if seen[apiBase] {
+			continue
+		}
+		seen[apiBase] = true
+		servers = append(servers, OllamaServer{
+			APIBase:  apiBase,
+			Provider: NewOllamaProvider(m.APIKey, m.APIBase, m.Proxy, m.KeepAlive),
+		})
+	}
+	return servers
+}
+
+// ResolveOllamaPull picks the server and model to pull for name. A model_list
+// name pulls that entry's model onto its server; any other name is pulled
+// onto the first Ollama server.
+func ResolveOllamaPull(models []config.ModelConfig, name string) (OllamaServer, string, error) {
+	for _, m := range models {
+		protocol, modelID := ExtractProtocol(m.Model)
+		if protocol == "ollama" && m.ModelName == name {
+			return OllamaServer{
+				APIBase:  ollama.NormalizeAPIBase(m.APIBase),
+				Provider: NewOllamaProvider(m.APIKey, m.APIBase, m.Proxy, m.KeepAlive),
+			}, modelID, nil
+		}
+	}
+	servers := OllamaServers(models)
+	if len(servers) == 0 {
+		return OllamaServer{}, "", fmt.Errorf("no ollama/ models in model_list")
+	}
+	return servers[0], strings.TrimPrefix(name, "ollama/"), nil
+}
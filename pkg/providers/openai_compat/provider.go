@@ -25,6 +25,9 @@ type (
 	ToolFunctionDefinition = protocoltypes.ToolFunctionDefinition
 	ExtraContent           = protocoltypes.ExtraContent
 	GoogleExtra            = protocoltypes.GoogleExtra
+	ResponseFormat         = protocoltypes.ResponseFormat
+	StreamDelta            = protocoltypes.StreamDelta
+	ToolCallDelta          = protocoltypes.ToolCallDelta
 )
 
 type Provider struct {
@@ -32,8 +35,14 @@ type Provider struct {
 	apiBase        string
 	maxTokensField string // Field name for max tokens (e.g., "max_completion_tokens" for o1/glm models)
 	httpClient     *http.Client
+	// streamIdleTimeout aborts a stream that sends nothing for this long
+	streamIdleTimeout time.Duration
 }
 
+// defaultStreamIdleTimeout matches the timeout of non-streaming requests, but
+// applies to the gap between chunks rather than to the whole response.
+const defaultStreamIdleTimeout = 120 * time.Second
+
 func NewProvider(apiKey, apiBase, proxy string) *Provider {
 	return NewProviderWithMaxTokensField(apiKey, apiBase, proxy, "")
 }
@@ -59,6 +68,8 @@ func NewProviderWithMaxTokensField(apiKey, apiBase, proxy, maxTokensField string
 		apiBase:        strings.TrimRight(apiBase, "/"),
 		maxTokensField: maxTokensField,
 		httpClient:     client,
+
+		streamIdleTimeout: defaultStreamIdleTimeout,
 	}
 }
 
@@ -73,11 +84,62 @@ func (p *Provider) Chat(
 		return nil, fmt.Errorf("API base not configured")
 	}
 
+	resp, err := p.post(ctx, p.httpClient, p.buildRequestBody(messages, tools, model, options))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return parseResponse(body)
+}
+
+// ChatStream is like Chat but requests a server-sent event stream and calls
+// onDelta for every content or tool-call fragment as it arrives.
+func (p *Provider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(StreamDelta),
+) (*LLMResponse, error) {
+	if p.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+
+	requestBody := p.buildRequestBody(messages, tools, model, options)
+	requestBody["stream"] = true
+	requestBody["stream_options"] = map[string]any{"include_usage": true}
+
+	ctx, watchdog := protocoltypes.WatchStream(ctx, p.streamIdleTimeout)
+	defer watchdog.Stop()
+
+	resp, err := p.post(ctx, protocoltypes.StreamClient(p.httpClient), requestBody)
+	if err != nil {
+		return nil, watchdog.StartErr(err)
+	}
+	defer resp.Body.Close()
+
+	out, err := parseStream(watchdog.Reader(resp.Body), onDelta)
+	return out, watchdog.ReadErr(err)
+}
+
+func (p *Provider) buildRequestBody(
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) map[string]any {
 	model = normalizeModel(model, p.apiBase)
 
 	requestBody := map[string]any{
 		"model":    model,
-		"messages": messages,
+		"messages": serializeMessages(messages),
 	}
 
 	if len(tools) > 0 {
@@ -111,6 +173,122 @@ func (p *Provider) Chat(
 		}
 	}
 
+	if rf := protocoltypes.ResponseFormatFrom(options); rf != nil {
+		requestBody["response_format"] = responseFormat(rf)
+	}
+
+	// Reasoning models (o-series, gpt-5, Grok, Gemini) take an effort level
+	if effort := protocoltypes.ReasoningEffort(options); effort != "" {
+		requestBody["reasoning_effort"] = effort
+	}
+
+	return requestBody
+}
+
+// responseFormat converts rf to the chat completions response_format field.
+// Schemas are not sent strict, since strict mode rejects common schemas.
+func responseFormat(rf *ResponseFormat) map[string]any {
+	if rf.Type != protocoltypes.ResponseFormatJSONSchema || rf.Schema == nil {
+		return map[string]any{"type": protocoltypes.ResponseFormatJSONObject}
+	}
+	return map[string]any{
+		"type": protocoltypes.ResponseFormatJSONSchema,
+		"json_schema": map[string]any{
+			"name":   rf.SchemaName(),
+			"schema": rf.Schema,
+		},
+	}
+}
+
+// serializeMessages converts messages to the chat completions wire format.
+// Messages with image attachments carry their content as an array of text and
+// image_url parts; other attachment types have no equivalent and are dropped.
+func serializeMessages(messages []Message) []any {
+	out := make([]any, 0, len(messages))
+	for _, msg := range messages {
+		// Signed thinking blocks and cache breakpoints belong to Anthropic
+		// and are rejected here
+		msg.Thinking = nil
+		msg.SystemParts = nil
+		if !hasImages(msg.Attachments) {
+			// Plain string content keeps text-only backends working
+			msg.Attachments = nil
+			out = append(out, msg)
+			continue
+		}
+
+		parts := make([]map[string]any, 0, len(msg.Attachments)+1)
+		if msg.Content != "" {
+			parts = append(parts, map[string]any{"type": "text", "text": msg.Content})
+		}
+		for _, att := range msg.Attachments {
+			if !strings.HasPrefix(att.MimeType, "image/") {
+				continue
+			}
+			parts = append(parts, map[string]any{
+				"type": "image_url",
+				"image_url": map[string]any{
+					"url": "data:" + att.MimeType + ";base64," + att.Data,
+				},
+			})
+		}
+
+		wire := map[string]any{
+			"role":    msg.Role,
+			"content": parts,
+		}
+		if len(msg.ToolCalls) > 0 {
+			wire["tool_calls"] = msg.ToolCalls
+		}
+		if msg.ToolCallID != "" {
+			wire["tool_call_id"] = msg.ToolCallID
+		}
+		out = append(out, wire)
+	}
+	return out
+}
+
+func hasImages(attachments []protocoltypes.Attachment) bool {
+	for _, att := range attachments {
+		if strings.HasPrefix(att.MimeType, "image/") {
+			return true
+		}
+	}
+	return false
+}
+
+// wireUsage is the usage object of a chat completions response. Prompt cache
+// hits are reported in prompt_tokens_details by OpenAI and as
+// prompt_cache_hit_tokens by DeepSeek.
+type wireUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"`
+}
+
+func (u *wireUsage) usageInfo() *UsageInfo {
+	if u == nil {
+		return nil
+	}
+	info := &UsageInfo{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		CachedTokens:     u.PromptCacheHitTokens,
+	}
+	if u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0 {
+		info.CachedTokens = u.PromptTokensDetails.CachedTokens
+	}
+	return info
+}
+
+// post sends the request body to /chat/completions and returns the response
+// if the status is 200. The caller must close the response body.
+func (p *Provider) post(ctx context.Context, client *http.Client, requestBody map[string]any) (*http.Response, error) {
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -126,30 +304,31 @@ func (p *Provider) Chat(
 		req.Header.Set("Authorization", "Bearer "+p.apiKey)
 	}
 
-	resp, err := p.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
 		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
 	}
 
-	return parseResponse(body)
+	return resp, nil
 }
 
 func parseResponse(body []byte) (*LLMResponse, error) {
 	var apiResponse struct {
 		Choices []struct {
 			Message struct {
-				Content   string `json:"content"`
-				ToolCalls []struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				Reasoning        string `json:"reasoning"`
+				ToolCalls        []struct {
 					ID       string `json:"id"`
 					Type     string `json:"type"`
 					Function *struct {
@@ -165,7 +344,7 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 			} `json:"message"`
 			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
-		Usage *UsageInfo `json:"usage"`
+		Usage *wireUsage `json:"usage"`
 	}
 
 	if err := json.Unmarshal(body, &apiResponse); err != nil {
@@ -182,8 +361,11 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 	choice := apiResponse.Choices[0]
 	toolCalls := make([]ToolCall, 0, len(choice.Message.ToolCalls))
 	for _, tc := range choice.Message.ToolCalls {
-		arguments := make(map[string]any)
-		name := ""
+		name, arguments := "", ""
+		if tc.Function != nil {
+			name = tc.Function.Name
+			arguments = tc.Function.Arguments
+		}
 
 		// Extract thought_signature from Gemini/Google-specific extra content
 		thoughtSignature := ""
@@ -191,43 +373,53 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 			thoughtSignature = tc.ExtraContent.Google.ThoughtSignature
 		}
 
-		if tc.Function != nil {
-			name = tc.Function.Name
-			if tc.Function.Arguments != "" {
-				if err := json.Unmarshal([]byte(tc.Function.Arguments), &arguments); err != nil {
-					log.Printf("openai_compat: failed to decode tool call arguments for %q: %v", name, err)
-					arguments["raw"] = tc.Function.Arguments
-				}
-			}
-		}
-
-		// Build ToolCall with ExtraContent for Gemini 3 thought_signature persistence
-		toolCall := ToolCall{
-			ID:               tc.ID,
-			Name:             name,
-			Arguments:        arguments,
-			ThoughtSignature: thoughtSignature,
-		}
-
-		if thoughtSignature != "" {
-			toolCall.ExtraContent = &ExtraContent{
-				Google: &GoogleExtra{
-					ThoughtSignature: thoughtSignature,
-				},
-			}
-		}
+		toolCalls = append(toolCalls, buildToolCall(tc.ID, name, arguments, thoughtSignature))
+	}
 
-		toolCalls = append(toolCalls, toolCall)
+	// DeepSeek, Qwen and Kimi return reasoning_content, OpenRouter reasoning
+	reasoning := choice.Message.ReasoningContent
+	if reasoning == "" {
+		reasoning = choice.Message.Reasoning
 	}
 
 	return &LLMResponse{
 		Content:      choice.Message.Content,
 		ToolCalls:    toolCalls,
 		FinishReason: choice.FinishReason,
-		Usage:        apiResponse.Usage,
+		Usage:        apiResponse.Usage.usageInfo(),
+		Reasoning:    reasoning,
 	}, nil
 }
 
+// buildToolCall decodes the JSON arguments of a tool call and attaches the
+// Gemini 3 thought_signature for persistence, if present.
+func buildToolCall(id, name, rawArguments, thoughtSignature string) ToolCall {
+	arguments := make(map[string]any)
+	if rawArguments != "" {
+		if err := json.Unmarshal([]byte(rawArguments), &arguments); err != nil {
+			log.Printf("openai_compat: failed to decode tool call arguments for %q: %v", name, err)
+			arguments["raw"] = rawArguments
+		}
+	}
+
+	toolCall := ToolCall{
+		ID:               id,
+		Name:             name,
+		Arguments:        arguments,
+		ThoughtSignature: thoughtSignature,
+	}
+
+	if thoughtSignature != "" {
+		toolCall.ExtraContent = &ExtraContent{
+			Google: &GoogleExtra{
+				ThoughtSignature: thoughtSignature,
+			},
+		}
+	}
+
+	return toolCall
+}
+
 func normalizeModel(model, apiBase string) string {
 	idx := strings.Index(model, "/")
 	if idx == -1 {
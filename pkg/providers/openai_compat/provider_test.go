@@ -2,10 +2,15 @@ package openai_compat
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 func TestProviderChat_UsesMaxCompletionTokensForGLM(t *testing.T) {
@@ -281,3 +286,321 @@ func TestNormalizeModel_UsesAPIBase(t *testing.T) {
 		t.Fatalf("normalizeModel(openrouter) = %q, want %q", got, "openrouter/auto")
 	}
 }
+
+func TestProviderChatStream_AssemblesContentAndToolCalls(t *testing.T) {
+	var requestBody map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"SF\"}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`,
+			`[DONE]`,
+		}
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	var contentDeltas []string
+	var argDeltas []string
+	p := NewProvider("key", server.URL, "")
+	out, err := p.ChatStream(
+		t.Context(),
+		[]Message{{Role: "user", Content: "hi"}},
+		nil,
+		"gpt-4o",
+		nil,
+		func(d StreamDelta) {
+			if d.ToolCall != nil {
+				argDeltas = append(argDeltas, d.ToolCall.Arguments)
+				return
+			}
+			contentDeltas = append(contentDeltas, d.Content)
+		},
+	)
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+
+	if requestBody["stream"] != true {
+		t.Fatalf("expected stream=true in request body, got %v", requestBody["stream"])
+	}
+	if out.Content != "Hello" {
+		t.Fatalf("Content = %q, want %q", out.Content, "Hello")
+	}
+	if strings.Join(contentDeltas, "|") != "Hel|lo" {
+		t.Fatalf("content deltas = %v", contentDeltas)
+	}
+	if len(argDeltas) != 2 {
+		t.Fatalf("expected 2 tool-call deltas, got %d", len(argDeltas))
+	}
+	if len(out.ToolCalls) != 1 {
+		t.Fatalf("len(ToolCalls) = %d, want 1", len(out.ToolCalls))
+	}
+	if out.ToolCalls[0].ID != "call_1" || out.ToolCalls[0].Name != "get_weather" {
+		t.Fatalf("unexpected tool call: %+v", out.ToolCalls[0])
+	}
+	if out.ToolCalls[0].Arguments["city"] != "SF" {
+		t.Fatalf("ToolCalls[0].Arguments[city] = %v, want SF", out.ToolCalls[0].Arguments["city"])
+	}
+	if out.FinishReason != "tool_calls" {
+		t.Fatalf("FinishReason = %q, want tool_calls", out.FinishReason)
+	}
+	if out.Usage == nil || out.Usage.TotalTokens != 10 {
+		t.Fatalf("Usage = %+v, want total 10", out.Usage)
+	}
+}
+
+func TestProviderChatStream_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	_, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil, nil)
+	if err == nil {
+		t.Fatal("expected error for non-200 stream response")
+	}
+	if !strings.Contains(err.Error(), "429") {
+		t.Fatalf("expected status in error, got %v", err)
+	}
+}
+
+func TestProviderChatStream_StreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"par\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"error\":{\"message\":\"overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	_, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("expected mid-stream error, got %v", err)
+	}
+}
+
+func TestProviderChatStream_StalledStreamTimesOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"par\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	p.streamIdleTimeout = 50 * time.Millisecond
+	_, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Fatalf("expected a stalled stream error, got %v", err)
+	}
+}
+
+func TestProviderChat_SendsImageAttachmentsAsContentParts(t *testing.T) {
+	var requestBody struct {
+		Messages []map[string]any `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]any{"content": "a cat"}}},
+		})
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	_, err := p.Chat(t.Context(), []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "what is this?", Attachments: []protocoltypes.Attachment{
+			{MimeType: "image/png", Data: "aGVsbG8="},
+			{MimeType: "audio/ogg", Data: "b2dn"},
+		}},
+		{Role: "user", Content: "and this?", Attachments: []protocoltypes.Attachment{
+			{MimeType: "audio/ogg", Data: "b2dn"},
+		}},
+	}, nil, "gpt-4o", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if len(requestBody.Messages) != 3 {
+		t.Fatalf("messages = %v", requestBody.Messages)
+	}
+	if content, ok := requestBody.Messages[0]["content"].(string); !ok || content != "be brief" {
+		t.Errorf("plain message content = %v, want a string", requestBody.Messages[0]["content"])
+	}
+	user := requestBody.Messages[1]
+	if _, ok := user["attachments"]; ok {
+		t.Error("raw attachments field should not be sent")
+	}
+	parts, ok := user["content"].([]any)
+	if !ok || len(parts) != 2 {
+		t.Fatalf("content = %v, want text and one image part", user["content"])
+	}
+	text := parts[0].(map[string]any)
+	if text["type"] != "text" || text["text"] != "what is this?" {
+		t.Errorf("text part = %v", text)
+	}
+	img := parts[1].(map[string]any)
+	imageURL, _ := img["image_url"].(map[string]any)
+	if img["type"] != "image_url" || imageURL["url"] != "data:image/png;base64,aGVsbG8=" {
+		t.Errorf("image part = %v", img)
+	}
+
+	audioOnly := requestBody.Messages[2]
+	if content, ok := audioOnly["content"].(string); !ok || content != "and this?" {
+		t.Errorf("content without images = %v, want a string", audioOnly["content"])
+	}
+	if _, ok := audioOnly["attachments"]; ok {
+		t.Error("raw attachments field should not be sent")
+	}
+}
+
+func TestProviderChat_SendsResponseFormat(t *testing.T) {
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"{\"ok\":true}"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	schema := map[string]any{"type": "object", "properties": map[string]any{"ok": map[string]any{"type": "boolean"}}}
+	tests := []struct {
+		format *ResponseFormat
+		want   string
+	}{
+		{&ResponseFormat{Type: protocoltypes.ResponseFormatJSONObject}, `{"type":"json_object"}`},
+		{
+			&ResponseFormat{Type: protocoltypes.ResponseFormatJSONSchema, Name: "status", Schema: schema},
+			`{"json_schema":{"name":"status","schema":{"properties":{"ok":{"type":"boolean"}},"type":"object"}},"type":"json_schema"}`,
+		},
+	}
+	for _, tt := range tests {
+		_, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o",
+			map[string]any{protocoltypes.ResponseFormatOption: tt.format})
+		if err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+		got, _ := json.Marshal(requestBody["response_format"])
+		if string(got) != tt.want {
+			t.Errorf("response_format = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestProviderChat_ReasoningEffortAndContent(t *testing.T) {
+	var requestBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"42","reasoning_content":"6 times 7"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	messages := []Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello", Thinking: []protocoltypes.ThinkingBlock{{Thinking: "x", Signature: "s"}}},
+		{Role: "user", Content: "what is 6*7?"},
+	}
+	out, err := p.Chat(t.Context(), messages, nil, "o3",
+		map[string]any{protocoltypes.ReasoningEffortOption: "low"})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if requestBody["reasoning_effort"] != "low" {
+		t.Errorf("reasoning_effort = %v, want low", requestBody["reasoning_effort"])
+	}
+	sent := requestBody["messages"].([]any)[1].(map[string]any)
+	if _, ok := sent["thinking"]; ok {
+		t.Errorf("assistant message sent with thinking blocks: %v", sent)
+	}
+	if out.Reasoning != "6 times 7" {
+		t.Errorf("Reasoning = %q, want %q", out.Reasoning, "6 times 7")
+	}
+}
+
+func TestProviderChatStream_AccumulatesReasoning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"choices":[{"index":0,"delta":{"reasoning_content":"6 times "}}]}`,
+			`{"choices":[{"index":0,"delta":{"reasoning_content":"7"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"42"},"finish_reason":"stop"}]}`,
+			`[DONE]`,
+		}
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	var contentDeltas []string
+	p := NewProvider("key", server.URL, "")
+	out, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "o3", nil,
+		func(d StreamDelta) { contentDeltas = append(contentDeltas, d.Content) })
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if out.Reasoning != "6 times 7" || out.Content != "42" {
+		t.Errorf("response = %+v, want reasoning %q and content %q", out, "6 times 7", "42")
+	}
+	if len(contentDeltas) != 1 {
+		t.Errorf("content deltas = %q, reasoning must not be streamed as content", contentDeltas)
+	}
+}
+
+func TestProviderChat_ReportsCachedTokens(t *testing.T) {
+	var requestBody map[string]any
+	usage := `{"prompt_tokens":2000,"completion_tokens":5,"total_tokens":2005,"prompt_tokens_details":{"cached_tokens":1536}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		fmt.Fprintf(w, `{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}],"usage":%s}`, usage)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	messages := []Message{
+		{Role: "system", Content: "stable", SystemParts: []protocoltypes.ContentBlock{
+			{Type: "text", Text: "stable", CacheControl: &protocoltypes.CacheControl{Type: "ephemeral"}},
+		}},
+		{Role: "user", Content: "hi"},
+	}
+	out, err := p.Chat(t.Context(), messages, nil, "gpt-4o", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if out.Usage == nil || out.Usage.CachedTokens != 1536 || out.Usage.PromptTokens != 2000 {
+		t.Errorf("Usage = %+v, want 1536 cached of 2000", out.Usage)
+	}
+	if _, ok := requestBody["messages"].([]any)[0].(map[string]any)["system_parts"]; ok {
+		t.Error("system_parts must not be sent to OpenAI-compatible APIs")
+	}
+
+	// DeepSeek reports cache hits at the top level
+	usage = `{"prompt_tokens":900,"completion_tokens":5,"total_tokens":905,"prompt_cache_hit_tokens":768}`
+	out, err = p.Chat(t.Context(), messages, nil, "deepseek-chat", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if out.Usage.CachedTokens != 768 {
+		t.Errorf("CachedTokens = %d, want 768", out.Usage.CachedTokens)
+	}
+}
@@ -0,0 +1,157 @@
+package openai_compat
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxStreamLineSize bounds a single SSE line; tool-call argument chunks can
+// be large when models emit whole files in one event.
+const maxStreamLineSize = 1024 * 1024
+
+type streamToolCall struct {
+	id               string
+	name             string
+	arguments        strings.Builder
+	thoughtSignature string
+}
+
+// parseStream reads an OpenAI-style server-sent event stream, forwarding
+// deltas to onDelta, and assembles the final response.
+func parseStream(r io.Reader, onDelta func(StreamDelta)) (*LLMResponse, error) {
+	var (
+		content      strings.Builder
+		reasoning    strings.Builder
+		toolCalls    []*streamToolCall
+		finishReason string
+		usage        *UsageInfo
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Index int `json:"index"`
+				Delta struct {
+					Content          string `json:"content"`
+					ReasoningContent string `json:"reasoning_content"`
+					Reasoning        string `json:"reasoning"`
+					ToolCalls        []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function *struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+						ExtraContent *struct {
+							Google *struct {
+								ThoughtSignature string `json:"thought_signature"`
+							} `json:"google"`
+						} `json:"extra_content"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *wireUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("API stream failed: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.usageInfo()
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				finishReason = *choice.FinishReason
+			}
+
+			reasoning.WriteString(choice.Delta.ReasoningContent)
+			reasoning.WriteString(choice.Delta.Reasoning)
+
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				emit(onDelta, StreamDelta{Content: choice.Delta.Content})
+			}
+
+			for _, tc := range choice.Delta.ToolCalls {
+				for len(toolCalls) <= tc.Index {
+					toolCalls = append(toolCalls, &streamToolCall{})
+				}
+				acc := toolCalls[tc.Index]
+				delta := ToolCallDelta{Index: tc.Index, ID: tc.ID}
+				if tc.ID != "" {
+					acc.id = tc.ID
+				}
+				if tc.Function != nil {
+					if tc.Function.Name != "" {
+						acc.name = tc.Function.Name
+						delta.Name = tc.Function.Name
+					}
+					acc.arguments.WriteString(tc.Function.Arguments)
+					delta.Arguments = tc.Function.Arguments
+				}
+				if tc.ExtraContent != nil && tc.ExtraContent.Google != nil &&
+					tc.ExtraContent.Google.ThoughtSignature != "" {
+					acc.thoughtSignature = tc.ExtraContent.Google.ThoughtSignature
+				}
+				emit(onDelta, StreamDelta{ToolCall: &delta})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	calls := make([]ToolCall, 0, len(toolCalls))
+	for _, tc := range toolCalls {
+		if tc.id == "" && tc.name == "" {
+			continue
+		}
+		calls = append(calls, buildToolCall(tc.id, tc.name, tc.arguments.String(), tc.thoughtSignature))
+	}
+
+	if finishReason == "" {
+		finishReason = "stop"
+		if len(calls) > 0 {
+			finishReason = "tool_calls"
+		}
+	}
+
+	return &LLMResponse{
+		Content:      content.String(),
+		ToolCalls:    calls,
+		FinishReason: finishReason,
+		Usage:        usage,
+		Reasoning:    reasoning.String(),
+	}, nil
+}
+
+func emit(onDelta func(StreamDelta), delta StreamDelta) {
+	if onDelta != nil {
+		onDelta(delta)
+	}
+}
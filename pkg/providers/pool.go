@@ -0,0 +1,139 @@
+package providers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ProviderPool serves fallback candidates from model_list entries. Each
+// entry gets its own provider, so a candidate is sent with its own protocol,
+// credentials, API base and proxy rather than through the agent's default
+// provider.
+type ProviderPool struct {
+	cfg *config.Config
+
+	mu        sync.Mutex
+	providers map[string]LLMProvider // by poolKey
+}
+
+// NewProviderPool creates a pool over cfg's model_list. A nil cfg yields an
+// empty pool that resolves every name with ParseModelRef.
+func NewProviderPool(cfg *config.Config) *ProviderPool {
+	return &ProviderPool{
+		cfg:       cfg,
+		providers: make(map[string]LLMProvider),
+	}
+}
+
+// ResolveCandidates is like the package-level ResolveCandidates, but names
+// found in model_list resolve to their entries. A name with several entries
+// (load balancing) yields one candidate per entry, so a key in cooldown
+// falls through to the next one.
+func (p *ProviderPool) ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandidate {
+	seen := make(map[string]bool)
+	var candidates []FallbackCandidate
+	for _, name := range append([]string{cfg.Primary}, cfg.Fallbacks...) {
+		for _, c := range p.candidates(name, defaultProvider) {
+			id := poolKey(c)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+// Provider returns the provider for a candidate resolved from model_list.
+// It reports false for candidates that were not, which the caller serves
+// with its default provider.
+func (p *ProviderPool) Provider(c FallbackCandidate) (LLMProvider, bool) {
+	if c.Key == "" {
+		return nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	provider, ok := p.providers[poolKey(c)]
+	return provider, ok
+}
+
+func (p *ProviderPool) candidates(name, defaultProvider string) []FallbackCandidate {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil
+	}
+
+	var entries []config.ModelConfig
+	if p.cfg != nil {
+		for _, m := range p.cfg.ModelList {
+			if m.ModelName == name {
+				entries = append(entries, m)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		ref := ParseModelRef(name, defaultProvider)
+		if ref == nil {
+			return nil
+		}
+		return []FallbackCandidate{{Provider: ref.Provider, Model: ref.Model}}
+	}
+
+	var candidates []FallbackCandidate
+	for _, m := range entries {
+		c, err := p.add(m)
+		if err != nil {
+			logger.WarnCF("providers", "Skipping model_list entry", map[string]any{
+				"model_name": m.ModelName,
+				"model":      m.Model,
+				"error":      err.Error(),
+			})
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// add creates the provider for a model_list entry unless the pool has it.
+func (p *ProviderPool) add(m config.ModelConfig) (FallbackCandidate, error) {
+	protocol, modelID := ExtractProtocol(m.Model)
+	c := FallbackCandidate{
+		Provider: NormalizeProvider(protocol),
+		Model:    modelID,
+		Key:      credentialKey(protocol, m),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.providers[poolKey(c)]; ok {
+		return c, nil
+	}
+	if m.Workspace == "" && p.cfg != nil {
+		m.Workspace = p.cfg.WorkspacePath()
+	}
+	provider, _, err := CreateProviderFromConfig(&m)
+	if err != nil {
+		return FallbackCandidate{}, err
+	}
+	p.providers[poolKey(c)] = provider
+	return c, nil
+}
+
+// credentialKey identifies the endpoint and credentials of an entry without
+// revealing them. Cooldowns are tracked per credential key, since rate
+// limits and billing apply per API key rather than per provider name.
+func credentialKey(protocol string, m config.ModelConfig) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{m.APIBase, m.APIKey, m.AuthMethod, m.Proxy}, "\x00")))
+	return NormalizeProvider(protocol) + "#" + hex.EncodeToString(sum[:4])
+}
+
+func poolKey(c FallbackCandidate) string {
+	return c.Key + "|" + ModelKey(c.Provider, c.Model)
+}
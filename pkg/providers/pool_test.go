@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestProviderPool_ResolvesModelListEntries(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.ModelList = []config.ModelConfig{
+		{ModelName: "gpt", Model: "openai/gpt-4o", APIKey: "sk-a", APIBase: "https://a.example.com/v1"},
+		{ModelName: "gpt", Model: "openai/gpt-4o", APIKey: "sk-b", APIBase: "https://b.example.com/v1"},
+		{ModelName: "claude", Model: "anthropic/claude-sonnet-4.6", APIKey: "sk-ant"},
+		{ModelName: "broken", Model: "openai/gpt-4o"},
+	}
+	pool := NewProviderPool(cfg)
+
+	candidates := pool.ResolveCandidates(ModelConfig{
+		Primary:   "gpt",
+		Fallbacks: []string{"claude", "broken", "deepseek/deepseek-chat", "gpt"},
+	}, "")
+
+	if len(candidates) != 4 {
+		t.Fatalf("candidates = %+v, want both gpt entries, claude and deepseek", candidates)
+	}
+	gptA, gptB, claude, deepseek := candidates[0], candidates[1], candidates[2], candidates[3]
+
+	if gptA.Provider != "openai" || gptA.Model != "gpt-4o" || gptA.Key == "" {
+		t.Errorf("first candidate = %+v", gptA)
+	}
+	if gptA.Key == gptB.Key {
+		t.Error("entries with different API keys should have different credential keys")
+	}
+	if claude.Provider != "anthropic" || claude.Model != "claude-sonnet-4.6" {
+		t.Errorf("claude candidate = %+v", claude)
+	}
+	if deepseek.Key != "" || deepseek.Provider != "deepseek" {
+		t.Errorf("unlisted candidate = %+v, want a plain model reference", deepseek)
+	}
+
+	pa, ok := pool.Provider(gptA)
+	if !ok {
+		t.Fatal("no provider for the first gpt entry")
+	}
+	pb, _ := pool.Provider(gptB)
+	if pa == pb {
+		t.Error("each model_list entry should get its own provider")
+	}
+	if p, _ := pool.Provider(claude); p == nil {
+		t.Error("no provider for claude")
+	} else if _, ok := p.(*HTTPProvider); !ok {
+		t.Errorf("claude provider = %T", p)
+	}
+	if _, ok := pool.Provider(deepseek); ok {
+		t.Error("unlisted candidates should fall back to the caller's provider")
+	}
+
+	// Resolving again reuses the same providers.
+	again := pool.ResolveCandidates(ModelConfig{Primary: "gpt"}, "")
+	if p, _ := pool.Provider(again[0]); p != pa {
+		t.Error("pool should cache providers per entry")
+	}
+}
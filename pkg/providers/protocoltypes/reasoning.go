@@ -0,0 +1,47 @@
+package protocoltypes
+
+// Options keys for reasoning controls. Effort is "low", "medium" or "high";
+// the budget is a number of thinking tokens.
+const (
+	ReasoningEffortOption = "reasoning_effort"
+	ReasoningBudgetOption = "reasoning_budget"
+)
+
+// ThinkingBlock is a piece of model reasoning signed by the provider.
+// Anthropic requires the blocks of an assistant turn to be sent back along
+// with the tool results that turn asked for.
+type ThinkingBlock struct {
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Redacted  string `json:"redacted,omitempty"` // encrypted data of a redacted block
+}
+
+// ReasoningEffort returns the reasoning effort set in options, or "".
+func ReasoningEffort(options map[string]any) string {
+	effort, _ := options[ReasoningEffortOption].(string)
+	return effort
+}
+
+// ReasoningBudget returns the thinking token budget for options: the budget
+// when set, otherwise one derived from the effort, or 0 when neither is set.
+func ReasoningBudget(options map[string]any) int {
+	switch budget := options[ReasoningBudgetOption].(type) {
+	case int:
+		if budget > 0 {
+			return budget
+		}
+	case float64:
+		if budget > 0 {
+			return int(budget)
+		}
+	}
+	switch ReasoningEffort(options) {
+	case "low":
+		return 1024
+	case "medium":
+		return 4096
+	case "high":
+		return 16384
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package protocoltypes
+
+import "encoding/json"
+
+// Response format types.
+const (
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormatOption is the options key a ResponseFormat is passed under.
+const ResponseFormatOption = "response_format"
+
+// StructuredOutputTool is the tool a response is forced through on providers
+// without a native JSON mode; its arguments are the structured answer.
+const StructuredOutputTool = "structured_output"
+
+// ResponseFormat asks for a machine-readable reply: any JSON object, or JSON
+// matching Schema.
+type ResponseFormat struct {
+	Type   string         `json:"type"`
+	Name   string         `json:"name,omitempty"`
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+// ResponseFormatFrom returns the response format set in options, or nil.
+func ResponseFormatFrom(options map[string]any) *ResponseFormat {
+	switch rf := options[ResponseFormatOption].(type) {
+	case *ResponseFormat:
+		return rf
+	case ResponseFormat:
+		return &rf
+	default:
+		return nil
+	}
+}
+
+// SchemaName returns the name to give the schema in provider requests.
+func (rf *ResponseFormat) SchemaName() string {
+	if rf.Name != "" {
+		return rf.Name
+	}
+	return "response"
+}
+
+// ObjectSchema returns the schema the reply must match, which for a plain
+// JSON object is any object.
+func (rf *ResponseFormat) ObjectSchema() map[string]any {
+	if rf.Type == ResponseFormatJSONSchema && rf.Schema != nil {
+		return rf.Schema
+	}
+	return map[string]any{"type": "object"}
+}
+
+// ToolSchema returns the input schema of the structured output tool. Tool
+// input must be an object, so other schemas are wrapped in a "value" field.
+func (rf *ResponseFormat) ToolSchema() map[string]any {
+	schema := rf.ObjectSchema()
+	if schema["type"] == "object" {
+		return schema
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"value": schema},
+		"required":   []any{"value"},
+	}
+}
+
+// ApplyToolAnswer turns a call of the structured output tool into the
+// response content. The answer is final, so other tool calls are dropped.
+func (rf *ResponseFormat) ApplyToolAnswer(resp *LLMResponse) *LLMResponse {
+	for _, tc := range resp.ToolCalls {
+		if tc.Name != StructuredOutputTool {
+			continue
+		}
+		var answer any = tc.Arguments
+		if rf.ObjectSchema()["type"] != "object" {
+			answer = tc.Arguments["value"]
+		}
+		content, _ := json.Marshal(answer)
+		resp.Content = string(content)
+		resp.ToolCalls = nil
+		resp.FinishReason = "stop"
+		break
+	}
+	return resp
+}
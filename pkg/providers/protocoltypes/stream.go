@@ -0,0 +1,89 @@
+package protocoltypes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// StreamClient returns a copy of client for streaming requests. The client
+// timeout covers reading the whole body, which would cut off long
+// generations, so it is dropped; a StreamWatchdog aborts stalled streams
+// instead.
+func StreamClient(client *http.Client) *http.Client {
+	c := *client
+	c.Timeout = 0
+	return &c
+}
+
+// StreamWatchdog cancels a streaming request once it has been silent for its
+// timeout, and turns the resulting cancellation into an error that says so.
+type StreamWatchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	stalled atomic.Bool
+}
+
+// WatchStream returns a context for a streaming request that is canceled
+// when the watchdog fires. Call Touch whenever data arrives, and Stop when
+// the request is done.
+func WatchStream(ctx context.Context, timeout time.Duration) (context.Context, *StreamWatchdog) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &StreamWatchdog{timeout: timeout, cancel: cancel}
+	w.timer = time.AfterFunc(timeout, func() {
+		w.stalled.Store(true)
+		cancel()
+	})
+	return ctx, w
+}
+
+// Touch restarts the idle timeout.
+func (w *StreamWatchdog) Touch() {
+	w.timer.Reset(w.timeout)
+}
+
+// Stop releases the watchdog and its context.
+func (w *StreamWatchdog) Stop() {
+	w.timer.Stop()
+	w.cancel()
+}
+
+// Reader wraps r so every read that returns data calls Touch.
+func (w *StreamWatchdog) Reader(r io.Reader) io.Reader {
+	return &idleReader{r: r, w: w}
+}
+
+// StartErr replaces err with a timeout error if the watchdog fired before
+// the response arrived.
+func (w *StreamWatchdog) StartErr(err error) error {
+	if err != nil && w.stalled.Load() {
+		return fmt.Errorf("no response within %s", w.timeout)
+	}
+	return err
+}
+
+// ReadErr replaces err with a stall error if the watchdog fired while the
+// response was being read.
+func (w *StreamWatchdog) ReadErr(err error) error {
+	if err != nil && w.stalled.Load() {
+		return fmt.Errorf("stream stalled: no data for %s", w.timeout)
+	}
+	return err
+}
+
+type idleReader struct {
+	r io.Reader
+	w *StreamWatchdog
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.w.Touch()
+	}
+	return n, err
+}
@@ -34,20 +34,57 @@ type LLMResponse struct {
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	FinishReason string     `json:"finish_reason"`
 	Usage        *UsageInfo `json:"usage,omitempty"`
+	// Reasoning is the model's reasoning text or summary, if it returned one.
+	Reasoning string `json:"reasoning,omitempty"`
+	// Thinking holds signed reasoning blocks to send back on the next call.
+	Thinking []ThinkingBlock `json:"thinking,omitempty"`
 }
 
 type UsageInfo struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	CachedTokens     int `json:"cached_tokens,omitempty"` // prompt tokens read from the prompt cache
+}
+
+// StreamDelta is an incremental piece of a streamed LLM response.
+// Exactly one of Content or ToolCall is set.
+type StreamDelta struct {
+	Content  string         `json:"content,omitempty"`
+	ToolCall *ToolCallDelta `json:"tool_call,omitempty"`
+}
+
+// ToolCallDelta is a fragment of a tool call. Fragments with the same Index
+// belong to the same call; Arguments is a partial JSON string.
+type ToolCallDelta struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
 }
 
 type Message struct {
-	Role       string     `json:"role"`
-	Content     string       `json:"content"`
-	ToolCalls   []ToolCall   `json:"tool_calls,omitempty"`
-	ToolCallID  string       `json:"tool_call_id,omitempty"`
-	Attachments []Attachment `json:"attachments,omitempty"`
+	Role        string          `json:"role"`
+	Content     string          `json:"content"`
+	ToolCalls   []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID  string          `json:"tool_call_id,omitempty"`
+	Attachments []Attachment    `json:"attachments,omitempty"`
+	Thinking    []ThinkingBlock `json:"thinking,omitempty"`     // signed reasoning of an assistant turn
+	SystemParts []ContentBlock  `json:"system_parts,omitempty"` // system prompt split at cache breakpoints
+}
+
+// ContentBlock is one part of a system prompt. The texts of a message's
+// SystemParts, joined, are a prefix of its Content; providers that take a
+// plain string use Content.
+type ContentBlock struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// CacheControl marks the end of a prompt prefix the provider should cache.
+type CacheControl struct {
+	Type string `json:"type"` // "ephemeral"
 }
 
 type ToolDefinition struct {
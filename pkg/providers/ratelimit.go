@@ -0,0 +1,323 @@
+package providers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// rateWindow is the sliding window over which RPM and TPM are counted.
+const rateWindow = time.Minute
+
+// RateLimiter enforces a requests-per-minute and tokens-per-minute budget
+// for one model and API key. Callers wait in arrival order until the budget
+// allows their request; a zero limit disables that check.
+type RateLimiter struct {
+	name   string
+	window time.Duration
+	turn   chan struct{} // held by the caller at the head of the queue
+
+	mu      sync.Mutex
+	rpm     int
+	tpm     int
+	entries []*Reservation
+	waiting int
+	waits   int64
+	waited  time.Duration
+	last    time.Duration
+}
+
+// Reservation is a request admitted by a RateLimiter.
+type Reservation struct {
+	at     time.Time
+	tokens int
+}
+
+// RateLimitStats describes the current state of a rate limiter.
+type RateLimitStats struct {
+	Name      string  `json:"name"`
+	RPM       int     `json:"rpm,omitempty"`
+	TPM       int     `json:"tpm,omitempty"`
+	Requests  int     `json:"requests"` // in the last minute
+	Tokens    int     `json:"tokens"`   // in the last minute
+	Waiting   int     `json:"waiting"`
+	Waits     int64   `json:"waits"` // requests that had to wait
+	WaitTotal float64 `json:"wait_total_seconds"`
+	LastWait  float64 `json:"last_wait_seconds"`
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = make(map[string]*RateLimiter)
+)
+
+// SharedRateLimiter returns the limiter registered under key, creating it if
+// needed, so every provider using the same model and API key draws from one
+// budget. name labels the limiter in logs and status and must not contain
+// secrets. Limits are updated to the latest values on each call.
+func SharedRateLimiter(key, name string, rpm, tpm int) *RateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	l, ok := rateLimiters[key]
+	if !ok {
+		l = NewRateLimiter(name, rpm, tpm)
+		rateLimiters[key] = l
+		return l
+	}
+	l.mu.Lock()
+	l.rpm, l.tpm = rpm, tpm
+	l.mu.Unlock()
+	return l
+}
+
+// RateLimitStatus returns the state of all shared limiters, sorted by name.
+func RateLimitStatus() []RateLimitStats {
+	rateLimitersMu.Lock()
+	limiters := make([]*RateLimiter, 0, len(rateLimiters))
+	for _, l := range rateLimiters {
+		limiters = append(limiters, l)
+	}
+	rateLimitersMu.Unlock()
+
+	stats := make([]RateLimitStats, 0, len(limiters))
+	for _, l := range limiters {
+		stats = append(stats, l.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// NewRateLimiter creates a standalone limiter. Most callers want
+// SharedRateLimiter instead.
+func NewRateLimiter(name string, rpm, tpm int) *RateLimiter {
+	return &RateLimiter{
+		name:   name,
+		window: rateWindow,
+		turn:   make(chan struct{}, 1),
+		rpm:    rpm,
+		tpm:    tpm,
+	}
+}
+
+// Wait blocks until a request estimated to use tokens fits the budget, then
+// reserves it. It returns how long the caller waited, or ctx's error if ctx
+// ended first. The reservation should be corrected with Settle once the
+// actual usage is known.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) (*Reservation, time.Duration, error) {
+	start := time.Now()
+
+	l.mu.Lock()
+	l.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	select {
+	case l.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, time.Since(start), ctx.Err()
+	}
+	defer func() { <-l.turn }()
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		delay := l.delayLocked(now, tokens)
+		if delay <= 0 {
+			entry := &Reservation{at: now, tokens: tokens}
+			l.entries = append(l.entries, entry)
+			waited := now.Sub(start)
+			if waited >= time.Millisecond {
+				l.waits++
+				l.waited += waited
+				l.last = waited
+			}
+			l.mu.Unlock()
+			return entry, waited, nil
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, time.Since(start), ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Settle replaces the estimated token count of a reservation with the
+// actual usage.
+func (l *RateLimiter) Settle(entry *Reservation, tokens int) {
+	if entry == nil || tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	entry.tokens = tokens
+	l.mu.Unlock()
+}
+
+// delayLocked prunes expired entries and returns how long a request of the
+// given size must wait; zero or less means it may go now.
+func (l *RateLimiter) delayLocked(now time.Time, tokens int) time.Duration {
+	cutoff := now.Add(-l.window)
+	i := 0
+	for i < len(l.entries) && !l.entries[i].at.After(cutoff) {
+		i++
+	}
+	l.entries = l.entries[i:]
+
+	var delay time.Duration
+	if l.rpm > 0 && len(l.entries) >= l.rpm {
+		// The oldest requests must leave the window first.
+		delay = l.entries[len(l.entries)-l.rpm].at.Sub(cutoff)
+	}
+	if l.tpm > 0 {
+		used := 0
+		for _, e := range l.entries {
+			used += e.tokens
+		}
+		// A request larger than the whole budget goes once the window is
+		// empty rather than waiting forever.
+		excess := used + min(tokens, l.tpm) - l.tpm
+		for _, e := range l.entries {
+			if excess <= 0 {
+				break
+			}
+			excess -= e.tokens
+			delay = max(delay, e.at.Sub(cutoff))
+		}
+	}
+	return delay
+}
+
+// Stats returns the limiter's current state.
+func (l *RateLimiter) Stats() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.delayLocked(time.Now(), 0)
+	tokens := 0
+	for _, e := range l.entries {
+		tokens += e.tokens
+	}
+	return RateLimitStats{
+		Name:      l.name,
+		RPM:       l.rpm,
+		TPM:       l.tpm,
+		Requests:  len(l.entries),
+		Tokens:    tokens,
+		Waiting:   l.waiting,
+		Waits:     l.waits,
+		WaitTotal: l.waited.Seconds(),
+		LastWait:  l.last.Seconds(),
+	}
+}
+
+// rateLimitedProvider waits for its limiter before every request.
+type rateLimitedProvider struct {
+	LLMProvider
+	limiter *RateLimiter
+}
+
+// rateLimitedStreamingProvider also limits streamed requests.
+type rateLimitedStreamingProvider struct {
+	rateLimitedProvider
+	streaming StreamingProvider
+}
+
+// WithRateLimit wraps provider so each request first waits for limiter. The
+// result implements StreamingProvider if provider does.
+func WithRateLimit(provider LLMProvider, limiter *RateLimiter) LLMProvider {
+	limited := rateLimitedProvider{LLMProvider: provider, limiter: limiter}
+	if sp, ok := provider.(StreamingProvider); ok {
+		return &rateLimitedStreamingProvider{rateLimitedProvider: limited, streaming: sp}
+	}
+	return &limited
+}
+
+func (p *rateLimitedProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	entry, err := p.wait(ctx, messages, tools, model)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.LLMProvider.Chat(ctx, messages, tools, model, options)
+	p.settle(entry, resp)
+	return resp, err
+}
+
+func (p *rateLimitedStreamingProvider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(StreamDelta),
+) (*LLMResponse, error) {
+	entry, err := p.wait(ctx, messages, tools, model)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.streaming.ChatStream(ctx, messages, tools, model, options, onDelta)
+	p.settle(entry, resp)
+	return resp, err
+}
+
+func (p *rateLimitedProvider) wait(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+) (*Reservation, error) {
+	entry, waited, err := p.limiter.Wait(ctx, estimateRequestTokens(messages, tools))
+	if err != nil {
+		return nil, err
+	}
+	if waited >= time.Second {
+		logger.InfoCF("providers", "Rate limit: request delayed", map[string]any{
+			"limiter": p.limiter.name,
+			"model":   model,
+			"waited":  waited.Round(time.Millisecond).String(),
+		})
+	}
+	return entry, nil
+}
+
+func (p *rateLimitedProvider) settle(entry *Reservation, resp *LLMResponse) {
+	if resp != nil && resp.Usage != nil {
+		p.limiter.Settle(entry, resp.Usage.TotalTokens)
+	}
+}
+
+// estimateRequestTokens roughly sizes a request's input at four characters
+// per token. Actual usage replaces it once the response arrives.
+func estimateRequestTokens(messages []Message, tools []ToolDefinition) int {
+	chars := 0
+	for _, m := range messages {
+		chars += len(m.Content)
+		for _, tc := range m.ToolCalls {
+			chars += len(tc.Name)
+			if tc.Function != nil {
+				chars += len(tc.Function.Arguments)
+			}
+		}
+	}
+	for _, t := range tools {
+		chars += len(t.Function.Name) + len(t.Function.Description)
+	}
+	return chars / 4
+}
@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestLimiter(rpm, tpm int, window time.Duration) *RateLimiter {
+	l := NewRateLimiter("test", rpm, tpm)
+	l.window = window
+	return l
+}
+
+func TestRateLimiter_EnforcesRPM(t *testing.T) {
+	l := newTestLimiter(2, 0, 200*time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, _, err := l.Wait(ctx, 0); err != nil {
+			t.Fatalf("Wait() error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("third request admitted after %v, want it to wait for the window", elapsed)
+	}
+
+	stats := l.Stats()
+	if stats.Waits != 1 || stats.LastWait <= 0 {
+		t.Errorf("stats = %+v, want one recorded wait", stats)
+	}
+}
+
+func TestRateLimiter_EnforcesTPMWithActualUsage(t *testing.T) {
+	l := newTestLimiter(0, 1000, 200*time.Millisecond)
+	ctx := context.Background()
+
+	res, _, err := l.Wait(ctx, 100)
+	if err != nil {
+		t.Fatalf("Wait() error: %v", err)
+	}
+	// The response used far more than estimated.
+	l.Settle(res, 950)
+
+	_, waited, err := l.Wait(ctx, 100)
+	if err != nil {
+		t.Fatalf("Wait() error: %v", err)
+	}
+	if waited < 150*time.Millisecond {
+		t.Errorf("waited %v, want the first request to leave the window", waited)
+	}
+
+	// Requests larger than the budget still go through on an empty window.
+	l2 := newTestLimiter(0, 10, time.Hour)
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, _, err := l2.Wait(waitCtx, 5000); err != nil {
+		t.Errorf("oversized request on empty window: %v", err)
+	}
+}
+
+func TestRateLimiter_CancelWhileQueued(t *testing.T) {
+	l := newTestLimiter(1, 0, time.Hour)
+	if _, _, err := l.Wait(context.Background(), 0); err != nil {
+		t.Fatalf("Wait() error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, errs[i] = l.Wait(ctx, 0)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("waiter %d error = %v, want deadline exceeded", i, err)
+		}
+	}
+	if stats := l.Stats(); stats.Waiting != 0 || stats.Requests != 1 {
+		t.Errorf("stats = %+v, want no waiters and one request", stats)
+	}
+}
+
+type countingProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *countingProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return &LLMResponse{Content: "ok", Usage: &UsageInfo{TotalTokens: 42}}, nil
+}
+
+func (p *countingProvider) GetDefaultModel() string { return "counting" }
+
+func TestCreateProviderFromConfig_SharesLimiterPerModelAndKey(t *testing.T) {
+	cfg := &config.ModelConfig{
+		ModelName: "fast",
+		Model:     "groq/llama-3.3-70b",
+		APIKey:    "gsk-shared-test-key",
+		RPM:       30,
+		TPM:       6000,
+	}
+	p1, _, err := CreateProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("CreateProviderFromConfig() error: %v", err)
+	}
+	p2, _, _ := CreateProviderFromConfig(cfg)
+
+	l1 := p1.(*rateLimitedStreamingProvider).limiter
+	l2 := p2.(*rateLimitedStreamingProvider).limiter
+	if l1 != l2 {
+		t.Error("providers for the same model and key should share a limiter")
+	}
+	if l1.name != "groq/llama-3.3-70b (key …-key)" {
+		t.Errorf("limiter name = %q", l1.name)
+	}
+
+	other := *cfg
+	other.APIKey = "gsk-another-test-key"
+	p3, _, _ := CreateProviderFromConfig(&other)
+	if p3.(*rateLimitedStreamingProvider).limiter == l1 {
+		t.Error("a different API key should get its own limiter")
+	}
+
+	unlimited := *cfg
+	unlimited.RPM, unlimited.TPM = 0, 0
+	if p, _, _ := CreateProviderFromConfig(&unlimited); p == nil {
+		t.Fatal("nil provider")
+	} else if _, ok := p.(*HTTPProvider); !ok {
+		t.Errorf("provider without limits = %T, want it unwrapped", p)
+	}
+}
+
+func TestWithRateLimit_SettlesActualUsage(t *testing.T) {
+	inner := &countingProvider{}
+	l := newTestLimiter(10, 0, time.Minute)
+	p := WithRateLimit(inner, l)
+	if _, ok := p.(StreamingProvider); ok {
+		t.Error("wrapper of a non-streaming provider should not stream")
+	}
+
+	if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m", nil); err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if stats := l.Stats(); stats.Requests != 1 || stats.Tokens != 42 {
+		t.Errorf("stats = %+v, want one request using 42 tokens", stats)
+	}
+}
@@ -0,0 +1,354 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+const (
+	ResponseFormatJSONObject = protocoltypes.ResponseFormatJSONObject
+	ResponseFormatJSONSchema = protocoltypes.ResponseFormatJSONSchema
+	ResponseFormatOption     = protocoltypes.ResponseFormatOption
+)
+
+// NewResponseFormat returns the response format for a requested schema. An
+// empty schema asks for any JSON object; nil asks for nothing.
+func NewResponseFormat(schema map[string]any) *ResponseFormat {
+	switch {
+	case schema == nil:
+		return nil
+	case len(schema) == 0:
+		return &ResponseFormat{Type: ResponseFormatJSONObject}
+	default:
+		return &ResponseFormat{Type: ResponseFormatJSONSchema, Schema: schema}
+	}
+}
+
+type responseFormatKey struct{}
+
+// WithResponseFormat asks the agent turn run with ctx for a final answer in
+// format rf. Direct callers such as cron jobs use it.
+func WithResponseFormat(ctx context.Context, rf *ResponseFormat) context.Context {
+	return context.WithValue(ctx, responseFormatKey{}, rf)
+}
+
+// ResponseFormatFromContext returns the response format set on ctx, or nil.
+func ResponseFormatFromContext(ctx context.Context) *ResponseFormat {
+	rf, _ := ctx.Value(responseFormatKey{}).(*ResponseFormat)
+	return rf
+}
+
+// StructuredOutputInstruction tells the model how to shape its final answer.
+// It is added to the system prompt so that providers without a native JSON
+// mode, and OpenAI's json_object mode, which requires it, see the request.
+func StructuredOutputInstruction(rf *ResponseFormat) string {
+	if rf.Type != ResponseFormatJSONSchema || rf.Schema == nil {
+		return "Your final answer must be a single JSON object with no other text."
+	}
+	schema, _ := json.Marshal(rf.Schema)
+	return "Your final answer must be a single JSON value matching this JSON schema, with no other text:\n" +
+		string(schema)
+}
+
+// ValidateStructuredOutput checks a reply against rf and returns it as
+// compact JSON. Markdown code fences around the JSON are tolerated.
+func ValidateStructuredOutput(content string, rf *ResponseFormat) (string, error) {
+	text := strings.TrimSpace(content)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimPrefix(text, "json")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+	if text == "" {
+		return "", fmt.Errorf("reply is empty")
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return "", fmt.Errorf("reply is not valid JSON: %w", err)
+	}
+	if err := validateSchema(value, rf.ObjectSchema(), "$"); err != nil {
+		return "", err
+	}
+
+	compact, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(compact), nil
+}
+
+// EnforceResponseFormat validates a final reply (one without tool calls)
+// against rf. An invalid reply is sent back once with the validation error;
+// if the second reply is also invalid, the error is returned. Valid replies
+// have their content normalized to compact JSON.
+func EnforceResponseFormat(
+	rf *ResponseFormat,
+	messages []Message,
+	resp *LLMResponse,
+	call func(messages []Message) (*LLMResponse, error),
+) (*LLMResponse, error) {
+	if rf == nil || resp == nil || len(resp.ToolCalls) > 0 {
+		return resp, nil
+	}
+
+	content, err := ValidateStructuredOutput(resp.Content, rf)
+	if err == nil {
+		resp.Content = content
+		return resp, nil
+	}
+
+	retry := append(messages[:len(messages):len(messages)],
+		Message{Role: "assistant", Content: resp.Content},
+		Message{Role: "user", Content: fmt.Sprintf(
+			"Your reply does not match the required format: %v. Reply again with only the corrected JSON.", err)},
+	)
+	resp, callErr := call(retry)
+	if callErr != nil {
+		return nil, callErr
+	}
+	if len(resp.ToolCalls) > 0 {
+		return resp, nil
+	}
+	content, err = ValidateStructuredOutput(resp.Content, rf)
+	if err != nil {
+		return nil, fmt.Errorf("structured output invalid after retry: %w", err)
+	}
+	resp.Content = content
+	return resp, nil
+}
+
+// applyStructuredToolAnswer moves a structured answer that a provider forced
+// through the structured output tool into the response content.
+func applyStructuredToolAnswer(resp *LLMResponse, options map[string]any) *LLMResponse {
+	if rf := protocoltypes.ResponseFormatFrom(options); rf != nil {
+		return rf.ApplyToolAnswer(resp)
+	}
+	return resp
+}
+
+// validateSchema checks value against the subset of JSON Schema that tool
+// and response schemas use in practice.
+func validateSchema(value any, schema map[string]any, path string) error {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	if err := checkType(value, schema["type"], path); err != nil {
+		return err
+	}
+	if enum := schemaList(schema["enum"]); enum != nil && !containsJSON(enum, value) {
+		return fmt.Errorf("%s: %s is not one of the allowed values", path, toJSON(value))
+	}
+	if c, ok := schema["const"]; ok && !containsJSON([]any{c}, value) {
+		return fmt.Errorf("%s: must be %s", path, toJSON(c))
+	}
+	if alts, ok := schema["anyOf"].([]any); ok {
+		if err := validateAny(value, alts, path); err != nil {
+			return err
+		}
+	}
+	if alts, ok := schema["oneOf"].([]any); ok {
+		if err := validateAny(value, alts, path); err != nil {
+			return err
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return validateObject(v, schema, path)
+	case []any:
+		if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s: must have at least %v items", path, n)
+		}
+		if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s: must have at most %v items", path, n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := schemaNumber(schema["minLength"]); ok && length < n {
+			return fmt.Errorf("%s: must be at least %v characters", path, n)
+		}
+		if n, ok := schemaNumber(schema["maxLength"]); ok && length > n {
+			return fmt.Errorf("%s: must be at most %v characters", path, n)
+		}
+	case float64:
+		if n, ok := schemaNumber(schema["minimum"]); ok && v < n {
+			return fmt.Errorf("%s: must be >= %v", path, n)
+		}
+		if n, ok := schemaNumber(schema["maximum"]); ok && v > n {
+			return fmt.Errorf("%s: must be <= %v", path, n)
+		}
+	}
+	return nil
+}
+
+func validateObject(obj map[string]any, schema map[string]any, path string) error {
+	properties, _ := schema["properties"].(map[string]any)
+	for _, name := range schemaStrings(schema["required"]) {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", path, name)
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if prop, ok := properties[name].(map[string]any); ok {
+			if err := validateSchema(obj[name], prop, path+"."+name); err != nil {
+				return err
+			}
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				return fmt.Errorf("%s: unexpected property %q", path, name)
+			}
+		case map[string]any:
+			if err := validateSchema(obj[name], extra, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateAny(value any, alternatives []any, path string) error {
+	var firstErr error
+	for _, alt := range alternatives {
+		altSchema, _ := alt.(map[string]any)
+		err := validateSchema(value, altSchema, path)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func checkType(value any, want any, path string) error {
+	types := schemaStrings(want)
+	if s, ok := want.(string); ok {
+		types = []string{s}
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	for _, t := range types {
+		if matchesType(value, t) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(value))
+}
+
+func matchesType(value any, t string) bool {
+	switch v := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case float64:
+		return t == "number" || (t == "integer" && v == math.Trunc(v))
+	case string:
+		return t == "string"
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	}
+	return false
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// schemaStrings reads a list of strings from a decoded or literal schema.
+func schemaStrings(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func schemaList(v any) []any {
+	switch list := v.(type) {
+	case []any:
+		return list
+	case []string:
+		out := make([]any, len(list))
+		for i, item := range list {
+			out[i] = item
+		}
+		return out
+	}
+	return nil
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func containsJSON(list []any, value any) bool {
+	want := toJSON(value)
+	for _, item := range list {
+		if toJSON(item) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func toJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateStructuredOutput(t *testing.T) {
+	schema := &ResponseFormat{Type: ResponseFormatJSONSchema, Schema: map[string]any{
+		"type":                 "object",
+		"required":             []any{"status", "count"},
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"status": map[string]any{"type": "string", "enum": []any{"ok", "failed"}},
+			"count":  map[string]any{"type": "integer", "minimum": 0},
+			"tags":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}}
+
+	tests := []struct {
+		name    string
+		content string
+		rf      *ResponseFormat
+		want    string
+		wantErr string
+	}{
+		{"valid", `{"status": "ok", "count": 3}`, schema, `{"count":3,"status":"ok"}`, ""},
+		{"fenced", "```json\n{\"status\":\"failed\",\"count\":0}\n```", schema, `{"count":0,"status":"failed"}`, ""},
+		{"not json", "All done!", schema, "", "not valid JSON"},
+		{"missing required", `{"status":"ok"}`, schema, "", `missing required property "count"`},
+		{"bad enum", `{"status":"maybe","count":1}`, schema, "", "$.status"},
+		{"not integer", `{"status":"ok","count":1.5}`, schema, "", "expected integer"},
+		{"extra property", `{"status":"ok","count":1,"note":"x"}`, schema, "", `unexpected property "note"`},
+		{"bad item", `{"status":"ok","count":1,"tags":["a",2]}`, schema, "", "$.tags[1]"},
+		{"any object", `{"a":1}`, &ResponseFormat{Type: ResponseFormatJSONObject}, `{"a":1}`, ""},
+		{"object required", `[1,2]`, &ResponseFormat{Type: ResponseFormatJSONObject}, "", "expected object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateStructuredOutput(tt.content, tt.rf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("content = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnforceResponseFormat_RetriesOnceWithValidationError(t *testing.T) {
+	rf := NewResponseFormat(map[string]any{
+		"type":     "object",
+		"required": []any{"answer"},
+	})
+	messages := []Message{{Role: "user", Content: "question"}}
+
+	var retried []Message
+	resp, err := EnforceResponseFormat(rf, messages, &LLMResponse{Content: `{"reply":"42"}`},
+		func(m []Message) (*LLMResponse, error) {
+			retried = m
+			return &LLMResponse{Content: `{"answer": "42"}`}, nil
+		})
+	if err != nil {
+		t.Fatalf("EnforceResponseFormat() error: %v", err)
+	}
+	if resp.Content != `{"answer":"42"}` {
+		t.Errorf("content = %s", resp.Content)
+	}
+	if len(retried) != 3 || retried[1].Role != "assistant" || retried[2].Role != "user" ||
+		!strings.Contains(retried[2].Content, `missing required property "answer"`) {
+		t.Errorf("retry messages = %+v", retried)
+	}
+	if len(messages) != 1 {
+		t.Errorf("original messages were modified: %+v", messages)
+	}
+}
+
+func TestEnforceResponseFormat_FailsAfterSecondInvalidReply(t *testing.T) {
+	calls := 0
+	_, err := EnforceResponseFormat(NewResponseFormat(map[string]any{}), nil, &LLMResponse{Content: "nope"},
+		func(m []Message) (*LLMResponse, error) {
+			calls++
+			return &LLMResponse{Content: "still nope"}, nil
+		})
+	if err == nil || !strings.Contains(err.Error(), "invalid after retry") {
+		t.Fatalf("error = %v, want invalid after retry", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want exactly one retry", calls)
+	}
+}
+
+func TestEnforceResponseFormat_PassesToolCallsThrough(t *testing.T) {
+	resp := &LLMResponse{ToolCalls: []ToolCall{{ID: "1", Name: "read_file"}}}
+	got, err := EnforceResponseFormat(NewResponseFormat(map[string]any{}), nil, resp,
+		func(m []Message) (*LLMResponse, error) {
+			t.Fatal("tool call responses must not be retried")
+			return nil, nil
+		})
+	if err != nil || got != resp {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}
+
+func TestResponseFormat_ApplyToolAnswer(t *testing.T) {
+	rf := NewResponseFormat(map[string]any{"type": "array", "items": map[string]any{"type": "string"}})
+	resp := rf.ApplyToolAnswer(&LLMResponse{
+		FinishReason: "tool_calls",
+		ToolCalls: []ToolCall{{
+			Name:      "structured_output",
+			Arguments: map[string]any{"value": []any{"a", "b"}},
+		}},
+	})
+	if resp.Content != `["a","b"]` || len(resp.ToolCalls) != 0 || resp.FinishReason != "stop" {
+		t.Errorf("response = %+v", resp)
+	}
+	if got := rf.ToolSchema()["required"]; len(got.([]any)) != 1 {
+		t.Errorf("tool schema = %+v, want the array wrapped in a value field", rf.ToolSchema())
+	}
+}
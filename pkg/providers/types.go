@@ -18,6 +18,12 @@ type (
 	ToolFunctionDefinition = protocoltypes.ToolFunctionDefinition
 	ExtraContent           = protocoltypes.ExtraContent
 	GoogleExtra            = protocoltypes.GoogleExtra
+	StreamDelta            = protocoltypes.StreamDelta
+	ToolCallDelta          = protocoltypes.ToolCallDelta
+	ResponseFormat         = protocoltypes.ResponseFormat
+	ThinkingBlock          = protocoltypes.ThinkingBlock
+	ContentBlock           = protocoltypes.ContentBlock
+	CacheControl           = protocoltypes.CacheControl
 )
 
 type LLMProvider interface {
@@ -31,6 +37,28 @@ type LLMProvider interface {
 	GetDefaultModel() string
 }
 
+// StreamingProvider is implemented by providers that can stream a response
+// as it is generated. ChatStream calls onDelta for every content or tool-call
+// fragment and returns the fully assembled response, identical to what Chat
+// would have returned.
+type StreamingProvider interface {
+	LLMProvider
+	ChatStream(
+		ctx context.Context,
+		messages []Message,
+		tools []ToolDefinition,
+		model string,
+		options map[string]any,
+		onDelta func(StreamDelta),
+	) (*LLMResponse, error)
+}
+
+// Options keys for the agent's reasoning settings.
+const (
+	ReasoningEffortOption = protocoltypes.ReasoningEffortOption
+	ReasoningBudgetOption = protocoltypes.ReasoningBudgetOption
+)
+
 // FailoverReason classifies why an LLM request failed for fallback decisions.
 type FailoverReason string
 
@@ -41,6 +69,7 @@ const (
 	FailoverTimeout    FailoverReason = "timeout"
 	FailoverFormat     FailoverReason = "format"
 	FailoverOverloaded FailoverReason = "overloaded"
+	FailoverSafety     FailoverReason = "safety"
 	FailoverUnknown    FailoverReason = "unknown"
 )
 
@@ -63,9 +92,10 @@ func (e *FailoverError) Unwrap() error {
 }
 
 // IsRetriable returns true if this error should trigger fallback to next candidate.
-// Non-retriable: Format errors (bad request structure, image dimension/size).
+// Non-retriable: Format errors (bad request structure, image dimension/size) and
+// safety blocks, which depend on the content rather than the candidate.
 func (e *FailoverError) IsRetriable() bool {
-	return e.Reason != FailoverFormat
+	return e.Reason != FailoverFormat && e.Reason != FailoverSafety
 }
 
 // ModelConfig holds primary model and fallback list.
@@ -339,6 +339,34 @@ func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
 	}
 }
 
+// Delete forgets a session and removes it from storage.
+func (sm *SessionManager) Delete(key string) error {
+	sm.mu.Lock()
+	delete(sm.sessions, key)
+	sm.mu.Unlock()
+
+	if sm.pType == config.PersistenceSQLite && sm.db != nil {
+		if _, err := sm.db.Exec("DELETE FROM messages WHERE session_key = ?", key); err != nil {
+			return err
+		}
+		_, err := sm.db.Exec("DELETE FROM sessions WHERE key = ?", key)
+		return err
+	}
+
+	if sm.storage == "" {
+		return nil
+	}
+	filename := sanitizeFilename(key)
+	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
+		return os.ErrInvalid
+	}
+	err := os.Remove(filepath.Join(sm.storage, filename+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 // SQLite helper methods
 
 func (sm *SessionManager) saveSessionMetadata(s *Session) error {
@@ -74,3 +74,28 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestDelete_RemovesSessionFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(config.PersistenceJSON, tmpDir)
+
+	key := "agent:main:api:oneoff-1"
+	sm.GetOrCreate(key)
+	sm.AddMessage(key, "user", "hello")
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("Save(%q) failed: %v", key, err)
+	}
+
+	if err := sm.Delete(key); err != nil {
+		t.Fatalf("Delete(%q) failed: %v", key, err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, sanitizeFilename(key)+".json")); !os.IsNotExist(err) {
+		t.Errorf("session file still exists after Delete")
+	}
+	if h := sm.GetHistory(key); len(h) != 0 {
+		t.Errorf("history after Delete has %d messages, want 0", len(h))
+	}
+	if err := sm.Delete(key); err != nil {
+		t.Errorf("deleting a missing session: %v", err)
+	}
+}
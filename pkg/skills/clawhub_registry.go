@@ -10,6 +10,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/egress"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -28,6 +29,7 @@ type ClawHubRegistry struct {
 	downloadPath    string // For fetching ZIP files for download
 	maxZipSize      int
 	maxResponseSize int
+	timeout         time.Duration
 	client          *http.Client
 }
 
@@ -73,17 +75,17 @@ func NewClawHubRegistry(cfg ClawHubConfig) *ClawHubRegistry {
 		downloadPath:    downloadPath,
 		maxZipSize:      maxZip,
 		maxResponseSize: maxResp,
-		client: &http.Client{
-			Timeout: timeout,
-			Transport: &http.Transport{
-				MaxIdleConns:        5,
-				IdleConnTimeout:     30 * time.Second,
-				TLSHandshakeTimeout: 10 * time.Second,
-			},
-		},
+		timeout:         timeout,
+		client:          egress.Default().NewClient(timeout, 0),
 	}
 }
 
+// SetEgressPolicy sets which hosts API calls and downloads may reach,
+// including hosts they are redirected to.
+func (c *ClawHubRegistry) SetEgressPolicy(policy *egress.Policy) {
+	c.client = policy.NewClient(c.timeout, 0)
+}
+
 func (c *ClawHubRegistry) Name() string {
 	return "clawhub"
 }
@@ -14,15 +14,20 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/egress"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 func newTestRegistry(serverURL, authToken string) *ClawHubRegistry {
-	return NewClawHubRegistry(ClawHubConfig{
+	reg := NewClawHubRegistry(ClawHubConfig{
 		Enabled:   true,
 		BaseURL:   serverURL,
 		AuthToken: authToken,
 	})
+	// httptest servers listen on loopback, which is blocked by default
+	reg.SetEgressPolicy(egress.NewPolicy(config.EgressConfig{AllowCIDRs: []string{"127.0.0.0/8", "::1"}}))
+	return reg
 }
 
 func TestClawHubRegistrySearch(t *testing.T) {
@@ -207,6 +212,22 @@ func TestClawHubRegistrySearchHTTPError(t *testing.T) {
 	assert.Contains(t, err.Error(), "500")
 }
 
+func TestClawHubRegistryEgressPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/skill.zip", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// Without a policy, the loopback test server itself is refused
+	reg := NewClawHubRegistry(ClawHubConfig{Enabled: true, BaseURL: srv.URL})
+	_, err := reg.Search(context.Background(), "test", 5)
+	assert.ErrorIs(t, err, egress.ErrBlocked)
+
+	// With loopback allowed, the redirect to the metadata address is refused
+	_, err = newTestRegistry(srv.URL, "").DownloadAndInstall(context.Background(), "test-skill", "1.0.0", t.TempDir())
+	assert.ErrorIs(t, err, egress.ErrBlocked)
+}
+
 func TestClawHubRegistrySearchNullableFields(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		validSlug := "valid-slug"
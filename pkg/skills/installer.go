@@ -9,10 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/egress"
 )
 
 type SkillInstaller struct {
 	workspace string
+	egress    *egress.Policy
 }
 
 type AvailableSkill struct {
@@ -29,6 +32,12 @@ func NewSkillInstaller(workspace string) *SkillInstaller {
 	}
 }
 
+// SetEgressPolicy sets which hosts downloads may reach. Without one,
+// non-public addresses are blocked.
+func (si *SkillInstaller) SetEgressPolicy(policy *egress.Policy) {
+	si.egress = policy
+}
+
 func (si *SkillInstaller) InstallFromGitHub(ctx context.Context, repo string) error {
 	skillDir := filepath.Join(si.workspace, "skills", filepath.Base(repo))
 
@@ -38,7 +47,7 @@ func (si *SkillInstaller) InstallFromGitHub(ctx context.Context, repo string) er
 
 	url := fmt.Sprintf("https://raw.githubusercontent.com/%s/main/SKILL.md", repo)
 
-	client := &http.Client{Timeout: 15 * time.Second}
+	client := si.egress.NewClient(15*time.Second, 0)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -88,7 +97,7 @@ func (si *SkillInstaller) Uninstall(skillName string) error {
 func (si *SkillInstaller) ListAvailableSkills(ctx context.Context) ([]AvailableSkill, error) {
 	url := "https://raw.githubusercontent.com/sipeed/picoclaw-skills/main/skills.json"
 
-	client := &http.Client{Timeout: 15 * time.Second}
+	client := si.egress.NewClient(15*time.Second, 0)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -73,6 +73,13 @@ func NewSkillsLoader(workspace string, globalSkills string, builtinSkills string
 	}
 }
 
+// Dirs returns the directories skills are loaded from, highest priority
+// first. Unset directories are returned as empty strings.
+func (sl *SkillsLoader) Dirs() []string {
+	dirs := append([]string(nil), sl.workspaceSkills...)
+	return append(dirs, sl.globalSkills, sl.builtinSkills)
+}
+
 func (sl *SkillsLoader) ListSkills() []SkillInfo {
 	skills := make([]SkillInfo, 0)
 
@@ -0,0 +1,382 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const defaultApprovalTimeout = 5 * time.Minute
+
+// Outcomes of an approval request, as recorded in the audit log.
+const (
+	ApprovalApproved    = "approved"
+	ApprovalDenied      = "denied"
+	ApprovalTimedOut    = "timeout"
+	ApprovalUnavailable = "unavailable" // no chat to ask in
+	ApprovalFailed      = "failed"      // the prompt could not be sent
+)
+
+// ApprovalAuditPath returns where the approval audit log of a workspace is
+// stored.
+func ApprovalAuditPath(workspace string) string {
+	return filepath.Join(workspace, "state", "approvals.jsonl")
+}
+
+// ApprovalRequest is a tool call waiting for the user's decision.
+type ApprovalRequest struct {
+	ID      string         `json:"id"`
+	AgentID string         `json:"agent_id,omitempty"`
+	Tool    string         `json:"tool"`
+	Args    map[string]any `json:"args,omitempty"`
+	Reason  string         `json:"reason"` // the rule that matched
+	Channel string         `json:"channel,omitempty"`
+	ChatID  string         `json:"chat_id,omitempty"`
+	// SenderID is the user whose message started the turn. Only they, or
+	// a configured approver, may answer.
+	SenderID string `json:"sender_id,omitempty"`
+}
+
+// ApprovalDecision is the user's answer to an approval request.
+type ApprovalDecision struct {
+	Approved bool
+	By       string // sender ID of the user who answered
+}
+
+// Approver asks the user in the request's chat to approve a tool call and
+// waits until they answer or ctx is done.
+type Approver interface {
+	RequestApproval(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+}
+
+// ApprovalRecord is one line of the approval audit log.
+type ApprovalRecord struct {
+	Time time.Time `json:"time"`
+	ApprovalRequest
+	Outcome string `json:"outcome"`
+	By      string `json:"by,omitempty"`
+}
+
+// ApprovalPolicyOptions configures an ApprovalPolicy.
+type ApprovalPolicyOptions struct {
+	AgentID   string
+	Workspace string // relative paths in rules and arguments resolve against it
+	Approver  Approver
+	AuditPath string // empty disables the audit log
+}
+
+type approvalRule struct {
+	tool         string
+	arg          string
+	patterns     []*regexp.Regexp
+	unlessWithin []string
+	reason       string
+}
+
+// ApprovalPolicy decides which tool calls need the user's approval and asks
+// for it before the registry runs them.
+type ApprovalPolicy struct {
+	rules     []approvalRule
+	timeout   time.Duration
+	agentID   string
+	workspace string
+	approver  Approver
+	auditPath string
+	auditMu   sync.Mutex
+}
+
+// NewApprovalPolicy builds the policy for cfg. It returns nil when cfg has
+// no rules. A pattern that does not compile makes its rule match every call
+// of the tool, so a typo never lets calls through unapproved.
+func NewApprovalPolicy(cfg config.ApprovalConfig, opts ApprovalPolicyOptions) *ApprovalPolicy {
+	if len(cfg.RequireApproval) == 0 {
+		return nil
+	}
+
+	p := &ApprovalPolicy{
+		timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+		agentID:   opts.AgentID,
+		workspace: opts.Workspace,
+		approver:  opts.Approver,
+		auditPath: opts.AuditPath,
+	}
+	if p.timeout <= 0 {
+		p.timeout = defaultApprovalTimeout
+	}
+
+	for _, rc := range cfg.RequireApproval {
+		rule := approvalRule{tool: rc.Tool, arg: rc.Arg, unlessWithin: rc.UnlessWithin}
+		if rule.arg == "" && len(rule.unlessWithin) > 0 {
+			rule.arg = "path"
+		}
+		for _, pattern := range rc.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				logger.WarnCF("tool", "Invalid approval pattern, approval needed for every call",
+					map[string]any{
+						"tool":    rc.Tool,
+						"pattern": pattern,
+						"error":   err.Error(),
+					})
+				rule.patterns, rule.unlessWithin = nil, nil
+				break
+			}
+			rule.patterns = append(rule.patterns, re)
+		}
+		rule.reason = describeApprovalRule(rule)
+		p.rules = append(p.rules, rule)
+	}
+	return p
+}
+
+func describeApprovalRule(rule approvalRule) string {
+	switch {
+	case len(rule.patterns) > 0 && rule.arg != "":
+		return fmt.Sprintf("%s matches an approval pattern", rule.arg)
+	case len(rule.patterns) > 0:
+		return "an argument matches an approval pattern"
+	case len(rule.unlessWithin) > 0:
+		return fmt.Sprintf("%s is outside the approved paths", rule.arg)
+	default:
+		return "every call needs approval"
+	}
+}
+
+// Match reports whether a call of the named tool with args needs approval,
+// and why.
+func (p *ApprovalPolicy) Match(name string, args map[string]any) (string, bool) {
+	for _, rule := range p.rules {
+		if rule.tool != name && rule.tool != "*" {
+			continue
+		}
+		if p.ruleMatches(rule, args) {
+			return rule.reason, true
+		}
+	}
+	return "", false
+}
+
+func (p *ApprovalPolicy) ruleMatches(rule approvalRule, args map[string]any) bool {
+	if len(rule.patterns) > 0 {
+		for _, value := range approvalArgValues(args, rule.arg) {
+			for _, re := range rule.patterns {
+				if re.MatchString(value) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(rule.unlessWithin) > 0 {
+		path, _ := args[rule.arg].(string)
+		return path == "" || !pathWithin(p.workspace, path, rule.unlessWithin)
+	}
+	return true
+}
+
+// approvalArgValues returns the named string argument, or every string
+// argument when name is empty.
+func approvalArgValues(args map[string]any, name string) []string {
+	if name != "" {
+		if value, ok := args[name].(string); ok {
+			return []string{value}
+		}
+		return nil
+	}
+	values := make([]string, 0, len(args))
+	for _, v := range args {
+		if value, ok := v.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// pathWithin reports whether path is inside one of dirs once symlinks are
+// resolved, so a link in an approved directory cannot point elsewhere.
+// Relative paths resolve against workspace.
+func pathWithin(workspace, path string, dirs []string) bool {
+	resolved := resolvePathPrefix(workspacePath(workspace, path))
+	for _, dir := range dirs {
+		if isWithinWorkspace(resolved, resolvePathPrefix(workspacePath(workspace, dir))) {
+			return true
+		}
+	}
+	return false
+}
+
+func workspacePath(workspace, path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspace, path)
+	}
+	return absPath(path)
+}
+
+// resolvePathPrefix resolves the symlinks in the longest existing prefix of
+// path, so paths that are about to be created resolve as well.
+func resolvePathPrefix(path string) string {
+	rest := ""
+	for current := path; ; current = filepath.Dir(current) {
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if filepath.Dir(current) == current {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(current), rest)
+	}
+}
+
+// Authorize asks for approval when the call needs it. It returns nil when
+// the call may run, and the result to report instead otherwise.
+func (p *ApprovalPolicy) Authorize(
+	ctx context.Context,
+	name string,
+	args map[string]any,
+	channel, chatID string,
+) *ToolResult {
+	reason, ok := p.Match(name, args)
+	if !ok {
+		return nil
+	}
+
+	req := ApprovalRequest{
+		ID:      newApprovalID(),
+		AgentID: p.agentID,
+		Tool:    name,
+		Args:    args,
+		Reason:  reason,
+		Channel: channel,
+		ChatID:  chatID,
+	}
+	if turn := TurnContextFrom(ctx); turn != nil {
+		req.SenderID = turn.SenderID
+	}
+	if p.approver == nil || channel == "" || chatID == "" || constants.IsInternalChannel(channel) {
+		p.audit(req, ApprovalUnavailable, "")
+		return ErrorResult(fmt.Sprintf(
+			"%s was not run: it needs the user's approval (%s), but this turn has no chat to ask in", name, reason))
+	}
+
+	logger.InfoCF("tool", "Waiting for approval",
+		map[string]any{
+			"tool":    name,
+			"id":      req.ID,
+			"channel": channel,
+			"chat_id": chatID,
+		})
+
+	askCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	decision, err := p.approver.RequestApproval(askCtx, req)
+	switch {
+	case err != nil && ctx.Err() == nil && errors.Is(askCtx.Err(), context.DeadlineExceeded):
+		p.audit(req, ApprovalTimedOut, "")
+		return ErrorResult(fmt.Sprintf("%s was not run: the user did not approve it within %v", name, p.timeout))
+	case err != nil:
+		p.audit(req, ApprovalFailed, "")
+		return ErrorResult(fmt.Sprintf("%s was not run: asking for approval failed: %v", name, err)).WithError(err)
+	case !decision.Approved:
+		p.audit(req, ApprovalDenied, decision.By)
+		return ErrorResult(fmt.Sprintf("%s was not run: the user denied it", name))
+	}
+	p.audit(req, ApprovalApproved, decision.By)
+	return nil
+}
+
+func (p *ApprovalPolicy) audit(req ApprovalRequest, outcome, by string) {
+	logger.InfoCF("tool", "Approval decided",
+		map[string]any{
+			"tool":    req.Tool,
+			"id":      req.ID,
+			"outcome": outcome,
+			"by":      by,
+		})
+	if p.auditPath == "" {
+		return
+	}
+
+	// Long arguments, such as file contents, are shortened in the log
+	args := make(map[string]any, len(req.Args))
+	for k, v := range req.Args {
+		if s, ok := v.(string); ok {
+			v = utils.Truncate(s, 500)
+		}
+		args[k] = v
+	}
+	req.Args = args
+
+	data, err := json.Marshal(ApprovalRecord{Time: time.Now(), ApprovalRequest: req, Outcome: outcome, By: by})
+	if err == nil {
+		p.auditMu.Lock()
+		err = appendLine(p.auditPath, data)
+		p.auditMu.Unlock()
+	}
+	if err != nil {
+		logger.WarnCF("tool", "Failed to write approval audit record",
+			map[string]any{
+				"path":  p.auditPath,
+				"error": err.Error(),
+			})
+	}
+}
+
+func appendLine(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newApprovalID returns a short ID the user can type in a reply.
+func newApprovalID() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%06x", time.Now().UnixNano()&0xffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+// FormatApprovalArgs renders a call's arguments one per line, sorted and
+// shortened, for showing in an approval prompt.
+func FormatApprovalArgs(args map[string]any) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, k := range keys {
+		value, ok := args[k].(string)
+		if !ok {
+			data, _ := json.Marshal(args[k])
+			value = string(data)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", k, utils.Truncate(value, 300)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type fakeApprover struct {
+	decision ApprovalDecision
+	block    bool
+	requests []ApprovalRequest
+}
+
+func (f *fakeApprover) RequestApproval(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	f.requests = append(f.requests, req)
+	if f.block {
+		<-ctx.Done()
+		return ApprovalDecision{}, ctx.Err()
+	}
+	return f.decision, nil
+}
+
+func TestApprovalPolicy_Match(t *testing.T) {
+	workspace := t.TempDir()
+	policy := NewApprovalPolicy(config.ApprovalConfig{RequireApproval: []config.ApprovalRule{
+		{Tool: "exec", Arg: "command", Patterns: []string{`\bgit\s+commit\b`, `^curl `}},
+		{Tool: "write_file", UnlessWithin: []string{"notes", "/tmp/picoclaw-approved"}},
+		{Tool: "i2c", Arg: "action", Patterns: []string{"^write$"}},
+		{Tool: "spi", Patterns: []string{"("}},
+	}}, ApprovalPolicyOptions{Workspace: workspace})
+
+	if err := os.Symlink(t.TempDir(), filepath.Join(workspace, "notes-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tool string
+		args map[string]any
+		want bool
+	}{
+		{"exec", map[string]any{"command": "git commit -m wip"}, true},
+		{"exec", map[string]any{"command": "git status"}, false},
+		{"exec", map[string]any{"command": "ls", "working_dir": "curl x"}, false},
+		{"write_file", map[string]any{"path": "notes/today.md"}, false},
+		{"write_file", map[string]any{"path": filepath.Join(workspace, "notes", "a", "b.md")}, false},
+		{"write_file", map[string]any{"path": "/tmp/picoclaw-approved/x"}, false},
+		{"write_file", map[string]any{"path": "notes/../config.json"}, true},
+		{"write_file", map[string]any{"path": "notes-link/escape.md"}, true},
+		{"write_file", map[string]any{"path": "/etc/hosts"}, true},
+		{"i2c", map[string]any{"action": "write", "bus": "1"}, true},
+		{"i2c", map[string]any{"action": "read"}, false},
+		{"spi", map[string]any{"action": "list"}, true}, // invalid pattern fails closed
+		{"read_file", map[string]any{"path": "/etc/hosts"}, false},
+	}
+	for _, tt := range tests {
+		if _, got := policy.Match(tt.tool, tt.args); got != tt.want {
+			t.Errorf("Match(%s, %v) = %v, want %v", tt.tool, tt.args, got, tt.want)
+		}
+	}
+
+	if NewApprovalPolicy(config.ApprovalConfig{}, ApprovalPolicyOptions{}) != nil {
+		t.Error("a config without rules should have no policy")
+	}
+}
+
+func TestToolRegistry_ApprovalPolicy(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "state", "approvals.jsonl")
+	approver := &fakeApprover{}
+	cfg := config.ApprovalConfig{RequireApproval: []config.ApprovalRule{{Tool: "mock_tool"}}}
+
+	tool := &mockRegistryTool{name: "mock_tool", result: SilentResult("ran")}
+	r := NewToolRegistry()
+	r.Register(tool)
+	r.SetApprovalPolicy(NewApprovalPolicy(cfg, ApprovalPolicyOptions{
+		AgentID:   "main",
+		Approver:  approver,
+		AuditPath: auditPath,
+	}))
+	ctx := context.Background()
+
+	result := r.ExecuteWithContext(ctx, "mock_tool", map[string]any{"x": "1"}, "telegram", "42", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "denied") {
+		t.Errorf("denied call = %+v, want an error result", result)
+	}
+	if len(approver.requests) != 1 || approver.requests[0].Channel != "telegram" || approver.requests[0].ChatID != "42" {
+		t.Fatalf("requests = %+v, want one for telegram:42", approver.requests)
+	}
+
+	approver.decision = ApprovalDecision{Approved: true, By: "u1"}
+	if result := r.ExecuteWithContext(ctx, "mock_tool", nil, "telegram", "42", nil); result.IsError {
+		t.Errorf("approved call failed: %s", result.ForLLM)
+	}
+
+	if result := r.ExecuteWithContext(ctx, "mock_tool", nil, "cli", "direct", nil); !result.IsError {
+		t.Error("a call from the CLI has no chat to ask in and should not run")
+	}
+	if len(approver.requests) != 2 {
+		t.Errorf("got %d requests, want no prompt for the CLI call", len(approver.requests))
+	}
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("reading audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("audit log has %d lines, want 3:\n%s", len(lines), data)
+	}
+	for i, want := range []string{`"outcome":"denied"`, `"outcome":"approved","by":"u1"`, `"outcome":"unavailable"`} {
+		if !strings.Contains(lines[i], want) || !strings.Contains(lines[i], `"agent_id":"main"`) {
+			t.Errorf("audit line %d = %s, want %s", i, lines[i], want)
+		}
+	}
+}
+
+func TestApprovalPolicy_Timeout(t *testing.T) {
+	policy := NewApprovalPolicy(config.ApprovalConfig{
+		RequireApproval: []config.ApprovalRule{{Tool: "*"}},
+		TimeoutSeconds:  1,
+	}, ApprovalPolicyOptions{Approver: &fakeApprover{block: true}})
+	policy.timeout = 10 * time.Millisecond
+
+	result := policy.Authorize(context.Background(), "exec", nil, "discord", "c1")
+	if result == nil || !strings.Contains(result.ForLLM, "did not approve it within") {
+		t.Errorf("Authorize() = %+v, want a timeout result", result)
+	}
+}
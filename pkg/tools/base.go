@@ -69,6 +69,20 @@ type AsyncTool interface {
 	SetCallback(cb AsyncCallback)
 }
 
+// SerialTool is an optional interface for tools whose calls must not overlap.
+// When the model requests several calls in one response, calls returning the
+// same non-empty key run one at a time, in the order they were requested.
+// Calls with different keys, or to other tools, may run in parallel.
+type SerialTool interface {
+	Tool
+	SerialKey(args map[string]any) string
+}
+
+// SerialExclusive is the serial key of calls that may touch anything, such
+// as shell commands. Such a call runs alone: after every call requested
+// before it, and before every call requested after it.
+const SerialExclusive = "*"
+
 func ToolToSchema(tool Tool) map[string]any {
 	return map[string]any{
 		"type": "function",
@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// TurnContext carries per-turn state for tools that are shared between
+// concurrently running agent turns. Shared tools (message, spawn, cron, ...)
+// must read the origin channel/chatID from here instead of from fields set
+// via SetContext, otherwise parallel sessions overwrite each other's target.
+type TurnContext struct {
+	Channel string
+	ChatID  string
+	// AgentID is the agent running the turn.
+	AgentID string
+	// SenderID is the user whose message started the turn; empty for
+	// turns nobody started from a chat.
+	SenderID string
+
+	messageSent   atomic.Bool
+	replyStreamed atomic.Bool
+
+	// parent is the turn a per-call context was derived from; it sees the
+	// messages sent through this one too.
+	parent *TurnContext
+}
+
+type (
+	turnContextKey   struct{}
+	asyncCallbackKey struct{}
+)
+
+// WithTurnContext returns a copy of ctx that carries the given turn context.
+func WithTurnContext(ctx context.Context, tc *TurnContext) context.Context {
+	return context.WithValue(ctx, turnContextKey{}, tc)
+}
+
+// TurnContextFrom returns the turn context stored in ctx, or nil.
+func TurnContextFrom(ctx context.Context) *TurnContext {
+	if ctx == nil {
+		return nil
+	}
+	tc, _ := ctx.Value(turnContextKey{}).(*TurnContext)
+	return tc
+}
+
+// MessageSent reports whether the message tool delivered a message during this turn.
+func (tc *TurnContext) MessageSent() bool {
+	return tc != nil && tc.messageSent.Load()
+}
+
+func (tc *TurnContext) markMessageSent() {
+	for ; tc != nil; tc = tc.parent {
+		tc.messageSent.Store(true)
+	}
+}
+
+// MarkReplyStreamed records that the final reply was already delivered by
+// streaming it to the channel, so it must not be published again.
+func (tc *TurnContext) MarkReplyStreamed() {
+	if tc != nil {
+		tc.replyStreamed.Store(true)
+	}
+}
+
+// ReplyStreamed reports whether the final reply was delivered by streaming.
+func (tc *TurnContext) ReplyStreamed() bool {
+	return tc != nil && tc.replyStreamed.Load()
+}
+
+// turnTarget resolves the channel/chatID for the current call, preferring the
+// turn context over the tool's own defaults.
+func turnTarget(ctx context.Context, defaultChannel, defaultChatID string) (string, string) {
+	if tc := TurnContextFrom(ctx); tc != nil && tc.Channel != "" && tc.ChatID != "" {
+		return tc.Channel, tc.ChatID
+	}
+	return defaultChannel, defaultChatID
+}
+
+// withAsyncCallback attaches the async completion callback for a single tool call.
+func withAsyncCallback(ctx context.Context, cb AsyncCallback) context.Context {
+	return context.WithValue(ctx, asyncCallbackKey{}, cb)
+}
+
+// callbackFor resolves the async callback for the current call, preferring
+// the one attached to ctx over the tool's own field.
+func callbackFor(ctx context.Context, fallback AsyncCallback) AsyncCallback {
+	if cb, ok := ctx.Value(asyncCallbackKey{}).(AsyncCallback); ok && cb != nil {
+		return cb
+	}
+	return fallback
+}
@@ -2,19 +2,23 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
-	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 // JobExecutor is the interface for executing cron jobs through the agent
 type JobExecutor interface {
 	ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error)
+	// GetAgentTools returns the tool registry of an agent, or of the
+	// default agent when agentID is empty.
+	GetAgentTools(agentID string) (*ToolRegistry, bool)
 }
 
 // CronTool provides scheduling capabilities for the agent
@@ -22,25 +26,23 @@ type CronTool struct {
 	cronService *cron.CronService
 	executor    JobExecutor
 	msgBus      *bus.MessageBus
-	execTool    *ExecTool
+	execTimeout time.Duration
 	channel     string
 	chatID      string
 	mu          sync.RWMutex
 }
 
-// NewCronTool creates a new CronTool
-// execTimeout: 0 means no timeout, >0 sets the timeout duration
+// NewCronTool creates a new CronTool. Scheduled commands run with the exec
+// tool of the agent that created the job.
+// execTimeout: 0 means no timeout, >0 caps how long a scheduled command may run
 func NewCronTool(
-	cronService *cron.CronService, executor JobExecutor, msgBus *bus.MessageBus, workspace string, restrict bool,
-	execTimeout time.Duration, config *config.Config,
+	cronService *cron.CronService, executor JobExecutor, msgBus *bus.MessageBus, execTimeout time.Duration,
 ) *CronTool {
-	execTool := NewExecToolWithConfig(workspace, restrict, config)
-	execTool.SetTimeout(execTimeout)
 	return &CronTool{
 		cronService: cronService,
 		executor:    executor,
 		msgBus:      msgBus,
-		execTool:    execTool,
+		execTimeout: execTimeout,
 	}
 }
 
@@ -72,6 +74,10 @@ func (t *CronTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Optional: Shell command to execute directly (e.g., 'df -h'). If set, the agent will run this command and report output instead of just showing the message. 'deliver' will be forced to false for commands.",
 			},
+			"response_schema": map[string]any{
+				"type":        "object",
+				"description": "Optional: JSON schema the agent's answer must match when the job runs (pass {} for any JSON object). 'deliver' will be forced to false.",
+			},
 			"at_seconds": map[string]any{
 				"type":        "integer",
 				"description": "One-time reminder: seconds from now when to trigger (e.g., 600 for 10 minutes later). Use this for one-time reminders like 'remind me in 10 minutes'.",
@@ -114,7 +120,7 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 
 	switch action {
 	case "add":
-		return t.addJob(args)
+		return t.addJob(ctx, args)
 	case "list":
 		return t.listJobs()
 	case "remove":
@@ -128,10 +134,9 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	}
 }
 
-func (t *CronTool) addJob(args map[string]any) *ToolResult {
+func (t *CronTool) addJob(ctx context.Context, args map[string]any) *ToolResult {
 	t.mu.RLock()
-	channel := t.channel
-	chatID := t.chatID
+	channel, chatID := turnTarget(ctx, t.channel, t.chatID)
 	t.mu.RUnlock()
 
 	if channel == "" || chatID == "" {
@@ -187,6 +192,22 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 		deliver = false
 	}
 
+	var agentID, senderID string
+	if tc := TurnContextFrom(ctx); tc != nil {
+		agentID, senderID = tc.AgentID, tc.SenderID
+	}
+	if command != "" {
+		if err := t.checkCommand(agentID, command); err != nil {
+			return ErrorResult(fmt.Sprintf("Error adding job: %v", err))
+		}
+	}
+
+	responseSchema, _ := args["response_schema"].(map[string]any)
+	if responseSchema != nil {
+		// A structured answer has to come from the agent
+		deliver = false
+	}
+
 	// Truncate message for job name (max 30 chars)
 	messagePreview := utils.Truncate(message, 30)
 
@@ -202,8 +223,11 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 		return ErrorResult(fmt.Sprintf("Error adding job: %v", err))
 	}
 
-	if command != "" {
+	if command != "" || responseSchema != nil || agentID != "" || senderID != "" {
 		job.Payload.Command = command
+		job.Payload.ResponseSchema = responseSchema
+		job.Payload.AgentID = agentID
+		job.Payload.SenderID = senderID
 		// Need to save the updated payload
 		t.cronService.UpdateJob(job)
 	}
@@ -282,11 +306,7 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 
 	// Execute command if present
 	if job.Payload.Command != "" {
-		args := map[string]any{
-			"command": job.Payload.Command,
-		}
-
-		result := t.execTool.Execute(ctx, args)
+		result := t.runCommand(ctx, job, channel, chatID)
 		var output string
 		if result.IsError {
 			output = fmt.Sprintf("Error executing scheduled command: %s", result.ForLLM)
@@ -312,8 +332,13 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 		return "ok"
 	}
 
-	// For deliver=false, process through agent (for complex tasks)
+	// For deliver=false, process through agent (for complex tasks), on
+	// behalf of the user who scheduled the job
 	sessionKey := fmt.Sprintf("cron-%s", job.ID)
+	ctx = WithTurnContext(ctx, &TurnContext{SenderID: job.Payload.SenderID})
+	if job.Payload.ResponseSchema != nil {
+		ctx = providers.WithResponseFormat(ctx, providers.NewResponseFormat(job.Payload.ResponseSchema))
+	}
 
 	// Call agent with job's message
 	response, err := t.executor.ProcessDirectWithChannel(
@@ -327,7 +352,51 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 		return fmt.Sprintf("Error: %v", err)
 	}
 
-	// Response is automatically sent via MessageBus by AgentLoop
-	_ = response // Will be sent by AgentLoop
+	// A structured answer is kept on the job's state, where the dashboard's
+	// cron API and the jobs file expose it
+	if job.Payload.ResponseSchema != nil && json.Valid([]byte(response)) {
+		if err := t.cronService.SetLastResult(job.ID, json.RawMessage(response)); err != nil {
+			return fmt.Sprintf("Error: %v", err)
+		}
+	}
 	return "ok"
 }
+
+// checkCommand reports why the agent may not run command, so a job it
+// could never run is not scheduled. The check is repeated when the job runs,
+// in case the agent's tools changed meanwhile.
+func (t *CronTool) checkCommand(agentID, command string) error {
+	registry, ok := t.executor.GetAgentTools(agentID)
+	if !ok {
+		return fmt.Errorf("agent %q not found", agentID)
+	}
+	if _, ok := registry.Get("exec"); !ok {
+		return fmt.Errorf("this agent cannot run commands")
+	}
+	return registry.CheckPolicy("exec", map[string]any{"command": command})
+}
+
+// runCommand runs a job's command through the exec tool of the agent that
+// scheduled it, so the agent's tool policy and approval rules apply as they
+// do to its own calls.
+func (t *CronTool) runCommand(ctx context.Context, job *cron.CronJob, channel, chatID string) *ToolResult {
+	registry, ok := t.executor.GetAgentTools(job.Payload.AgentID)
+	if !ok {
+		return ErrorResult(fmt.Sprintf("agent %q no longer exists", job.Payload.AgentID))
+	}
+
+	if t.execTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.execTimeout)
+		defer cancel()
+	}
+	ctx = WithTurnContext(ctx, &TurnContext{
+		Channel:  channel,
+		ChatID:   chatID,
+		AgentID:  job.Payload.AgentID,
+		SenderID: job.Payload.SenderID,
+	})
+	return registry.ExecuteWithContext(ctx, "exec", map[string]any{
+		"command": job.Payload.Command,
+	}, channel, chatID, nil)
+}
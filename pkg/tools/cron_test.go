@@ -0,0 +1,184 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// fakeJobExecutor answers every cron turn with a fixed response and serves
+// the tool registries of its agents.
+type fakeJobExecutor struct {
+	response string
+	format   *providers.ResponseFormat
+	agents   map[string]*ToolRegistry
+}
+
+func (e *fakeJobExecutor) ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error) {
+	e.format = providers.ResponseFormatFromContext(ctx)
+	return e.response, nil
+}
+
+func (e *fakeJobExecutor) GetAgentTools(agentID string) (*ToolRegistry, bool) {
+	if agentID == "" {
+		agentID = "main"
+	}
+	r, ok := e.agents[agentID]
+	return r, ok
+}
+
+func newTestCronTool(t *testing.T, executor JobExecutor) (*CronTool, *bus.MessageBus, string) {
+	t.Helper()
+	storePath := filepath.Join(t.TempDir(), "cron", "jobs.json")
+	msgBus := bus.NewMessageBus()
+	tool := NewCronTool(cron.NewCronService(storePath, nil), executor, msgBus, 0)
+	tool.SetContext("telegram", "chat1")
+	return tool, msgBus, storePath
+}
+
+// addCommandJob schedules command as the given agent and returns the job.
+func addCommandJob(t *testing.T, tool *CronTool, agentID, command string) (*cron.CronJob, *ToolResult) {
+	t.Helper()
+	ctx := WithTurnContext(context.Background(), &TurnContext{
+		Channel:  "telegram",
+		ChatID:   "chat1",
+		AgentID:  agentID,
+		SenderID: "u1",
+	})
+	result := tool.Execute(ctx, map[string]any{
+		"action":        "add",
+		"message":       "run it",
+		"command":       command,
+		"every_seconds": float64(3600),
+	})
+	for _, job := range tool.cronService.ListJobs(true) {
+		if job.Payload.Command == command {
+			return &job, result
+		}
+	}
+	return nil, result
+}
+
+// nextOutbound returns the next message published on msgBus.
+func nextOutbound(t *testing.T, msgBus *bus.MessageBus) bus.OutboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok {
+		t.Fatal("no outbound message")
+	}
+	return msg
+}
+
+func TestCronTool_ExecuteJob_StoresStructuredResult(t *testing.T) {
+	executor := &fakeJobExecutor{response: `{"temperature":21}`}
+	tool, _, storePath := newTestCronTool(t, executor)
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"action":        "add",
+		"message":       "Report the temperature",
+		"every_seconds": float64(3600),
+		"response_schema": map[string]any{
+			"type":     "object",
+			"required": []any{"temperature"},
+		},
+	})
+	if result.IsError {
+		t.Fatalf("add failed: %s", result.ForLLM)
+	}
+	jobs := tool.cronService.ListJobs(true)
+	if len(jobs) != 1 {
+		t.Fatalf("jobs = %d, want 1", len(jobs))
+	}
+
+	if status := tool.ExecuteJob(context.Background(), &jobs[0]); status != "ok" {
+		t.Fatalf("ExecuteJob() = %q", status)
+	}
+	if executor.format == nil {
+		t.Error("the job's turn was not asked for structured output")
+	}
+
+	reloaded := cron.NewCronService(storePath, nil).GetJob(jobs[0].ID)
+	if reloaded == nil {
+		t.Fatal("job not found after reload")
+	}
+	var got map[string]any
+	if err := json.Unmarshal(reloaded.State.LastResult, &got); err != nil || got["temperature"] != float64(21) {
+		t.Errorf("LastResult = %s, want the validated answer", reloaded.State.LastResult)
+	}
+}
+
+func TestCronTool_ExecuteJob_CommandNeedsApproval(t *testing.T) {
+	approver := &fakeApprover{}
+	cfg := config.ApprovalConfig{RequireApproval: []config.ApprovalRule{{Tool: "exec"}}}
+	registry := NewToolRegistry()
+	registry.Register(NewExecTool(t.TempDir(), false))
+	registry.SetApprovalPolicy(NewApprovalPolicy(cfg, ApprovalPolicyOptions{AgentID: "ops", Approver: approver}))
+
+	tool, msgBus, _ := newTestCronTool(t, &fakeJobExecutor{agents: map[string]*ToolRegistry{"ops": registry}})
+	job, result := addCommandJob(t, tool, "ops", "echo scheduled-output")
+	if job == nil || job.Payload.AgentID != "ops" {
+		t.Fatalf("job = %+v (%s), want one owned by ops", job, result.ForLLM)
+	}
+
+	tool.ExecuteJob(context.Background(), job)
+	if len(approver.requests) != 1 || approver.requests[0].Channel != "telegram" ||
+		approver.requests[0].AgentID != "ops" || approver.requests[0].SenderID != "u1" {
+		t.Fatalf("requests = %+v, want one in the job's chat for the user who scheduled it", approver.requests)
+	}
+	if out := nextOutbound(t, msgBus); !strings.Contains(out.Content, "denied") || strings.Contains(out.Content, "scheduled-output") {
+		t.Errorf("denied job reported %q", out.Content)
+	}
+
+	approver.decision = ApprovalDecision{Approved: true, By: "u1"}
+	tool.ExecuteJob(context.Background(), job)
+	if out := nextOutbound(t, msgBus); !strings.Contains(out.Content, "scheduled-output") {
+		t.Errorf("approved job reported %q", out.Content)
+	}
+}
+
+func TestCronTool_DeniedAgentCannotRunCommands(t *testing.T) {
+	workspace := t.TempDir()
+	marker := filepath.Join(workspace, "ran")
+	newRegistry := func(policy *config.ToolPolicyConfig) *ToolRegistry {
+		r := NewToolRegistry()
+		r.Register(NewExecTool(workspace, false))
+		r.SetToolPolicy(NewToolPolicy(policy, workspace))
+		return r
+	}
+	executor := &fakeJobExecutor{agents: map[string]*ToolRegistry{
+		"family": newRegistry(&config.ToolPolicyConfig{Deny: []string{"exec"}}),
+		"ops":    newRegistry(nil),
+	}}
+	tool, msgBus, _ := newTestCronTool(t, executor)
+
+	job, result := addCommandJob(t, tool, "family", "touch "+marker)
+	if !result.IsError || job != nil {
+		t.Fatalf("denied agent scheduled a command: %+v", result)
+	}
+
+	// A job scheduled before the policy changed is refused when it runs
+	job, result = addCommandJob(t, tool, "ops", "touch "+marker)
+	if job == nil {
+		t.Fatalf("ops could not schedule a command: %s", result.ForLLM)
+	}
+	executor.agents["ops"].SetToolPolicy(NewToolPolicy(&config.ToolPolicyConfig{Deny: []string{"exec"}}, workspace))
+	tool.ExecuteJob(context.Background(), job)
+
+	if out := nextOutbound(t, msgBus); !strings.Contains(out.Content, "not available to this agent") {
+		t.Errorf("job reported %q, want the policy refusal", out.Content)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the command ran for an agent denied exec")
+	}
+}
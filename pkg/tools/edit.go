@@ -29,6 +29,10 @@ func (t *EditFileTool) Name() string {
 	return "edit_file"
 }
 
+func (t *EditFileTool) SerialKey(args map[string]any) string {
+	return fileSerialKey(t.fs, args)
+}
+
 func (t *EditFileTool) Description() string {
 	return "Edit a file by replacing old_text with new_text. The old_text must exist exactly in the file."
 }
@@ -94,6 +98,10 @@ func (t *AppendFileTool) Name() string {
 	return "append_file"
 }
 
+func (t *AppendFileTool) SerialKey(args map[string]any) string {
+	return fileSerialKey(t.fs, args)
+}
+
 func (t *AppendFileTool) Description() string {
 	return "Append content to the end of a file"
 }
@@ -81,6 +81,18 @@ func isWithinWorkspace(candidate, workspace string) bool {
 	return err == nil && filepath.IsLocal(rel)
 }
 
+// fileSerialKey keeps calls that touch the same file in order.
+func fileSerialKey(fs fileSystem, args map[string]any) string {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return ""
+	}
+	if sfs, ok := fs.(*sandboxFs); ok && !filepath.IsAbs(path) {
+		path = filepath.Join(sfs.workspace, path)
+	}
+	return "file:" + filepath.Clean(path)
+}
+
 type ReadFileTool struct {
 	fs fileSystem
 }
@@ -99,6 +111,10 @@ func (t *ReadFileTool) Name() string {
 	return "read_file"
 }
 
+func (t *ReadFileTool) SerialKey(args map[string]any) string {
+	return fileSerialKey(t.fs, args)
+}
+
 func (t *ReadFileTool) Description() string {
 	return "Read the contents of a file"
 }
@@ -147,6 +163,10 @@ func (t *WriteFileTool) Name() string {
 	return "write_file"
 }
 
+func (t *WriteFileTool) SerialKey(args map[string]any) string {
+	return fileSerialKey(t.fs, args)
+}
+
 func (t *WriteFileTool) Description() string {
 	return "Write content to a file"
 }
@@ -3,15 +3,24 @@ package tools
 import (
 	"context"
 	"fmt"
+	"os"
+	"sync/atomic"
 )
 
 type SendCallback func(channel, chatID, content string) error
 
+// SendMediaCallback sends a message with files attached; media holds
+// absolute paths of local files.
+type SendMediaCallback func(channel, chatID, content string, media []string) error
+
 type MessageTool struct {
-	sendCallback   SendCallback
-	defaultChannel string
-	defaultChatID  string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
+	sendCallback      SendCallback
+	sendMediaCallback SendMediaCallback
+	workspace         string
+	restrict          bool
+	defaultChannel    string
+	defaultChatID     string
+	sentInRound       atomic.Bool // Tracks whether a message was sent in the current processing round
 }
 
 func NewMessageTool() *MessageTool {
@@ -22,6 +31,11 @@ func (t *MessageTool) Name() string {
 	return "message"
 }
 
+// SerialKey keeps messages in the order the model wrote them.
+func (t *MessageTool) SerialKey(args map[string]any) string {
+	return "message"
+}
+
 func (t *MessageTool) Description() string {
 	return "Send a message to user on a chat channel. Use this when you want to communicate something."
 }
@@ -42,6 +56,11 @@ func (t *MessageTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"media": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Optional: paths of files to attach, such as images or documents. Channels that cannot send files send the text only.",
+			},
 		},
 		"required": []string{"content"},
 	}
@@ -50,18 +69,58 @@ func (t *MessageTool) Parameters() map[string]any {
 func (t *MessageTool) SetContext(channel, chatID string) {
 	t.defaultChannel = channel
 	t.defaultChatID = chatID
-	t.sentInRound = false // Reset send tracking for new processing round
+	t.sentInRound.Store(false) // Reset send tracking for new processing round
 }
 
 // HasSentInRound returns true if the message tool sent a message during the current round.
 func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound
+	return t.sentInRound.Load()
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
+// SetSendMediaCallback enables the media argument. Relative paths resolve
+// against workspace, and with restrict only files inside it can be sent.
+func (t *MessageTool) SetSendMediaCallback(workspace string, restrict bool, callback SendMediaCallback) {
+	t.workspace = workspace
+	t.restrict = restrict
+	t.sendMediaCallback = callback
+}
+
+// mediaPaths resolves the media argument to files that may be sent.
+func (t *MessageTool) mediaPaths(args map[string]any) ([]string, error) {
+	raw, _ := args["media"].([]any)
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	if t.sendMediaCallback == nil {
+		return nil, fmt.Errorf("sending files is not configured")
+	}
+
+	paths := make([]string, 0, len(raw))
+	for _, v := range raw {
+		path, ok := v.(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("media must be a list of file paths")
+		}
+		resolved, err := validatePath(path, t.workspace, t.restrict)
+		if err != nil {
+			return nil, fmt.Errorf("media %s: %w", path, err)
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return nil, fmt.Errorf("media %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("media %s is not a regular file", path)
+		}
+		paths = append(paths, resolved)
+	}
+	return paths, nil
+}
+
 func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	content, ok := args["content"].(string)
 	if !ok {
@@ -71,11 +130,12 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 	channel, _ := args["channel"].(string)
 	chatID, _ := args["chat_id"].(string)
 
+	defaultChannel, defaultChatID := turnTarget(ctx, t.defaultChannel, t.defaultChatID)
 	if channel == "" {
-		channel = t.defaultChannel
+		channel = defaultChannel
 	}
 	if chatID == "" {
-		chatID = t.defaultChatID
+		chatID = defaultChatID
 	}
 
 	if channel == "" || chatID == "" {
@@ -86,7 +146,17 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	media, err := t.mediaPaths(args)
+	if err != nil {
+		return &ToolResult{ForLLM: err.Error(), IsError: true, Err: err}
+	}
+
+	if len(media) > 0 {
+		err = t.sendMediaCallback(channel, chatID, content, media)
+	} else {
+		err = t.sendCallback(channel, chatID, content)
+	}
+	if err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -94,7 +164,8 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 		}
 	}
 
-	t.sentInRound = true
+	t.sentInRound.Store(true)
+	TurnContextFrom(ctx).markMessageSent()
 	// Silent: user already received the message directly
 	return &ToolResult{
 		ForLLM: fmt.Sprintf("Message sent to %s:%s", channel, chatID),
@@ -3,6 +3,8 @@ package tools
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -257,3 +259,68 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Execute_UsesTurnContext(t *testing.T) {
+	tool := NewMessageTool()
+	// Stale defaults from another session must not win over the turn context.
+	tool.SetContext("other-channel", "other-chat")
+
+	var sentChannel, sentChatID string
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		sentChannel = channel
+		sentChatID = chatID
+		return nil
+	})
+
+	turn := &TurnContext{Channel: "telegram", ChatID: "chat-1"}
+	ctx := WithTurnContext(context.Background(), turn)
+
+	result := tool.Execute(ctx, map[string]any{"content": "hi"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if sentChannel != "telegram" || sentChatID != "chat-1" {
+		t.Errorf("expected telegram:chat-1, got %s:%s", sentChannel, sentChatID)
+	}
+	if !turn.MessageSent() {
+		t.Error("expected turn context to record the sent message")
+	}
+}
+
+func TestMessageTool_Execute_Media(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "chart.png"), []byte("png"), 0o600)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("secret"), 0o600)
+
+	tool := NewMessageTool()
+	tool.SetContext("matrix", "!room")
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		t.Error("text callback used for a message with media")
+		return nil
+	})
+	var sentMedia []string
+	tool.SetSendMediaCallback(workspace, true, func(channel, chatID, content string, media []string) error {
+		sentMedia = media
+		return nil
+	})
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"content": "Here",
+		"media":   []any{"chart.png"},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if len(sentMedia) != 1 || sentMedia[0] != filepath.Join(workspace, "chart.png") {
+		t.Errorf("media = %v, want the workspace file", sentMedia)
+	}
+
+	for _, path := range []string{outside, "missing.png", "."} {
+		sentMedia = nil
+		result = tool.Execute(context.Background(), map[string]any{"content": "Here", "media": []any{path}})
+		if !result.IsError || sentMedia != nil {
+			t.Errorf("media %q: result %+v, sent %v; want it refused", path, result, sentMedia)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,8 +12,11 @@ import (
 )
 
 type ToolRegistry struct {
-	tools map[string]Tool
-	mu    sync.RWMutex
+	tools    map[string]Tool
+	version  uint64 // bumped whenever the set of tools changes
+	approval *ApprovalPolicy
+	policy   *ToolPolicy
+	mu       sync.RWMutex
 }
 
 func NewToolRegistry() *ToolRegistry {
@@ -25,6 +29,78 @@ func (r *ToolRegistry) Register(tool Tool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.tools[tool.Name()] = tool
+	r.version++
+}
+
+// Unregister removes the named tool, if present.
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[name]; ok {
+		delete(r.tools, name)
+		r.version++
+	}
+}
+
+// Version returns a counter that changes whenever a tool is registered or
+// removed or the tool policy changes, so callers can tell when derived data such as prompts is stale.
+func (r *ToolRegistry) Version() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// sortedTools returns the registered tools the tool policy allows, ordered by
+// name. Callers must hold r.mu. A stable order keeps prompts byte-identical
+// between requests, which provider prompt caches depend on.
+func (r *ToolRegistry) sortedTools() []Tool {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		if r.policy.Allows(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	sorted := make([]Tool, len(names))
+	for i, name := range names {
+		sorted[i] = r.tools[name]
+	}
+	return sorted
+}
+
+// SetToolPolicy restricts the tools offered to the model and the calls the
+// registry runs. A nil policy allows everything.
+func (r *ToolRegistry) SetToolPolicy(policy *ToolPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+	r.version++
+}
+
+func (r *ToolRegistry) toolPolicy() *ToolPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.policy
+}
+
+// CheckPolicy returns why the tool policy would refuse a call of the named
+// tool with args, or nil if it would not. It runs nothing.
+func (r *ToolRegistry) CheckPolicy(name string, args map[string]any) error {
+	return r.toolPolicy().Check(name, args)
+}
+
+// SetApprovalPolicy makes calls matching policy wait for the user's
+// approval before they run. A nil policy runs every call directly.
+func (r *ToolRegistry) SetApprovalPolicy(policy *ApprovalPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.approval = policy
+}
+
+func (r *ToolRegistry) approvalPolicy() *ApprovalPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.approval
 }
 
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
@@ -63,20 +139,51 @@ func (r *ToolRegistry) ExecuteWithContext(
 		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
 	}
 
-	// If tool implements ContextualTool, set context
-	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
-		contextualTool.SetContext(channel, chatID)
+	if err := r.toolPolicy().Check(name, args); err != nil {
+		logger.WarnCF("tool", "Tool call refused by tool policy",
+			map[string]any{
+				"tool":  name,
+				"error": err.Error(),
+			})
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	// Carry channel/chatID on the context so shared tools don't leak state
+	// between concurrently running turns. Callers that don't run inside a
+	// turn context still get the legacy SetContext/SetCallback injection.
+	turn := TurnContextFrom(ctx)
+	if channel != "" && chatID != "" {
+		if turn == nil {
+			if contextualTool, ok := tool.(ContextualTool); ok {
+				contextualTool.SetContext(channel, chatID)
+			}
+		}
+		if turn == nil || turn.Channel != channel || turn.ChatID != chatID {
+			ctx = WithTurnContext(ctx, &TurnContext{Channel: channel, ChatID: chatID, parent: turn})
+		}
 	}
 
-	// If tool implements AsyncTool and callback is provided, set callback
+	// If tool implements AsyncTool and callback is provided, attach callback
 	if asyncTool, ok := tool.(AsyncTool); ok && asyncCallback != nil {
-		asyncTool.SetCallback(asyncCallback)
+		ctx = withAsyncCallback(ctx, asyncCallback)
+		if turn == nil {
+			asyncTool.SetCallback(asyncCallback)
+		}
 		logger.DebugCF("tool", "Async callback injected",
 			map[string]any{
 				"tool": name,
 			})
 	}
 
+	if policy := r.approvalPolicy(); policy != nil {
+		if turn := TurnContextFrom(ctx); turn != nil && channel == "" {
+			channel, chatID = turn.Channel, turn.ChatID
+		}
+		if result := policy.Authorize(ctx, name, args, channel, chatID); result != nil {
+			return result
+		}
+	}
+
 	start := time.Now()
 	result := tool.Execute(ctx, args)
 	duration := time.Since(start)
@@ -107,12 +214,25 @@ func (r *ToolRegistry) ExecuteWithContext(
 	return result
 }
 
+// SerialKey returns the key serializing a call to the named tool, or "" if
+// the call may run alongside others. See SerialTool.
+func (r *ToolRegistry) SerialKey(name string, args map[string]any) string {
+	tool, ok := r.Get(name)
+	if !ok {
+		return ""
+	}
+	if serial, ok := tool.(SerialTool); ok {
+		return serial.SerialKey(args)
+	}
+	return ""
+}
+
 func (r *ToolRegistry) GetDefinitions() []map[string]any {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	definitions := make([]map[string]any, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sortedTools() {
 		definitions = append(definitions, ToolToSchema(tool))
 	}
 	return definitions
@@ -125,7 +245,7 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 	defer r.mu.RUnlock()
 
 	definitions := make([]providers.ToolDefinition, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sortedTools() {
 		schema := ToolToSchema(tool)
 
 		// Safely extract nested values with type checks
@@ -159,9 +279,17 @@ func (r *ToolRegistry) List() []string {
 	for name := range r.tools {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
+// Available returns the tools the tool policy allows, sorted by name.
+func (r *ToolRegistry) Available() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sortedTools()
+}
+
 // Count returns the number of registered tools.
 func (r *ToolRegistry) Count() int {
 	r.mu.RLock()
@@ -176,7 +304,7 @@ func (r *ToolRegistry) GetSummaries() []string {
 	defer r.mu.RUnlock()
 
 	summaries := make([]string, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sortedTools() {
 		summaries = append(summaries, fmt.Sprintf("- `%s` - %s", tool.Name(), tool.Description()))
 	}
 	return summaries
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"context"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -104,6 +105,22 @@ func TestToolRegistry_RegisterOverwrite(t *testing.T) {
 	}
 }
 
+func TestToolRegistry_Unregister(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(newMockTool("echo", "echoes input"))
+	r.Register(newMockTool("other", "stays"))
+
+	r.Unregister("echo")
+	r.Unregister("missing")
+
+	if _, ok := r.Get("echo"); ok {
+		t.Error("expected echo to be removed")
+	}
+	if r.Count() != 1 {
+		t.Errorf("expected 1 remaining tool, got %d", r.Count())
+	}
+}
+
 func TestToolRegistry_Execute_Success(t *testing.T) {
 	r := NewToolRegistry()
 	r.Register(&mockRegistryTool{
@@ -269,6 +286,37 @@ func TestToolRegistry_List(t *testing.T) {
 	}
 }
 
+func TestToolRegistry_StableOrderAndVersion(t *testing.T) {
+	r := NewToolRegistry()
+	v0 := r.Version()
+	for _, name := range []string{"write", "exec", "read", "list"} {
+		r.Register(newMockTool(name, "desc"))
+	}
+	if r.Version() == v0 {
+		t.Error("expected version to change after Register")
+	}
+
+	want := []string{"exec", "list", "read", "write"}
+	for i := 0; i < 5; i++ {
+		defs := r.ToProviderDefs()
+		for j, def := range defs {
+			if def.Function.Name != want[j] {
+				t.Fatalf("ToProviderDefs order = %v, want %v", defs, want)
+			}
+		}
+	}
+
+	v1 := r.Version()
+	r.Unregister("missing")
+	if r.Version() != v1 {
+		t.Error("expected version to stay the same when nothing is removed")
+	}
+	r.Unregister("exec")
+	if r.Version() == v1 {
+		t.Error("expected version to change after Unregister")
+	}
+}
+
 func TestToolRegistry_Count(t *testing.T) {
 	r := NewToolRegistry()
 	if r.Count() != 0 {
@@ -348,3 +396,76 @@ func TestToolRegistry_ConcurrentAccess(t *testing.T) {
 		t.Error("expected tools to be registered after concurrent access")
 	}
 }
+
+func TestToolRegistry_ExecuteWithContext_TurnContextSkipsSetContext(t *testing.T) {
+	r := NewToolRegistry()
+	var gotChannel, gotChatID string
+	ct := &mockCtxTool{
+		mockRegistryTool: *newMockTool("ctx_tool", "needs context"),
+	}
+	r.Register(&turnCapturingTool{mockCtxTool: ct, channel: &gotChannel, chatID: &gotChatID})
+
+	ctx := WithTurnContext(context.Background(), &TurnContext{Channel: "slack", ChatID: "C1"})
+	r.ExecuteWithContext(ctx, "ctx_tool", nil, "slack", "C1", nil)
+
+	if ct.channel != "" || ct.chatID != "" {
+		t.Error("SetContext should not be called when a turn context is present")
+	}
+	if gotChannel != "slack" || gotChatID != "C1" {
+		t.Errorf("expected tool to see slack:C1 from context, got %s:%s", gotChannel, gotChatID)
+	}
+}
+
+type turnCapturingTool struct {
+	*mockCtxTool
+	channel *string
+	chatID  *string
+}
+
+func (m *turnCapturingTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	*m.channel, *m.chatID = turnTarget(ctx, "", "")
+	return m.result
+}
+
+func TestToolRegistry_SerialKey(t *testing.T) {
+	workspace := t.TempDir()
+	r := NewToolRegistry()
+	r.Register(NewReadFileTool(workspace, true))
+	r.Register(NewEditFileTool(workspace, true))
+	r.Register(NewI2CTool())
+	r.Register(&mockRegistryTool{name: "web_search"})
+
+	read := r.SerialKey("read_file", map[string]any{"path": "notes/a.md"})
+	edit := r.SerialKey("edit_file", map[string]any{"path": filepath.Join(workspace, "notes", "a.md")})
+	if read == "" || read != edit {
+		t.Errorf("read and edit of the same file got keys %q and %q, want one shared key", read, edit)
+	}
+	if other := r.SerialKey("edit_file", map[string]any{"path": "notes/b.md"}); other == edit {
+		t.Errorf("edits of different files share key %q", other)
+	}
+	if key := r.SerialKey("i2c", map[string]any{"action": "scan"}); key == "" {
+		t.Error("i2c calls should be serialized")
+	}
+	if key := r.SerialKey("web_search", nil); key != "" {
+		t.Errorf("web_search key = %q, want none", key)
+	}
+	if key := r.SerialKey("missing", nil); key != "" {
+		t.Errorf("unknown tool key = %q, want none", key)
+	}
+}
+
+func TestToolRegistry_ExecuteWithContext_OtherTargetKeepsMessageSent(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetSendCallback(func(channel, chatID, content string) error { return nil })
+	r := NewToolRegistry()
+	r.Register(tool)
+
+	// The turn's target is set after the context is created, as in the agent loop
+	turn := &TurnContext{}
+	ctx := WithTurnContext(context.Background(), turn)
+	r.ExecuteWithContext(ctx, "message", map[string]any{"content": "hi"}, "telegram", "chat-1", nil)
+
+	if !turn.MessageSent() {
+		t.Error("a message sent through a per-call context should mark the turn")
+	}
+}
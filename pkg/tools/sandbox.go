@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Resource limits of sandboxed commands when the config leaves them unset.
+const (
+	defaultSandboxCPUSeconds    = 120
+	defaultSandboxMemoryMB      = 1024
+	defaultSandboxMaxProcesses  = 1024
+	defaultSandboxMaxFileSizeMB = 512
+)
+
+// sandboxSpecEnv carries the sandbox spec to the re-executed binary that
+// sets the sandbox up and then runs the command.
+const sandboxSpecEnv = "PICOCLAW_EXEC_SANDBOX"
+
+// sandboxSystemPaths are the host directories visible read-only in the
+// sandbox. Missing ones are skipped and symlinks, such as /bin on merged-/usr
+// systems, are recreated as symlinks.
+var sandboxSystemPaths = []string{
+	"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/libx32", "/etc", "/opt",
+}
+
+// sandboxEnvVars are the variables passed through to sandboxed commands.
+// Everything else, API keys included, stays outside.
+var sandboxEnvVars = []string{"PATH", "LANG", "LC_ALL", "LC_CTYPE", "TERM", "TZ"}
+
+// sandboxSpec describes one sandboxed command.
+type sandboxSpec struct {
+	Command       string   `json:"command"`
+	Dir           string   `json:"dir"`
+	Workspace     string   `json:"workspace"`
+	ReadOnlyPaths []string `json:"read_only_paths,omitempty"`
+	WritablePaths []string `json:"writable_paths,omitempty"`
+	Network       bool     `json:"network"`
+	CPUSeconds    int      `json:"cpu_seconds"`
+	MemoryMB      int      `json:"memory_mb"`
+	MaxProcesses  int      `json:"max_processes"`
+	MaxFileSizeMB int      `json:"max_file_size_mb"`
+	Env           []string `json:"env"`
+}
+
+// newSandboxSpec builds the spec for running command in dir, with the
+// workspace writable and network access as allowed for the agent.
+func newSandboxSpec(cfg config.ExecSandboxConfig, network bool, workspace, dir, command string) sandboxSpec {
+	spec := sandboxSpec{
+		Command:       command,
+		Dir:           dir,
+		Workspace:     absPath(workspace),
+		ReadOnlyPaths: absPaths(cfg.ReadOnlyPaths),
+		WritablePaths: absPaths(cfg.WritablePaths),
+		Network:       network,
+		CPUSeconds:    orDefault(cfg.CPUSeconds, defaultSandboxCPUSeconds),
+		MemoryMB:      orDefault(cfg.MemoryMB, defaultSandboxMemoryMB),
+		MaxProcesses:  orDefault(cfg.MaxProcesses, defaultSandboxMaxProcesses),
+		MaxFileSizeMB: orDefault(cfg.MaxFileSizeMB, defaultSandboxMaxFileSizeMB),
+	}
+	if spec.Dir == "" {
+		spec.Dir = spec.Workspace
+	}
+	for _, name := range sandboxEnvVars {
+		if value, ok := os.LookupEnv(name); ok {
+			spec.Env = append(spec.Env, name+"="+value)
+		}
+	}
+	spec.Env = append(spec.Env, "HOME="+spec.Workspace, "TMPDIR=/tmp")
+	return spec
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+func absPaths(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p != "" {
+			out = append(out, absPath(p))
+		}
+	}
+	return out
+}
+
+func orDefault(value, def int) int {
+	if value > 0 {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,550 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	// The sandboxed command starts as a copy of this binary, which becomes
+	// PID 1 of the new namespaces, locks itself down and execs the shell.
+	if spec := os.Getenv(sandboxSpecEnv); spec != "" && os.Getpid() == 1 {
+		runSandboxChild(spec)
+	}
+}
+
+// newSandboxCommand returns a command that runs spec in a new sandbox.
+func newSandboxCommand(ctx context.Context, spec sandboxSpec) (*exec.Cmd, error) {
+	if _, ok := seccompArchs[runtime.GOARCH]; !ok {
+		return nil, fmt.Errorf("exec sandbox is not supported on %s", runtime.GOARCH)
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	cloneFlags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if !spec.Network {
+		cloneFlags |= syscall.CLONE_NEWNET
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{"picoclaw-sandbox"}
+	cmd.Env = []string{sandboxSpecEnv + "=" + string(data)}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Pdeathsig:  syscall.SIGKILL,
+		Cloneflags: cloneFlags,
+		// Root inside the namespace is the calling user outside of it
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+	}
+	return cmd, nil
+}
+
+// runSandboxChild sets up the sandbox described by data and execs the
+// command. It only returns by exiting with status 126 on failure.
+func runSandboxChild(data string) {
+	// Landlock, seccomp and no_new_privs apply per thread and carry over
+	// execve, so everything must happen on the thread that execs
+	runtime.LockOSThread()
+
+	var spec sandboxSpec
+	err := json.Unmarshal([]byte(data), &spec)
+	if err == nil {
+		err = enterSandbox(spec)
+	}
+	if err == nil {
+		err = unix.Exec("/bin/sh", []string{"sh", "-c", spec.Command}, spec.Env)
+	}
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+func enterSandbox(spec sandboxSpec) error {
+	if err := setupFilesystem(spec); err != nil {
+		return err
+	}
+	if err := os.Chdir(spec.Dir); err != nil {
+		return fmt.Errorf("working directory %s is not available in the sandbox", spec.Dir)
+	}
+	_ = unix.Sethostname([]byte("sandbox"))
+	bringUpLoopback()
+	if err := setLimits(spec); err != nil {
+		return err
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("no_new_privs: %w", err)
+	}
+	if err := dropCapabilityBounds(); err != nil {
+		return err
+	}
+	if err := applyLandlock(spec); err != nil {
+		return err
+	}
+	if err := applySeccomp(); err != nil {
+		return err
+	}
+	return clearCapabilities()
+}
+
+// setupFilesystem builds a new root on a tmpfs with the system directories
+// bound read-only, the workspace and writable paths bound read-write and
+// fresh /tmp, /dev and /proc, then switches to it and detaches the host root.
+func setupFilesystem(spec sandboxSpec) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	// Pivot onto a tmpfs first so that host paths, even ones under /tmp,
+	// stay reachable below /oldroot while the new root is assembled
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mount base tmpfs: %w", err)
+	}
+	for _, dir := range []string{"/tmp/oldroot", "/tmp/newroot"} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	if err := unix.PivotRoot("/tmp", "/tmp/oldroot"); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Mount("/newroot", "/newroot", "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind new root: %w", err)
+	}
+
+	for _, path := range sandboxSystemPaths {
+		if err := bindHostPath(path, false, true); err != nil {
+			return err
+		}
+	}
+	if err := mountSpecialFilesystems(); err != nil {
+		return err
+	}
+	for _, path := range spec.ReadOnlyPaths {
+		if err := bindHostPath(path, false, false); err != nil {
+			return err
+		}
+	}
+	for _, path := range append([]string{spec.Workspace}, spec.WritablePaths...) {
+		if err := bindHostPath(path, true, false); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Chdir("/newroot"); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach host root: %w", err)
+	}
+	return os.Chdir("/")
+}
+
+// bindHostPath makes the host path visible at the same place in the new
+// root. With optional set, a missing path is skipped.
+func bindHostPath(path string, writable, optional bool) error {
+	source := "/oldroot" + path
+	target := "/newroot" + path
+	info, err := os.Lstat(source)
+	if err != nil {
+		if optional {
+			return nil
+		}
+		return fmt.Errorf("sandbox path %s: %w", path, err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 && optional {
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	}
+
+	if info, err = os.Stat(source); err != nil {
+		return fmt.Errorf("sandbox path %s: %w", path, err)
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0o755)
+	} else {
+		err = createEmptyFile(target)
+	}
+	if err != nil {
+		return fmt.Errorf("sandbox path %s: %w", path, err)
+	}
+
+	if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", path, err)
+	}
+	if writable {
+		return nil
+	}
+	// A read-only remount must keep the flags the kernel locked on the
+	// original mount, or it fails inside a user namespace
+	var st unix.Statfs_t
+	if err := unix.Statfs(target, &st); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY) | lockedMountFlags(int64(st.Flags))
+	if err := unix.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("make %s read-only: %w", path, err)
+	}
+	return nil
+}
+
+func lockedMountFlags(statfsFlags int64) uintptr {
+	var flags uintptr
+	for st, ms := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if statfsFlags&st != 0 {
+			flags |= ms
+		}
+	}
+	return flags
+}
+
+// mountSpecialFilesystems gives the new root its own /tmp, a minimal /dev
+// and a /proc for the new PID namespace.
+func mountSpecialFilesystems() error {
+	for _, dir := range []string{"/newroot/tmp", "/newroot/dev", "/newroot/proc"} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	if err := unix.Mount("tmpfs", "/newroot/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount /tmp: %w", err)
+	}
+
+	if err := unix.Mount("tmpfs", "/newroot/dev", "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=0755"); err != nil {
+		return fmt.Errorf("mount /dev: %w", err)
+	}
+	for _, name := range []string{"null", "zero", "full", "random", "urandom", "tty"} {
+		target := "/newroot/dev/" + name
+		if err := createEmptyFile(target); err != nil {
+			return err
+		}
+		if err := unix.Mount("/oldroot/dev/"+name, target, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("bind /dev/%s: %w", name, err)
+		}
+	}
+	for name, link := range map[string]string{
+		"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2",
+	} {
+		if err := os.Symlink(link, "/newroot/dev/"+name); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir("/newroot/dev/shm", 0o1777); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", "/newroot/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount /dev/shm: %w", err)
+	}
+
+	flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	if err := unix.Mount("proc", "/newroot/proc", "proc", flags, ""); err != nil {
+		// Container runtimes mask parts of /proc, which forbids a fresh
+		// mount; the existing one still works, if less isolated
+		if err := unix.Mount("/oldroot/proc", "/newroot/proc", "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("mount /proc: %w", err)
+		}
+	}
+	return nil
+}
+
+func createEmptyFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// bringUpLoopback enables lo in a new network namespace, where it starts
+// down, so local servers and clients still work without network access.
+func bringUpLoopback() {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil || unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr) != nil {
+		return
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	_ = unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+func setLimits(spec sandboxSpec) error {
+	const mb = 1 << 20
+	limits := []struct {
+		resource int
+		value    uint64
+		name     string
+	}{
+		{unix.RLIMIT_CPU, uint64(spec.CPUSeconds), "cpu"},
+		{unix.RLIMIT_DATA, uint64(spec.MemoryMB) * mb, "memory"},
+		{unix.RLIMIT_NPROC, uint64(spec.MaxProcesses), "processes"},
+		{unix.RLIMIT_FSIZE, uint64(spec.MaxFileSizeMB) * mb, "file size"},
+		{unix.RLIMIT_CORE, 0, "core size"},
+	}
+	for _, l := range limits {
+		if err := unix.Setrlimit(l.resource, &unix.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return fmt.Errorf("set %s limit: %w", l.name, err)
+		}
+	}
+	return nil
+}
+
+// dropCapabilityBounds empties the capability bounding set, so that the
+// command, although root inside the namespace, gets no capabilities on exec.
+func dropCapabilityBounds() error {
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil &&
+		!errors.Is(err, unix.EINVAL) {
+		return fmt.Errorf("clear ambient capabilities: %w", err)
+	}
+	for c := 0; c <= 63; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			if errors.Is(err, unix.EINVAL) {
+				break // past the last capability the kernel knows
+			}
+			return fmt.Errorf("drop capability %d: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// clearCapabilities drops the remaining capabilities of this process,
+// including inheritable ones, which root would otherwise keep across exec.
+func clearCapabilities() error {
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("clear capabilities: %w", err)
+	}
+	return nil
+}
+
+// Landlock filesystem access rights, by the ABI version that introduced them.
+const (
+	landlockAccessV1 = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG | unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+	landlockAccessV2 = landlockAccessV1 | unix.LANDLOCK_ACCESS_FS_REFER
+	landlockAccessV3 = landlockAccessV2 | unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	landlockAccessV5 = landlockAccessV3 | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+
+	landlockRead     = unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	landlockReadExec = landlockRead | unix.LANDLOCK_ACCESS_FS_EXECUTE
+	landlockDevices  = landlockRead | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+	landlockFileOnly = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+)
+
+// applyLandlock restricts filesystem access to the sandbox's own paths, as a
+// second line behind the mount layout. Kernels without Landlock (before 5.13)
+// are left to the mount layout alone.
+func applyLandlock(spec sandboxSpec) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return nil
+	}
+	handled := uint64(landlockAccessV5)
+	switch {
+	case abi == 1:
+		handled = landlockAccessV1
+	case abi == 2:
+		handled = landlockAccessV2
+	case abi < 5:
+		handled = landlockAccessV3
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer unix.Close(ruleset)
+
+	// Listing directories is harmless on the new root, which holds nothing
+	// but what was mounted into it
+	rules := map[string]uint64{
+		"/":     unix.LANDLOCK_ACCESS_FS_READ_DIR,
+		"/proc": landlockRead,
+		"/dev":  landlockDevices,
+	}
+	for _, path := range append(sandboxSystemPaths, spec.ReadOnlyPaths...) {
+		rules[path] = landlockReadExec
+	}
+	for _, path := range append([]string{spec.Workspace, "/tmp", "/dev/shm"}, spec.WritablePaths...) {
+		rules[path] = handled
+	}
+	for path, access := range rules {
+		if err := addLandlockRule(ruleset, path, access&handled); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("landlock restrict: %w", errno)
+	}
+	return nil
+}
+
+func addLandlockRule(ruleset int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil // not present in this sandbox
+	}
+	defer unix.Close(fd)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return err
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= landlockFileOnly
+	}
+	attr := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset),
+		unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&attr)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock rule for %s: %w", path, errno)
+	}
+	return nil
+}
+
+// seccompArch describes the syscall ABI of an architecture for the filter.
+type seccompArch struct {
+	audit         uint32
+	bigEndian     bool
+	cloneFlagsArg int // s390 passes the stack first
+}
+
+var seccompArchs = map[string]seccompArch{
+	"386":      {audit: unix.AUDIT_ARCH_I386},
+	"amd64":    {audit: unix.AUDIT_ARCH_X86_64},
+	"arm":      {audit: unix.AUDIT_ARCH_ARM},
+	"arm64":    {audit: unix.AUDIT_ARCH_AARCH64},
+	"loong64":  {audit: unix.AUDIT_ARCH_LOONGARCH64},
+	"mips64":   {audit: unix.AUDIT_ARCH_MIPS64, bigEndian: true},
+	"mips64le": {audit: unix.AUDIT_ARCH_MIPSEL64},
+	"ppc64le":  {audit: unix.AUDIT_ARCH_PPC64LE},
+	"riscv64":  {audit: unix.AUDIT_ARCH_RISCV64},
+	"s390x":    {audit: unix.AUDIT_ARCH_S390X, bigEndian: true, cloneFlagsArg: 1},
+}
+
+// seccompDenied are syscalls a sandboxed command has no use for and that
+// widen the kernel surface it can reach. They fail with EPERM.
+var seccompDenied = []uintptr{
+	unix.SYS_MOUNT, unix.SYS_UMOUNT2, unix.SYS_PIVOT_ROOT, unix.SYS_CHROOT,
+	unix.SYS_FSOPEN, unix.SYS_FSCONFIG, unix.SYS_FSMOUNT, unix.SYS_FSPICK,
+	unix.SYS_MOVE_MOUNT, unix.SYS_OPEN_TREE, unix.SYS_MOUNT_SETATTR,
+	unix.SYS_UNSHARE, unix.SYS_SETNS,
+	unix.SYS_PTRACE, unix.SYS_PROCESS_VM_READV, unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_KEXEC_LOAD, unix.SYS_INIT_MODULE, unix.SYS_FINIT_MODULE, unix.SYS_DELETE_MODULE,
+	unix.SYS_REBOOT, unix.SYS_SWAPON, unix.SYS_SWAPOFF, unix.SYS_ACCT, unix.SYS_QUOTACTL,
+	unix.SYS_BPF, unix.SYS_PERF_EVENT_OPEN, unix.SYS_USERFAULTFD, unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_KEYCTL, unix.SYS_ADD_KEY, unix.SYS_REQUEST_KEY,
+	unix.SYS_SETTIMEOFDAY, unix.SYS_CLOCK_SETTIME, unix.SYS_CLOCK_ADJTIME,
+}
+
+// cloneNamespaceFlags are the clone flags that create namespaces.
+const cloneNamespaceFlags = unix.CLONE_NEWNS | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC | unix.CLONE_NEWUSER |
+	unix.CLONE_NEWPID | unix.CLONE_NEWNET | unix.CLONE_NEWCGROUP | unix.CLONE_NEWTIME
+
+// applySeccomp installs a filter that kills the process on a foreign
+// syscall ABI, fails the denied syscalls and namespace-creating clones with
+// EPERM, and makes clone3, whose flags it cannot inspect, fall back to clone.
+func applySeccomp() error {
+	arch := seccompArchs[runtime.GOARCH]
+	const (
+		offNr   = 0
+		offArch = 4
+		offArgs = 16
+	)
+	stmt := func(code uint16, k uint32) unix.SockFilter { return unix.SockFilter{Code: code, K: k} }
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+	const (
+		load  = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		jeq   = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jge   = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		jset  = unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K
+		ret   = unix.BPF_RET | unix.BPF_K
+		eperm = unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+	)
+
+	filter := []unix.SockFilter{
+		stmt(load, offArch),
+		jump(jeq, arch.audit, 1, 0),
+		stmt(ret, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(load, offNr),
+	}
+	if runtime.GOARCH == "amd64" {
+		// x32 syscalls reach the same kernel entry points with this bit set
+		filter = append(filter, jump(jge, 0x40000000, 0, 1), stmt(ret, eperm))
+	}
+	for _, nr := range seccompDenied {
+		filter = append(filter, jump(jeq, uint32(nr), 0, 1), stmt(ret, eperm))
+	}
+	cloneFlagsOffset := uint32(offArgs + 8*arch.cloneFlagsArg)
+	if arch.bigEndian {
+		cloneFlagsOffset += 4 // low word of the 64-bit argument
+	}
+	filter = append(filter,
+		jump(jeq, uint32(unix.SYS_CLONE3), 0, 1),
+		stmt(ret, unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)),
+		jump(jeq, uint32(unix.SYS_CLONE), 0, 3),
+		stmt(load, cloneFlagsOffset),
+		jump(jset, cloneNamespaceFlags, 0, 1),
+		stmt(ret, eperm),
+		stmt(ret, unix.SECCOMP_RET_ALLOW),
+	)
+
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("seccomp: %w", err)
+	}
+	return nil
+}
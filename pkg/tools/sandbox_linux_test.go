@@ -0,0 +1,124 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newSandboxedExecTool(t *testing.T, workspace string) *ExecTool {
+	t.Helper()
+
+	// Hosts without unprivileged user namespaces cannot run the sandbox
+	cmd, err := newSandboxCommand(context.Background(), newSandboxSpec(config.ExecSandboxConfig{}, false, workspace, "", "true"))
+	if err != nil {
+		t.Skipf("sandbox not supported: %v", err)
+	}
+	if err := cmd.Run(); errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.ENOSPC) {
+		t.Skipf("user namespaces not available: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.Sandbox = config.ExecSandboxConfig{Enabled: true, MaxFileSizeMB: 8}
+	return NewExecToolWithConfig(workspace, false, cfg)
+}
+
+func TestExecSandbox_Filesystem(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "workspace")
+	if err := os.Mkdir(workspace, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tool := newSandboxedExecTool(t, workspace)
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]any{"command": "echo sandboxed > out.txt && cat out.txt"})
+	if result.IsError || !strings.Contains(result.ForLLM, "sandboxed") {
+		t.Fatalf("workspace write failed: %s", result.ForLLM)
+	}
+	if data, err := os.ReadFile(filepath.Join(workspace, "out.txt")); err != nil || string(data) != "sandboxed\n" {
+		t.Errorf("out.txt on the host = %q, %v", data, err)
+	}
+
+	if result := tool.Execute(ctx, map[string]any{"command": "touch /etc/sandbox-test"}); !result.IsError {
+		t.Errorf("writing to /etc should fail, got: %s", result.ForLLM)
+	}
+	if result := tool.Execute(ctx, map[string]any{"command": "cat " + filepath.Join(root, "secret.txt")}); !result.IsError {
+		t.Errorf("files outside the workspace should be hidden, got: %s", result.ForLLM)
+	}
+}
+
+func TestExecSandbox_Restrictions(t *testing.T) {
+	t.Setenv("PICOCLAW_TEST_SECRET", "hunter2")
+	tool := newSandboxedExecTool(t, t.TempDir())
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]any{"command": "grep -E '^(Seccomp|NoNewPrivs|CapEff):' /proc/self/status"})
+	if result.IsError {
+		t.Fatalf("reading status failed: %s", result.ForLLM)
+	}
+	for _, want := range []string{"Seccomp:\t2", "NoNewPrivs:\t1", "CapEff:\t0000000000000000"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("status missing %q:\n%s", want, result.ForLLM)
+		}
+	}
+
+	result = tool.Execute(ctx, map[string]any{"command": "grep 'Max file size' /proc/self/limits"})
+	if !strings.Contains(result.ForLLM, "8388608") {
+		t.Errorf("file size limit not applied: %s", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]any{"command": "env"})
+	if strings.Contains(result.ForLLM, "hunter2") {
+		t.Errorf("environment leaked into the sandbox:\n%s", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]any{"command": "unshare -r true"})
+	if !result.IsError {
+		t.Errorf("creating namespaces should fail, got: %s", result.ForLLM)
+	}
+}
+
+func TestExecSandbox_Network(t *testing.T) {
+	tool := newSandboxedExecTool(t, t.TempDir())
+	ctx := context.Background()
+
+	interfaces := func() []string {
+		result := tool.Execute(ctx, map[string]any{"command": "cat /proc/net/dev"})
+		if result.IsError {
+			t.Fatalf("reading /proc/net/dev failed: %s", result.ForLLM)
+		}
+		var names []string
+		for _, line := range strings.Split(result.ForLLM, "\n") {
+			if name, _, ok := strings.Cut(line, ":"); ok && !strings.Contains(name, "|") {
+				names = append(names, strings.TrimSpace(name))
+			}
+		}
+		return names
+	}
+
+	if names := interfaces(); len(names) != 1 || names[0] != "lo" {
+		t.Errorf("interfaces without network = %v, want only lo", names)
+	}
+
+	tool.SetSandboxNetwork(true)
+	host, err := os.ReadFile("/proc/net/dev")
+	if err != nil {
+		t.Skip("no /proc/net/dev on the host")
+	}
+	if names := interfaces(); len(names) != strings.Count(string(host), ":") {
+		t.Errorf("interfaces with network = %v, want the host's", names)
+	}
+}
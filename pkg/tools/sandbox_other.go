@@ -0,0 +1,13 @@
+//go:build !linux
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+func newSandboxCommand(ctx context.Context, spec sandboxSpec) (*exec.Cmd, error) {
+	return nil, errors.New("exec sandbox requires Linux")
+}
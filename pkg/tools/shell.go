@@ -22,6 +22,8 @@ type ExecTool struct {
 	denyPatterns        []*regexp.Regexp
 	allowPatterns       []*regexp.Regexp
 	restrictToWorkspace bool
+	sandbox             config.ExecSandboxConfig
+	sandboxNetwork      bool
 }
 
 var defaultDenyPatterns = []*regexp.Regexp{
@@ -102,19 +104,31 @@ func NewExecToolWithConfig(workingDir string, restrict bool, config *config.Conf
 		denyPatterns = append(denyPatterns, defaultDenyPatterns...)
 	}
 
-	return &ExecTool{
+	tool := &ExecTool{
 		workingDir:          workingDir,
 		timeout:             60 * time.Second,
 		denyPatterns:        denyPatterns,
 		allowPatterns:       nil,
 		restrictToWorkspace: restrict,
 	}
+	if config != nil {
+		tool.sandbox = config.Tools.Exec.Sandbox
+		tool.sandboxNetwork = tool.sandbox.Network
+	}
+	return tool
 }
 
 func (t *ExecTool) Name() string {
 	return "exec"
 }
 
+// SerialKey runs commands alone and in order, since a command can read or
+// change any file the other calls touch, and later calls often depend on
+// its effects.
+func (t *ExecTool) SerialKey(args map[string]any) string {
+	return SerialExclusive
+}
+
 func (t *ExecTool) Description() string {
 	return "Execute a shell command and return its output. Use with caution."
 }
@@ -177,16 +191,27 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	defer cancel()
 
 	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
+	if t.sandbox.Enabled {
+		// Fail closed: a sandbox that cannot be set up never falls back
+		// to running the command directly
+		spec := newSandboxSpec(t.sandbox, t.sandboxNetwork, t.workingDir, cwd, command)
+		sandboxed, err := newSandboxCommand(cmdCtx, spec)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to sandbox command: %v", err))
+		}
+		cmd = sandboxed
 	} else {
-		cmd = exec.CommandContext(cmdCtx, "sh", "-c", command)
-	}
-	if cwd != "" {
-		cmd.Dir = cwd
-	}
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
+		} else {
+			cmd = exec.CommandContext(cmdCtx, "sh", "-c", command)
+		}
+		if cwd != "" {
+			cmd.Dir = cwd
+		}
 
-	prepareCommandForTermination(cmd)
+		prepareCommandForTermination(cmd)
+	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -321,6 +346,11 @@ func (t *ExecTool) SetRestrictToWorkspace(restrict bool) {
 	t.restrictToWorkspace = restrict
 }
 
+// SetSandboxNetwork sets whether sandboxed commands may use the network.
+func (t *ExecTool) SetSandboxNetwork(allow bool) {
+	t.sandboxNetwork = allow
+}
+
 func (t *ExecTool) SetAllowPatterns(patterns []string) error {
 	t.allowPatterns = make([]*regexp.Regexp, 0, len(patterns))
 	for _, p := range patterns {
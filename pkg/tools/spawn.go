@@ -50,6 +50,7 @@ func (t *SpawnTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Optional target agent ID to delegate the task to",
 			},
+			"response_schema": responseSchemaParameter(),
 		},
 		"required": []string{"task"},
 	}
@@ -72,6 +73,7 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]any) *ToolResul
 
 	label, _ := args["label"].(string)
 	agentID, _ := args["agent_id"].(string)
+	format := responseFormatArg(args)
 
 	// Check allowlist if targeting a specific agent
 	if agentID != "" && t.allowlistCheck != nil {
@@ -85,7 +87,8 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]any) *ToolResul
 	}
 
 	// Pass callback to manager for async completion notification
-	result, err := t.manager.Spawn(ctx, task, label, agentID, t.originChannel, t.originChatID, t.callback)
+	originChannel, originChatID := turnTarget(ctx, t.originChannel, t.originChatID)
+	result, err := t.manager.Spawn(ctx, task, label, agentID, originChannel, originChatID, format, callbackFor(ctx, t.callback))
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to spawn subagent: %v", err))
 	}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/usage"
 )
 
 type SubagentTask struct {
@@ -20,6 +21,8 @@ type SubagentTask struct {
 	Status        string
 	Result        string
 	Created       int64
+	// ResponseFormat, when set, asks for a structured final answer.
+	ResponseFormat *providers.ResponseFormat
 }
 
 type SubagentManager struct {
@@ -83,6 +86,7 @@ func (sm *SubagentManager) RegisterTool(tool Tool) {
 func (sm *SubagentManager) Spawn(
 	ctx context.Context,
 	task, label, agentID, originChannel, originChatID string,
+	format *providers.ResponseFormat,
 	callback AsyncCallback,
 ) (string, error) {
 	sm.mu.Lock()
@@ -92,14 +96,15 @@ func (sm *SubagentManager) Spawn(
 	sm.nextID++
 
 	subagentTask := &SubagentTask{
-		ID:            taskID,
-		Task:          task,
-		Label:         label,
-		AgentID:       agentID,
-		OriginChannel: originChannel,
-		OriginChatID:  originChatID,
-		Status:        "running",
-		Created:       time.Now().UnixMilli(),
+		ID:             taskID,
+		Task:           task,
+		Label:          label,
+		AgentID:        agentID,
+		OriginChannel:  originChannel,
+		OriginChatID:   originChatID,
+		Status:         "running",
+		Created:        time.Now().UnixMilli(),
+		ResponseFormat: format,
 	}
 	sm.tasks[taskID] = subagentTask
 
@@ -115,6 +120,7 @@ func (sm *SubagentManager) Spawn(
 func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, callback AsyncCallback) {
 	task.Status = "running"
 	task.Created = time.Now().UnixMilli()
+	ctx = usage.WithKind(ctx, usage.KindSubagent)
 
 	// Build system prompt for subagent
 	systemPrompt := `You are a subagent. Complete the given task independently and report the result.
@@ -165,11 +171,12 @@ After completing the task, provide a clear summary of what was done.`
 	}
 
 	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
-		Provider:      sm.provider,
-		Model:         sm.defaultModel,
-		Tools:         tools,
-		MaxIterations: maxIter,
-		LLMOptions:    llmOptions,
+		Provider:       sm.provider,
+		Model:          sm.defaultModel,
+		Tools:          tools,
+		MaxIterations:  maxIter,
+		LLMOptions:     llmOptions,
+		ResponseFormat: task.ResponseFormat,
 	}, messages, task.OriginChannel, task.OriginChatID)
 
 	sm.mu.Lock()
@@ -283,6 +290,7 @@ func (t *SubagentTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Optional short label for the task (for display)",
 			},
+			"response_schema": responseSchemaParameter(),
 		},
 		"required": []string{"task"},
 	}
@@ -300,6 +308,7 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 	}
 
 	label, _ := args["label"].(string)
+	format := responseFormatArg(args)
 
 	if t.manager == nil {
 		return ErrorResult("Subagent manager not configured").WithError(fmt.Errorf("manager is nil"))
@@ -339,13 +348,15 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 		}
 	}
 
-	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
-		Provider:      sm.provider,
-		Model:         sm.defaultModel,
-		Tools:         tools,
-		MaxIterations: maxIter,
-		LLMOptions:    llmOptions,
-	}, messages, t.originChannel, t.originChatID)
+	originChannel, originChatID := turnTarget(ctx, t.originChannel, t.originChatID)
+	loopResult, err := RunToolLoop(usage.WithKind(ctx, usage.KindSubagent), ToolLoopConfig{
+		Provider:       sm.provider,
+		Model:          sm.defaultModel,
+		Tools:          tools,
+		MaxIterations:  maxIter,
+		LLMOptions:     llmOptions,
+		ResponseFormat: format,
+	}, messages, originChannel, originChatID)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("Subagent execution failed: %v", err)).WithError(err)
 	}
@@ -373,3 +384,21 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 		Async:   false,
 	}
 }
+
+// responseSchemaParameter describes the optional schema a subagent's final
+// answer must match.
+func responseSchemaParameter() map[string]any {
+	return map[string]any{
+		"type":        "object",
+		"description": "Optional JSON schema the subagent's final answer must match; pass {} for any JSON object",
+	}
+}
+
+// responseFormatArg returns the response format requested in args, or nil.
+func responseFormatArg(args map[string]any) *providers.ResponseFormat {
+	schema, ok := args["response_schema"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	return providers.NewResponseFormat(schema)
+}
@@ -348,3 +348,63 @@ func TestSubagentTool_ForUserTruncation(t *testing.T) {
 		t.Error("ForLLM should contain reference to original task")
 	}
 }
+
+// scriptedProvider returns its replies in order and records the requests.
+type scriptedProvider struct {
+	replies  []string
+	messages [][]providers.Message
+	options  []map[string]any
+}
+
+func (p *scriptedProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	p.messages = append(p.messages, messages)
+	p.options = append(p.options, options)
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return &providers.LLMResponse{Content: reply}, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestSubagentTool_Execute_ResponseSchema(t *testing.T) {
+	provider := &scriptedProvider{replies: []string{"The answer is 4.", "```json\n{\"answer\": 4}\n```"}}
+	manager := NewSubagentManager(provider, "test-model", "/tmp/test", nil)
+	tool := NewSubagentTool(manager)
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"task": "What is 2+2?",
+		"response_schema": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"answer": map[string]any{"type": "integer"}},
+			"required":   []any{"answer"},
+		},
+	})
+	if result.IsError {
+		t.Fatalf("Execute() error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, `Result: {"answer":4}`) {
+		t.Errorf("ForLLM = %q, want the validated JSON", result.ForLLM)
+	}
+
+	if len(provider.messages) != 2 {
+		t.Fatalf("LLM calls = %d, want the answer and one retry", len(provider.messages))
+	}
+	if !strings.Contains(provider.messages[0][0].Content, "JSON schema") {
+		t.Errorf("system prompt does not ask for the schema: %q", provider.messages[0][0].Content)
+	}
+	if _, ok := provider.options[0][providers.ResponseFormatOption].(*providers.ResponseFormat); !ok {
+		t.Errorf("options = %v, want a response format", provider.options[0])
+	}
+	retry := provider.messages[1]
+	if last := retry[len(retry)-1]; last.Role != "user" || !strings.Contains(last.Content, "not valid JSON") {
+		t.Errorf("retry message = %+v", last)
+	}
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+type argConstraint struct {
+	config.ArgConstraint
+	pattern *regexp.Regexp
+	invalid bool // the pattern did not compile, so no value passes
+}
+
+// ToolPolicy restricts which tools an agent may use and the arguments it may
+// pass them. The registry hides tools the policy does not allow and refuses
+// calls that break it.
+type ToolPolicy struct {
+	allow     []string
+	deny      []string
+	args      map[string]map[string]argConstraint
+	workspace string
+}
+
+// NewToolPolicy builds the policy for cfg, or returns nil when cfg is nil.
+// Relative paths in within constraints and in arguments resolve against
+// workspace. A pattern that does not compile rejects every value, so a typo
+// never lets calls through unchecked.
+func NewToolPolicy(cfg *config.ToolPolicyConfig, workspace string) *ToolPolicy {
+	if cfg == nil {
+		return nil
+	}
+
+	p := &ToolPolicy{
+		allow:     cfg.Allow,
+		deny:      cfg.Deny,
+		args:      make(map[string]map[string]argConstraint, len(cfg.Args)),
+		workspace: workspace,
+	}
+	for tool, constraints := range cfg.Args {
+		p.args[tool] = make(map[string]argConstraint, len(constraints))
+		for arg, ac := range constraints {
+			c := argConstraint{ArgConstraint: ac}
+			if ac.Pattern != "" {
+				re, err := regexp.Compile(ac.Pattern)
+				if err != nil {
+					logger.WarnCF("tool", "Invalid argument pattern, rejecting every value",
+						map[string]any{
+							"tool":    tool,
+							"arg":     arg,
+							"pattern": ac.Pattern,
+							"error":   err.Error(),
+						})
+					c.invalid = true
+				}
+				c.pattern = re
+			}
+			p.args[tool][arg] = c
+		}
+	}
+	return p
+}
+
+// Allows reports whether the named tool may be used at all.
+func (p *ToolPolicy) Allows(name string) bool {
+	if p == nil {
+		return true
+	}
+	if matchToolName(name, p.deny) {
+		return false
+	}
+	return len(p.allow) == 0 || matchToolName(name, p.allow)
+}
+
+func matchToolName(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == name {
+			return true
+		}
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns why a call of the named tool with args is not allowed, or
+// nil if it is.
+func (p *ToolPolicy) Check(name string, args map[string]any) error {
+	if p == nil {
+		return nil
+	}
+	if !p.Allows(name) {
+		return fmt.Errorf("tool %q is not available to this agent", name)
+	}
+
+	constraints := p.args[name]
+	argNames := make([]string, 0, len(constraints))
+	for arg := range constraints {
+		argNames = append(argNames, arg)
+	}
+	sort.Strings(argNames)
+	for _, arg := range argNames {
+		value, ok := args[arg]
+		if !ok || value == nil {
+			continue
+		}
+		if reason := p.checkArg(constraints[arg], value); reason != "" {
+			return fmt.Errorf("argument %q of %s %s", arg, name, reason)
+		}
+	}
+	return nil
+}
+
+// checkArg returns why value breaks c, or "" if it does not.
+func (p *ToolPolicy) checkArg(c argConstraint, value any) string {
+	if len(c.Enum) > 0 {
+		allowed := false
+		for _, v := range c.Enum {
+			if fmt.Sprint(v) == fmt.Sprint(value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("must be one of %s", formatEnum(c.Enum))
+		}
+	}
+
+	if c.invalid {
+		return "is restricted by an invalid pattern"
+	}
+	if c.pattern != nil && !c.pattern.MatchString(fmt.Sprint(value)) {
+		return fmt.Sprintf("must match %s", c.Pattern)
+	}
+
+	if c.Minimum != nil || c.Maximum != nil {
+		n, ok := value.(float64)
+		if !ok {
+			if i, isInt := value.(int); isInt {
+				n, ok = float64(i), true
+			}
+		}
+		switch {
+		case !ok:
+			return "must be a number"
+		case c.Minimum != nil && n < *c.Minimum:
+			return fmt.Sprintf("must be at least %v", *c.Minimum)
+		case c.Maximum != nil && n > *c.Maximum:
+			return fmt.Sprintf("must be at most %v", *c.Maximum)
+		}
+	}
+
+	if len(c.Within) > 0 {
+		s, ok := value.(string)
+		if !ok || !pathWithin(p.workspace, s, c.Within) {
+			return fmt.Sprintf("must be a path inside %s", strings.Join(c.Within, ", "))
+		}
+	}
+	return ""
+}
+
+func formatEnum(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
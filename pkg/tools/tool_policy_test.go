@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestToolPolicy_Allows(t *testing.T) {
+	p := NewToolPolicy(&config.ToolPolicyConfig{
+		Allow: []string{"read_file", "web_*", "mcp_github_*"},
+		Deny:  []string{"web_fetch", "mcp_github_delete_*"},
+	}, "")
+
+	for name, want := range map[string]bool{
+		"read_file":              true,
+		"web_search":             true,
+		"web_fetch":              false,
+		"mcp_github_list_issues": true,
+		"mcp_github_delete_repo": false,
+		"exec":                   false,
+	} {
+		if got := p.Allows(name); got != want {
+			t.Errorf("Allows(%s) = %v, want %v", name, got, want)
+		}
+	}
+
+	if NewToolPolicy(nil, "") != nil || !(*ToolPolicy)(nil).Allows("exec") {
+		t.Error("without a config every tool should be allowed")
+	}
+}
+
+func TestToolPolicy_ArgConstraints(t *testing.T) {
+	workspace := t.TempDir()
+	maxLen := 64.0
+	p := NewToolPolicy(&config.ToolPolicyConfig{Args: map[string]map[string]config.ArgConstraint{
+		"i2c":        {"bus": {Enum: []any{"1", 3}}, "length": {Maximum: &maxLen}},
+		"write_file": {"path": {Within: []string{"notes"}}},
+		"exec":       {"command": {Pattern: `^(ls|cat) `}},
+		"spi":        {"device": {Pattern: "("}},
+	}}, workspace)
+
+	tests := []struct {
+		tool string
+		args map[string]any
+		want string // substring of the error, or "" for allowed
+	}{
+		{"i2c", map[string]any{"action": "scan", "bus": "1"}, ""},
+		{"i2c", map[string]any{"action": "scan", "bus": "3"}, ""},
+		{"i2c", map[string]any{"action": "scan", "bus": "0"}, "must be one of [1, 3]"},
+		{"i2c", map[string]any{"action": "detect"}, ""},
+		{"i2c", map[string]any{"action": "read", "bus": "1", "length": 65.0}, "at most 64"},
+		{"i2c", map[string]any{"action": "read", "bus": "1", "length": "x"}, "must be a number"},
+		{"write_file", map[string]any{"path": "notes/a.md"}, ""},
+		{"write_file", map[string]any{"path": filepath.Join(workspace, "notes", "b.md")}, ""},
+		{"write_file", map[string]any{"path": "notes/../config.json"}, "inside notes"},
+		{"write_file", map[string]any{"path": "/etc/passwd"}, "inside notes"},
+		{"exec", map[string]any{"command": "ls -la"}, ""},
+		{"exec", map[string]any{"command": "rm -rf notes"}, "must match"},
+		{"spi", map[string]any{"device": "0.0"}, "invalid pattern"},
+		{"read_file", map[string]any{"path": "/etc/passwd"}, ""},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.tool, tt.args)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("Check(%s, %v) = %v, want allowed", tt.tool, tt.args, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("Check(%s, %v) = %v, want error containing %q", tt.tool, tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestToolRegistry_ToolPolicy(t *testing.T) {
+	tool := &mockRegistryTool{name: "exec", result: SilentResult("ran")}
+	r := NewToolRegistry()
+	r.Register(tool)
+	r.Register(&mockRegistryTool{name: "read_file", result: SilentResult("read")})
+
+	version := r.Version()
+	r.SetToolPolicy(NewToolPolicy(&config.ToolPolicyConfig{Deny: []string{"exec"}}, ""))
+	if r.Version() == version {
+		t.Error("setting a policy should change the version so prompts are rebuilt")
+	}
+
+	defs := r.ToProviderDefs()
+	if len(defs) != 1 || defs[0].Function.Name != "read_file" {
+		t.Errorf("ToProviderDefs() = %+v, want only read_file", defs)
+	}
+	if summaries := r.GetSummaries(); len(summaries) != 1 {
+		t.Errorf("GetSummaries() = %v, want only read_file", summaries)
+	}
+
+	result := r.ExecuteWithContext(context.Background(), "exec", map[string]any{"command": "ls"}, "", "", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "not available") {
+		t.Errorf("denied call = %+v, want it refused", result)
+	}
+	if result := r.Execute(context.Background(), "read_file", nil); result.IsError {
+		t.Errorf("allowed call failed: %s", result.ForLLM)
+	}
+}
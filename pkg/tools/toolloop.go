@@ -18,11 +18,12 @@ import (
 
 // ToolLoopConfig configures the tool execution loop.
 type ToolLoopConfig struct {
-	Provider      providers.LLMProvider
-	Model         string
-	Tools         *ToolRegistry
-	MaxIterations int
-	LLMOptions    map[string]any
+	Provider       providers.LLMProvider
+	Model          string
+	Tools          *ToolRegistry
+	MaxIterations  int
+	LLMOptions     map[string]any
+	ResponseFormat *providers.ResponseFormat // Structured final answer, validated with one retry
 }
 
 // ToolLoopResult contains the result of running the tool loop.
@@ -42,6 +43,11 @@ func RunToolLoop(
 	iteration := 0
 	var finalContent string
 
+	if config.ResponseFormat != nil && len(messages) > 0 && messages[0].Role == "system" {
+		messages = append([]providers.Message(nil), messages...)
+		messages[0].Content += "\n\n" + providers.StructuredOutputInstruction(config.ResponseFormat)
+	}
+
 	for iteration < config.MaxIterations {
 		iteration++
 
@@ -58,12 +64,21 @@ func RunToolLoop(
 		}
 
 		// 2. Set default LLM options
-		llmOpts := config.LLMOptions
-		if llmOpts == nil {
-			llmOpts = map[string]any{}
+		llmOpts := map[string]any{}
+		for k, v := range config.LLMOptions {
+			llmOpts[k] = v
+		}
+		if config.ResponseFormat != nil {
+			llmOpts[providers.ResponseFormatOption] = config.ResponseFormat
+		}
+		// 3. Call LLM, validating a structured final answer
+		callLLM := func(messages []providers.Message) (*providers.LLMResponse, error) {
+			return config.Provider.Chat(ctx, messages, providerToolDefs, config.Model, llmOpts)
+		}
+		response, err := callLLM(messages)
+		if err == nil && config.ResponseFormat != nil {
+			response, err = providers.EnforceResponseFormat(config.ResponseFormat, messages, response, callLLM)
 		}
-		// 3. Call LLM
-		response, err := config.Provider.Chat(ctx, messages, providerToolDefs, config.Model, llmOpts)
 		if err != nil {
 			logger.ErrorCF("toolloop", "LLM call failed",
 				map[string]any{
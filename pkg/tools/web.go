@@ -11,6 +11,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/egress"
 )
 
 const (
@@ -441,6 +443,7 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]any) *ToolR
 
 type WebFetchTool struct {
 	maxChars int
+	egress   *egress.Policy
 }
 
 func NewWebFetchTool(maxChars int) *WebFetchTool {
@@ -452,6 +455,12 @@ func NewWebFetchTool(maxChars int) *WebFetchTool {
 	}
 }
 
+// SetEgressPolicy sets which hosts the tool may fetch from. Without one,
+// non-public addresses are blocked.
+func (t *WebFetchTool) SetEgressPolicy(policy *egress.Policy) {
+	t.egress = policy
+}
+
 func (t *WebFetchTool) Name() string {
 	return "web_fetch"
 }
@@ -497,6 +506,10 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 		return ErrorResult("missing domain in URL")
 	}
 
+	if err := t.egress.CheckURL(parsedURL); err != nil {
+		return ErrorResult(err.Error())
+	}
+
 	maxChars := t.maxChars
 	if mc, ok := args["maxChars"].(float64); ok {
 		if int(mc) > 100 {
@@ -511,21 +524,8 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 
 	req.Header.Set("User-Agent", userAgent)
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     30 * time.Second,
-			DisableCompression:  false,
-			TLSHandshakeTimeout: 15 * time.Second,
-		},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 5 {
-				return fmt.Errorf("stopped after 5 redirects")
-			}
-			return nil
-		},
-	}
+	// Connections and redirects are checked against the egress policy
+	client := t.egress.NewClient(60*time.Second, 5)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -7,8 +7,18 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/egress"
 )
 
+// allowLoopback lets the tool fetch from httptest servers, which listen on
+// loopback addresses blocked by default.
+func allowLoopback(tool *WebFetchTool) *WebFetchTool {
+	tool.SetEgressPolicy(egress.NewPolicy(config.EgressConfig{AllowCIDRs: []string{"127.0.0.0/8", "::1"}}))
+	return tool
+}
+
 // TestWebTool_WebFetch_Success verifies successful URL fetching
 func TestWebTool_WebFetch_Success(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -18,7 +28,7 @@ func TestWebTool_WebFetch_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := allowLoopback(NewWebFetchTool(50000))
 	ctx := context.Background()
 	args := map[string]any{
 		"url": server.URL,
@@ -54,7 +64,7 @@ func TestWebTool_WebFetch_JSON(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := allowLoopback(NewWebFetchTool(50000))
 	ctx := context.Background()
 	args := map[string]any{
 		"url": server.URL,
@@ -145,7 +155,7 @@ func TestWebTool_WebFetch_Truncation(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(1000) // Limit to 1000 chars
+	tool := allowLoopback(NewWebFetchTool(1000)) // Limit to 1000 chars
 	ctx := context.Background()
 	args := map[string]any{
 		"url": server.URL,
@@ -214,7 +224,7 @@ func TestWebTool_WebFetch_HTMLExtraction(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := allowLoopback(NewWebFetchTool(50000))
 	ctx := context.Background()
 	args := map[string]any{
 		"url": server.URL,
@@ -334,6 +344,34 @@ func TestWebTool_WebFetch_MissingDomain(t *testing.T) {
 	}
 }
 
+// TestWebTool_WebFetch_EgressPolicy verifies non-public addresses and
+// redirects to them are refused
+func TestWebTool_WebFetch_EgressPolicy(t *testing.T) {
+	tool := NewWebFetchTool(50000)
+	for _, u := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1:18790/",
+		"http://[::1]/",
+		"http://[::ffff:10.0.0.1]/",
+		"http://localhost/",
+	} {
+		result := tool.Execute(context.Background(), map[string]any{"url": u})
+		if !result.IsError || !strings.Contains(result.ForLLM, "blocked by egress policy") {
+			t.Errorf("fetching %s = %s, want it blocked", u, result.ForLLM)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://10.0.0.1/admin", http.StatusFound)
+	}))
+	defer server.Close()
+
+	result := allowLoopback(NewWebFetchTool(50000)).Execute(context.Background(), map[string]any{"url": server.URL})
+	if !result.IsError || !strings.Contains(result.ForLLM, "10.0.0.1") {
+		t.Errorf("redirect to a private address = %s, want it blocked", result.ForLLM)
+	}
+}
+
 // TestWebTool_TavilySearch_Success verifies successful Tavily search
 func TestWebTool_TavilySearch_Success(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
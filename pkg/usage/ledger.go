@@ -0,0 +1,261 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// LedgerPath returns where the usage ledger of a workspace is stored.
+func LedgerPath(workspace string) string {
+	return filepath.Join(workspace, "state", "usage.jsonl")
+}
+
+// Ledger appends usage records to a JSON Lines file and keeps each agent's
+// spend for the current day and month in memory for budget checks. Day and
+// month boundaries follow local time.
+type Ledger struct {
+	path   string
+	prices Prices
+	now    func() time.Time
+
+	mu      sync.Mutex
+	day     string
+	month   string
+	daily   map[string]float64 // cost by agent ID
+	monthly map[string]float64
+}
+
+// NewLedger opens the ledger at path, loading this month's records so
+// budgets survive restarts.
+func NewLedger(path string, prices Prices) *Ledger {
+	l := &Ledger{
+		path:   path,
+		prices: prices,
+		now:    time.Now,
+	}
+	now := l.now()
+	l.rollLocked(now)
+
+	records, err := ReadRecords(path, monthStart(now))
+	if err != nil {
+		logger.WarnCF("usage", "Failed to load usage ledger", map[string]any{
+			"path":  path,
+			"error": err.Error(),
+		})
+	}
+	for _, r := range records {
+		l.countLocked(r)
+	}
+	return l
+}
+
+// Add prices r, appends it to the ledger and counts it against its agent's
+// budget. A missing time or kind is filled in.
+func (l *Ledger) Add(r Record) {
+	if l == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = l.now()
+	}
+	if r.Kind == "" {
+		r.Kind = KindChat
+	}
+	r.Cost = l.prices.Cost(r.Model, r.PromptTokens, r.CompletionTokens)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := appendRecord(l.path, r); err != nil {
+		logger.WarnCF("usage", "Failed to write usage record", map[string]any{
+			"path":  l.path,
+			"error": err.Error(),
+		})
+	}
+	l.rollLocked(r.Time)
+	l.countLocked(r)
+}
+
+// Spent returns what an agent has spent today and this month, in USD.
+func (l *Ledger) Spent(agentID string) (day, month float64) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollLocked(l.now())
+	return l.daily[agentID], l.monthly[agentID]
+}
+
+// Exceeded reports which limit of budget an agent has reached, if any.
+func (l *Ledger) Exceeded(agentID string, budget config.BudgetConfig) (string, bool) {
+	day, month := l.Spent(agentID)
+	switch {
+	case budget.Daily > 0 && day >= budget.Daily:
+		return fmt.Sprintf("daily budget of $%.2f", budget.Daily), true
+	case budget.Monthly > 0 && month >= budget.Monthly:
+		return fmt.Sprintf("monthly budget of $%.2f", budget.Monthly), true
+	}
+	return "", false
+}
+
+// rollLocked resets the totals when now falls in a new day or month.
+func (l *Ledger) rollLocked(now time.Time) {
+	now = now.Local()
+	if day := now.Format("2006-01-02"); day != l.day {
+		l.day = day
+		l.daily = make(map[string]float64)
+	}
+	if month := now.Format("2006-01"); month != l.month {
+		l.month = month
+		l.monthly = make(map[string]float64)
+	}
+}
+
+func (l *Ledger) countLocked(r Record) {
+	t := r.Time.Local()
+	if t.Format("2006-01") != l.month {
+		return
+	}
+	l.monthly[r.AgentID] += r.Cost
+	if t.Format("2006-01-02") == l.day {
+		l.daily[r.AgentID] += r.Cost
+	}
+}
+
+func appendRecord(path string, r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// One write per record keeps lines whole for concurrent readers.
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadRecords reads the ledger at path, returning the records made at or
+// after since. A missing ledger has no records; malformed lines are skipped.
+func ReadRecords(path string, since time.Time) ([]Record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Time.Before(since) {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// Period returns the start of a named reporting period: "today", "month" or
+// "all" (the zero time).
+func Period(name string, now time.Time) (time.Time, error) {
+	now = now.Local()
+	switch name {
+	case "today", "day":
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
+	case "month", "":
+		return monthStart(now), nil
+	case "all":
+		return time.Time{}, nil
+	}
+	return time.Time{}, fmt.Errorf("unknown period %q (want today, month or all)", name)
+}
+
+func monthStart(now time.Time) time.Time {
+	now = now.Local()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// Total sums the records sharing a key.
+type Total struct {
+	Key              string  `json:"key"`
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Summarize totals records grouped by agent, session, channel, model, kind
+// or day. Days are listed in order; other groups by cost, highest first.
+func Summarize(records []Record, by string) ([]Total, error) {
+	var key func(Record) string
+	switch by {
+	case "agent":
+		key = func(r Record) string { return r.AgentID }
+	case "session":
+		key = func(r Record) string { return r.SessionKey }
+	case "channel":
+		key = func(r Record) string { return r.Channel }
+	case "model":
+		key = func(r Record) string { return r.Model }
+	case "kind":
+		key = func(r Record) string { return r.Kind }
+	case "day":
+		key = func(r Record) string { return r.Time.Local().Format("2006-01-02") }
+	default:
+		return nil, fmt.Errorf("unknown grouping %q (want agent, session, channel, model, kind or day)", by)
+	}
+
+	index := make(map[string]int)
+	var totals []Total
+	for _, r := range records {
+		k := key(r)
+		if k == "" {
+			k = "-"
+		}
+		i, ok := index[k]
+		if !ok {
+			i = len(totals)
+			index[k] = i
+			totals = append(totals, Total{Key: k})
+		}
+		totals[i].Requests++
+		totals[i].PromptTokens += r.PromptTokens
+		totals[i].CompletionTokens += r.CompletionTokens
+		totals[i].CachedTokens += r.CachedTokens
+		totals[i].Cost += r.Cost
+	}
+
+	sort.SliceStable(totals, func(i, j int) bool {
+		if by == "day" || totals[i].Cost == totals[j].Cost {
+			return totals[i].Key < totals[j].Key
+		}
+		return totals[i].Cost > totals[j].Cost
+	})
+	return totals, nil
+}
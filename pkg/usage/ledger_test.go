@@ -0,0 +1,135 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestPricesFromConfig(t *testing.T) {
+	prices := PricesFromConfig([]config.ModelConfig{
+		{ModelName: "smart", Model: "anthropic/claude-sonnet-4.6", InputPrice: 3, OutputPrice: 15},
+		{ModelName: "free", Model: "ollama/llama3"},
+	})
+
+	if got := prices.Cost("claude-sonnet-4.6", 1_000_000, 100_000); got != 4.5 {
+		t.Errorf("Cost(model ID) = %v, want 4.5", got)
+	}
+	if got := prices.Cost("anthropic/claude-sonnet-4.6", 1_000_000, 0); got != 3 {
+		t.Errorf("Cost(model ref) = %v, want 3", got)
+	}
+	if got := prices.Cost("llama3", 1_000_000, 1_000_000); got != 0 {
+		t.Errorf("Cost(unpriced) = %v, want 0", got)
+	}
+}
+
+func TestLedger_TracksSpendAndSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "usage.jsonl")
+	prices := Prices{"gpt-4o": {Input: 10, Output: 30}}
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+
+	l := NewLedger(path, prices)
+	l.now = func() time.Time { return now }
+	l.Add(Record{Time: now.AddDate(0, 0, -1), AgentID: "main", Model: "gpt-4o", PromptTokens: 1000})
+	l.Add(Record{Time: now, AgentID: "main", Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 1000})
+	l.Add(Record{Time: now, AgentID: "other", Model: "gpt-4o", PromptTokens: 1000})
+
+	day, month := l.Spent("main")
+	if day < 0.0399 || day > 0.0401 || month < 0.0499 || month > 0.0501 {
+		t.Errorf("Spent(main) = %v, %v, want 0.04 today and 0.05 this month", day, month)
+	}
+	if limit, exceeded := l.Exceeded("main", config.BudgetConfig{Daily: 1, Monthly: 0.05}); !exceeded || limit != "monthly budget of $0.05" {
+		t.Errorf("Exceeded() = %q, %v, want the monthly budget", limit, exceeded)
+	}
+	if _, exceeded := l.Exceeded("other", config.BudgetConfig{Daily: 0.05}); exceeded {
+		t.Error("other agent should be within its budget")
+	}
+
+	records, err := ReadRecords(path, time.Time{})
+	if err != nil {
+		t.Fatalf("ReadRecords() error: %v", err)
+	}
+	if len(records) != 3 || records[1].Kind != KindChat {
+		t.Fatalf("records = %+v, want 3 with the kind filled in", records)
+	}
+
+	totals, err := Summarize(records, "agent")
+	if err != nil {
+		t.Fatalf("Summarize() error: %v", err)
+	}
+	if len(totals) != 2 || totals[0].Key != "main" || totals[0].Requests != 2 || totals[0].PromptTokens != 2000 {
+		t.Errorf("totals = %+v, want main first with two calls", totals)
+	}
+	if _, err := Summarize(records, "planet"); err == nil {
+		t.Error("Summarize() with an unknown grouping should fail")
+	}
+}
+
+type fakeProvider struct{}
+
+func (fakeProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{
+		Content: "ok",
+		Usage:   &providers.UsageInfo{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10, CachedTokens: 4},
+	}, nil
+}
+
+func (fakeProvider) GetDefaultModel() string { return "fake" }
+
+func TestTrack_RecordsTaggedUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	ledger := NewLedger(path, nil)
+	p := Track(fakeProvider{}, ledger)
+	if Track(p, ledger) != p {
+		t.Error("tracking a tracked provider again should return it unchanged")
+	}
+	if _, ok := p.(providers.StreamingProvider); ok {
+		t.Error("wrapper of a non-streaming provider should not stream")
+	}
+
+	ctx := WithTags(context.Background(), Tags{AgentID: "main", SessionKey: "s1", Channel: "telegram"})
+	ctx = WithKind(ctx, KindSubagent)
+	meter := &Meter{}
+	ctx = WithMeter(ctx, meter)
+	for i := 0; i < 2; i++ {
+		if _, err := p.Chat(ctx, nil, nil, "fake-model", nil); err != nil {
+			t.Fatalf("Chat() error: %v", err)
+		}
+	}
+	if prompt, completion := meter.Tokens(); prompt != 14 || completion != 6 {
+		t.Errorf("meter = %d prompt, %d completion tokens, want 14 and 6", prompt, completion)
+	}
+
+	records, err := ReadRecords(path, time.Time{})
+	if err != nil {
+		t.Fatalf("ReadRecords() error: %v", err)
+	}
+	want := Record{
+		AgentID:          "main",
+		SessionKey:       "s1",
+		Channel:          "telegram",
+		Kind:             KindSubagent,
+		Model:            "fake-model",
+		PromptTokens:     7,
+		CompletionTokens: 3,
+		CachedTokens:     4,
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	got := records[0]
+	got.Time = time.Time{}
+	if got != want {
+		t.Errorf("record = %+v, want %+v", got, want)
+	}
+}
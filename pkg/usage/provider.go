@@ -0,0 +1,89 @@
+package usage
+
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// trackedProvider records the usage of every response in a ledger.
+type trackedProvider struct {
+	providers.LLMProvider
+	ledger *Ledger
+}
+
+// trackedStreamingProvider also records streamed responses.
+type trackedStreamingProvider struct {
+	trackedProvider
+	streaming providers.StreamingProvider
+}
+
+// Track wraps provider so the usage of each response is added to ledger,
+// tagged from the request context. The result implements StreamingProvider
+// if provider does. A provider already tracked by ledger is returned as is.
+func Track(provider providers.LLMProvider, ledger *Ledger) providers.LLMProvider {
+	if provider == nil || ledger == nil {
+		return provider
+	}
+	switch p := provider.(type) {
+	case *trackedProvider:
+		if p.ledger == ledger {
+			return p
+		}
+	case *trackedStreamingProvider:
+		if p.ledger == ledger {
+			return p
+		}
+	}
+
+	tracked := trackedProvider{LLMProvider: provider, ledger: ledger}
+	if sp, ok := provider.(providers.StreamingProvider); ok {
+		return &trackedStreamingProvider{trackedProvider: tracked, streaming: sp}
+	}
+	return &tracked
+}
+
+func (p *trackedProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	resp, err := p.LLMProvider.Chat(ctx, messages, tools, model, options)
+	p.record(ctx, model, resp)
+	return resp, err
+}
+
+func (p *trackedStreamingProvider) ChatStream(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(providers.StreamDelta),
+) (*providers.LLMResponse, error) {
+	resp, err := p.streaming.ChatStream(ctx, messages, tools, model, options, onDelta)
+	p.record(ctx, model, resp)
+	return resp, err
+}
+
+func (p *trackedProvider) record(ctx context.Context, model string, resp *providers.LLMResponse) {
+	if resp == nil || resp.Usage == nil {
+		return
+	}
+	if m, ok := ctx.Value(meterKey{}).(*Meter); ok {
+		m.add(resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	}
+	tags := TagsFrom(ctx)
+	p.ledger.Add(Record{
+		AgentID:          tags.AgentID,
+		SessionKey:       tags.SessionKey,
+		Channel:          tags.Channel,
+		Kind:             tags.Kind,
+		Model:            model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		CachedTokens:     resp.Usage.CachedTokens,
+	})
+}
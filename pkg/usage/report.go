@@ -0,0 +1,114 @@
+package usage
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/routing"
+)
+
+// Report totals the ledger over a period.
+type Report struct {
+	Since   time.Time      `json:"since"`
+	By      string         `json:"by"`
+	Total   Total          `json:"total"`
+	Totals  []Total        `json:"totals"`
+	Budgets []BudgetStatus `json:"budgets,omitempty"`
+}
+
+// BudgetStatus compares an agent's budget with what it has spent.
+type BudgetStatus struct {
+	AgentID        string  `json:"agent_id"`
+	Daily          float64 `json:"daily,omitempty"`
+	Monthly        float64 `json:"monthly,omitempty"`
+	DowngradeModel string  `json:"downgrade_model,omitempty"`
+	SpentToday     float64 `json:"spent_today"`
+	SpentMonth     float64 `json:"spent_month"`
+	Exceeded       bool    `json:"exceeded"`
+}
+
+// BuildReport reads the ledger of cfg's workspace and totals the records
+// since the start of period, grouped by by. Agents with a budget are listed
+// with their spend for the current day and month.
+func BuildReport(cfg *config.Config, period, by string, now time.Time) (*Report, error) {
+	since, err := Period(period, now)
+	if err != nil {
+		return nil, err
+	}
+	if by == "" {
+		by = "agent"
+	}
+
+	month := monthStart(now)
+	readFrom := since
+	if month.Before(readFrom) {
+		readFrom = month
+	}
+	records, err := ReadRecords(LedgerPath(cfg.WorkspacePath()), readFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	var inPeriod []Record
+	for _, r := range records {
+		if !r.Time.Before(since) {
+			inPeriod = append(inPeriod, r)
+		}
+	}
+	totals, err := Summarize(inPeriod, by)
+	if err != nil {
+		return nil, err
+	}
+	if totals == nil {
+		totals = []Total{}
+	}
+
+	report := &Report{Since: since, By: by, Totals: totals, Total: Total{Key: "total"}}
+	for _, t := range totals {
+		report.Total.Requests += t.Requests
+		report.Total.PromptTokens += t.PromptTokens
+		report.Total.CompletionTokens += t.CompletionTokens
+		report.Total.CachedTokens += t.CachedTokens
+		report.Total.Cost += t.Cost
+	}
+	report.Budgets = budgetStatus(cfg, records, now)
+	return report, nil
+}
+
+// budgetStatus lists the agents that have a budget, given this month's
+// records.
+func budgetStatus(cfg *config.Config, records []Record, now time.Time) []BudgetStatus {
+	agents := cfg.Agents.List
+	if len(agents) == 0 {
+		agents = []config.AgentConfig{{ID: routing.DefaultAgentID, Default: true}}
+	}
+
+	l := &Ledger{now: func() time.Time { return now }}
+	l.rollLocked(now)
+	for _, r := range records {
+		l.countLocked(r)
+	}
+
+	var statuses []BudgetStatus
+	for _, ac := range agents {
+		budget := cfg.Agents.Defaults.Budget
+		if ac.Budget != nil {
+			budget = *ac.Budget
+		}
+		if budget.Daily <= 0 && budget.Monthly <= 0 {
+			continue
+		}
+		id := routing.NormalizeAgentID(ac.ID)
+		_, exceeded := l.Exceeded(id, budget)
+		statuses = append(statuses, BudgetStatus{
+			AgentID:        id,
+			Daily:          budget.Daily,
+			Monthly:        budget.Monthly,
+			DowngradeModel: budget.DowngradeModel,
+			SpentToday:     l.daily[id],
+			SpentMonth:     l.monthly[id],
+			Exceeded:       exceeded,
+		})
+	}
+	return statuses
+}
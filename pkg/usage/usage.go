@@ -0,0 +1,152 @@
+// Package usage records the tokens and cost of every LLM call in a ledger
+// and enforces per-agent spending budgets.
+package usage
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Kinds of LLM call recorded in the ledger.
+const (
+	KindChat      = "chat"
+	KindSubagent  = "subagent"
+	KindSummary   = "summary"
+	KindHeartbeat = "heartbeat"
+	KindRouter    = "router"
+)
+
+// Tags attribute an LLM call to the agent, session and channel it was made
+// for.
+type Tags struct {
+	AgentID    string
+	SessionKey string
+	Channel    string
+	Kind       string
+}
+
+type tagsKey struct{}
+
+// WithTags returns a context whose LLM calls are recorded with tags. Empty
+// fields keep the values already set on ctx, so a subagent started from a
+// turn inherits the turn's agent, session and channel.
+func WithTags(ctx context.Context, tags Tags) context.Context {
+	prev := TagsFrom(ctx)
+	if tags.AgentID == "" {
+		tags.AgentID = prev.AgentID
+	}
+	if tags.SessionKey == "" {
+		tags.SessionKey = prev.SessionKey
+	}
+	if tags.Channel == "" {
+		tags.Channel = prev.Channel
+	}
+	if tags.Kind == "" {
+		tags.Kind = prev.Kind
+	}
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// WithKind is shorthand for WithTags with only the kind set.
+func WithKind(ctx context.Context, kind string) context.Context {
+	return WithTags(ctx, Tags{Kind: kind})
+}
+
+// TagsFrom returns the tags set on ctx.
+func TagsFrom(ctx context.Context) Tags {
+	if tags, ok := ctx.Value(tagsKey{}).(Tags); ok {
+		return tags
+	}
+	return Tags{}
+}
+
+// Meter totals the tokens of the LLM calls made with a context, so a caller
+// can report what one request used.
+type Meter struct {
+	mu               sync.Mutex
+	promptTokens     int
+	completionTokens int
+}
+
+type meterKey struct{}
+
+// WithMeter returns a context whose tracked LLM calls are also counted by m.
+func WithMeter(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+func (m *Meter) add(promptTokens, completionTokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.promptTokens += promptTokens
+	m.completionTokens += completionTokens
+}
+
+// Tokens returns the prompt and completion tokens counted so far.
+func (m *Meter) Tokens() (prompt, completion int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.promptTokens, m.completionTokens
+}
+
+// Record is one LLM call in the ledger.
+type Record struct {
+	Time             time.Time `json:"time"`
+	AgentID          string    `json:"agent_id,omitempty"`
+	SessionKey       string    `json:"session_key,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	Kind             string    `json:"kind"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CachedTokens     int       `json:"cached_tokens,omitempty"` // part of PromptTokens read from the prompt cache
+	Cost             float64   `json:"cost,omitempty"`          // USD
+}
+
+// Price is what a model costs in USD per million tokens.
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// Prices maps model identifiers to their prices.
+type Prices map[string]Price
+
+// PricesFromConfig collects the prices set on model_list entries. Each entry
+// is keyed by its full model reference ("openai/gpt-4o") and by the bare
+// model ID providers are called with ("gpt-4o").
+func PricesFromConfig(models []config.ModelConfig) Prices {
+	prices := make(Prices)
+	for _, m := range models {
+		if m.InputPrice == 0 && m.OutputPrice == 0 {
+			continue
+		}
+		price := Price{Input: m.InputPrice, Output: m.OutputPrice}
+		protocol, modelID := providers.ExtractProtocol(m.Model)
+		for _, key := range []string{m.Model, providers.ModelKey(protocol, modelID), modelID} {
+			if _, ok := prices[key]; !ok {
+				prices[key] = price
+			}
+		}
+	}
+	return prices
+}
+
+// Cost prices a call to model. Models without a price cost nothing.
+func (p Prices) Cost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := p[model]
+	if !ok {
+		if _, modelID, found := strings.Cut(model, "/"); found {
+			price, ok = p[modelID]
+		}
+	}
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
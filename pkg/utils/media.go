@@ -52,6 +52,22 @@ type DownloadOptions struct {
 	Timeout      time.Duration
 	ExtraHeaders map[string]string
 	LoggerPrefix string
+	Client       *http.Client // used instead of a plain client with Timeout
+}
+
+// SaveMediaFile writes data to the local media temp directory, where
+// DownloadFile also stores files. Returns the local file path.
+func SaveMediaFile(filename string, data []byte) (string, error) {
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return "", err
+	}
+
+	localPath := filepath.Join(mediaDir, uuid.New().String()[:8]+"_"+SanitizeFilename(filename))
+	if err := os.WriteFile(localPath, data, 0o600); err != nil {
+		return "", err
+	}
+	return localPath, nil
 }
 
 // DownloadFile downloads a file from URL to a local temp directory.
@@ -91,7 +107,10 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		req.Header.Set(key, value)
 	}
 
-	client := &http.Client{Timeout: opts.Timeout}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: opts.Timeout}
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to download file", map[string]any{
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	_ "modernc.org/sqlite"
 )
@@ -35,6 +36,11 @@ func InitDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping sqlite database: %w", err)
 	}
 
+	// Several components open the same file; wait for locks instead of failing.
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		return nil, fmt.Errorf("failed to configure sqlite database: %w", err)
+	}
+
 	d := &DB{db}
 	if err := d.migrate(); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
@@ -65,6 +71,25 @@ func (db *DB) migrate() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY(session_key) REFERENCES sessions(key)
 		);`,
+		`CREATE TABLE IF NOT EXISTS bus_inbound (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_bus_inbound_status ON bus_inbound(status, id);`,
+		`CREATE TABLE IF NOT EXISTS bus_outbound (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
 	}
 
 	for _, q := range queries {
@@ -73,5 +98,75 @@ func (db *DB) migrate() error {
 		}
 	}
 
+	return db.migrateBusOutbound()
+}
+
+// migrateBusOutbound brings bus_outbound up to date. Tables created before
+// retries were scheduled lack next_attempt_at and last_error, and their
+// status index covers (status, id); CREATE INDEX IF NOT EXISTS would keep
+// that index, so it is rebuilt whenever its columns differ.
+func (db *DB) migrateBusOutbound() error {
+	columns, err := db.columnNames("PRAGMA table_info(bus_outbound)")
+	if err != nil {
+		return fmt.Errorf("failed to inspect bus_outbound: %w", err)
+	}
+	for _, col := range []struct{ name, def string }{
+		{"next_attempt_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"last_error", "TEXT"},
+	} {
+		if !slices.Contains(columns, col.name) {
+			if _, err := db.Exec(`ALTER TABLE bus_outbound ADD COLUMN ` + col.name + ` ` + col.def); err != nil {
+				return fmt.Errorf("failed to add bus_outbound.%s: %w", col.name, err)
+			}
+		}
+	}
+
+	indexed, err := db.columnNames("PRAGMA index_info(idx_bus_outbound_status)")
+	if err != nil {
+		return fmt.Errorf("failed to inspect idx_bus_outbound_status: %w", err)
+	}
+	if slices.Equal(indexed, []string{"status", "next_attempt_at"}) {
+		return nil
+	}
+	for _, q := range []string{
+		`DROP INDEX IF EXISTS idx_bus_outbound_status;`,
+		`CREATE INDEX idx_bus_outbound_status ON bus_outbound(status, next_attempt_at);`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			return fmt.Errorf("failed to rebuild idx_bus_outbound_status: %w", err)
+		}
+	}
 	return nil
 }
+
+// columnNames returns the name column of a table_info or index_info pragma,
+// in order.
+func (db *DB) columnNames(pragma string) ([]string, error) {
+	rows, err := db.Query(pragma)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		values := make([]any, len(cols))
+		for i := range values {
+			values[i] = new(any)
+		}
+		if err := rows.Scan(values...); err != nil {
+			return nil, err
+		}
+		for i, col := range cols {
+			if col == "name" {
+				name, _ := (*values[i].(*any)).(string)
+				names = append(names, name)
+			}
+		}
+	}
+	return names, rows.Err()
+}
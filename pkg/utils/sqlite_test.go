@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestInitDB_MigratesOldBusOutbound(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "picoclaw.db")
+
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, q := range []string{
+		`CREATE TABLE bus_outbound (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX idx_bus_outbound_status ON bus_outbound(status, id);`,
+		`INSERT INTO bus_outbound (payload) VALUES ('{"content":"kept"}');`,
+	} {
+		if _, err := old.Exec(q); err != nil {
+			t.Fatalf("old schema: %v", err)
+		}
+	}
+	old.Close()
+
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	columns, err := db.columnNames("PRAGMA table_info(bus_outbound)")
+	if err != nil {
+		t.Fatalf("table_info: %v", err)
+	}
+	for _, want := range []string{"next_attempt_at", "last_error"} {
+		if !slices.Contains(columns, want) {
+			t.Errorf("bus_outbound columns = %v, missing %s", columns, want)
+		}
+	}
+
+	indexed, err := db.columnNames("PRAGMA index_info(idx_bus_outbound_status)")
+	if err != nil {
+		t.Fatalf("index_info: %v", err)
+	}
+	if !slices.Equal(indexed, []string{"status", "next_attempt_at"}) {
+		t.Errorf("idx_bus_outbound_status columns = %v, want [status next_attempt_at]", indexed)
+	}
+
+	var payload string
+	var next int64
+	if err := db.QueryRow(`SELECT payload, next_attempt_at FROM bus_outbound`).Scan(&payload, &next); err != nil {
+		t.Fatalf("read row: %v", err)
+	}
+	if payload != `{"content":"kept"}` || next != 0 {
+		t.Errorf("row = (%q, %d), want the old payload due immediately", payload, next)
+	}
+
+	// A second open finds nothing left to migrate.
+	db.Close()
+	again, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	again.Close()
+}